@@ -1,5 +1,7 @@
 package adapter
 
+import "context"
+
 // Adapter defines the interface for printer communication adapters
 type Adapter interface {
 	// Open opens the connection to the printer
@@ -17,3 +19,41 @@ type Adapter interface {
 	// IsOpen returns whether the connection is open
 	IsOpen() bool
 }
+
+// Flusher is implemented by adapters that buffer writes. Flush blocks until
+// everything written so far has been sent to the printer.
+type Flusher interface {
+	Flush() error
+}
+
+// ContextWriter is implemented by adapters whose writes can be cancelled
+// through a context
+type ContextWriter interface {
+	WriteContext(ctx context.Context, data []byte) (int, error)
+}
+
+// WriteContext writes data to a. Adapters implementing ContextWriter abort
+// the write when ctx is done; for others ctx is only checked before the
+// write starts.
+func WriteContext(ctx context.Context, a Adapter, data []byte) (int, error) {
+	if cw, ok := a.(ContextWriter); ok {
+		return cw.WriteContext(ctx, data)
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return a.Write(data)
+}
+
+// OpenIfNeeded opens a unless it is already open, so callers racing to open
+// a shared adapter all succeed. Adapters with an OpenIfNeeded method check
+// and open atomically; for others the check and the open are separate steps.
+func OpenIfNeeded(a Adapter) error {
+	if o, ok := a.(interface{ OpenIfNeeded() error }); ok {
+		return o.OpenIfNeeded()
+	}
+	if a.IsOpen() {
+		return nil
+	}
+	return a.Open()
+}
@@ -0,0 +1,126 @@
+package adapter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nixxel-company-limited/escpos-usb-server/escpos"
+)
+
+// adaptiveChunkSize is the size of the pieces adaptive flow control writes
+// between buffer polls
+const adaptiveChunkSize = 512
+
+// flowControlTimeout bounds how long a flow-controlled write waits for a
+// busy printer, e.g. one that ran out of paper mid-print
+const flowControlTimeout = 30 * time.Second
+
+// ErrPrinterBusy is returned by flow-controlled writes when the printer
+// stays busy for flowControlTimeout
+var ErrPrinterBusy = errors.New("printer busy")
+
+// SetAdaptiveFlowControl makes writes go out in chunks, asking the printer
+// before each one whether it is busy and waiting while it is, so long raster
+// prints are sent at the rate the mechanism consumes them instead of
+// stalling the transfer. The printer counts as busy while its buffer is full
+// if it has a buffer query (see SetBufferQuery), else while its real-time
+// status (DLE EOT 1 and 2) reports it offline or feeding paper. Flow control
+// set with SetFlowControl takes precedence. If the printer stops answering,
+// the rest of the write is sent unpaced; if it stays busy for 30 seconds,
+// the write fails with ErrPrinterBusy.
+func (a *USBAdapter) SetAdaptiveFlowControl(enabled bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.adaptiveFlowControl = enabled
+}
+
+// adaptiveQuery reports whether adaptive flow control is on, with the
+// buffer query to pace writes by, or nil to use the real-time status
+func (a *USBAdapter) adaptiveQuery() ([]byte, bool) {
+	a.mu.Lock()
+	enabled := a.adaptiveFlowControl
+	a.mu.Unlock()
+
+	if !enabled {
+		return nil, false
+	}
+	return a.bufferQueryCommand(), true
+}
+
+// adaptiveRoom returns how much adaptive flow control may send next for
+// writePaced: a chunk of adaptiveChunkSize while the printer is not busy,
+// nothing while it is. Callers must hold a.mu.
+func (a *USBAdapter) adaptiveRoom(query []byte) func() (int, error) {
+	busy := a.printerBusy
+	switch {
+	case busy != nil:
+	case query != nil:
+		busy = func() (bool, error) {
+			free, err := a.bufferFree(query)
+			return free == 0, err
+		}
+	default:
+		busy = a.statusBusy
+	}
+
+	return func() (int, error) {
+		isBusy, err := busy()
+		if err != nil || isBusy {
+			return 0, err
+		}
+		return adaptiveChunkSize, nil
+	}
+}
+
+// statusBusy asks the printer whether it is offline (DLE EOT 1) or feeding
+// paper (DLE EOT 2). Callers must hold a.mu.
+func (a *USBAdapter) statusBusy() (bool, error) {
+	b, err := a.queryStatus(StatusPrinter)
+	if err != nil {
+		return false, err
+	}
+	if escpos.ParsePrinterStatus(b).Offline {
+		return true, nil
+	}
+
+	b, err = a.queryStatus(StatusOffline)
+	if err != nil {
+		return false, err
+	}
+	return escpos.ParseOfflineStatus(b).PaperFeeding, nil
+}
+
+// waitBusy waits flowControlWait for a busy printer with a.mu released, so
+// status queries and Close get through meanwhile; writes stay serialized by
+// the write lease. waited accumulates the write's waits. It fails once they
+// reach flowControlTimeout, when ctx is done, or when the adapter was
+// closed or reopened meanwhile, since the caller's station belongs to the
+// old device and the printer lost the start of the write. Callers must hold
+// a.mu.
+func (a *USBAdapter) waitBusy(ctx context.Context, waited *time.Duration) error {
+	if *waited >= flowControlTimeout {
+		return fmt.Errorf("%w for %s", ErrPrinterBusy, *waited)
+	}
+
+	opens := a.opens
+	a.mu.Unlock()
+	var err error
+	select {
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-a.after(flowControlWait):
+	}
+	a.mu.Lock()
+
+	*waited += flowControlWait
+	switch {
+	case err != nil:
+	case !a.isOpen:
+		err = errors.New("device not open")
+	case a.opens != opens:
+		err = errors.New("printer reconnected during the write")
+	}
+	return err
+}
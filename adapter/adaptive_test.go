@@ -0,0 +1,218 @@
+package adapter
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUSBAdapterAdaptiveFlowControlPacesToStatus(t *testing.T) {
+	dev := newFakePrinter("A")
+	adapter, _ := newFakeUSBAdapter(dev)
+	require.NoError(t, adapter.Open())
+	defer adapter.Close()
+	adapter.SetBufferQuery(testBufferQuery)
+	adapter.SetAdaptiveFlowControl(true)
+
+	out := dev.config.interfaces[0].out[1]
+
+	// The printer alternates between busy and ready; each poll records how
+	// much was written before it
+	var mu sync.Mutex
+	var writtenAtPoll []int
+	adapter.printerBusy = func() (bool, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		writtenAtPoll = append(writtenAtPoll, len(out.data()))
+		return len(writtenAtPoll)%2 == 1, nil
+	}
+
+	after := newFakeAfter()
+	adapter.after = after.After
+	go func() {
+		for range 4 {
+			after.fire <- time.Time{}
+		}
+	}()
+
+	data := bytes.Repeat([]byte{0xAA}, 3*adaptiveChunkSize+100)
+	n, err := adapter.Write(data)
+	require.NoError(t, err)
+	assert.Equal(t, len(data), n)
+	assert.Equal(t, data, out.data())
+
+	// Nothing is written while the printer is busy, one chunk once it is
+	// ready
+	c := adaptiveChunkSize
+	assert.Equal(t, []int{0, 0, c, c, 2 * c, 2 * c, 3 * c, 3 * c}, writtenAtPoll)
+	assert.Equal(t, []time.Duration{flowControlWait, flowControlWait, flowControlWait, flowControlWait}, after.Durations())
+}
+
+func TestUSBAdapterAdaptiveFlowControlPacesToRealtimeStatus(t *testing.T) {
+	dev := newFakePrinter("A")
+	adapter, _ := newFakeUSBAdapter(dev)
+	require.NoError(t, adapter.Open())
+	defer adapter.Close()
+	adapter.SetAdaptiveFlowControl(true)
+
+	// A model without a buffer query: offline, then feeding paper, then
+	// ready for both chunks
+	dev.config.interfaces[0].in[2].responses = [][]byte{
+		[]byte("_TM-T88V\x00"),
+		{0x1A},
+		{0x12}, {0x1A},
+		{0x12}, {0x12},
+		{0x12}, {0x12},
+	}
+
+	after := newFakeAfter()
+	adapter.after = after.After
+	go func() {
+		for range 2 {
+			after.fire <- time.Time{}
+		}
+	}()
+
+	data := bytes.Repeat([]byte{0xAA}, adaptiveChunkSize+10)
+	n, err := adapter.Write(data)
+	require.NoError(t, err)
+	assert.Equal(t, len(data), n)
+
+	printer, offline := []byte{0x10, 0x04, 0x01}, []byte{0x10, 0x04, 0x02}
+	var want []byte
+	want = append(want, "\x1dIC"...)
+	want = append(want, printer...)
+	want = append(want, printer...)
+	want = append(want, offline...)
+	want = append(want, printer...)
+	want = append(want, offline...)
+	want = append(want, data[:adaptiveChunkSize]...)
+	want = append(want, printer...)
+	want = append(want, offline...)
+	want = append(want, data[adaptiveChunkSize:]...)
+	assert.Equal(t, want, dev.config.interfaces[0].out[1].data())
+	assert.Len(t, after.Durations(), 2)
+}
+
+func TestUSBAdapterAdaptiveFlowControlGivesUp(t *testing.T) {
+	dev := newFakePrinter("A")
+	adapter, _ := newFakeUSBAdapter(dev)
+	require.NoError(t, adapter.Open())
+	defer adapter.Close()
+	adapter.SetBufferQuery(testBufferQuery)
+	adapter.SetAdaptiveFlowControl(true)
+	adapter.printerBusy = func() (bool, error) { return true, nil }
+
+	after := newFakeAfter()
+	adapter.after = after.After
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case after.fire <- time.Time{}:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	n, err := adapter.Write([]byte("receipt"))
+	assert.ErrorIs(t, err, ErrPrinterBusy)
+	assert.Zero(t, n)
+	assert.Len(t, after.Durations(), int(flowControlTimeout/flowControlWait))
+	assert.Empty(t, dev.config.interfaces[0].out[1].data())
+}
+
+func TestUSBAdapterAdaptiveFlowControlWaitReleasesAdapter(t *testing.T) {
+	dev := newFakePrinter("A")
+	adapter, _ := newFakeUSBAdapter(dev)
+	require.NoError(t, adapter.Open())
+	adapter.SetBufferQuery(testBufferQuery)
+	adapter.SetAdaptiveFlowControl(true)
+	adapter.printerBusy = func() (bool, error) { return true, nil }
+
+	after := newFakeAfter()
+	adapter.after = after.After
+
+	result := make(chan error, 1)
+	go func() {
+		_, err := adapter.Write([]byte("receipt"))
+		result <- err
+	}()
+	require.Eventually(t, func() bool { return len(after.Durations()) == 1 }, time.Second, time.Millisecond)
+
+	// The waiting write does not hold the adapter
+	closed := make(chan error, 1)
+	go func() { closed <- adapter.Close() }()
+	select {
+	case err := <-closed:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Close blocked behind a waiting write")
+	}
+
+	after.fire <- time.Time{}
+	assert.ErrorContains(t, <-result, "device not open")
+}
+
+func TestUSBAdapterAdaptiveFlowControlStatusUnavailable(t *testing.T) {
+	dev := newFakePrinter("A")
+	adapter, _ := newFakeUSBAdapter(dev)
+	require.NoError(t, adapter.Open())
+	defer adapter.Close()
+	adapter.SetBufferQuery(testBufferQuery)
+	adapter.SetAdaptiveFlowControl(true)
+
+	polls := 0
+	adapter.printerBusy = func() (bool, error) {
+		polls++
+		if polls > 1 {
+			return false, assert.AnError
+		}
+		return false, nil
+	}
+
+	data := bytes.Repeat([]byte{0xAA}, 3*adaptiveChunkSize)
+	n, err := adapter.Write(data)
+	require.NoError(t, err)
+	assert.Equal(t, len(data), n)
+	assert.Equal(t, data, dev.config.interfaces[0].out[1].data())
+	assert.Equal(t, 2, polls, "the rest is written unpaced")
+}
+
+func TestUSBAdapterAdaptiveFlowControlReconnectFailsWrite(t *testing.T) {
+	dev := newFakePrinter("A")
+	adapter, ctx := newFakeUSBAdapter(dev)
+	require.NoError(t, adapter.Open())
+	defer adapter.Close()
+	adapter.SetBufferQuery(testBufferQuery)
+	adapter.SetAdaptiveFlowControl(true)
+	adapter.printerBusy = func() (bool, error) { return true, nil }
+
+	after := newFakeAfter()
+	adapter.after = after.After
+
+	result := make(chan error, 1)
+	go func() {
+		_, err := adapter.Write([]byte("receipt"))
+		result <- err
+	}()
+	require.Eventually(t, func() bool { return len(after.Durations()) == 1 }, time.Second, time.Millisecond)
+
+	// The printer is power-cycled while the write waits
+	second := newFakePrinter("A")
+	ctx.mu.Lock()
+	ctx.devices = []*fakeDevice{second}
+	ctx.mu.Unlock()
+	require.NoError(t, adapter.Reconnect())
+
+	after.fire <- time.Time{}
+	assert.ErrorContains(t, <-result, "printer reconnected")
+	assert.Empty(t, dev.config.interfaces[0].out[1].data())
+	assert.Empty(t, second.config.interfaces[0].out[1].data())
+}
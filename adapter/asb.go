@@ -0,0 +1,65 @@
+package adapter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/nixxel-company-limited/escpos-usb-server/escpos"
+)
+
+// EnableASB turns on automatic status back for the statuses in mask, a
+// combination of the escpos.ASB* masks, and starts the read loop, which
+// then emits EventStatus with each status packet the printer sends, e.g.
+// when the cover opens or the FEED button is pressed. Other data the
+// printer sends is still emitted as EventRead. A zero mask turns automatic
+// status back off; the read loop keeps running until StopReadLoop.
+func (a *USBAdapter) EnableASB(mask byte) error {
+	a.mu.Lock()
+
+	if !a.isOpen {
+		a.mu.Unlock()
+		return errors.New("device not open")
+	}
+	if a.inEndpoint == nil {
+		a.mu.Unlock()
+		return ErrNoInEndpoint
+	}
+	if _, err := a.writeCommand(escpos.EnableASB(mask)); err != nil {
+		a.mu.Unlock()
+		return fmt.Errorf("enable automatic status back failed: %w", err)
+	}
+
+	if mask == 0 {
+		a.asb = nil
+		a.mu.Unlock()
+		return nil
+	}
+	a.asb = &escpos.ASBScanner{}
+	a.mu.Unlock()
+
+	a.StartReadLoop()
+	return nil
+}
+
+// readIn reads from the IN endpoint like ReadContext, but with automatic
+// status back enabled it emits the status packets that arrive as
+// EventStatus and returns only the other bytes, reading again while only
+// status packets arrive, so a packet sent while a reply is awaited is not
+// taken for the reply. Callers must hold a.mu.
+func (a *USBAdapter) readIn(ctx context.Context, buf []byte) (int, error) {
+	for {
+		n, err := a.inEndpoint.ReadContext(ctx, buf)
+		if a.asb == nil || n == 0 {
+			return n, err
+		}
+		statuses, other := a.asb.Scan(buf[:n])
+		for _, status := range statuses {
+			a.emit(Event{Type: EventStatus, Device: rawDevice(a.device), Status: status})
+		}
+		n = copy(buf, other)
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+}
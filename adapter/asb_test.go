@@ -0,0 +1,108 @@
+package adapter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nixxel-company-limited/escpos-usb-server/escpos"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUSBAdapterEnableASB(t *testing.T) {
+	dev := newFakePrinter("A")
+	adapter, _ := newFakeUSBAdapter(dev)
+	after := newFakeAfter()
+	adapter.after = after.After
+	require.NoError(t, adapter.Open())
+	defer adapter.Close()
+
+	statuses := make(chan escpos.Status, 4)
+	reads := make(chan []byte, 4)
+	adapter.On(EventStatus, func(e Event) { statuses <- e.Status })
+	adapter.On(EventRead, func(e Event) { reads <- e.Data })
+
+	// The first packet arrives split across two reads, the second one
+	// reports the FEED button with other data after it
+	in := dev.config.interfaces[0].in[2]
+	in.mu.Lock()
+	in.responses = [][]byte{
+		{0x10, 0x00},
+		{0x00, 0x00},
+		{0x58, 0x02, 0x00, 0x00, 0x12},
+	}
+	in.mu.Unlock()
+
+	require.NoError(t, adapter.EnableASB(escpos.ASBAllStatus))
+	defer adapter.StopReadLoop()
+	assert.Equal(t, []byte{0x1D, 'a', 0x0F}, dev.config.interfaces[0].out[1].data())
+
+	for i := 0; i < 3; i++ {
+		after.fire <- time.Now()
+	}
+
+	for _, want := range []escpos.Status{
+		{},
+		{Offline: true, PaperFeeding: true, FeedButton: true},
+	} {
+		select {
+		case got := <-statuses:
+			assert.Equal(t, want, got)
+		case <-time.After(time.Second):
+			t.Fatal("no status event")
+		}
+	}
+	select {
+	case data := <-reads:
+		assert.Equal(t, []byte{0x12}, data)
+	case <-time.After(time.Second):
+		t.Fatal("no read event")
+	}
+}
+
+func TestUSBAdapterEnableASBNotOpen(t *testing.T) {
+	adapter, _ := newFakeUSBAdapter(newFakePrinter("A"))
+	assert.Error(t, adapter.EnableASB(escpos.ASBAllStatus))
+}
+
+func TestUSBAdapterASBPacketsSkippedInReplies(t *testing.T) {
+	dev := newFakePrinter("A")
+	adapter, _ := newFakeUSBAdapter(dev)
+	adapter.after = newFakeAfter().After
+	require.NoError(t, adapter.Open())
+	defer adapter.Close()
+
+	statuses := make(chan escpos.Status, 4)
+	adapter.On(EventStatus, func(e Event) { statuses <- e.Status })
+
+	require.NoError(t, adapter.EnableASB(escpos.ASBAllStatus))
+	defer adapter.StopReadLoop()
+
+	// A status packet arrives ahead of each reply
+	in := dev.config.interfaces[0].in[2]
+	in.mu.Lock()
+	in.responses = [][]byte{
+		{0x18, 0x00, 0x00, 0x00},
+		{0x12},
+		{0x10, 0x00, 0x00, 0x00, '_', 'a', 'b'},
+		{0x00},
+	}
+	in.mu.Unlock()
+
+	status, err := adapter.QueryStatus(StatusPrinter)
+	require.NoError(t, err)
+	assert.Equal(t, byte(0x12), status)
+
+	reply, err := adapter.ReadStatusUntil(0x00, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("_ab"), reply)
+
+	for _, want := range []escpos.Status{{Offline: true}, {}} {
+		select {
+		case got := <-statuses:
+			assert.Equal(t, want, got)
+		case <-time.After(time.Second):
+			t.Fatal("no status event")
+		}
+	}
+}
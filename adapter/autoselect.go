@@ -0,0 +1,85 @@
+package adapter
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ErrMultiplePrinters is returned when several printers are connected and
+// the auto-select policy set with SetAutoSelect declines to pick one
+var ErrMultiplePrinters = errors.New("several printers found")
+
+var (
+	autoSelectMu sync.Mutex
+	autoSelect   func([]PrinterInfo) int
+)
+
+// SetAutoSelect sets how NewUSBAdapterAuto, and Reconnect of the adapters
+// it creates, choose when several printers are connected. choose gets the
+// candidates and returns the index of the one to use, or a negative index
+// to fail with ErrMultiplePrinters listing them, so the printer has to be
+// selected explicitly (see RequireSinglePrinter). It is not called when
+// only one printer is connected. Nil restores the default of taking the
+// first printer found.
+func SetAutoSelect(choose func([]PrinterInfo) int) {
+	autoSelectMu.Lock()
+	defer autoSelectMu.Unlock()
+	autoSelect = choose
+}
+
+// RequireSinglePrinter is an auto-select policy that refuses to choose
+// between several printers
+func RequireSinglePrinter([]PrinterInfo) int {
+	return -1
+}
+
+// openAutoPrinter opens the printer on ctx that the auto-select policy
+// picks, closing the others
+func openAutoPrinter(ctx usbContext) (usbDevice, error) {
+	devices := findPrinters(ctx)
+	if len(devices) == 0 {
+		return nil, errors.New("cannot find printer")
+	}
+
+	chosen, err := choosePrinter(devices)
+	if err != nil {
+		for _, dev := range devices {
+			closeDevice(dev)
+		}
+		return nil, err
+	}
+	for i, dev := range devices {
+		if i != chosen {
+			closeDevice(dev)
+		}
+	}
+	return devices[chosen], nil
+}
+
+// choosePrinter returns the index of the device the auto-select policy
+// picks
+func choosePrinter(devices []usbDevice) (int, error) {
+	autoSelectMu.Lock()
+	choose := autoSelect
+	autoSelectMu.Unlock()
+
+	if len(devices) == 1 || choose == nil {
+		return 0, nil
+	}
+
+	candidates := make([]PrinterInfo, len(devices))
+	for i, dev := range devices {
+		candidates[i] = describePrinter(dev)
+	}
+	if i := choose(candidates); i >= 0 && i < len(devices) {
+		return i, nil
+	}
+
+	names := make([]string, len(candidates))
+	for i, info := range candidates {
+		names[i] = info.String()
+	}
+	return -1, fmt.Errorf("%w, select one by serial or bus and address: %s", ErrMultiplePrinters, strings.Join(names, "; "))
+}
@@ -0,0 +1,75 @@
+package adapter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func twoPrinterContext() (*fakeContext, *fakeDevice, *fakeDevice) {
+	a := newFakePrinter("SN-A")
+	a.desc.Bus, a.desc.Address = 1, 4
+	b := newFakePrinter("SN-B")
+	b.desc.Bus, b.desc.Address = 2, 7
+	return &fakeContext{devices: []*fakeDevice{a, b}}, a, b
+}
+
+func TestAutoSelectPolicyPicksPrinter(t *testing.T) {
+	t.Cleanup(func() { SetAutoSelect(nil) })
+	ctx, a, b := twoPrinterContext()
+
+	var candidates []PrinterInfo
+	SetAutoSelect(func(printers []PrinterInfo) int {
+		candidates = printers
+		return 1
+	})
+
+	dev, err := openAutoPrinter(ctx)
+	require.NoError(t, err)
+	assert.Same(t, b, dev)
+	assert.True(t, a.isClosed(), "the printer not chosen should be closed")
+	assert.False(t, b.isClosed())
+
+	require.Len(t, candidates, 2)
+	assert.Equal(t, "SN-A", candidates[0].Serial)
+	assert.Equal(t, 2, candidates[1].Bus)
+	assert.Equal(t, 7, candidates[1].Address)
+}
+
+func TestAutoSelectDefaultsToFirstPrinter(t *testing.T) {
+	ctx, a, b := twoPrinterContext()
+
+	dev, err := openAutoPrinter(ctx)
+	require.NoError(t, err)
+	assert.Same(t, a, dev)
+	assert.True(t, b.isClosed())
+}
+
+func TestAutoSelectRequireSinglePrinter(t *testing.T) {
+	t.Cleanup(func() { SetAutoSelect(nil) })
+	SetAutoSelect(RequireSinglePrinter)
+
+	ctx, a, b := twoPrinterContext()
+	_, err := openAutoPrinter(ctx)
+	require.ErrorIs(t, err, ErrMultiplePrinters)
+	assert.Contains(t, err.Error(), "SN-A")
+	assert.Contains(t, err.Error(), "SN-B")
+	assert.True(t, a.isClosed())
+	assert.True(t, b.isClosed())
+
+	// One printer needs no choice
+	single := newFakePrinter("SN-C")
+	dev, err := openAutoPrinter(&fakeContext{devices: []*fakeDevice{single}})
+	require.NoError(t, err)
+	assert.Same(t, single, dev)
+}
+
+func TestAutoSelectOutOfRangeIndex(t *testing.T) {
+	t.Cleanup(func() { SetAutoSelect(nil) })
+	SetAutoSelect(func([]PrinterInfo) int { return 2 })
+
+	ctx, _, _ := twoPrinterContext()
+	_, err := openAutoPrinter(ctx)
+	assert.ErrorIs(t, err, ErrMultiplePrinters)
+}
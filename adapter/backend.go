@@ -0,0 +1,153 @@
+package adapter
+
+import (
+	"context"
+
+	"github.com/google/gousb"
+)
+
+// The interfaces below mirror the subset of gousb used by USBAdapter. They
+// let tests substitute fake devices, configs and endpoints for real hardware.
+
+// usbContext enumerates and opens USB devices
+type usbContext interface {
+	OpenDevices(opener func(desc *gousb.DeviceDesc) bool) ([]usbDevice, error)
+	OpenDeviceWithVIDPID(vid, pid gousb.ID) (usbDevice, error)
+	Debug(level int)
+	Close() error
+}
+
+// usbDevice is an opened USB device
+type usbDevice interface {
+	Desc() *gousb.DeviceDesc
+	SetAutoDetach(autodetach bool) error
+	DetachKernelDriver(ifaceNum int) error
+	ActiveConfigNum() (int, error)
+	Config(cfgNum int) (usbConfig, error)
+	SerialNumber() (string, error)
+	Product() (string, error)
+	Close() error
+
+	// raw returns the underlying gousb device exposed by the public API
+	raw() *gousb.Device
+}
+
+// usbConfig is a claimed device configuration
+type usbConfig interface {
+	Desc() gousb.ConfigDesc
+	Interface(num, alt int) (usbInterface, error)
+	Close() error
+}
+
+// usbInterface is a claimed interface
+type usbInterface interface {
+	Setting() gousb.InterfaceSetting
+	OutEndpoint(epNum int) (outEndpoint, error)
+	InEndpoint(epNum int) (inEndpoint, error)
+	Close()
+}
+
+// outEndpoint is an OUT endpoint the adapter writes print data to
+type outEndpoint interface {
+	Write(buf []byte) (int, error)
+	WriteContext(ctx context.Context, buf []byte) (int, error)
+}
+
+// inEndpoint is an IN endpoint the adapter reads printer responses from
+type inEndpoint interface {
+	Read(buf []byte) (int, error)
+	ReadContext(ctx context.Context, buf []byte) (int, error)
+}
+
+// gousbContext adapts *gousb.Context to usbContext
+type gousbContext struct {
+	*gousb.Context
+}
+
+func (c gousbContext) OpenDevices(opener func(desc *gousb.DeviceDesc) bool) ([]usbDevice, error) {
+	devices, err := c.Context.OpenDevices(opener)
+	wrapped := make([]usbDevice, 0, len(devices))
+	for _, dev := range devices {
+		wrapped = append(wrapped, gousbDevice{dev})
+	}
+	return wrapped, err
+}
+
+func (c gousbContext) OpenDeviceWithVIDPID(vid, pid gousb.ID) (usbDevice, error) {
+	dev, err := c.Context.OpenDeviceWithVIDPID(vid, pid)
+	if dev == nil {
+		return nil, err
+	}
+	return gousbDevice{dev}, err
+}
+
+// gousbDevice adapts *gousb.Device to usbDevice
+type gousbDevice struct {
+	*gousb.Device
+}
+
+func (d gousbDevice) Desc() *gousb.DeviceDesc {
+	return d.Device.Desc
+}
+
+func (d gousbDevice) Config(cfgNum int) (usbConfig, error) {
+	cfg, err := d.Device.Config(cfgNum)
+	if err != nil {
+		return nil, err
+	}
+	return gousbConfig{cfg}, nil
+}
+
+func (d gousbDevice) raw() *gousb.Device {
+	return d.Device
+}
+
+// gousbConfig adapts *gousb.Config to usbConfig
+type gousbConfig struct {
+	*gousb.Config
+}
+
+func (c gousbConfig) Desc() gousb.ConfigDesc {
+	return c.Config.Desc
+}
+
+func (c gousbConfig) Interface(num, alt int) (usbInterface, error) {
+	iface, err := c.Config.Interface(num, alt)
+	if err != nil {
+		return nil, err
+	}
+	return gousbInterface{iface}, nil
+}
+
+// gousbInterface adapts *gousb.Interface to usbInterface
+type gousbInterface struct {
+	*gousb.Interface
+}
+
+func (i gousbInterface) Setting() gousb.InterfaceSetting {
+	return i.Interface.Setting
+}
+
+func (i gousbInterface) OutEndpoint(epNum int) (outEndpoint, error) {
+	ep, err := i.Interface.OutEndpoint(epNum)
+	if err != nil {
+		return nil, err
+	}
+	return ep, nil
+}
+
+func (i gousbInterface) InEndpoint(epNum int) (inEndpoint, error) {
+	ep, err := i.Interface.InEndpoint(epNum)
+	if err != nil {
+		return nil, err
+	}
+	return ep, nil
+}
+
+// rawDevice returns the gousb device behind dev, or nil
+func rawDevice(dev usbDevice) *gousb.Device {
+	if dev == nil {
+		return nil
+	}
+	return dev.raw()
+}
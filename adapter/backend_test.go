@@ -0,0 +1,384 @@
+package adapter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/gousb"
+	"github.com/stretchr/testify/assert"
+)
+
+// Fakes implementing the backend interfaces, used to exercise USBAdapter
+// without USB hardware.
+
+type fakeContext struct {
+	mu         sync.Mutex
+	devices    []*fakeDevice
+	closed     bool
+	debugLevel int
+	// openErr is returned by OpenDevices along with the devices opened,
+	// as gousb does when a device cannot be opened
+	openErr error
+	// closeErr is returned by Close
+	closeErr error
+}
+
+func (c *fakeContext) OpenDevices(opener func(desc *gousb.DeviceDesc) bool) ([]usbDevice, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var opened []usbDevice
+	for _, dev := range c.devices {
+		if opener(dev.desc) {
+			dev.reopen()
+			opened = append(opened, dev)
+		}
+	}
+	return opened, c.openErr
+}
+
+func (c *fakeContext) OpenDeviceWithVIDPID(vid, pid gousb.ID) (usbDevice, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, dev := range c.devices {
+		if dev.desc.Vendor == vid && dev.desc.Product == pid {
+			dev.reopen()
+			return dev, nil
+		}
+	}
+	return nil, nil
+}
+
+func (c *fakeContext) Debug(level int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.debugLevel = level
+}
+
+func (c *fakeContext) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return c.closeErr
+}
+
+type fakeDevice struct {
+	mu      sync.Mutex
+	desc    *gousb.DeviceDesc
+	serial  string
+	product string
+	config  *fakeConfig
+	closed  bool
+	// handle stands in for the *gousb.Device surfaced in events
+	handle *gousb.Device
+	// autoDetachErr is returned by SetAutoDetach(true)
+	autoDetachErr error
+	// detached records interfaces passed to DetachKernelDriver
+	detached []int
+	// configErr is returned by Config, e.g. for a device unplugged after
+	// being opened
+	configErr error
+	// closeErr is returned by Close
+	closeErr error
+	// stringsBlock, if set, holds SerialNumber and Product until closed
+	stringsBlock chan struct{}
+}
+
+// newFakePrinter returns a printer with a bulk OUT endpoint 1 and a bulk IN
+// endpoint 2 on interface 0
+func newFakePrinter(serial string) *fakeDevice {
+	setting := gousb.InterfaceSetting{
+		Number: 0,
+		Class:  gousb.Class(IfaceClassPrinter),
+		Endpoints: map[gousb.EndpointAddress]gousb.EndpointDesc{
+			0x01: {Address: 0x01, Number: 1, Direction: gousb.EndpointDirectionOut, MaxPacketSize: 64, TransferType: gousb.TransferTypeBulk},
+			0x82: {Address: 0x82, Number: 2, Direction: gousb.EndpointDirectionIn, MaxPacketSize: 64, TransferType: gousb.TransferTypeBulk},
+		},
+	}
+	return &fakeDevice{
+		desc:   &gousb.DeviceDesc{Vendor: 0x04b8, Product: 0x0202},
+		serial: serial,
+		config: newFakeConfig(setting),
+		handle: &gousb.Device{},
+	}
+}
+
+func (d *fakeDevice) reopen() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.closed = false
+}
+
+func (d *fakeDevice) isClosed() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.closed
+}
+
+func (d *fakeDevice) Desc() *gousb.DeviceDesc { return d.desc }
+
+func (d *fakeDevice) SetAutoDetach(autodetach bool) error {
+	if autodetach {
+		return d.autoDetachErr
+	}
+	return nil
+}
+
+func (d *fakeDevice) DetachKernelDriver(ifaceNum int) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.detached = append(d.detached, ifaceNum)
+	return nil
+}
+
+func (d *fakeDevice) ActiveConfigNum() (int, error) { return 1, nil }
+
+func (d *fakeDevice) Config(cfgNum int) (usbConfig, error) {
+	if d.configErr != nil {
+		return nil, d.configErr
+	}
+	return d.config, nil
+}
+
+func (d *fakeDevice) SerialNumber() (string, error) {
+	if d.stringsBlock != nil {
+		<-d.stringsBlock
+	}
+	return d.serial, nil
+}
+
+func (d *fakeDevice) Product() (string, error) {
+	if d.stringsBlock != nil {
+		<-d.stringsBlock
+	}
+	return d.product, nil
+}
+
+func (d *fakeDevice) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.closed = true
+	return d.closeErr
+}
+
+func (d *fakeDevice) raw() *gousb.Device { return d.handle }
+
+type fakeConfig struct {
+	desc       gousb.ConfigDesc
+	interfaces map[int]*fakeInterface
+	// claimErrs are returned by successive Interface calls before they
+	// start succeeding
+	claimErrs []error
+	// claims counts successful Interface calls
+	claims int
+	// claimed records the interface number of each successful claim
+	claimed []int
+	// closeErr is returned by Close
+	closeErr error
+}
+
+func newFakeConfig(settings ...gousb.InterfaceSetting) *fakeConfig {
+	cfg := &fakeConfig{
+		desc:       gousb.ConfigDesc{Number: 1},
+		interfaces: make(map[int]*fakeInterface),
+	}
+	for _, setting := range settings {
+		cfg.desc.Interfaces = append(cfg.desc.Interfaces, gousb.InterfaceDesc{
+			Number:      setting.Number,
+			AltSettings: []gousb.InterfaceSetting{setting},
+		})
+		cfg.interfaces[setting.Number] = newFakeInterface(setting)
+	}
+	return cfg
+}
+
+func (c *fakeConfig) Desc() gousb.ConfigDesc { return c.desc }
+
+func (c *fakeConfig) Interface(num, alt int) (usbInterface, error) {
+	if len(c.claimErrs) > 0 {
+		err := c.claimErrs[0]
+		c.claimErrs = c.claimErrs[1:]
+		return nil, err
+	}
+	iface, ok := c.interfaces[num]
+	if !ok {
+		return nil, fmt.Errorf("interface %d not found", num)
+	}
+	c.claims++
+	c.claimed = append(c.claimed, num)
+	return iface, nil
+}
+
+func (c *fakeConfig) Close() error { return c.closeErr }
+
+type fakeInterface struct {
+	setting gousb.InterfaceSetting
+	out     map[int]*fakeOutEndpoint
+	in      map[int]*fakeInEndpoint
+}
+
+func newFakeInterface(setting gousb.InterfaceSetting) *fakeInterface {
+	iface := &fakeInterface{
+		setting: setting,
+		out:     make(map[int]*fakeOutEndpoint),
+		in:      make(map[int]*fakeInEndpoint),
+	}
+	for _, ep := range setting.Endpoints {
+		if ep.Direction == gousb.EndpointDirectionOut {
+			iface.out[ep.Number] = &fakeOutEndpoint{}
+		} else {
+			iface.in[ep.Number] = &fakeInEndpoint{}
+		}
+	}
+	return iface
+}
+
+func (i *fakeInterface) Setting() gousb.InterfaceSetting { return i.setting }
+
+func (i *fakeInterface) OutEndpoint(epNum int) (outEndpoint, error) {
+	ep, ok := i.out[epNum]
+	if !ok {
+		return nil, fmt.Errorf("out endpoint %d not found", epNum)
+	}
+	return ep, nil
+}
+
+func (i *fakeInterface) InEndpoint(epNum int) (inEndpoint, error) {
+	ep, ok := i.in[epNum]
+	if !ok {
+		return nil, fmt.Errorf("in endpoint %d not found", epNum)
+	}
+	return ep, nil
+}
+
+func (i *fakeInterface) Close() {}
+
+type fakeOutEndpoint struct {
+	mu      sync.Mutex
+	written []byte
+	// sizes records the length of each successful write
+	sizes []int
+	// errs are returned by successive writes before they start succeeding
+	errs []error
+	// halts counts ClearHalt calls
+	halts int
+	// stall makes WriteContext block until its context is done, like a
+	// printer that stopped accepting data
+	stall bool
+	// delay makes WriteContext take at least this long
+	delay time.Duration
+}
+
+func (e *fakeOutEndpoint) Write(buf []byte) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if len(e.errs) > 0 {
+		err := e.errs[0]
+		e.errs = e.errs[1:]
+		return 0, err
+	}
+	e.written = append(e.written, buf...)
+	e.sizes = append(e.sizes, len(buf))
+	return len(buf), nil
+}
+
+func (e *fakeOutEndpoint) WriteContext(ctx context.Context, buf []byte) (int, error) {
+	e.mu.Lock()
+	stall, delay := e.stall, e.delay
+	e.mu.Unlock()
+
+	time.Sleep(delay)
+	if stall {
+		<-ctx.Done()
+		return 0, ctx.Err()
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return e.Write(buf)
+}
+
+func (e *fakeOutEndpoint) ClearHalt() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.halts++
+	return nil
+}
+
+func (e *fakeOutEndpoint) data() []byte {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]byte(nil), e.written...)
+}
+
+type fakeInEndpoint struct {
+	mu sync.Mutex
+	// responses are returned by successive reads
+	responses [][]byte
+	// bufSizes records the buffer length passed to each read
+	bufSizes []int
+}
+
+// ReadContext returns the next response, or waits for ctx to expire when
+// there is none, like a printer that stays silent
+func (e *fakeInEndpoint) ReadContext(ctx context.Context, buf []byte) (int, error) {
+	e.mu.Lock()
+	pending := len(e.responses)
+	if pending == 0 {
+		e.bufSizes = append(e.bufSizes, len(buf))
+	}
+	e.mu.Unlock()
+
+	if pending == 0 {
+		<-ctx.Done()
+		return 0, ctx.Err()
+	}
+	return e.Read(buf)
+}
+
+func (e *fakeInEndpoint) Read(buf []byte) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.bufSizes = append(e.bufSizes, len(buf))
+	if len(e.responses) == 0 {
+		return 0, errors.New("no data")
+	}
+	n := copy(buf, e.responses[0])
+	e.responses = e.responses[1:]
+	return n, nil
+}
+
+// newFakeUSBAdapter returns an adapter bound to a fake context holding devices,
+// with the first device selected
+func newFakeUSBAdapter(devices ...*fakeDevice) (*USBAdapter, *fakeContext) {
+	ctx := &fakeContext{devices: devices}
+	a := newUSBAdapter(ctx)
+	if len(devices) > 0 {
+		a.device = devices[0]
+	}
+	return a, ctx
+}
+
+func TestFakeBackend(t *testing.T) {
+	dev := newFakePrinter("A")
+	a, ctx := newFakeUSBAdapter(dev)
+
+	assert.True(t, isPrinter(dev))
+	assert.NoError(t, a.Open())
+	assert.True(t, a.IsOpen())
+
+	_, err := a.Write([]byte{0x1B, 0x40})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x1B, 0x40}, dev.config.interfaces[0].out[1].data())
+
+	assert.NoError(t, a.Close())
+	assert.True(t, dev.isClosed())
+	assert.True(t, ctx.closed)
+}
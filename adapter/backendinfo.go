@@ -0,0 +1,47 @@
+package adapter
+
+import "runtime"
+
+// USBStack describes the USB stack the adapters run on, see BackendInfo
+type USBStack struct {
+	// LibusbVersion is the version of the libusb library linked in, e.g.
+	// "1.0.26.11724", empty in a build without cgo
+	LibusbVersion string `json:"libusb_version"`
+	// Backend is the operating system interface libusb drives devices
+	// through, e.g. "usbfs" on Linux
+	Backend string `json:"backend"`
+	// Hotplug and DetachKernelDriver report the libusb capabilities of
+	// the same names on this platform
+	Hotplug            bool   `json:"hotplug"`
+	DetachKernelDriver bool   `json:"detach_kernel_driver"`
+	OS                 string `json:"os"`
+	Arch               string `json:"arch"`
+}
+
+// libusbBackends names the libusb backend of each operating system
+var libusbBackends = map[string]string{
+	"linux":   "usbfs",
+	"android": "usbfs",
+	"darwin":  "IOKit",
+	"windows": "WinUSB",
+	"freebsd": "libusb20",
+	"openbsd": "ugen",
+	"netbsd":  "ugen",
+}
+
+// BackendInfo returns the libusb version and capabilities and the platform
+// the process runs on, to confirm in bug reports and GET /status which USB
+// stack is in use
+func BackendInfo() USBStack {
+	info := USBStack{Backend: "none", OS: runtime.GOOS, Arch: runtime.GOARCH}
+	if !libusbLinked {
+		return info
+	}
+
+	info.Backend = libusbBackends[runtime.GOOS]
+	if info.Backend == "" {
+		info.Backend = runtime.GOOS
+	}
+	info.LibusbVersion, info.Hotplug, info.DetachKernelDriver = libusbInfo()
+	return info
+}
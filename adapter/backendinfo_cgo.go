@@ -0,0 +1,24 @@
+//go:build cgo
+
+package adapter
+
+/*
+#cgo pkg-config: libusb-1.0
+#include <libusb.h>
+*/
+import "C"
+
+import "fmt"
+
+// libusbLinked is set in builds that link libusb
+const libusbLinked = true
+
+// libusbInfo returns the linked libusb's version and whether it supports
+// hotplug events and detaching kernel drivers. Neither needs a context.
+func libusbInfo() (version string, hotplug, detach bool) {
+	v := C.libusb_get_version()
+	version = fmt.Sprintf("%d.%d.%d.%d%s", v.major, v.minor, v.micro, v.nano, C.GoString(v.rc))
+	hotplug = C.libusb_has_capability(C.uint32_t(C.LIBUSB_CAP_HAS_HOTPLUG)) != 0
+	detach = C.libusb_has_capability(C.uint32_t(C.LIBUSB_CAP_SUPPORTS_DETACH_KERNEL_DRIVER)) != 0
+	return version, hotplug, detach
+}
@@ -0,0 +1,11 @@
+//go:build !cgo
+
+package adapter
+
+// libusbLinked is set in builds that link libusb
+const libusbLinked = false
+
+// libusbInfo is only available with cgo
+func libusbInfo() (version string, hotplug, detach bool) {
+	return "", false, false
+}
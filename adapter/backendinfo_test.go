@@ -0,0 +1,22 @@
+package adapter
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackendInfo(t *testing.T) {
+	info := BackendInfo()
+
+	assert.Equal(t, runtime.GOOS, info.OS)
+	assert.Equal(t, runtime.GOARCH, info.Arch)
+	assert.NotEmpty(t, info.Backend)
+	if libusbLinked {
+		assert.Regexp(t, `^1\.\d+\.\d+`, info.LibusbVersion)
+	} else {
+		assert.Equal(t, "none", info.Backend)
+		assert.Empty(t, info.LibusbVersion)
+	}
+}
@@ -0,0 +1,148 @@
+package adapter
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// ErrBufferFreeUnsupported is returned by BufferFree when the printer
+// model has no known buffer status query
+var ErrBufferFreeUnsupported = errors.New("printer cannot report free buffer space")
+
+// flowControlWait is how long a flow-controlled write waits before asking
+// again while the printer's buffer is full
+const flowControlWait = 50 * time.Millisecond
+
+// SetBufferQuery sets the command the printer answers with the free bytes
+// in its receive buffer, as a two byte little-endian count, for models
+// whose profile has no BufferQuery (currently all of them). BufferFree and
+// SetFlowControl need it. Nil restores the profile's.
+func (a *USBAdapter) SetBufferQuery(query []byte) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.bufferQuery = append([]byte(nil), query...)
+}
+
+// bufferQueryCommand returns the query set with SetBufferQuery, else the
+// detected model profile's, or nil if the printer cannot be asked
+func (a *USBAdapter) bufferQueryCommand() []byte {
+	a.mu.Lock()
+	query := a.bufferQuery
+	a.mu.Unlock()
+	if query != nil {
+		return query
+	}
+
+	if profile, ok := a.Profile(); ok {
+		return profile.BufferQuery
+	}
+	return nil
+}
+
+// BufferFree asks the printer how many bytes its receive buffer can still
+// take. It fails with ErrBufferFreeUnsupported for printers without a
+// buffer query, see SetBufferQuery.
+func (a *USBAdapter) BufferFree() (int, error) {
+	query := a.bufferQueryCommand()
+	if query == nil {
+		return 0, ErrBufferFreeUnsupported
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !a.isOpen {
+		return 0, errors.New("device not open")
+	}
+	if a.inEndpoint == nil {
+		return 0, ErrNoInEndpoint
+	}
+	return a.bufferFree(query)
+}
+
+// bufferFree sends query and decodes the reply. Callers must hold a.mu.
+func (a *USBAdapter) bufferFree(query []byte) (int, error) {
+	if _, err := a.writeCommand(query); err != nil {
+		return 0, fmt.Errorf("buffer status request failed: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), statusTimeout)
+	defer cancel()
+
+	buf := make([]byte, a.readBufSize())
+	n, err := a.readIn(ctx, buf)
+	if err != nil {
+		return 0, fmt.Errorf("buffer status read failed: %w", err)
+	}
+	if n < 2 {
+		return 0, fmt.Errorf("short buffer status reply of %d bytes", n)
+	}
+	return int(binary.LittleEndian.Uint16(buf)), nil
+}
+
+// SetFlowControl makes writes ask the printer for its free buffer space
+// (see BufferFree) and send only as much as fits, waiting while the buffer
+// is full, instead of relying on the USB transfer to stall. A write fails
+// with ErrPrinterBusy if the buffer stays full for 30 seconds.
+//
+// No built-in model profile has a buffer query, so flow control needs one
+// set with SetBufferQuery; until then writes go out as usual. The query is
+// whichever command the model's manual documents as answering with the free
+// receive buffer bytes as a two byte little-endian count:
+//
+//	a.SetBufferQuery(query) // e.g. from the printer's command reference
+//	a.SetFlowControl(true)
+func (a *USBAdapter) SetFlowControl(enabled bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.flowControl = enabled
+}
+
+// flowControlQuery returns the buffer query to pace writes with, or nil
+// when flow control is off or unsupported
+func (a *USBAdapter) flowControlQuery() []byte {
+	a.mu.Lock()
+	enabled := a.flowControl
+	a.mu.Unlock()
+
+	if !enabled {
+		return nil
+	}
+	return a.bufferQueryCommand()
+}
+
+// writePaced writes data in pieces no larger than room reports, the
+// printer's free buffer space for SetFlowControl or a chunk while the
+// printer is not busy for SetAdaptiveFlowControl. While room is zero it
+// waits with a.mu released (see waitBusy). If the printer stops answering
+// the rest is written unpaced. Callers must hold a.mu.
+func (a *USBAdapter) writePaced(ctx context.Context, st outStation, room func() (int, error), data []byte) (int, error) {
+	written := 0
+	var waited time.Duration
+	for written < len(data) {
+		free, err := room()
+		if err != nil {
+			log.Printf("Printer status unavailable, writing without flow control: %v", err)
+			n, err := a.writeOut(ctx, st, data[written:])
+			return written + n, err
+		}
+		if free == 0 {
+			if err := a.waitBusy(ctx, &waited); err != nil {
+				return written, err
+			}
+			continue
+		}
+
+		end := min(written+free, len(data))
+		n, err := a.writeOut(ctx, st, data[written:end])
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
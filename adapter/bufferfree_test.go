@@ -0,0 +1,125 @@
+package adapter
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testBufferQuery stands in for a model's buffer status command
+var testBufferQuery = []byte{0x1D, 'r', 0x7F}
+
+func TestUSBAdapterBufferFree(t *testing.T) {
+	dev := newFakePrinter("A")
+	adapter, _ := newFakeUSBAdapter(dev)
+	require.NoError(t, adapter.Open())
+	defer adapter.Close()
+	adapter.SetBufferQuery(testBufferQuery)
+
+	dev.config.interfaces[0].in[2].responses = [][]byte{{0x00, 0x10}}
+
+	free, err := adapter.BufferFree()
+	require.NoError(t, err)
+	assert.Equal(t, 4096, free)
+	assert.Equal(t, testBufferQuery, dev.config.interfaces[0].out[1].data())
+}
+
+func TestUSBAdapterBufferFreeUnsupported(t *testing.T) {
+	dev := newFakePrinter("A")
+	adapter, _ := newFakeUSBAdapter(dev)
+	require.NoError(t, adapter.Open())
+	defer adapter.Close()
+
+	dev.config.interfaces[0].in[2].responses = [][]byte{[]byte("_TM-T88V\x00")}
+
+	_, err := adapter.BufferFree()
+	assert.ErrorIs(t, err, ErrBufferFreeUnsupported)
+}
+
+func TestUSBAdapterFlowControlRespectsBufferFree(t *testing.T) {
+	dev := newFakePrinter("A")
+	adapter, _ := newFakeUSBAdapter(dev)
+	require.NoError(t, adapter.Open())
+	defer adapter.Close()
+	adapter.SetBufferQuery(testBufferQuery)
+	adapter.SetFlowControl(true)
+
+	after := newFakeAfter()
+	adapter.after = after.After
+	go func() { after.fire <- time.Time{} }()
+
+	// 10 bytes free, then a full buffer, then 5 bytes free
+	dev.config.interfaces[0].in[2].responses = [][]byte{{10, 0}, {0, 0}, {5, 0}}
+
+	data := []byte("0123456789abcde")
+	n, err := adapter.Write(data)
+	require.NoError(t, err)
+	assert.Equal(t, len(data), n)
+
+	out := dev.config.interfaces[0].out[1]
+	want := bytes.Join([][]byte{testBufferQuery, data[:10], testBufferQuery, testBufferQuery, data[10:]}, nil)
+	assert.Equal(t, want, out.data())
+	assert.Equal(t, []time.Duration{flowControlWait}, after.Durations())
+}
+
+func TestUSBAdapterFlowControlUnsupportedWritesWhole(t *testing.T) {
+	dev := newFakePrinter("A")
+	adapter, _ := newFakeUSBAdapter(dev)
+	require.NoError(t, adapter.Open())
+	defer adapter.Close()
+	adapter.SetFlowControl(true)
+
+	dev.config.interfaces[0].in[2].responses = [][]byte{[]byte("_TM-T88V\x00")}
+
+	_, err := adapter.Write([]byte("receipt"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("\x1dIC"+"receipt"), dev.config.interfaces[0].out[1].data())
+}
+
+func TestUSBAdapterFlowControlFailedDetectionCached(t *testing.T) {
+	dev := newFakePrinter("A")
+	adapter, _ := newFakeUSBAdapter(dev)
+	require.NoError(t, adapter.Open())
+	defer adapter.Close()
+	adapter.SetFlowControl(true)
+
+	// The printer does not answer GS I with a model name
+	dev.config.interfaces[0].in[2].responses = [][]byte{[]byte("garbage\x00")}
+
+	for _, job := range []string{"one", "two"} {
+		_, err := adapter.Write([]byte(job))
+		require.NoError(t, err)
+	}
+	// Detection is not retried on every write
+	assert.Equal(t, []byte("\x1dIC"+"one"+"two"), dev.config.interfaces[0].out[1].data())
+}
+
+func TestUSBAdapterFlowControlGivesUp(t *testing.T) {
+	dev := newFakePrinter("A")
+	adapter, _ := newFakeUSBAdapter(dev)
+	require.NoError(t, adapter.Open())
+	defer adapter.Close()
+	adapter.SetBufferQuery(testBufferQuery)
+	adapter.SetFlowControl(true)
+
+	after := newFakeAfter()
+	adapter.after = after.After
+	go func() {
+		for range flowControlTimeout / flowControlWait {
+			after.fire <- time.Time{}
+		}
+	}()
+
+	// The buffer never drains, e.g. out of paper
+	waits := int(flowControlTimeout / flowControlWait)
+	for range waits + 1 {
+		dev.config.interfaces[0].in[2].responses = append(dev.config.interfaces[0].in[2].responses, []byte{0, 0})
+	}
+
+	_, err := adapter.Write([]byte("receipt"))
+	assert.ErrorIs(t, err, ErrPrinterBusy)
+	assert.Len(t, after.Durations(), waits)
+}
@@ -0,0 +1,104 @@
+package adapter
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// CharDeviceAdapter talks to a printer through an OS character device such
+// as the Linux usblp driver's /dev/usb/lp0 or a udev symlink to it. It
+// bypasses libusb, so it needs no USB permissions beyond access to the
+// device node, and a udev symlink keeps pointing at the same printer across
+// re-plugs.
+type CharDeviceAdapter struct {
+	path     string
+	file     *os.File
+	readable bool
+	mu       sync.Mutex
+}
+
+// NewCharDeviceAdapter creates an adapter for the character device at path.
+// The device is opened by Open.
+func NewCharDeviceAdapter(path string) (*CharDeviceAdapter, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("printer device not found: %w", err)
+	}
+	return &CharDeviceAdapter{path: path}, nil
+}
+
+// Path returns the device path
+func (a *CharDeviceAdapter) Path() string {
+	return a.path
+}
+
+// Open opens the device for reading and writing, or write-only when the
+// device cannot be read, in which case Read returns ErrNoInEndpoint
+func (a *CharDeviceAdapter) Open() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.file != nil {
+		return nil
+	}
+
+	file, err := os.OpenFile(a.path, os.O_RDWR, 0)
+	readable := true
+	if err != nil {
+		file, err = os.OpenFile(a.path, os.O_WRONLY, 0)
+		readable = false
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open printer device: %w", err)
+	}
+
+	a.file = file
+	a.readable = readable
+	return nil
+}
+
+// Write sends data to the printer
+func (a *CharDeviceAdapter) Write(data []byte) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.file == nil {
+		return 0, errors.New("device not open")
+	}
+	return a.file.Write(data)
+}
+
+// Read reads data from the printer
+func (a *CharDeviceAdapter) Read(buf []byte) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.file == nil {
+		return 0, errors.New("device not open")
+	}
+	if !a.readable {
+		return 0, ErrNoInEndpoint
+	}
+	return a.file.Read(buf)
+}
+
+// Close closes the device
+func (a *CharDeviceAdapter) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.file == nil {
+		return nil
+	}
+	err := a.file.Close()
+	a.file = nil
+	return err
+}
+
+// IsOpen returns whether the device is open
+func (a *CharDeviceAdapter) IsOpen() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.file != nil
+}
@@ -0,0 +1,81 @@
+//go:build unix
+
+package adapter
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCharDeviceAdapterWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lp0")
+	require.NoError(t, os.WriteFile(path, nil, 0o600))
+
+	a, err := NewCharDeviceAdapter(path)
+	require.NoError(t, err)
+	assert.Equal(t, path, a.Path())
+	assert.False(t, a.IsOpen())
+
+	_, err = a.Write([]byte("early"))
+	assert.Error(t, err)
+
+	require.NoError(t, a.Open())
+	assert.True(t, a.IsOpen())
+
+	n, err := a.Write([]byte{0x1B, 0x40, 'h', 'i', 0x0A})
+	require.NoError(t, err)
+	assert.Equal(t, 5, n)
+
+	require.NoError(t, a.Close())
+	assert.False(t, a.IsOpen())
+
+	written, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x1B, 0x40, 'h', 'i', 0x0A}, written)
+}
+
+func TestCharDeviceAdapterReadFromPipe(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lp0")
+	require.NoError(t, syscall.Mkfifo(path, 0o600))
+
+	a, err := NewCharDeviceAdapter(path)
+	require.NoError(t, err)
+	require.NoError(t, a.Open())
+	defer a.Close()
+
+	// The printer answers a status request through the same node
+	_, err = a.Write([]byte{0x12})
+	require.NoError(t, err)
+
+	buf := make([]byte, 4)
+	n, err := a.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x12}, buf[:n])
+}
+
+func TestCharDeviceAdapterWriteOnly(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can read a write-only file")
+	}
+
+	path := filepath.Join(t.TempDir(), "lp0")
+	require.NoError(t, os.WriteFile(path, nil, 0o200))
+
+	a, err := NewCharDeviceAdapter(path)
+	require.NoError(t, err)
+	require.NoError(t, a.Open())
+	defer a.Close()
+
+	_, err = a.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, ErrNoInEndpoint)
+}
+
+func TestCharDeviceAdapterMissingPath(t *testing.T) {
+	_, err := NewCharDeviceAdapter(filepath.Join(t.TempDir(), "missing"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,186 @@
+package adapter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultCoalesceBytes is how much a CoalescingAdapter buffers before it
+// writes without waiting for the window to pass
+const DefaultCoalesceBytes = 16 << 10
+
+// CoalescingAdapter merges small writes into fewer, larger ones, for
+// clients that send a receipt a few bytes at a time. Buffered bytes are
+// written when the coalesce window passes after the first of them, when
+// the buffer fills, or when Flush is called. Writes report success once
+// buffered; an error writing buffered bytes is returned by the next Write
+// or Flush, so callers must Flush at the end of each job to learn whether
+// it reached the printer.
+//
+// WriteContext and Reconnect are passed through to the wrapped adapter;
+// other optional capabilities, such as status queries, are only available
+// through Inner.
+type CoalescingAdapter struct {
+	inner    Adapter
+	window   time.Duration
+	maxBytes int
+	buf      []byte
+	timer    *time.Timer
+	// err is the error from a write started by the timer
+	err error
+	mu  sync.Mutex
+}
+
+// NewCoalescingAdapter returns an adapter buffering writes to inner for up
+// to window
+func NewCoalescingAdapter(inner Adapter, window time.Duration) *CoalescingAdapter {
+	return &CoalescingAdapter{inner: inner, window: window, maxBytes: DefaultCoalesceBytes}
+}
+
+// SetMaxBytes sets how much is buffered before it is written without
+// waiting for the window. Zero restores DefaultCoalesceBytes.
+func (a *CoalescingAdapter) SetMaxBytes(n int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if n <= 0 {
+		n = DefaultCoalesceBytes
+	}
+	a.maxBytes = n
+}
+
+// Inner returns the wrapped adapter
+func (a *CoalescingAdapter) Inner() Adapter {
+	return a.inner
+}
+
+// Open opens the wrapped adapter
+func (a *CoalescingAdapter) Open() error {
+	return a.inner.Open()
+}
+
+// Write buffers data, writing the buffer once it reaches the size limit
+func (a *CoalescingAdapter) Write(data []byte) (int, error) {
+	return a.WriteContext(context.Background(), data)
+}
+
+// WriteContext buffers data like Write. When the buffer fills, it is
+// written with ctx, so cancelling ctx aborts that write if the wrapped
+// adapter implements ContextWriter.
+func (a *CoalescingAdapter) WriteContext(ctx context.Context, data []byte) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.takeErr(); err != nil {
+		return 0, err
+	}
+
+	a.buf = append(a.buf, data...)
+	if len(a.buf) >= a.maxBytes {
+		if err := a.flushLocked(ctx); err != nil {
+			return 0, err
+		}
+		return len(data), nil
+	}
+	if a.timer == nil {
+		a.timer = time.AfterFunc(a.window, a.flushOnTimer)
+	}
+	return len(data), nil
+}
+
+// Flush writes the buffered bytes now, then flushes the wrapped adapter if
+// it buffers writes too, e.g. a FailoverAdapter ending its job
+func (a *CoalescingAdapter) Flush() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.takeErr(); err != nil {
+		return err
+	}
+	if err := a.flushLocked(context.Background()); err != nil {
+		return err
+	}
+	return flushIfBuffered(a.inner)
+}
+
+// Reconnect discards the buffered bytes and any error writing them, which
+// belong to the write the disconnect interrupted, and reconnects the
+// wrapped adapter. It fails with errors.ErrUnsupported if the wrapped
+// adapter cannot reconnect.
+func (a *CoalescingAdapter) Reconnect() error {
+	r, ok := a.inner.(interface{ Reconnect() error })
+	if !ok {
+		return fmt.Errorf("reconnect: %w", errors.ErrUnsupported)
+	}
+
+	a.mu.Lock()
+	if a.timer != nil {
+		a.timer.Stop()
+		a.timer = nil
+	}
+	a.buf = nil
+	a.err = nil
+	a.mu.Unlock()
+
+	return r.Reconnect()
+}
+
+// Read reads from the wrapped adapter
+func (a *CoalescingAdapter) Read(buf []byte) (int, error) {
+	return a.inner.Read(buf)
+}
+
+// Close writes the buffered bytes and closes the wrapped adapter
+func (a *CoalescingAdapter) Close() error {
+	flushErr := a.Flush()
+	if err := a.inner.Close(); err != nil {
+		return err
+	}
+	return flushErr
+}
+
+// IsOpen reports whether the wrapped adapter is open
+func (a *CoalescingAdapter) IsOpen() bool {
+	return a.inner.IsOpen()
+}
+
+// flushOnTimer writes the buffer once the coalesce window has passed
+func (a *CoalescingAdapter) flushOnTimer() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.timer = nil
+	if err := a.flushLocked(context.Background()); err != nil {
+		a.err = err
+	}
+}
+
+// flushLocked writes the buffer to the wrapped adapter. Callers must hold
+// a.mu.
+func (a *CoalescingAdapter) flushLocked(ctx context.Context) error {
+	if a.timer != nil {
+		a.timer.Stop()
+		a.timer = nil
+	}
+	if len(a.buf) == 0 {
+		return nil
+	}
+
+	data := a.buf
+	a.buf = nil
+	_, err := WriteContext(ctx, a.inner, data)
+	return err
+}
+
+// takeErr returns and clears the error from the last timed write. Callers
+// must hold a.mu.
+func (a *CoalescingAdapter) takeErr() error {
+	err := a.err
+	a.err = nil
+	return err
+}
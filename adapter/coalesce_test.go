@@ -0,0 +1,157 @@
+package adapter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoalescingAdapterMergesWrites(t *testing.T) {
+	inner := &switchableAdapter{}
+	a := NewCoalescingAdapter(inner, time.Hour)
+	require.NoError(t, a.Open())
+
+	for _, part := range []string{"rec", "ei", "pt"} {
+		n, err := a.Write([]byte(part))
+		require.NoError(t, err)
+		assert.Equal(t, len(part), n)
+	}
+	assert.Zero(t, inner.buf.Len(), "writes are held until the window passes")
+
+	require.NoError(t, a.Flush())
+	assert.Equal(t, "receipt", inner.buf.String())
+}
+
+func TestCoalescingAdapterWritesAfterWindow(t *testing.T) {
+	inner := &switchableAdapter{}
+	a := NewCoalescingAdapter(inner, 10*time.Millisecond)
+	require.NoError(t, a.Open())
+
+	_, err := a.Write([]byte("receipt"))
+	require.NoError(t, err)
+
+	// The timed write happens under a.mu
+	assert.Eventually(t, func() bool {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		return inner.buf.String() == "receipt"
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestCoalescingAdapterWritesWhenFull(t *testing.T) {
+	inner := &switchableAdapter{}
+	a := NewCoalescingAdapter(inner, time.Hour)
+	a.SetMaxBytes(4)
+	require.NoError(t, a.Open())
+
+	_, err := a.Write([]byte("abc"))
+	require.NoError(t, err)
+	assert.Zero(t, inner.buf.Len())
+
+	_, err = a.Write([]byte("def"))
+	require.NoError(t, err)
+	assert.Equal(t, "abcdef", inner.buf.String())
+}
+
+func TestCoalescingAdapterReportsTimedWriteError(t *testing.T) {
+	inner := &switchableAdapter{writeErr: errUnplugged}
+	a := NewCoalescingAdapter(inner, time.Millisecond)
+	require.NoError(t, a.Open())
+
+	_, err := a.Write([]byte("receipt"))
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		return a.err != nil
+	}, time.Second, time.Millisecond)
+
+	_, err = a.Write([]byte("next"))
+	assert.ErrorIs(t, err, errUnplugged)
+}
+
+func TestCoalescingAdapterCloseFlushes(t *testing.T) {
+	inner := &switchableAdapter{}
+	a := NewCoalescingAdapter(inner, time.Hour)
+	require.NoError(t, a.Open())
+
+	_, err := a.Write([]byte("receipt"))
+	require.NoError(t, err)
+	require.NoError(t, a.Close())
+
+	assert.Equal(t, "receipt", inner.buf.String())
+	assert.False(t, a.IsOpen())
+}
+
+// reconnectingAdapter is a switchableAdapter that counts reconnects and
+// records the contexts of its writes
+type reconnectingAdapter struct {
+	switchableAdapter
+	reconnects int
+	ctxs       []context.Context
+}
+
+func (a *reconnectingAdapter) Reconnect() error {
+	a.reconnects++
+	return nil
+}
+
+func (a *reconnectingAdapter) WriteContext(ctx context.Context, data []byte) (int, error) {
+	a.ctxs = append(a.ctxs, ctx)
+	return a.Write(data)
+}
+
+func TestCoalescingAdapterWriteContextPassesContext(t *testing.T) {
+	inner := &reconnectingAdapter{}
+	a := NewCoalescingAdapter(inner, time.Hour)
+	a.SetMaxBytes(4)
+	require.NoError(t, a.Open())
+
+	type key struct{}
+	ctx := context.WithValue(context.Background(), key{}, "job")
+	_, err := a.WriteContext(ctx, []byte("receipt"))
+	require.NoError(t, err)
+	require.Len(t, inner.ctxs, 1)
+	assert.Equal(t, "job", inner.ctxs[0].Value(key{}))
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = a.WriteContext(cancelled, []byte("more"))
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestCoalescingAdapterReconnectDiscardsBuffer(t *testing.T) {
+	inner := &reconnectingAdapter{}
+	a := NewCoalescingAdapter(inner, time.Hour)
+	require.NoError(t, a.Open())
+
+	_, err := a.Write([]byte("interrupted"))
+	require.NoError(t, err)
+	require.NoError(t, a.Reconnect())
+	assert.Equal(t, 1, inner.reconnects)
+
+	require.NoError(t, a.Flush())
+	assert.Zero(t, inner.buf.Len(), "the interrupted write's bytes are dropped")
+}
+
+func TestCoalescingAdapterReconnectUnsupported(t *testing.T) {
+	a := NewCoalescingAdapter(&switchableAdapter{}, time.Hour)
+	assert.ErrorIs(t, a.Reconnect(), errors.ErrUnsupported)
+}
+
+func TestCoalescingAdapterFlushesInner(t *testing.T) {
+	inner := &capableAdapter{}
+	a := NewCoalescingAdapter(inner, time.Hour)
+	require.NoError(t, a.Open())
+
+	_, err := a.Write([]byte("receipt"))
+	require.NoError(t, err)
+	require.NoError(t, a.Flush())
+	assert.Equal(t, "receipt", inner.buf.String())
+	assert.Equal(t, 1, inner.flushes)
+}
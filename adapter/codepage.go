@@ -0,0 +1,68 @@
+package adapter
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/nixxel-company-limited/escpos-usb-server/escpos"
+)
+
+// ErrCodePageUnsupported is returned by CurrentCodePage when the printer
+// model has no known code page query
+var ErrCodePageUnsupported = errors.New("printer cannot report its code page")
+
+// SetCodePageQuery sets the command the printer answers with its selected
+// character code table, for models whose profile has no CodePageQuery. The
+// reply must be a NUL terminated block as decoded by
+// escpos.ParseCodePageReply. Nil restores the profile's.
+func (a *USBAdapter) SetCodePageQuery(query []byte) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.codePageQuery = append([]byte(nil), query...)
+}
+
+// codePageQueryCommand returns the query set with SetCodePageQuery, else
+// the detected model profile's, or nil if the printer cannot be asked
+func (a *USBAdapter) codePageQueryCommand() []byte {
+	a.mu.Lock()
+	query := a.codePageQuery
+	a.mu.Unlock()
+	if query != nil {
+		return query
+	}
+
+	if profile, ok := a.Profile(); ok {
+		return profile.CodePageQuery
+	}
+	return nil
+}
+
+// CurrentCodePage asks the printer which character code table is selected,
+// so callers can skip an ESC t that changes nothing or warn when text was
+// encoded for another table. It fails with ErrCodePageUnsupported for
+// printers without a code page query, see SetCodePageQuery.
+func (a *USBAdapter) CurrentCodePage() (escpos.CodePage, error) {
+	query := a.codePageQueryCommand()
+	if query == nil {
+		return 0, ErrCodePageUnsupported
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !a.isOpen {
+		return 0, errors.New("device not open")
+	}
+	if a.inEndpoint == nil {
+		return 0, ErrNoInEndpoint
+	}
+
+	if _, err := a.writeCommand(query); err != nil {
+		return 0, fmt.Errorf("code page request failed: %w", err)
+	}
+	reply, err := a.readUntil(0x00, statusTimeout)
+	if err != nil {
+		return 0, err
+	}
+	return escpos.ParseCodePageReply(reply)
+}
@@ -0,0 +1,52 @@
+package adapter
+
+import (
+	"testing"
+
+	"github.com/nixxel-company-limited/escpos-usb-server/escpos"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCodePageQuery stands in for a model's code page query
+var testCodePageQuery = []byte{0x1D, '(', 'E', 0x02, 0x00, 0x06, 0x08}
+
+func TestUSBAdapterCurrentCodePage(t *testing.T) {
+	dev := newFakePrinter("A")
+	adapter, _ := newFakeUSBAdapter(dev)
+	require.NoError(t, adapter.Open())
+	defer adapter.Close()
+	adapter.SetCodePageQuery(testCodePageQuery)
+
+	dev.config.interfaces[0].in[2].responses = [][]byte{{0x37, 0x27, '8', 0x1F, '1', '6', 0x00}}
+
+	cp, err := adapter.CurrentCodePage()
+	require.NoError(t, err)
+	assert.Equal(t, escpos.CodePageWPC1252, cp)
+	assert.Equal(t, testCodePageQuery, dev.config.interfaces[0].out[1].data())
+}
+
+func TestUSBAdapterCurrentCodePageBadReply(t *testing.T) {
+	dev := newFakePrinter("A")
+	adapter, _ := newFakeUSBAdapter(dev)
+	require.NoError(t, adapter.Open())
+	defer adapter.Close()
+	adapter.SetCodePageQuery(testCodePageQuery)
+
+	dev.config.interfaces[0].in[2].responses = [][]byte{[]byte("x\x00")}
+
+	_, err := adapter.CurrentCodePage()
+	assert.Error(t, err)
+}
+
+func TestUSBAdapterCurrentCodePageUnsupported(t *testing.T) {
+	dev := newFakePrinter("A")
+	adapter, _ := newFakeUSBAdapter(dev)
+	require.NoError(t, adapter.Open())
+	defer adapter.Close()
+
+	dev.config.interfaces[0].in[2].responses = [][]byte{[]byte("_TM-T88V\x00")}
+
+	_, err := adapter.CurrentCodePage()
+	assert.ErrorIs(t, err, ErrCodePageUnsupported)
+}
@@ -0,0 +1,87 @@
+package adapter
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/google/gousb"
+)
+
+// libusb log levels accepted by SetUSBDebug
+const (
+	USBDebugNone    = 0
+	USBDebugError   = 1
+	USBDebugWarning = 2
+	USBDebugInfo    = 3
+	USBDebugVerbose = 4
+)
+
+var (
+	usbDebugMu    sync.Mutex
+	usbDebugLevel int
+)
+
+// SetUSBDebug sets the libusb log level for USB contexts created afterwards
+// by NewUSBAdapter and NewUSBAdapterAuto, so transfer-level diagnostics can
+// be enabled without recompiling. libusb logs to stderr.
+func SetUSBDebug(level int) error {
+	if err := checkUSBDebug(level); err != nil {
+		return err
+	}
+
+	usbDebugMu.Lock()
+	defer usbDebugMu.Unlock()
+	usbDebugLevel = level
+	return nil
+}
+
+// SetUSBDebug changes the libusb log level of this adapter's USB context
+func (a *USBAdapter) SetUSBDebug(level int) error {
+	if err := checkUSBDebug(level); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.ctx == nil {
+		return errors.New("adapter closed")
+	}
+	a.ctx.Debug(level)
+	return nil
+}
+
+// debugf logs a diagnostic that only matters when USB debugging is enabled
+// with SetUSBDebug
+func debugf(format string, args ...any) {
+	usbDebugMu.Lock()
+	level := usbDebugLevel
+	usbDebugMu.Unlock()
+
+	if level > USBDebugNone {
+		log.Printf(format, args...)
+	}
+}
+
+func checkUSBDebug(level int) error {
+	if level < USBDebugNone || level > USBDebugVerbose {
+		return fmt.Errorf("invalid USB debug level %d, expected %d-%d", level, USBDebugNone, USBDebugVerbose)
+	}
+	return nil
+}
+
+// newGousbContext creates a libusb context with the package debug level
+func newGousbContext() gousbContext {
+	ctx := gousbContext{gousb.NewContext()}
+
+	usbDebugMu.Lock()
+	level := usbDebugLevel
+	usbDebugMu.Unlock()
+
+	if level > USBDebugNone {
+		ctx.Debug(level)
+	}
+	return ctx
+}
@@ -0,0 +1,28 @@
+package adapter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUSBAdapterSetUSBDebug(t *testing.T) {
+	adapter, ctx := newFakeUSBAdapter(newFakePrinter("A"))
+
+	require.NoError(t, adapter.SetUSBDebug(USBDebugVerbose))
+	assert.Equal(t, USBDebugVerbose, ctx.debugLevel)
+
+	assert.Error(t, adapter.SetUSBDebug(5))
+	assert.Equal(t, USBDebugVerbose, ctx.debugLevel)
+}
+
+func TestSetUSBDebug(t *testing.T) {
+	defer SetUSBDebug(USBDebugNone)
+
+	require.NoError(t, SetUSBDebug(USBDebugWarning))
+	assert.Equal(t, USBDebugWarning, usbDebugLevel)
+
+	assert.Error(t, SetUSBDebug(-1))
+	assert.Equal(t, USBDebugWarning, usbDebugLevel)
+}
@@ -0,0 +1,100 @@
+package adapter
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// DefaultDescriptorReadTimeout bounds each string descriptor read unless
+// set with SetDescriptorReadTimeout
+const DefaultDescriptorReadTimeout = 2 * time.Second
+
+// errDescriptorTimeout is returned by readDescriptor for a read that did
+// not complete in time
+var errDescriptorTimeout = errors.New("string descriptor read timed out")
+
+var (
+	descriptorTimeoutMu sync.Mutex
+	descriptorTimeout   = DefaultDescriptorReadTimeout
+	// abandonedReads holds, per device, channels closed when reads that
+	// timed out finish, see closeDevice
+	abandonedReads = map[usbDevice][]chan struct{}{}
+)
+
+// SetDescriptorReadTimeout bounds how long ListPrinters, the printer
+// lookups and Open wait for a device's product and serial strings, so a
+// misbehaving device that never answers cannot hang the scan. Such a
+// device is reported without the strings that timed out. The abandoned
+// read finishes in the background, and the device is only closed once it
+// has. Zero or less waits indefinitely.
+func SetDescriptorReadTimeout(d time.Duration) {
+	descriptorTimeoutMu.Lock()
+	defer descriptorTimeoutMu.Unlock()
+	descriptorTimeout = d
+}
+
+// readDescriptor calls read, one of dev's string descriptor getters,
+// giving up after the descriptor read timeout
+func readDescriptor(dev usbDevice, read func() (string, error)) (string, error) {
+	descriptorTimeoutMu.Lock()
+	timeout := descriptorTimeout
+	descriptorTimeoutMu.Unlock()
+	if timeout <= 0 {
+		return read()
+	}
+
+	type result struct {
+		s   string
+		err error
+	}
+	done := make(chan result, 1)
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		s, err := read()
+		done <- result{s, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.s, r.err
+	case <-time.After(timeout):
+		descriptorTimeoutMu.Lock()
+		abandonedReads[dev] = append(abandonedReads[dev], finished)
+		descriptorTimeoutMu.Unlock()
+		return "", errDescriptorTimeout
+	}
+}
+
+// closeDevice closes dev, waiting in the background for descriptor reads
+// that timed out on it to finish first, so they never use a closed handle
+func closeDevice(dev usbDevice) error {
+	descriptorTimeoutMu.Lock()
+	pending := abandonedReads[dev]
+	delete(abandonedReads, dev)
+	descriptorTimeoutMu.Unlock()
+
+	if len(pending) == 0 {
+		return dev.Close()
+	}
+	go func() {
+		for _, finished := range pending {
+			<-finished
+		}
+		dev.Close()
+	}()
+	return nil
+}
+
+// readDescriptors reads the product and serial strings of dev. After one
+// read times out the other is not attempted, so a device that stopped
+// answering costs a single timeout.
+func readDescriptors(dev usbDevice) (product, serial string) {
+	product, err := readDescriptor(dev, dev.Product)
+	if errors.Is(err, errDescriptorTimeout) {
+		return "", ""
+	}
+	serial, _ = readDescriptor(dev, dev.SerialNumber)
+	return product, serial
+}
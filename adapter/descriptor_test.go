@@ -0,0 +1,61 @@
+package adapter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListPrintersDescriptorReadTimeout(t *testing.T) {
+	t.Cleanup(func() { SetDescriptorReadTimeout(DefaultDescriptorReadTimeout) })
+	SetDescriptorReadTimeout(50 * time.Millisecond)
+
+	a := newFakePrinter("SN-A")
+	a.product = "TM-T88VI"
+	a.desc.Bus, a.desc.Address = 1, 4
+	b := newFakePrinter("SN-B")
+	b.product = "TM-T20"
+	b.desc.Bus, b.desc.Address = 2, 7
+	b.stringsBlock = make(chan struct{})
+	defer close(b.stringsBlock)
+
+	start := time.Now()
+	printers := listPrinters(&fakeContext{devices: []*fakeDevice{a, b}})
+	elapsed := time.Since(start)
+
+	// The hung device costs one timeout, not one per string
+	assert.Less(t, elapsed, 90*time.Millisecond)
+	require.Len(t, printers, 2)
+	assert.Equal(t, PrinterInfo{Bus: 1, Address: 4, VID: 0x04b8, PID: 0x0202, Product: "TM-T88VI", Serial: "SN-A"}, printers[0])
+	assert.Equal(t, PrinterInfo{Bus: 2, Address: 7, VID: 0x04b8, PID: 0x0202}, printers[1])
+}
+
+func TestGetDeviceBySerialSkipsHungDevice(t *testing.T) {
+	t.Cleanup(func() { SetDescriptorReadTimeout(DefaultDescriptorReadTimeout) })
+	SetDescriptorReadTimeout(20 * time.Millisecond)
+
+	a := newFakePrinter("SN-A")
+	a.stringsBlock = make(chan struct{})
+	b := newFakePrinter("SN-B")
+
+	dev, err := getDeviceBySerial(&fakeContext{devices: []*fakeDevice{a, b}}, "SN-B")
+	require.NoError(t, err)
+	assert.Same(t, b, dev)
+
+	// The hung device stays open until its abandoned read returns
+	assert.False(t, a.isClosed())
+	close(a.stringsBlock)
+	assert.Eventually(t, a.isClosed, time.Second, time.Millisecond)
+}
+
+func TestDescriptorReadWithoutTimeout(t *testing.T) {
+	t.Cleanup(func() { SetDescriptorReadTimeout(DefaultDescriptorReadTimeout) })
+	SetDescriptorReadTimeout(0)
+
+	dev := newFakePrinter("SN-A")
+	s, err := readDescriptor(dev, func() (string, error) { return "TM-T88VI", nil })
+	require.NoError(t, err)
+	assert.Equal(t, "TM-T88VI", s)
+}
@@ -0,0 +1,45 @@
+package adapter
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/gousb"
+)
+
+// isBusy reports whether err means the interface is claimed by a kernel
+// driver or another process. gousb formats libusb errors with %v when
+// claiming, so the error text is checked as well.
+func isBusy(err error) bool {
+	if err == nil {
+		return false
+	}
+	return errors.Is(err, gousb.ErrorBusy) || strings.Contains(err.Error(), gousb.ErrorBusy.Error())
+}
+
+// isAccessDenied reports whether err means the process may not use the
+// device, which right after plug-in can also mean udev has not applied its
+// rules yet. As with isBusy the error text is checked as well.
+func isAccessDenied(err error) bool {
+	if err == nil {
+		return false
+	}
+	return errors.Is(err, gousb.ErrorAccess) || strings.Contains(err.Error(), gousb.ErrorAccess.Error())
+}
+
+// accessError explains an interface that stayed inaccessible
+func accessError(ifaceNum int, err error) error {
+	return fmt.Errorf("access to interface %d denied; if the printer was just plugged in, udev may still be applying permissions, "+
+		"otherwise add a udev rule granting this user access to the device: %w", ifaceNum, err)
+}
+
+// busyError explains how to free an interface that could not be claimed
+func busyError(ifaceNum int, err error) error {
+	return fmt.Errorf("interface %d is busy, it is still bound to a kernel driver (e.g. usblp) or claimed by another process; "+
+		"run as a user with write access to the device (add a udev rule) or unbind the driver: %w", ifaceNum, err)
+}
+
+func (d gousbDevice) DetachKernelDriver(ifaceNum int) error {
+	return detachKernelDriver(d.Device.Desc.Bus, d.Device.Desc.Address, ifaceNum)
+}
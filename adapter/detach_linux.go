@@ -0,0 +1,43 @@
+//go:build linux
+
+package adapter
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// usbfs ioctls, see linux/usbdevice_fs.h
+const (
+	usbdevfsIoctl      = 0xC0000000 | uintptr(unsafe.Sizeof(usbdevfsIoctlArg{}))<<16 | 'U'<<8 | 18
+	usbdevfsDisconnect = 'U'<<8 | 22
+)
+
+// usbdevfsIoctlArg is struct usbdevfs_ioctl
+type usbdevfsIoctlArg struct {
+	ifno      int32
+	ioctlCode int32
+	data      uintptr
+}
+
+// detachKernelDriver unbinds the kernel driver from one interface through
+// usbfs, like libusb_detach_kernel_driver. It is used when libusb's
+// auto-detach is unavailable. No driver being bound is not an error.
+func detachKernelDriver(bus, address, ifaceNum int) error {
+	path := fmt.Sprintf("/dev/bus/usb/%03d/%03d", bus, address)
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	arg := usbdevfsIoctlArg{ifno: int32(ifaceNum), ioctlCode: usbdevfsDisconnect}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), usbdevfsIoctl, uintptr(unsafe.Pointer(&arg)))
+	if errno != 0 && !errors.Is(errno, syscall.ENODATA) {
+		return fmt.Errorf("failed to detach kernel driver from interface %d: %w", ifaceNum, errno)
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package adapter
+
+import "errors"
+
+// detachKernelDriver is only implemented on Linux
+func detachKernelDriver(bus, address, ifaceNum int) error {
+	return errors.ErrUnsupported
+}
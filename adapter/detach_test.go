@@ -0,0 +1,65 @@
+package adapter
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"testing"
+
+	"github.com/google/gousb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUSBAdapterOpenExplicitDetach(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("kernel driver detach only applies on Linux")
+	}
+
+	dev := newFakePrinter("A")
+	dev.autoDetachErr = gousb.ErrorNotSupported
+	a, _ := newFakeUSBAdapter(dev)
+
+	require.NoError(t, a.Open())
+	defer a.Close()
+
+	assert.Equal(t, []int{0}, dev.detached)
+}
+
+func TestUSBAdapterOpenAutoDetachSkipsExplicitDetach(t *testing.T) {
+	dev := newFakePrinter("A")
+	a, _ := newFakeUSBAdapter(dev)
+
+	require.NoError(t, a.Open())
+	defer a.Close()
+
+	assert.Empty(t, dev.detached)
+}
+
+func TestUSBAdapterOpenStillBusy(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("kernel driver detach only applies on Linux")
+	}
+
+	dev := newFakePrinter("A")
+	dev.autoDetachErr = gousb.ErrorNotSupported
+	// gousb flattens the libusb error into the message when claiming
+	dev.config.claimErrs = []error{fmt.Errorf("failed to claim interface 0: %v", gousb.ErrorBusy)}
+	a, _ := newFakeUSBAdapter(dev)
+	a.SetClaimRetry(1, 0)
+
+	err := a.Open()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "interface 0 is busy")
+	assert.Contains(t, err.Error(), "udev")
+	assert.Equal(t, []int{0}, dev.detached)
+	assert.False(t, a.IsOpen())
+}
+
+func TestIsBusy(t *testing.T) {
+	assert.True(t, isBusy(gousb.ErrorBusy))
+	assert.True(t, isBusy(fmt.Errorf("claim: %w", gousb.ErrorBusy)))
+	assert.True(t, isBusy(fmt.Errorf("claim: %v", gousb.ErrorBusy)))
+	assert.False(t, isBusy(errors.New("no device")))
+	assert.False(t, isBusy(nil))
+}
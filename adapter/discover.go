@@ -0,0 +1,200 @@
+package adapter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/gousb"
+)
+
+// PrinterInfo describes a connected USB printer
+type PrinterInfo struct {
+	Bus     int
+	Address int
+	VID     gousb.ID
+	PID     gousb.ID
+	// Product and Serial are the device's string descriptors, empty if it
+	// does not report them
+	Product string
+	Serial  string
+}
+
+func (p PrinterInfo) String() string {
+	s := fmt.Sprintf("bus %03d address %03d  %s:%s", p.Bus, p.Address, p.VID, p.PID)
+	if p.Product != "" {
+		s += "  " + p.Product
+	}
+	if p.Serial != "" {
+		s += "  serial " + p.Serial
+	}
+	return s
+}
+
+// ListPrinters returns the USB printers currently connected
+func ListPrinters() []PrinterInfo {
+	ctx := newGousbContext()
+	defer ctx.Close()
+	return listPrinters(ctx)
+}
+
+// listPrinters describes and closes every printer on ctx
+func listPrinters(ctx usbContext) []PrinterInfo {
+	var printers []PrinterInfo
+	for _, dev := range findPrinters(ctx) {
+		printers = append(printers, describePrinter(dev))
+		closeDevice(dev)
+	}
+	return printers
+}
+
+// describePrinter reads the descriptor and strings of an open device,
+// leaving out strings it does not answer in time, see
+// SetDescriptorReadTimeout
+func describePrinter(dev usbDevice) PrinterInfo {
+	desc := dev.Desc()
+	info := PrinterInfo{Bus: desc.Bus, Address: desc.Address, VID: desc.Vendor, PID: desc.Product}
+	info.Product, info.Serial = readDescriptors(dev)
+	return info
+}
+
+// NewUSBAdapterBySerial creates an adapter for the printer with the given
+// serial number
+func NewUSBAdapterBySerial(serial string) (*USBAdapter, error) {
+	ctx := newGousbContext()
+	dev, err := getDeviceBySerial(ctx, serial)
+	if err != nil {
+		ctx.Close()
+		return nil, err
+	}
+
+	adapter := newUSBAdapter(ctx)
+	adapter.device = dev
+	adapter.selector = deviceSelector{serial: serial}
+	return adapter, nil
+}
+
+// NewUSBAdapterByProduct creates an adapter for the printer whose product
+// string contains substr, ignoring case, e.g. "TM-T88V"
+func NewUSBAdapterByProduct(substr string) (*USBAdapter, error) {
+	ctx := newGousbContext()
+	dev, err := getDeviceByProduct(ctx, substr)
+	if err != nil {
+		ctx.Close()
+		return nil, err
+	}
+
+	adapter := newUSBAdapter(ctx)
+	adapter.device = dev
+	adapter.selector = deviceSelector{product: substr}
+	return adapter, nil
+}
+
+// GetDeviceByProduct opens the device whose product string contains
+// substr, ignoring case. It fails, listing the candidates, if more than one
+// device matches.
+func GetDeviceByProduct(ctx *gousb.Context, substr string) (*gousb.Device, error) {
+	dev, err := getDeviceByProduct(gousbContext{ctx}, substr)
+	if err != nil {
+		return nil, err
+	}
+	return dev.raw(), nil
+}
+
+// getDeviceByProduct opens the one device on ctx whose product string
+// contains substr, closing every other device. As in findPrinters, devices
+// that could not be opened are skipped and the opened ones still checked.
+func getDeviceByProduct(ctx usbContext, substr string) (usbDevice, error) {
+	devices, err := ctx.OpenDevices(func(desc *gousb.DeviceDesc) bool {
+		return true
+	})
+	if err != nil {
+		debugf("Opening USB devices: %v; checking the %d opened", err, len(devices))
+	}
+
+	want := strings.ToLower(substr)
+	var matches []usbDevice
+	for _, dev := range devices {
+		product, err := readDescriptor(dev, dev.Product)
+		if err == nil && strings.Contains(strings.ToLower(product), want) {
+			matches = append(matches, dev)
+			continue
+		}
+		closeDevice(dev)
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("no device with product matching %q", substr)
+	case 1:
+		return matches[0], nil
+	}
+
+	candidates := make([]string, len(matches))
+	for i, dev := range matches {
+		candidates[i] = describePrinter(dev).String()
+		closeDevice(dev)
+	}
+	return nil, fmt.Errorf("%d devices match product %q, pin one by serial or bus and address: %s",
+		len(matches), substr, strings.Join(candidates, "; "))
+}
+
+// NewUSBAdapterAt creates an adapter for the printer at a USB bus and
+// device address, for printers without a serial number. Addresses change
+// when the printer is replugged.
+func NewUSBAdapterAt(bus, address int) (*USBAdapter, error) {
+	ctx := newGousbContext()
+	dev, err := getDeviceAt(ctx, bus, address)
+	if err != nil {
+		ctx.Close()
+		return nil, err
+	}
+
+	adapter := newUSBAdapter(ctx)
+	adapter.device = dev
+	adapter.selector = deviceSelector{bus: bus, address: address}
+	return adapter, nil
+}
+
+// getDeviceAt opens the device on ctx at bus and address
+func getDeviceAt(ctx usbContext, bus, address int) (usbDevice, error) {
+	devices, err := ctx.OpenDevices(func(desc *gousb.DeviceDesc) bool {
+		return desc.Bus == bus && desc.Address == address
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(devices) == 0 {
+		return nil, fmt.Errorf("no device at bus %d address %d", bus, address)
+	}
+	return devices[0], nil
+}
+
+// deviceSelector records how an adapter's printer was chosen, so Reconnect
+// finds the same unit again. The zero value selects the first printer.
+type deviceSelector struct {
+	serial       string
+	product      string
+	bus, address int
+	vid, pid     gousb.ID
+}
+
+// find opens the printer matching the first criterion set, in order of how
+// reliably it identifies one unit: serial number, product string, bus and
+// address, then VID and PID. As in NewUSBAdapter, a VID and PID that match
+// nothing fall back to auto-selection, see SetAutoSelect.
+func (sel deviceSelector) find(ctx usbContext) (usbDevice, error) {
+	switch {
+	case sel.serial != "":
+		return getDeviceBySerial(ctx, sel.serial)
+	case sel.product != "":
+		return getDeviceByProduct(ctx, sel.product)
+	case sel.bus > 0 && sel.address > 0:
+		return getDeviceAt(ctx, sel.bus, sel.address)
+	case sel.vid != 0 || sel.pid != 0:
+		if dev, err := ctx.OpenDeviceWithVIDPID(sel.vid, sel.pid); err == nil && dev != nil {
+			return dev, nil
+		}
+	}
+
+	return openAutoPrinter(ctx)
+}
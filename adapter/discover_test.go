@@ -0,0 +1,98 @@
+package adapter
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListPrinters(t *testing.T) {
+	a := newFakePrinter("SN-A")
+	a.product = "TM-T88VI"
+	a.desc.Bus, a.desc.Address = 1, 4
+	b := newFakePrinter("")
+	b.desc.Bus, b.desc.Address = 2, 7
+
+	printers := listPrinters(&fakeContext{devices: []*fakeDevice{a, b}})
+
+	require.Len(t, printers, 2)
+	assert.Equal(t, PrinterInfo{Bus: 1, Address: 4, VID: 0x04b8, PID: 0x0202, Product: "TM-T88VI", Serial: "SN-A"}, printers[0])
+	assert.Equal(t, "bus 001 address 004  04b8:0202  TM-T88VI  serial SN-A", printers[0].String())
+	assert.Equal(t, "", printers[1].Serial)
+	assert.True(t, a.isClosed())
+	assert.True(t, b.isClosed())
+}
+
+func TestGetDeviceAt(t *testing.T) {
+	a := newFakePrinter("A")
+	a.desc.Bus, a.desc.Address = 1, 4
+	b := newFakePrinter("B")
+	b.desc.Bus, b.desc.Address = 2, 7
+	ctx := &fakeContext{devices: []*fakeDevice{a, b}}
+
+	dev, err := getDeviceAt(ctx, 2, 7)
+	require.NoError(t, err)
+	assert.Same(t, b, dev)
+
+	_, err = getDeviceAt(ctx, 3, 1)
+	assert.Error(t, err)
+}
+
+func TestGetDeviceByProduct(t *testing.T) {
+	a := newFakePrinter("SN-A")
+	a.product = "TM-T88V"
+	b := newFakePrinter("SN-B")
+	b.product = "TM-T20III"
+	c := newFakePrinter("SN-C")
+	c.product = "Receipt Printer XP-80"
+	ctx := &fakeContext{devices: []*fakeDevice{a, b, c}}
+
+	dev, err := getDeviceByProduct(ctx, "tm-t20")
+	require.NoError(t, err)
+	assert.Same(t, b, dev)
+	assert.True(t, a.isClosed())
+	assert.False(t, b.isClosed())
+	assert.True(t, c.isClosed())
+
+	_, err = getDeviceByProduct(ctx, "TM-U220")
+	assert.ErrorContains(t, err, `no device with product matching "TM-U220"`)
+	assert.True(t, b.isClosed())
+}
+
+func TestGetDeviceByProductAmbiguous(t *testing.T) {
+	a := newFakePrinter("SN-A")
+	a.product = "TM-T88V"
+	a.desc.Bus, a.desc.Address = 1, 4
+	b := newFakePrinter("SN-B")
+	b.product = "TM-T88VI"
+	b.desc.Bus, b.desc.Address = 1, 5
+	c := newFakePrinter("SN-C")
+	c.product = "TM-T20III"
+	ctx := &fakeContext{devices: []*fakeDevice{a, b, c}}
+
+	_, err := getDeviceByProduct(ctx, "TM-T88")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "2 devices match product")
+	assert.Contains(t, err.Error(), "bus 001 address 004  04b8:0202  TM-T88V  serial SN-A")
+	assert.Contains(t, err.Error(), "bus 001 address 005  04b8:0202  TM-T88VI  serial SN-B")
+	assert.True(t, a.isClosed())
+	assert.True(t, b.isClosed())
+	assert.True(t, c.isClosed())
+}
+
+func TestGetDeviceByProductSkipsUnopenable(t *testing.T) {
+	a := newFakePrinter("SN-A")
+	a.product = "TM-T88V"
+	b := newFakePrinter("SN-B")
+	b.product = "TM-T20III"
+	// Another device on the bus could not be opened
+	ctx := &fakeContext{devices: []*fakeDevice{a, b}, openErr: errors.New("access denied")}
+
+	dev, err := getDeviceByProduct(ctx, "TM-T20")
+	require.NoError(t, err)
+	assert.Same(t, b, dev)
+	assert.True(t, a.isClosed())
+	assert.False(t, b.isClosed())
+}
@@ -0,0 +1,71 @@
+package adapter
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/gousb"
+)
+
+// USBError is returned by Write and Read when a transfer fails. Code
+// classifies the failure so callers can choose a recovery with errors.As:
+//
+//	var usbErr *adapter.USBError
+//	if errors.As(err, &usbErr) && usbErr.Code == gousb.TransferNoDevice {
+//		adapter.Reconnect()
+//	}
+type USBError struct {
+	// Op is the failed operation, "write" or "read"
+	Op string
+	// Code is the transfer status, TransferError when the cause is unknown
+	Code gousb.TransferStatus
+	// Err is the underlying gousb error
+	Err error
+}
+
+func (e *USBError) Error() string {
+	return e.Op + " failed: " + e.Err.Error()
+}
+
+func (e *USBError) Unwrap() error {
+	return e.Err
+}
+
+// IsDisconnect reports whether err means the printer is no longer on the
+// bus, so it has to be reopened (see Reconnect) before it can be written to
+func IsDisconnect(err error) bool {
+	var usbErr *USBError
+	if errors.As(err, &usbErr) {
+		return usbErr.Code == gousb.TransferNoDevice
+	}
+	return errors.Is(err, gousb.ErrorNoDevice)
+}
+
+// newUSBError classifies a transfer error
+func newUSBError(op string, err error) *USBError {
+	return &USBError{Op: op, Code: transferCode(err), Err: err}
+}
+
+// transferCode maps gousb transfer statuses and libusb error codes onto a
+// transfer status
+func transferCode(err error) gousb.TransferStatus {
+	var status gousb.TransferStatus
+	if errors.As(err, &status) {
+		return status
+	}
+
+	switch {
+	case errors.Is(err, gousb.ErrorTimeout), errors.Is(err, context.DeadlineExceeded):
+		return gousb.TransferTimedOut
+	case errors.Is(err, gousb.ErrorPipe):
+		return gousb.TransferStall
+	case errors.Is(err, gousb.ErrorNoDevice):
+		return gousb.TransferNoDevice
+	case errors.Is(err, gousb.ErrorOverflow):
+		return gousb.TransferOverflow
+	case errors.Is(err, gousb.ErrorInterrupted), errors.Is(err, context.Canceled):
+		return gousb.TransferCancelled
+	default:
+		return gousb.TransferError
+	}
+}
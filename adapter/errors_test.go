@@ -0,0 +1,70 @@
+package adapter
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/gousb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUSBAdapterWriteTypedErrors(t *testing.T) {
+	testCases := []struct {
+		name string
+		err  error
+		code gousb.TransferStatus
+	}{
+		{"Timeout", gousb.ErrorTimeout, gousb.TransferTimedOut},
+		{"TransferTimedOut", gousb.TransferTimedOut, gousb.TransferTimedOut},
+		{"Pipe", gousb.ErrorPipe, gousb.TransferStall},
+		{"Stall", gousb.TransferStall, gousb.TransferStall},
+		{"NoDevice", gousb.ErrorNoDevice, gousb.TransferNoDevice},
+		{"Overflow", gousb.ErrorOverflow, gousb.TransferOverflow},
+		{"Interrupted", gousb.ErrorInterrupted, gousb.TransferCancelled},
+		{"Unknown", errors.New("mystery"), gousb.TransferError},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dev := newFakePrinter("A")
+			adapter, _ := newFakeUSBAdapter(dev)
+			require.NoError(t, adapter.Open())
+			defer adapter.Close()
+
+			dev.config.interfaces[0].out[1].errs = []error{tc.err}
+
+			_, err := adapter.Write([]byte("job"))
+
+			var usbErr *USBError
+			require.ErrorAs(t, err, &usbErr)
+			assert.Equal(t, tc.code, usbErr.Code)
+			assert.Equal(t, "write", usbErr.Op)
+			assert.ErrorIs(t, err, tc.err)
+			assert.Contains(t, err.Error(), "write failed")
+		})
+	}
+}
+
+func TestUSBAdapterReadTypedError(t *testing.T) {
+	dev := newFakePrinter("A")
+	adapter, _ := newFakeUSBAdapter(dev)
+	require.NoError(t, adapter.Open())
+	defer adapter.Close()
+
+	_, err := adapter.Read(make([]byte, 8))
+
+	var usbErr *USBError
+	require.ErrorAs(t, err, &usbErr)
+	assert.Equal(t, "read", usbErr.Op)
+	assert.Equal(t, gousb.TransferError, usbErr.Code)
+}
+
+func TestIsDisconnect(t *testing.T) {
+	assert.True(t, IsDisconnect(newUSBError("write", gousb.ErrorNoDevice)))
+	assert.True(t, IsDisconnect(newUSBError("write", gousb.TransferNoDevice)))
+	assert.True(t, IsDisconnect(gousb.ErrorNoDevice))
+	assert.False(t, IsDisconnect(newUSBError("write", gousb.ErrorTimeout)))
+	assert.False(t, IsDisconnect(errors.New("mystery")))
+	assert.False(t, IsDisconnect(nil))
+}
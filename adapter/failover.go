@@ -0,0 +1,359 @@
+package adapter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/nixxel-company-limited/escpos-usb-server/escpos"
+)
+
+// maxFailoverJobBytes caps the job a FailoverAdapter keeps for replaying on
+// the other printer
+const maxFailoverJobBytes = 1 << 20
+
+// FailoverPolicy decides when a FailoverAdapter returns to the primary
+// printer after failing over to the secondary
+type FailoverPolicy int
+
+const (
+	// FailoverSticky keeps printing on the secondary until it fails too
+	FailoverSticky FailoverPolicy = iota
+	// FailoverRevert returns to the primary once it can be reopened,
+	// checked before a write at most once per retry interval
+	FailoverRevert
+)
+
+// FailoverEvent describes a switch between the printers of a
+// FailoverAdapter
+type FailoverEvent struct {
+	// From and To are "primary" or "secondary"
+	From string
+	To   string
+	// Err is the error that caused the switch, nil when reverting to a
+	// recovered primary
+	Err error
+}
+
+// FailoverAdapter prints to a primary printer and switches to a secondary
+// one when the primary fails, for counters with two printers. A job is what
+// is written between calls to Flush, which the server makes at the end of
+// every job. The job is kept, up to 1 MiB, so a job that fails on one
+// printer is sent whole to the other; a larger job continues there from
+// the failed write after a reset (ESC @). Switching back to the primary
+// only happens between jobs. Flush, Reconnect and status queries go to the
+// active printer.
+type FailoverAdapter struct {
+	primary   Adapter
+	secondary Adapter
+	// active is the adapter jobs are written to
+	active Adapter
+	// job is the data written since the last Flush, nil once it outgrew
+	// maxFailoverJobBytes and jobTooLarge was set
+	job         []byte
+	jobTooLarge bool
+	policy      FailoverPolicy
+	retryEvery  time.Duration
+	failedAt    time.Time
+	onFailover  func(FailoverEvent)
+	mu          sync.Mutex
+}
+
+// NewFailoverAdapter returns an adapter writing to primary and failing over
+// to secondary. The policy defaults to FailoverSticky.
+func NewFailoverAdapter(primary, secondary Adapter) *FailoverAdapter {
+	return &FailoverAdapter{primary: primary, secondary: secondary, active: primary}
+}
+
+// SetPolicy sets the failback policy. With FailoverRevert, retry is the
+// minimum time between attempts to reopen the primary.
+func (a *FailoverAdapter) SetPolicy(policy FailoverPolicy, retry time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.policy = policy
+	a.retryEvery = retry
+}
+
+// OnFailover registers a callback invoked after every switch between the
+// printers. The callback must not call back into the adapter.
+func (a *FailoverAdapter) OnFailover(callback func(FailoverEvent)) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.onFailover = callback
+}
+
+// Active returns the adapter jobs are currently written to
+func (a *FailoverAdapter) Active() Adapter {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.active
+}
+
+// Open opens the primary printer, or the secondary if the primary cannot
+// be opened
+func (a *FailoverAdapter) Open() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.openLocked()
+}
+
+// OpenIfNeeded opens the printers like Open unless the active one is
+// already open, checking and opening atomically
+func (a *FailoverAdapter) OpenIfNeeded() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.active.IsOpen() {
+		return nil
+	}
+	return a.openLocked()
+}
+
+// openLocked implements Open. Callers must hold a.mu.
+func (a *FailoverAdapter) openLocked() error {
+	if err := openIfClosed(a.primary); err != nil {
+		log.Printf("Primary printer unavailable, trying secondary: %v", err)
+		if err2 := openIfClosed(a.secondary); err2 != nil {
+			return fmt.Errorf("failed to open primary (%v) and secondary printer: %w", err, err2)
+		}
+		a.switchTo(a.secondary, err)
+		return nil
+	}
+	a.active = a.primary
+	return nil
+}
+
+// Write sends data to the active printer. If that fails, the job so far,
+// ending with data, is written to the other printer, which becomes active.
+func (a *FailoverAdapter) Write(data []byte) (int, error) {
+	return a.WriteContext(context.Background(), data)
+}
+
+// WriteContext is Write, aborting the write when ctx is done. A write
+// aborted by ctx is not retried on the other printer.
+func (a *FailoverAdapter) WriteContext(ctx context.Context, data []byte) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.job == nil && !a.jobTooLarge {
+		a.maybeRevert()
+	}
+
+	n, err := WriteContext(ctx, a.active, data)
+	if err == nil {
+		a.keep(data)
+		return n, nil
+	}
+	if ctx.Err() != nil {
+		return n, err
+	}
+
+	log.Printf("%s printer write failed after %d bytes, failing over: %v", a.name(a.active), n, err)
+	if err := a.failOver(ctx, err, a.replay(data)); err != nil {
+		return n, err
+	}
+	a.keep(data)
+	return len(data), nil
+}
+
+// Flush flushes the active printer, if it buffers writes, and ends the
+// job. If the flush fails the job is written to the other printer and
+// flushed there.
+func (a *FailoverAdapter) Flush() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	err := flushIfBuffered(a.active)
+	if err != nil && a.job != nil {
+		log.Printf("%s printer flush failed, failing over: %v", a.name(a.active), err)
+		if err = a.failOver(context.Background(), err, a.job); err == nil {
+			err = flushIfBuffered(a.active)
+		}
+	}
+	a.job = nil
+	a.jobTooLarge = false
+	return err
+}
+
+// failOver switches to the other printer after cause and writes job to it.
+// Callers must hold a.mu.
+func (a *FailoverAdapter) failOver(ctx context.Context, cause error, job []byte) error {
+	other := a.other()
+	if err := openIfClosed(other); err != nil {
+		return fmt.Errorf("write failed (%w) and %s printer unavailable: %v", cause, a.name(other), err)
+	}
+	a.switchTo(other, cause)
+	_, err := WriteContext(ctx, other, job)
+	return err
+}
+
+// keep adds data to the job kept for replay. Callers must hold a.mu.
+func (a *FailoverAdapter) keep(data []byte) {
+	if a.jobTooLarge {
+		return
+	}
+	if len(a.job)+len(data) > maxFailoverJobBytes {
+		a.job = nil
+		a.jobTooLarge = true
+		return
+	}
+	a.job = append(a.job, data...)
+}
+
+// replay returns what to write to the other printer when writing data
+// failed: the job up to and including data, or data after a reset if the
+// job was too large to keep. Callers must hold a.mu.
+func (a *FailoverAdapter) replay(data []byte) []byte {
+	if a.jobTooLarge {
+		return append(escpos.Init(), data...)
+	}
+	return append(append([]byte(nil), a.job...), data...)
+}
+
+// flushIfBuffered flushes ad if it buffers writes
+func flushIfBuffered(ad Adapter) error {
+	if f, ok := ad.(Flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// Reconnect reconnects the active printer. It fails with
+// errors.ErrUnsupported if that printer cannot reconnect.
+func (a *FailoverAdapter) Reconnect() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	r, ok := a.active.(interface{ Reconnect() error })
+	if !ok {
+		return fmt.Errorf("reconnect: %w", errors.ErrUnsupported)
+	}
+	return r.Reconnect()
+}
+
+// QueryStatus sends DLE EOT n to the active printer and returns its reply.
+// It fails with errors.ErrUnsupported if that printer cannot report status.
+func (a *FailoverAdapter) QueryStatus(n byte) (byte, error) {
+	a.mu.Lock()
+	active := a.active
+	a.mu.Unlock()
+
+	q, ok := active.(interface{ QueryStatus(n byte) (byte, error) })
+	if !ok {
+		return 0, fmt.Errorf("query status: %w", errors.ErrUnsupported)
+	}
+	return q.QueryStatus(n)
+}
+
+// QueryPaperStatus queries the active printer's paper sensors (DLE EOT 4).
+// It fails with errors.ErrUnsupported if that printer cannot report status.
+func (a *FailoverAdapter) QueryPaperStatus() (byte, error) {
+	a.mu.Lock()
+	active := a.active
+	a.mu.Unlock()
+
+	q, ok := active.(interface{ QueryPaperStatus() (byte, error) })
+	if !ok {
+		return 0, fmt.Errorf("query paper status: %w", errors.ErrUnsupported)
+	}
+	return q.QueryPaperStatus()
+}
+
+// Read reads from the active printer
+func (a *FailoverAdapter) Read(buf []byte) (int, error) {
+	a.mu.Lock()
+	active := a.active
+	a.mu.Unlock()
+	return active.Read(buf)
+}
+
+// Close closes both printers
+func (a *FailoverAdapter) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var firstErr error
+	for _, ad := range []Adapter{a.primary, a.secondary} {
+		if !ad.IsOpen() {
+			continue
+		}
+		if err := ad.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	a.active = a.primary
+	a.job = nil
+	a.jobTooLarge = false
+	return firstErr
+}
+
+// IsOpen returns whether the active printer is open
+func (a *FailoverAdapter) IsOpen() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.active.IsOpen()
+}
+
+// maybeRevert switches back to the primary under FailoverRevert once the
+// retry interval has passed and it reopens. It is only called between jobs.
+// Callers must hold a.mu.
+func (a *FailoverAdapter) maybeRevert() {
+	if a.policy != FailoverRevert || a.active != a.secondary || time.Since(a.failedAt) < a.retryEvery {
+		return
+	}
+	a.failedAt = time.Now()
+
+	if a.primary.IsOpen() {
+		a.primary.Close()
+	}
+	if err := a.primary.Open(); err != nil {
+		return
+	}
+	a.switchTo(a.primary, nil)
+}
+
+// switchTo makes to the active adapter and notifies the callback. Callers
+// must hold a.mu.
+func (a *FailoverAdapter) switchTo(to Adapter, cause error) {
+	from := a.active
+	a.active = to
+	if to == a.secondary {
+		a.failedAt = time.Now()
+	}
+	if from == to {
+		return
+	}
+
+	event := FailoverEvent{From: a.name(from), To: a.name(to), Err: cause}
+	log.Printf("Switched from %s to %s printer", event.From, event.To)
+	if a.onFailover != nil {
+		a.onFailover(event)
+	}
+}
+
+// other returns the inactive adapter. Callers must hold a.mu.
+func (a *FailoverAdapter) other() Adapter {
+	if a.active == a.primary {
+		return a.secondary
+	}
+	return a.primary
+}
+
+// name labels one of the two adapters in logs and events
+func (a *FailoverAdapter) name(ad Adapter) string {
+	if ad == a.primary {
+		return "primary"
+	}
+	return "secondary"
+}
+
+// openIfClosed opens ad unless it is already open
+func openIfClosed(ad Adapter) error {
+	if ad.IsOpen() {
+		return nil
+	}
+	return ad.Open()
+}
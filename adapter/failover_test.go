@@ -0,0 +1,290 @@
+package adapter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nixxel-company-limited/escpos-usb-server/escpos"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errUnplugged = errors.New("printer unplugged")
+
+// switchableAdapter is an in-memory Adapter whose writes and opens can be
+// made to fail
+type switchableAdapter struct {
+	open      bool
+	openErr   error
+	writeErr  error
+	buf       bytes.Buffer
+	openCalls int
+}
+
+func (a *switchableAdapter) Open() error {
+	a.openCalls++
+	if a.openErr != nil {
+		return a.openErr
+	}
+	a.open = true
+	return nil
+}
+
+func (a *switchableAdapter) Write(data []byte) (int, error) {
+	if !a.open {
+		return 0, errors.New("not open")
+	}
+	if a.writeErr != nil {
+		return 0, a.writeErr
+	}
+	return a.buf.Write(data)
+}
+
+func (a *switchableAdapter) Read(buf []byte) (int, error) { return 0, ErrNoInEndpoint }
+
+func (a *switchableAdapter) Close() error {
+	a.open = false
+	return nil
+}
+
+func (a *switchableAdapter) IsOpen() bool { return a.open }
+
+func TestFailoverAdapterWritesToPrimary(t *testing.T) {
+	primary, secondary := &switchableAdapter{}, &switchableAdapter{}
+	a := NewFailoverAdapter(primary, secondary)
+	require.NoError(t, a.Open())
+
+	n, err := a.Write([]byte("receipt"))
+	require.NoError(t, err)
+	assert.Equal(t, 7, n)
+	assert.Equal(t, "receipt", primary.buf.String())
+	assert.False(t, secondary.IsOpen())
+	assert.Same(t, primary, a.Active())
+}
+
+func TestFailoverAdapterFailsOverOnWriteError(t *testing.T) {
+	primary, secondary := &switchableAdapter{}, &switchableAdapter{}
+	a := NewFailoverAdapter(primary, secondary)
+	var events []FailoverEvent
+	a.OnFailover(func(e FailoverEvent) { events = append(events, e) })
+	require.NoError(t, a.Open())
+
+	primary.writeErr = errUnplugged
+	n, err := a.Write([]byte("job 1"))
+	require.NoError(t, err)
+	assert.Equal(t, 5, n)
+	assert.Equal(t, "job 1", secondary.buf.String())
+	assert.Same(t, secondary, a.Active())
+
+	require.Len(t, events, 1)
+	assert.Equal(t, "primary", events[0].From)
+	assert.Equal(t, "secondary", events[0].To)
+	assert.ErrorIs(t, events[0].Err, errUnplugged)
+
+	// Sticky by default, even once the primary works again
+	primary.writeErr = nil
+	_, err = a.Write([]byte(", job 2"))
+	require.NoError(t, err)
+	assert.Equal(t, "job 1, job 2", secondary.buf.String())
+	assert.Empty(t, primary.buf.String())
+}
+
+func TestFailoverAdapterOpensSecondaryWhenPrimaryMissing(t *testing.T) {
+	primary := &switchableAdapter{openErr: errUnplugged}
+	secondary := &switchableAdapter{}
+	a := NewFailoverAdapter(primary, secondary)
+
+	require.NoError(t, a.Open())
+	assert.True(t, a.IsOpen())
+	assert.Same(t, secondary, a.Active())
+
+	secondary.openErr = errors.New("no device")
+	require.NoError(t, a.Close())
+	assert.Error(t, a.Open())
+}
+
+func TestFailoverAdapterBothFail(t *testing.T) {
+	primary := &switchableAdapter{writeErr: errUnplugged}
+	secondary := &switchableAdapter{openErr: errors.New("no device")}
+	a := NewFailoverAdapter(primary, secondary)
+	require.NoError(t, a.Open())
+
+	_, err := a.Write([]byte("job"))
+	assert.ErrorIs(t, err, errUnplugged)
+	assert.Same(t, primary, a.Active())
+}
+
+func TestFailoverAdapterRevertsToPrimary(t *testing.T) {
+	primary, secondary := &switchableAdapter{}, &switchableAdapter{}
+	a := NewFailoverAdapter(primary, secondary)
+	a.SetPolicy(FailoverRevert, 0)
+	var events []FailoverEvent
+	a.OnFailover(func(e FailoverEvent) { events = append(events, e) })
+	require.NoError(t, a.Open())
+
+	primary.writeErr = errUnplugged
+	_, err := a.Write([]byte("a"))
+	require.NoError(t, err)
+	assert.Equal(t, "a", secondary.buf.String())
+
+	// The primary is back, but the job in progress stays on the secondary
+	primary.writeErr = nil
+	_, err = a.Write([]byte("a"))
+	require.NoError(t, err)
+	assert.Equal(t, "aa", secondary.buf.String())
+
+	// The next job returns to the primary
+	require.NoError(t, a.Flush())
+	_, err = a.Write([]byte("b"))
+	require.NoError(t, err)
+	assert.Equal(t, "b", primary.buf.String())
+	assert.Same(t, primary, a.Active())
+
+	require.Len(t, events, 2)
+	assert.Equal(t, "primary", events[1].To)
+	assert.NoError(t, events[1].Err)
+}
+
+func TestFailoverAdapterRevertWaitsForRetryInterval(t *testing.T) {
+	primary, secondary := &switchableAdapter{}, &switchableAdapter{}
+	a := NewFailoverAdapter(primary, secondary)
+	a.SetPolicy(FailoverRevert, time.Hour)
+	require.NoError(t, a.Open())
+
+	primary.writeErr = errUnplugged
+	_, err := a.Write([]byte("a"))
+	require.NoError(t, err)
+	require.NoError(t, a.Flush())
+	opens := primary.openCalls
+
+	primary.writeErr = nil
+	_, err = a.Write([]byte("b"))
+	require.NoError(t, err)
+	assert.Equal(t, "ab", secondary.buf.String())
+	assert.Equal(t, opens, primary.openCalls)
+}
+
+// capableAdapter is a switchableAdapter that buffers writes, reconnects and
+// reports status
+type capableAdapter struct {
+	switchableAdapter
+	flushes    int
+	flushErr   error
+	reconnects int
+	status     byte
+}
+
+func (a *capableAdapter) Flush() error {
+	a.flushes++
+	return a.flushErr
+}
+
+func (a *capableAdapter) Reconnect() error {
+	a.reconnects++
+	return nil
+}
+
+func (a *capableAdapter) QueryStatus(n byte) (byte, error) { return a.status, nil }
+
+func TestFailoverAdapterDelegatesToActive(t *testing.T) {
+	primary, secondary := &capableAdapter{status: 0x12}, &capableAdapter{status: 0x16}
+	a := NewFailoverAdapter(primary, secondary)
+	require.NoError(t, a.OpenIfNeeded())
+	require.NoError(t, a.OpenIfNeeded())
+	assert.Equal(t, 1, primary.openCalls)
+
+	require.NoError(t, a.Flush())
+	require.NoError(t, a.Reconnect())
+	status, err := a.QueryStatus(StatusPrinter)
+	require.NoError(t, err)
+	assert.Equal(t, byte(0x12), status)
+	assert.Equal(t, 1, primary.flushes)
+	assert.Equal(t, 1, primary.reconnects)
+
+	primary.writeErr = errUnplugged
+	_, err = a.Write([]byte("job"))
+	require.NoError(t, err)
+
+	require.NoError(t, a.Flush())
+	require.NoError(t, a.Reconnect())
+	status, err = a.QueryStatus(StatusPrinter)
+	require.NoError(t, err)
+	assert.Equal(t, byte(0x16), status)
+	assert.Equal(t, 1, secondary.flushes)
+	assert.Equal(t, 1, secondary.reconnects)
+}
+
+func TestFailoverAdapterActiveLacksCapability(t *testing.T) {
+	a := NewFailoverAdapter(&switchableAdapter{}, &switchableAdapter{})
+	require.NoError(t, a.Open())
+
+	assert.NoError(t, a.Flush())
+	assert.ErrorIs(t, a.Reconnect(), errors.ErrUnsupported)
+	_, err := a.QueryStatus(StatusPrinter)
+	assert.ErrorIs(t, err, errors.ErrUnsupported)
+	_, err = a.QueryPaperStatus()
+	assert.ErrorIs(t, err, errors.ErrUnsupported)
+}
+
+func TestFailoverAdapterCancelledWriteStays(t *testing.T) {
+	primary, secondary := &switchableAdapter{}, &switchableAdapter{}
+	a := NewFailoverAdapter(primary, secondary)
+	require.NoError(t, a.Open())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := a.WriteContext(ctx, []byte("job"))
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Same(t, primary, a.Active())
+	assert.False(t, secondary.IsOpen())
+}
+
+func TestFailoverAdapterReplaysJobMidway(t *testing.T) {
+	primary, secondary := &switchableAdapter{}, &switchableAdapter{}
+	a := NewFailoverAdapter(primary, secondary)
+	require.NoError(t, a.Open())
+
+	// A finished job is not replayed
+	_, err := a.Write([]byte("old"))
+	require.NoError(t, err)
+	require.NoError(t, a.Flush())
+
+	// The job is streamed in pieces; the second one fails
+	_, err = a.Write([]byte("\x1b@head,"))
+	require.NoError(t, err)
+	primary.writeErr = errUnplugged
+	n, err := a.Write([]byte("tail"))
+	require.NoError(t, err)
+	assert.Equal(t, 4, n)
+	assert.Equal(t, "\x1b@head,tail", secondary.buf.String())
+}
+
+func TestFailoverAdapterLargeJobResets(t *testing.T) {
+	primary, secondary := &switchableAdapter{}, &switchableAdapter{}
+	a := NewFailoverAdapter(primary, secondary)
+	require.NoError(t, a.Open())
+
+	_, err := a.Write(make([]byte, maxFailoverJobBytes+1))
+	require.NoError(t, err)
+	primary.writeErr = errUnplugged
+	_, err = a.Write([]byte("tail"))
+	require.NoError(t, err)
+	assert.Equal(t, append(escpos.Init(), "tail"...), secondary.buf.Bytes())
+}
+
+func TestFailoverAdapterFlushFailureReplaysJob(t *testing.T) {
+	primary, secondary := &capableAdapter{}, &capableAdapter{}
+	a := NewFailoverAdapter(primary, secondary)
+	require.NoError(t, a.Open())
+
+	_, err := a.Write([]byte("job"))
+	require.NoError(t, err)
+	primary.flushErr = errUnplugged
+	require.NoError(t, a.Flush())
+	assert.Same(t, secondary, a.Active())
+	assert.Equal(t, "job", secondary.buf.String())
+	assert.Equal(t, 1, secondary.flushes)
+}
@@ -0,0 +1,108 @@
+package adapter
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/gousb"
+)
+
+// IfaceClassVendor is the class of vendor-specific interfaces, which some
+// printers expose instead of, or besides, a printer class interface
+const IfaceClassVendor = 0xff
+
+// ErrNoPrinterInterface is returned by Open when the device has no
+// interface it can print to. The error message lists the interfaces found.
+var ErrNoPrinterInterface = errors.New("no printer interface found")
+
+// AllowVendorInterface lets Open fall back to a vendor-specific interface
+// with an OUT endpoint when the device has no printer class interface, for
+// printers that only speak ESC/POS over a vendor interface. Auto-detection
+// still only finds printer class devices, so select such a printer by
+// VID/PID, serial or bus and address. Takes effect on the next Open.
+func (a *USBAdapter) AllowVendorInterface(enabled bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.allowVendor = enabled
+}
+
+// findPrinterInterface returns the interface setting to claim: the first
+// printer class one, or with allowVendor the first vendor-specific one with
+// an OUT endpoint. The setting carries the interface number and alternate
+// setting from the descriptor, which on composite devices need not match
+// the interface's position in the configuration.
+func findPrinterInterface(cfg gousb.ConfigDesc, allowVendor bool) (gousb.InterfaceSetting, error) {
+	for _, iface := range cfg.Interfaces {
+		for _, alt := range iface.AltSettings {
+			if alt.Class == IfaceClassPrinter {
+				return alt, nil
+			}
+		}
+	}
+
+	var vendor *gousb.InterfaceSetting
+	for _, iface := range cfg.Interfaces {
+		for _, alt := range iface.AltSettings {
+			if alt.Class == IfaceClassVendor && len(outEndpointDescs(alt.Endpoints)) > 0 {
+				vendor = &alt
+				break
+			}
+		}
+		if vendor != nil {
+			break
+		}
+	}
+	if vendor != nil && allowVendor {
+		return *vendor, nil
+	}
+
+	summary := describeInterfaces(cfg)
+	if summary == "" {
+		return gousb.InterfaceSetting{}, fmt.Errorf("%w: the device has no interfaces", ErrNoPrinterInterface)
+	}
+	if vendor != nil {
+		return gousb.InterfaceSetting{}, fmt.Errorf("%w; found interfaces: %s; use AllowVendorInterface (USB_ALLOW_VENDOR_INTERFACE) to print to interface %d",
+			ErrNoPrinterInterface, summary, vendor.Number)
+	}
+	return gousb.InterfaceSetting{}, fmt.Errorf("%w; found interfaces: %s", ErrNoPrinterInterface, summary)
+}
+
+// checkClaimedInterface verifies that the interface claimed is the one
+// chosen from the descriptor, so a backend that looked the interface up
+// by position rather than number cannot leave the adapter writing to, say,
+// a keyboard interface
+func checkClaimedInterface(want, got gousb.InterfaceSetting) error {
+	if got.Number != want.Number || got.Alternate != want.Alternate || got.Class != want.Class {
+		return fmt.Errorf("%w: claimed interface %d alt %d has class 0x%02x, expected interface %d alt %d with class 0x%02x",
+			ErrNoPrinterInterface, got.Number, got.Alternate, uint8(got.Class), want.Number, want.Alternate, uint8(want.Class))
+	}
+	return nil
+}
+
+// describeInterfaces summarizes the interfaces of cfg for an error message,
+// e.g. "interface 0 class 0xff with bulk OUT ep 0x01, bulk IN ep 0x82"
+func describeInterfaces(cfg gousb.ConfigDesc) string {
+	var parts []string
+	for _, iface := range cfg.Interfaces {
+		for _, alt := range iface.AltSettings {
+			part := fmt.Sprintf("interface %d", alt.Number)
+			if alt.Alternate != 0 {
+				part += fmt.Sprintf(" alt %d", alt.Alternate)
+			}
+			part += fmt.Sprintf(" class 0x%02x", uint8(alt.Class))
+
+			var endpoints []string
+			for _, ep := range sortedEndpoints(alt.Endpoints) {
+				endpoints = append(endpoints, fmt.Sprintf("%s %s ep 0x%02x", ep.TransferType, directionName(ep.Direction), uint8(ep.Address)))
+			}
+			if len(endpoints) > 0 {
+				part += " with " + strings.Join(endpoints, ", ")
+			} else {
+				part += " without endpoints"
+			}
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,113 @@
+package adapter
+
+import (
+	"testing"
+
+	"github.com/google/gousb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newFakeVendorPrinter returns a printer exposing ESC/POS only through a
+// vendor-specific interface
+func newFakeVendorPrinter() *fakeDevice {
+	dev := newFakePrinter("V1")
+	dev.config = newFakeConfig(gousb.InterfaceSetting{
+		Number: 0,
+		Class:  gousb.Class(IfaceClassVendor),
+		Endpoints: map[gousb.EndpointAddress]gousb.EndpointDesc{
+			0x01: {Address: 0x01, Number: 1, Direction: gousb.EndpointDirectionOut, MaxPacketSize: 64, TransferType: gousb.TransferTypeBulk},
+			0x82: {Address: 0x82, Number: 2, Direction: gousb.EndpointDirectionIn, MaxPacketSize: 64, TransferType: gousb.TransferTypeBulk},
+		},
+	})
+	return dev
+}
+
+func TestUSBAdapterNoPrinterInterfaceListsInterfaces(t *testing.T) {
+	adapter, _ := newFakeUSBAdapter(newFakeVendorPrinter())
+
+	err := adapter.Open()
+	require.ErrorIs(t, err, ErrNoPrinterInterface)
+	assert.Contains(t, err.Error(), "interface 0 class 0xff with bulk OUT ep 0x01, bulk IN ep 0x82")
+	assert.Contains(t, err.Error(), "AllowVendorInterface")
+	assert.False(t, adapter.IsOpen())
+}
+
+func TestUSBAdapterNoPrinterInterfaceWithoutVendorHint(t *testing.T) {
+	dev := newFakePrinter("H1")
+	dev.config = newFakeConfig(gousb.InterfaceSetting{
+		Number: 0,
+		Class:  gousb.Class(IfaceClassHID),
+		Endpoints: map[gousb.EndpointAddress]gousb.EndpointDesc{
+			0x81: {Address: 0x81, Number: 1, Direction: gousb.EndpointDirectionIn, MaxPacketSize: 8, TransferType: gousb.TransferTypeInterrupt},
+		},
+	})
+	adapter, _ := newFakeUSBAdapter(dev)
+
+	err := adapter.Open()
+	require.ErrorIs(t, err, ErrNoPrinterInterface)
+	assert.Contains(t, err.Error(), "interface 0 class 0x03 with interrupt IN ep 0x81")
+	assert.NotContains(t, err.Error(), "AllowVendorInterface")
+}
+
+func TestUSBAdapterAllowVendorInterface(t *testing.T) {
+	dev := newFakeVendorPrinter()
+	adapter, _ := newFakeUSBAdapter(dev)
+	adapter.AllowVendorInterface(true)
+
+	require.NoError(t, adapter.Open())
+	defer adapter.Close()
+
+	_, err := adapter.Write([]byte("receipt"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("receipt"), dev.config.interfaces[0].out[1].data())
+}
+
+// newFakeCompositePrinter returns a device with a HID interface numbered 0
+// and the printer interface numbered 3, the second in the configuration
+func newFakeCompositePrinter() *fakeDevice {
+	dev := newFakePrinter("C1")
+	dev.config = newFakeConfig(
+		gousb.InterfaceSetting{
+			Number: 0,
+			Class:  gousb.Class(IfaceClassHID),
+			Endpoints: map[gousb.EndpointAddress]gousb.EndpointDesc{
+				0x81: {Address: 0x81, Number: 1, Direction: gousb.EndpointDirectionIn, MaxPacketSize: 8, TransferType: gousb.TransferTypeInterrupt},
+			},
+		},
+		gousb.InterfaceSetting{
+			Number: 3,
+			Class:  gousb.Class(IfaceClassPrinter),
+			Endpoints: map[gousb.EndpointAddress]gousb.EndpointDesc{
+				0x02: {Address: 0x02, Number: 2, Direction: gousb.EndpointDirectionOut, MaxPacketSize: 64, TransferType: gousb.TransferTypeBulk},
+			},
+		},
+	)
+	return dev
+}
+
+func TestUSBAdapterClaimsNonContiguousInterfaceNumber(t *testing.T) {
+	dev := newFakeCompositePrinter()
+	adapter, _ := newFakeUSBAdapter(dev)
+
+	require.NoError(t, adapter.Open())
+	defer adapter.Close()
+
+	assert.Equal(t, []int{3}, dev.config.claimed)
+	_, err := adapter.Write([]byte("receipt"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("receipt"), dev.config.interfaces[3].out[2].data())
+}
+
+func TestUSBAdapterRejectsClaimOfWrongInterface(t *testing.T) {
+	dev := newFakeCompositePrinter()
+	// A backend indexing interfaces by position hands out the HID
+	// interface for number 3
+	dev.config.interfaces[3] = dev.config.interfaces[0]
+	adapter, _ := newFakeUSBAdapter(dev)
+
+	err := adapter.Open()
+	require.ErrorIs(t, err, ErrNoPrinterInterface)
+	assert.Contains(t, err.Error(), "claimed interface 0 alt 0 has class 0x03, expected interface 3 alt 0 with class 0x07")
+	assert.False(t, adapter.IsOpen())
+}
@@ -0,0 +1,78 @@
+package adapter
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+)
+
+// ErrLeaseReleased is returned by writes to a lease's writer after the
+// lease was released
+var ErrLeaseReleased = errors.New("adapter lease released")
+
+// Lease grants exclusive write access to the printer for a sequence of
+// commands that must not be interleaved with other jobs, e.g. init, an
+// image and a cut. Write the sequence to the returned writer and call
+// release when done. Until then Write, WriteContext and WriteTo block (or
+// fail when their context is done); real-time status queries still go
+// through. Lease waits for a write in progress and for an earlier lease to
+// be released.
+func (a *USBAdapter) Lease() (io.Writer, func(), error) {
+	a.lease <- struct{}{}
+
+	a.mu.Lock()
+	open := a.isOpen
+	a.mu.Unlock()
+	if !open {
+		<-a.lease
+		return nil, nil, errors.New("device not open")
+	}
+
+	w := &leaseWriter{a: a}
+	return w, w.release, nil
+}
+
+// acquireWrite waits until no lease is held, then holds the lease for one
+// write. The caller must call releaseWrite afterwards.
+func (a *USBAdapter) acquireWrite(ctx context.Context) error {
+	select {
+	case a.lease <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return newUSBError("write", ctx.Err())
+	}
+}
+
+func (a *USBAdapter) releaseWrite() {
+	<-a.lease
+}
+
+// leaseWriter writes to the adapter on behalf of a lease holder
+type leaseWriter struct {
+	a        *USBAdapter
+	mu       sync.Mutex
+	released bool
+}
+
+func (w *leaseWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.released {
+		return 0, ErrLeaseReleased
+	}
+	return w.a.writeTo(context.Background(), 0, data)
+}
+
+// release ends the lease; calling it again does nothing
+func (w *leaseWriter) release() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.released {
+		return
+	}
+	w.released = true
+	w.a.releaseWrite()
+}
@@ -0,0 +1,72 @@
+package adapter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUSBAdapterLeaseIsNotInterleaved(t *testing.T) {
+	dev := newFakePrinter("A")
+	adapter, _ := newFakeUSBAdapter(dev)
+	require.NoError(t, adapter.Open())
+	defer adapter.Close()
+
+	w, release, err := adapter.Lease()
+	require.NoError(t, err)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := adapter.Write([]byte("job"))
+		done <- err
+	}()
+
+	for _, part := range []string{"init", "image", "cut"} {
+		_, err := w.Write([]byte(part))
+		require.NoError(t, err)
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case <-done:
+		t.Fatal("write went through during the lease")
+	default:
+	}
+
+	release()
+	require.NoError(t, <-done)
+	assert.Equal(t, []byte("initimagecutjob"), dev.config.interfaces[0].out[1].data())
+
+	// The writer is unusable after release, and releasing twice is harmless
+	_, err = w.Write([]byte("late"))
+	assert.ErrorIs(t, err, ErrLeaseReleased)
+	release()
+	_, err = adapter.Write([]byte("!"))
+	assert.NoError(t, err)
+}
+
+func TestUSBAdapterWriteContextGivesUpOnLease(t *testing.T) {
+	dev := newFakePrinter("A")
+	adapter, _ := newFakeUSBAdapter(dev)
+	require.NoError(t, adapter.Open())
+	defer adapter.Close()
+
+	_, release, err := adapter.Lease()
+	require.NoError(t, err)
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = adapter.WriteContext(ctx, []byte("job"))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Empty(t, dev.config.interfaces[0].out[1].data())
+}
+
+func TestUSBAdapterLeaseClosed(t *testing.T) {
+	adapter, _ := newFakeUSBAdapter(newFakePrinter("A"))
+
+	_, _, err := adapter.Lease()
+	assert.Error(t, err)
+}
@@ -0,0 +1,63 @@
+package adapter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/google/gousb"
+)
+
+// overflowChunkPackets is the number of max-size packets per chunk when
+// re-sending data after an overflow
+const overflowChunkPackets = 8
+
+// haltClearer is implemented by OUT endpoints that can clear a halt/stall
+// condition. gousb does not expose clear-halt, so on real hardware recovery
+// goes straight to re-chunking.
+type haltClearer interface {
+	ClearHalt() error
+}
+
+// SetRecoverOverflow enables recovery from LIBUSB_ERROR_OVERFLOW in Write.
+// When enabled, the endpoint halt is cleared (where supported) and the
+// unwritten remainder is retried once in max-packet-size multiples.
+func (a *USBAdapter) SetRecoverOverflow(enabled bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.recoverOverflow = enabled
+}
+
+// isOverflow reports whether err is a USB babble/overflow error
+func isOverflow(err error) bool {
+	return errors.Is(err, gousb.ErrorOverflow) || errors.Is(err, gousb.TransferOverflow)
+}
+
+// retryAfterOverflow clears the endpoint halt and re-sends data in chunks
+// that are a multiple of the endpoint's max packet size. Callers must hold a.mu.
+func (a *USBAdapter) retryAfterOverflow(ctx context.Context, st outStation, data []byte) (int, error) {
+	if hc, ok := st.endpoint.(haltClearer); ok {
+		if err := hc.ClearHalt(); err != nil {
+			return 0, fmt.Errorf("clear halt failed: %w", err)
+		}
+	}
+
+	chunkSize := st.maxPacketSize * overflowChunkPackets
+	if chunkSize <= 0 {
+		chunkSize = len(data)
+	}
+
+	written := 0
+	for written < len(data) {
+		end := min(written+chunkSize, len(data))
+		n, err := st.endpoint.WriteContext(ctx, data[written:end])
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+
+	log.Printf("Recovered from USB overflow, re-sent %d bytes in %d byte chunks", written, chunkSize)
+	return written, nil
+}
@@ -0,0 +1,60 @@
+package adapter
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/google/gousb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUSBAdapterWriteOverflowRecovery(t *testing.T) {
+	dev := newFakePrinter("A")
+	a, _ := newFakeUSBAdapter(dev)
+	a.SetRecoverOverflow(true)
+	require.NoError(t, a.Open())
+	defer a.Close()
+
+	out := dev.config.interfaces[0].out[1]
+	out.errs = []error{gousb.ErrorOverflow}
+
+	// 64 byte packets, re-sent in chunks of 8 packets
+	data := bytes.Repeat([]byte{'x'}, 1200)
+	n, err := a.Write(data)
+	require.NoError(t, err)
+	assert.Equal(t, len(data), n)
+	assert.Equal(t, data, out.data())
+	assert.Equal(t, []int{512, 512, 176}, out.sizes)
+	assert.Equal(t, 1, out.halts)
+}
+
+func TestUSBAdapterWriteOverflowRetriedOnce(t *testing.T) {
+	dev := newFakePrinter("A")
+	a, _ := newFakeUSBAdapter(dev)
+	a.SetRecoverOverflow(true)
+	require.NoError(t, a.Open())
+	defer a.Close()
+
+	out := dev.config.interfaces[0].out[1]
+	out.errs = []error{gousb.ErrorOverflow, gousb.ErrorOverflow}
+
+	_, err := a.Write([]byte("hello"))
+	assert.ErrorIs(t, err, gousb.ErrorOverflow)
+	assert.Equal(t, 1, out.halts)
+}
+
+func TestUSBAdapterWriteOverflowNoRecovery(t *testing.T) {
+	dev := newFakePrinter("A")
+	a, _ := newFakeUSBAdapter(dev)
+	require.NoError(t, a.Open())
+	defer a.Close()
+
+	out := dev.config.interfaces[0].out[1]
+	out.errs = []error{gousb.TransferOverflow}
+
+	_, err := a.Write([]byte("hello"))
+	assert.ErrorIs(t, err, gousb.TransferOverflow)
+	assert.Empty(t, out.data())
+	assert.Zero(t, out.halts)
+}
@@ -0,0 +1,196 @@
+package adapter
+
+import (
+	"image"
+	"log"
+	"strings"
+
+	"github.com/nixxel-company-limited/escpos-usb-server/escpos"
+)
+
+// DefaultCharWidth is the font A line width assumed when the printer model
+// is unknown (80mm paper)
+const DefaultCharWidth = 48
+
+// DefaultDotWidth is the print head width in dots assumed when the printer
+// model is unknown (80mm paper at 203 dpi)
+const DefaultDotWidth = 576
+
+// ModelProfile describes the capabilities of a printer model
+type ModelProfile struct {
+	// Model is the model name prefix reported by GS I 67, e.g. "TM-T88"
+	Model string
+	// CharWidth is the number of font A characters per line
+	CharWidth int
+	// DotWidth is the printable width of the head in dots; zero means
+	// DefaultDotWidth
+	DotWidth int
+	// MaxBandHeight is the tallest raster band (GS v 0) the image buffer
+	// holds at full width; zero means escpos.DefaultMaxBandHeight
+	MaxBandHeight int
+	// CutCommand cuts the paper after a job; nil means escpos.Cut
+	CutCommand []byte
+	// BufferQuery is answered with the free receive buffer bytes as a two
+	// byte little-endian count; nil if the model cannot report them
+	BufferQuery []byte
+	// CodePageQuery is answered with the selected character code table,
+	// see escpos.ParseCodePageReply; nil if the model cannot report it
+	CodePageQuery []byte
+}
+
+// modelProfiles lists known models. More specific prefixes come first.
+var modelProfiles = []ModelProfile{
+	{Model: "TM-T88", CharWidth: 42, DotWidth: 512, CutCommand: escpos.FeedPartialCut(0)},
+	{Model: "TM-T20", CharWidth: 48, DotWidth: 576},
+	{Model: "TM-T82", CharWidth: 48, DotWidth: 576},
+	{Model: "TM-m30", CharWidth: 48, DotWidth: 576},
+	{Model: "TM-m10", CharWidth: 32, DotWidth: 384},
+	{Model: "TM-P20", CharWidth: 32, DotWidth: 384},
+	{Model: "TM-P60", CharWidth: 32, DotWidth: 384},
+	// The TM-U220 autocutter only makes partial cuts
+	{Model: "TM-U220", CharWidth: 33, CutCommand: escpos.PartialCut()},
+	{Model: "TSP100", CharWidth: 48, DotWidth: 576},
+	{Model: "mC-Print3", CharWidth: 48, DotWidth: 576},
+}
+
+// LookupProfile returns the profile of a model name as reported by the printer
+func LookupProfile(model string) (ModelProfile, bool) {
+	for _, profile := range modelProfiles {
+		if strings.HasPrefix(model, profile.Model) {
+			return profile, true
+		}
+	}
+	return ModelProfile{}, false
+}
+
+// SetCharWidth overrides the number of font A characters per line, e.g.
+// for 58mm paper in an 80mm printer. Zero restores auto-detection.
+func (a *USBAdapter) SetCharWidth(n int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.charWidth = n
+}
+
+// CharWidth returns the number of font A characters per line: the value
+// set with SetCharWidth, else the width from the detected model profile,
+// else DefaultCharWidth. Font B fits 4/3 as many (see escpos.Columns).
+func (a *USBAdapter) CharWidth() int {
+	a.mu.Lock()
+	width := a.charWidth
+	a.mu.Unlock()
+	if width > 0 {
+		return width
+	}
+
+	if profile, ok := a.Profile(); ok {
+		return profile.CharWidth
+	}
+	return DefaultCharWidth
+}
+
+// SetMaxBandHeight overrides the tallest raster band sent in one GS v 0
+// command, for printers that drop rows of large images. Zero restores the
+// model profile's value.
+func (a *USBAdapter) SetMaxBandHeight(n int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.maxBandHeight = n
+}
+
+// MaxBandHeight returns the band height to pass to
+// escpos.RasterImageBanded: the value set with SetMaxBandHeight, else the
+// detected model profile's, else escpos.DefaultMaxBandHeight
+func (a *USBAdapter) MaxBandHeight() int {
+	a.mu.Lock()
+	height := a.maxBandHeight
+	a.mu.Unlock()
+	if height > 0 {
+		return height
+	}
+
+	if profile, ok := a.Profile(); ok && profile.MaxBandHeight > 0 {
+		return profile.MaxBandHeight
+	}
+	return escpos.DefaultMaxBandHeight
+}
+
+// SetDotWidth overrides the print head width in dots, e.g. for 58mm paper
+// in an 80mm printer. Zero restores the model profile's value.
+func (a *USBAdapter) SetDotWidth(n int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.dotWidth = n
+}
+
+// DotWidth returns the print head width in dots: the value set with
+// SetDotWidth, else the detected model profile's, else DefaultDotWidth
+func (a *USBAdapter) DotWidth() int {
+	a.mu.Lock()
+	width := a.dotWidth
+	a.mu.Unlock()
+	if width > 0 {
+		return width
+	}
+
+	if profile, ok := a.Profile(); ok && profile.DotWidth > 0 {
+		return profile.DotWidth
+	}
+	return DefaultDotWidth
+}
+
+// CutCommand returns the bytes that cut the paper on this printer: the
+// detected model profile's cut command, else escpos.Cut. Like the other
+// profile lookups it detects the model only once per Open, even if the
+// printer does not answer.
+func (a *USBAdapter) CutCommand() []byte {
+	if profile, ok := a.Profile(); ok && profile.CutCommand != nil {
+		return append([]byte(nil), profile.CutCommand...)
+	}
+	return escpos.Cut()
+}
+
+// RasterImage encodes img for this printer with escpos.RasterImageBanded,
+// limited to DotWidth and split into bands of MaxBandHeight. Set
+// opts.FitWidth to scale an over-wide image down instead of failing with
+// escpos.ErrImageTooWide.
+func (a *USBAdapter) RasterImage(img image.Image, opts escpos.RasterOptions) ([]byte, error) {
+	if opts.MaxWidth == 0 {
+		opts.MaxWidth = a.DotWidth()
+	}
+	return escpos.RasterImageBanded(img, opts, a.MaxBandHeight())
+}
+
+// Profile detects the printer model with GS I 67 and returns its profile.
+// The result is cached until the device is reopened, including a failed
+// detection of an open printer, so a model that does not answer GS I is
+// not asked again, and made to wait out the reply timeout, on every use.
+func (a *USBAdapter) Profile() (ModelProfile, bool) {
+	a.mu.Lock()
+	if a.profileDetected {
+		profile, ok := a.profile, a.profileKnown
+		a.mu.Unlock()
+		return profile, ok
+	}
+	a.mu.Unlock()
+
+	model, err := a.ModelName()
+	if err != nil {
+		log.Printf("Cannot detect printer model: %v", err)
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		if a.isOpen {
+			a.profile, a.profileKnown, a.profileDetected = ModelProfile{}, false, true
+		}
+		return ModelProfile{}, false
+	}
+
+	profile, ok := LookupProfile(model)
+	if !ok {
+		log.Printf("No profile for printer model %q", model)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.profile, a.profileKnown, a.profileDetected = profile, ok, true
+	return profile, ok
+}
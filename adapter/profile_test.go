@@ -0,0 +1,190 @@
+package adapter
+
+import (
+	"image"
+	"testing"
+
+	"github.com/nixxel-company-limited/escpos-usb-server/escpos"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookupProfile(t *testing.T) {
+	profile, ok := LookupProfile("TM-T88V")
+	require.True(t, ok)
+	assert.Equal(t, 42, profile.CharWidth)
+
+	_, ok = LookupProfile("XP-58")
+	assert.False(t, ok)
+}
+
+func TestUSBAdapterCharWidthDetected(t *testing.T) {
+	testCases := []struct {
+		name  string
+		reply string
+		width int
+	}{
+		{"TM-T88", "_TM-T88VI\x00", 42},
+		{"TM-P20", "_TM-P20\x00", 32},
+		{"Unknown", "_XP-80C\x00", DefaultCharWidth},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dev := newFakePrinter("A")
+			adapter, _ := newFakeUSBAdapter(dev)
+			require.NoError(t, adapter.Open())
+			defer adapter.Close()
+
+			in := dev.config.interfaces[0].in[2]
+			in.responses = [][]byte{[]byte(tc.reply)}
+
+			assert.Equal(t, tc.width, adapter.CharWidth())
+			// Cached: the printer is asked only once
+			assert.Equal(t, tc.width, adapter.CharWidth())
+			assert.Equal(t, []byte{0x1D, 0x49, 0x43}, dev.config.interfaces[0].out[1].data())
+		})
+	}
+}
+
+func TestUSBAdapterSetCharWidth(t *testing.T) {
+	dev := newFakePrinter("A")
+	adapter, _ := newFakeUSBAdapter(dev)
+	require.NoError(t, adapter.Open())
+	defer adapter.Close()
+
+	adapter.SetCharWidth(32)
+	assert.Equal(t, 32, adapter.CharWidth())
+	// No detection query is sent when the width is configured
+	assert.Empty(t, dev.config.interfaces[0].out[1].data())
+}
+
+func TestUSBAdapterCharWidthClosed(t *testing.T) {
+	dev := newFakePrinter("A")
+	adapter, _ := newFakeUSBAdapter(dev)
+
+	assert.Equal(t, DefaultCharWidth, adapter.CharWidth())
+}
+
+func TestUSBAdapterMaxBandHeight(t *testing.T) {
+	dev := newFakePrinter("A")
+	adapter, _ := newFakeUSBAdapter(dev)
+	require.NoError(t, adapter.Open())
+	defer adapter.Close()
+
+	in := dev.config.interfaces[0].in[2]
+	in.responses = [][]byte{[]byte("_XP-80C\x00")}
+	assert.Equal(t, escpos.DefaultMaxBandHeight, adapter.MaxBandHeight())
+
+	adapter.SetMaxBandHeight(64)
+	assert.Equal(t, 64, adapter.MaxBandHeight())
+}
+
+func TestLookupProfileDotWidth(t *testing.T) {
+	testCases := []struct {
+		model string
+		width int
+	}{
+		{"TM-T88VI", 512},
+		{"TM-T20III", 576},
+		{"TM-m30II", 576},
+		{"TM-P20", 384},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.model, func(t *testing.T) {
+			profile, ok := LookupProfile(tc.model)
+			require.True(t, ok)
+			assert.Equal(t, tc.width, profile.DotWidth)
+		})
+	}
+}
+
+func TestUSBAdapterDotWidth(t *testing.T) {
+	testCases := []struct {
+		name  string
+		reply string
+		width int
+	}{
+		{"TM-T88", "_TM-T88V\x00", 512},
+		{"TM-U220 has no raster width", "_TM-U220\x00", DefaultDotWidth},
+		{"Unknown", "_XP-80C\x00", DefaultDotWidth},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dev := newFakePrinter("A")
+			adapter, _ := newFakeUSBAdapter(dev)
+			require.NoError(t, adapter.Open())
+			defer adapter.Close()
+
+			in := dev.config.interfaces[0].in[2]
+			in.responses = [][]byte{[]byte(tc.reply)}
+
+			assert.Equal(t, tc.width, adapter.DotWidth())
+		})
+	}
+}
+
+func TestUSBAdapterCutCommand(t *testing.T) {
+	testCases := []struct {
+		name  string
+		reply string
+		cut   []byte
+	}{
+		{"TM-T88", "_TM-T88V\x00", escpos.FeedPartialCut(0)},
+		{"TM-U220", "_TM-U220\x00", escpos.PartialCut()},
+		{"Star in ESC/POS emulation", "_TSP100\x00", escpos.Cut()},
+		{"Unknown", "_XP-80C\x00", escpos.Cut()},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dev := newFakePrinter("A")
+			adapter, _ := newFakeUSBAdapter(dev)
+			require.NoError(t, adapter.Open())
+			defer adapter.Close()
+
+			in := dev.config.interfaces[0].in[2]
+			in.responses = [][]byte{[]byte(tc.reply)}
+
+			assert.Equal(t, tc.cut, adapter.CutCommand())
+		})
+	}
+}
+
+func TestUSBAdapterCutCommandFailedDetectionCached(t *testing.T) {
+	dev := newFakePrinter("A")
+	adapter, _ := newFakeUSBAdapter(dev)
+	require.NoError(t, adapter.Open())
+	defer adapter.Close()
+
+	// The printer does not answer GS I with a model name
+	dev.config.interfaces[0].in[2].responses = [][]byte{[]byte("garbage\x00")}
+
+	assert.Equal(t, escpos.Cut(), adapter.CutCommand())
+	assert.Equal(t, escpos.Cut(), adapter.CutCommand())
+	assert.Equal(t, []byte("\x1dIC"), dev.config.interfaces[0].out[1].data(), "model asked once")
+}
+
+func TestUSBAdapterRasterImageDotWidth(t *testing.T) {
+	dev := newFakePrinter("A")
+	adapter, _ := newFakeUSBAdapter(dev)
+	require.NoError(t, adapter.Open())
+	defer adapter.Close()
+
+	in := dev.config.interfaces[0].in[2]
+	in.responses = [][]byte{[]byte("_TM-T88V\x00")}
+
+	img := image.NewGray(image.Rect(0, 0, 576, 4))
+	_, err := adapter.RasterImage(img, escpos.RasterOptions{})
+	assert.ErrorIs(t, err, escpos.ErrImageTooWide)
+
+	data, err := adapter.RasterImage(img, escpos.RasterOptions{FitWidth: true})
+	require.NoError(t, err)
+	// Scaled to the 512 dot head: 64 bytes wide, 3 rows
+	assert.Equal(t, []byte{0x1D, 'v', '0', 0, 64, 0, 3, 0}, data[:8])
+
+	adapter.SetDotWidth(384)
+	assert.Equal(t, 384, adapter.DotWidth())
+}
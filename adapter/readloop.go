@@ -0,0 +1,143 @@
+package adapter
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DefaultReadPollInterval is how often the read loop polls the IN endpoint
+// unless set with SetReadPollInterval
+const DefaultReadPollInterval = 100 * time.Millisecond
+
+// readPollTimeout bounds each poll of the read loop, during which writes
+// wait for the adapter
+const readPollTimeout = 10 * time.Millisecond
+
+// SetReadBufferSize sets the buffer size of status reads and of the read
+// loop. libusb fails a read that ends mid-packet with an overflow, so on an
+// open adapter n must be a multiple of the IN endpoint's max packet size;
+// a size set while closed is rounded up to one when the adapter is used.
+// Zero restores the default of 64 bytes.
+func (a *USBAdapter) SetReadBufferSize(n int) error {
+	if n < 0 {
+		return fmt.Errorf("invalid read buffer size %d", n)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if n > 0 && a.isOpen && a.inMaxPacket > 0 && n%a.inMaxPacket != 0 {
+		return fmt.Errorf("read buffer size %d is not a multiple of the IN endpoint's %d byte max packet size", n, a.inMaxPacket)
+	}
+	a.readBufferSize = n
+	return nil
+}
+
+// readBufSize returns the size of read buffers, rounded up to whole
+// packets of the IN endpoint. Callers must hold a.mu.
+func (a *USBAdapter) readBufSize() int {
+	n := a.readBufferSize
+	if n <= 0 {
+		n = statusReadSize
+	}
+	if p := a.inMaxPacket; p > 0 && n%p != 0 {
+		n += p - n%p
+	}
+	return n
+}
+
+// SetReadPollInterval sets how often the read loop polls the IN endpoint.
+// Shorter intervals deliver unsolicited status sooner at the cost of CPU
+// and of writes waiting for the poll. Zero restores
+// DefaultReadPollInterval. Takes effect on the next poll.
+func (a *USBAdapter) SetReadPollInterval(d time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.readPollInterval = d
+}
+
+// StartReadLoop polls the IN endpoint in the background and emits
+// EventRead with whatever the printer sends unprompted, e.g. automatic
+// status back. Status queries still get their replies, since the loop
+// never reads while a query holds the adapter. The loop runs until
+// StopReadLoop or Close.
+func (a *USBAdapter) StartReadLoop() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.stopReadLoop != nil {
+		return
+	}
+	stop := make(chan struct{})
+	a.stopReadLoop = stop
+	go a.readLoop(stop)
+}
+
+// StopReadLoop stops the loop started by StartReadLoop
+func (a *USBAdapter) StopReadLoop() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.stopReadLoopLocked()
+}
+
+// stopReadLoopLocked stops the read loop if it runs. Callers must hold
+// a.mu.
+func (a *USBAdapter) stopReadLoopLocked() {
+	if a.stopReadLoop != nil {
+		close(a.stopReadLoop)
+		a.stopReadLoop = nil
+	}
+}
+
+// readLoop polls the IN endpoint every read poll interval until stop is
+// closed
+func (a *USBAdapter) readLoop(stop <-chan struct{}) {
+	for {
+		a.mu.Lock()
+		interval := a.readPollInterval
+		a.mu.Unlock()
+		if interval <= 0 {
+			interval = DefaultReadPollInterval
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-a.after(interval):
+		}
+
+		a.pollIn(stop)
+	}
+}
+
+// pollIn reads once from the IN endpoint and emits what arrived, as
+// EventStatus for automatic status back packets and EventRead for the rest
+func (a *USBAdapter) pollIn(stop <-chan struct{}) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// StopReadLoop may have run while waiting for the lock
+	select {
+	case <-stop:
+		return
+	default:
+	}
+	if !a.isOpen || a.inEndpoint == nil {
+		return
+	}
+	// A process ID wait reads the responses itself
+	if a.awaitingResponse > 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), readPollTimeout)
+	defer cancel()
+
+	buf := make([]byte, a.readBufSize())
+	// A poll that times out with nothing read is the usual case
+	n, _ := a.readIn(ctx, buf)
+	if n > 0 {
+		a.emit(Event{Type: EventRead, Device: rawDevice(a.device), Data: buf[:n]})
+	}
+}
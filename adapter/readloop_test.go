@@ -0,0 +1,135 @@
+package adapter
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAfter stands in for time.After, recording the requested durations
+// and firing only when told to
+type fakeAfter struct {
+	mu        sync.Mutex
+	durations []time.Duration
+	fire      chan time.Time
+}
+
+func newFakeAfter() *fakeAfter {
+	return &fakeAfter{fire: make(chan time.Time)}
+}
+
+func (f *fakeAfter) After(d time.Duration) <-chan time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.durations = append(f.durations, d)
+	return f.fire
+}
+
+func (f *fakeAfter) Durations() []time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]time.Duration(nil), f.durations...)
+}
+
+func (in *fakeInEndpoint) BufSizes() []int {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	return append([]int(nil), in.bufSizes...)
+}
+
+func TestUSBAdapterReadBufferSize(t *testing.T) {
+	dev := newFakePrinter("A")
+	adapter, _ := newFakeUSBAdapter(dev)
+	defer adapter.Close()
+	require.NoError(t, adapter.Open())
+	in := dev.config.interfaces[0].in[2]
+
+	// The fake IN endpoint has 64 byte packets
+	assert.Error(t, adapter.SetReadBufferSize(100))
+	assert.Error(t, adapter.SetReadBufferSize(-1))
+	require.NoError(t, adapter.SetReadBufferSize(256))
+
+	in.responses = [][]byte{{0x12}}
+	_, err := adapter.QueryPaperStatus()
+	require.NoError(t, err)
+	assert.Equal(t, []int{256}, in.BufSizes())
+
+	require.NoError(t, adapter.SetReadBufferSize(0))
+	in.responses = [][]byte{{0x12}}
+	_, err = adapter.QueryPaperStatus()
+	require.NoError(t, err)
+	assert.Equal(t, []int{256, statusReadSize}, in.BufSizes())
+}
+
+func TestUSBAdapterReadBufferSizeRoundedOnOpen(t *testing.T) {
+	dev := newFakePrinter("A")
+	adapter, _ := newFakeUSBAdapter(dev)
+	defer adapter.Close()
+
+	// Unchecked while closed, then rounded up to whole packets
+	require.NoError(t, adapter.SetReadBufferSize(100))
+	require.NoError(t, adapter.Open())
+	in := dev.config.interfaces[0].in[2]
+
+	in.responses = [][]byte{{0x12}}
+	_, err := adapter.QueryPaperStatus()
+	require.NoError(t, err)
+	assert.Equal(t, []int{128}, in.BufSizes())
+}
+
+func TestUSBAdapterReadLoop(t *testing.T) {
+	dev := newFakePrinter("A")
+	adapter, _ := newFakeUSBAdapter(dev)
+	after := newFakeAfter()
+	adapter.after = after.After
+	adapter.SetReadPollInterval(250 * time.Millisecond)
+	require.NoError(t, adapter.Open())
+	defer adapter.Close()
+
+	reads := make(chan Event, 1)
+	adapter.On(EventRead, func(e Event) { reads <- e })
+
+	in := dev.config.interfaces[0].in[2]
+	in.mu.Lock()
+	in.responses = [][]byte{{0x10, 0x0f}}
+	in.mu.Unlock()
+
+	adapter.StartReadLoop()
+	defer adapter.StopReadLoop()
+
+	// Nothing is read until the poll interval passes
+	require.Eventually(t, func() bool { return len(after.Durations()) == 1 }, time.Second, time.Millisecond)
+	assert.Empty(t, in.BufSizes())
+	assert.Equal(t, 250*time.Millisecond, after.Durations()[0])
+
+	after.fire <- time.Now()
+	select {
+	case e := <-reads:
+		assert.Equal(t, []byte{0x10, 0x0f}, e.Data)
+	case <-time.After(time.Second):
+		t.Fatal("no read event")
+	}
+
+	// The next poll waits for the interval again
+	require.Eventually(t, func() bool { return len(after.Durations()) == 2 }, time.Second, time.Millisecond)
+	assert.Equal(t, 250*time.Millisecond, after.Durations()[1])
+}
+
+func TestUSBAdapterReadLoopStopsOnClose(t *testing.T) {
+	adapter, _ := newFakeUSBAdapter(newFakePrinter("A"))
+	after := newFakeAfter()
+	adapter.after = after.After
+	require.NoError(t, adapter.Open())
+
+	adapter.StartReadLoop()
+	require.Eventually(t, func() bool { return len(after.Durations()) == 1 }, time.Second, time.Millisecond)
+	assert.Equal(t, DefaultReadPollInterval, after.Durations()[0])
+
+	require.NoError(t, adapter.Close())
+	adapter.mu.Lock()
+	defer adapter.mu.Unlock()
+	assert.Nil(t, adapter.stopReadLoop)
+}
@@ -0,0 +1,104 @@
+package adapter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nixxel-company-limited/escpos-usb-server/escpos"
+)
+
+// Real-time requests (DLE ENQ n)
+const (
+	// RealtimeRecover recovers from a recoverable error and resumes
+	// printing from the line where the error occurred
+	RealtimeRecover byte = 1
+	// RealtimeRecoverAndClear recovers from an error after clearing the
+	// receive and print buffers
+	RealtimeRecoverAndClear byte = 2
+)
+
+// realtimeDrainTimeout bounds the wait for a reply to DLE ENQ. Most
+// printers send none.
+const realtimeDrainTimeout = 50 * time.Millisecond
+
+// RealtimeRequest sends DLE ENQ n, which the printer executes as soon as
+// it receives it, ahead of the data buffered before it, even while
+// offline. Unlike a reset (ESC @) it keeps the printer's settings. The
+// request goes out on the same endpoint as print data, and USB transfers
+// on an endpoint complete in order, so it waits for a write in progress to
+// finish or be cancelled; it cannot reach a printer whose receive buffer
+// is full while a transfer is stalled. Anything the printer sends back is
+// read and discarded so it is not taken for the reply to a later status
+// query.
+func (a *USBAdapter) RealtimeRequest(n byte) error {
+	if n != RealtimeRecover && n != RealtimeRecoverAndClear {
+		return fmt.Errorf("unknown real-time request %d", n)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !a.isOpen {
+		return errors.New("device not open")
+	}
+
+	if _, err := a.writeCommand([]byte{0x10, 0x05, n}); err != nil {
+		return fmt.Errorf("real-time request failed: %w", err)
+	}
+
+	if a.inEndpoint != nil {
+		a.drainIn(realtimeDrainTimeout)
+	}
+	return nil
+}
+
+// RecoverAndResume clears a recoverable error, such as an auto cutter
+// jam, and resumes printing where it stopped (DLE ENQ 1)
+func (a *USBAdapter) RecoverAndResume() error {
+	return a.RealtimeRequest(RealtimeRecover)
+}
+
+// RecoverAndClearBuffers clears a recoverable error and discards the data
+// the printer has buffered but not printed (DLE ENQ 2). This is the
+// recommended way to recover before resending the interrupted job.
+func (a *USBAdapter) RecoverAndClearBuffers() error {
+	return a.RealtimeRequest(RealtimeRecoverAndClear)
+}
+
+// ClearBuffer discards the data the printer has received but not printed,
+// such as the rest of an aborted job (DLE DC4 8). The printer's reply is
+// read and discarded so it is not taken for the reply to a later status
+// query.
+func (a *USBAdapter) ClearBuffer() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !a.isOpen {
+		return errors.New("device not open")
+	}
+
+	if _, err := a.writeCommand(escpos.ClearBuffer()); err != nil {
+		return fmt.Errorf("clear buffer request failed: %w", err)
+	}
+
+	if a.inEndpoint != nil {
+		a.drainIn(realtimeDrainTimeout)
+	}
+	return nil
+}
+
+// drainIn discards whatever arrives on the IN endpoint within timeout.
+// Callers must hold a.mu.
+func (a *USBAdapter) drainIn(timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	buf := make([]byte, a.readBufSize())
+	for {
+		if _, err := a.readIn(ctx, buf); err != nil {
+			return
+		}
+	}
+}
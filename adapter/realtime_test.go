@@ -0,0 +1,82 @@
+package adapter
+
+import (
+	"testing"
+
+	"github.com/google/gousb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRealtimeRequest(t *testing.T) {
+	dev := newFakePrinter("A")
+	adapter, _ := newFakeUSBAdapter(dev)
+	defer adapter.Close()
+
+	// Real-time requests need an open device
+	assert.Error(t, adapter.RecoverAndClearBuffers())
+
+	require.NoError(t, adapter.Open())
+	iface := dev.config.interfaces[0]
+
+	require.NoError(t, adapter.RecoverAndClearBuffers())
+	require.NoError(t, adapter.RecoverAndResume())
+	assert.Equal(t, []byte{0x10, 0x05, 0x02, 0x10, 0x05, 0x01}, iface.out[1].data())
+
+	assert.Error(t, adapter.RealtimeRequest(0))
+	assert.Error(t, adapter.RealtimeRequest(3))
+}
+
+func TestRealtimeRequestDiscardsReply(t *testing.T) {
+	dev := newFakePrinter("A")
+	adapter, _ := newFakeUSBAdapter(dev)
+	defer adapter.Close()
+	require.NoError(t, adapter.Open())
+
+	// A stray reply to DLE ENQ must not be read as the status byte
+	iface := dev.config.interfaces[0]
+	iface.in[2].responses = [][]byte{{0xAA}}
+	require.NoError(t, adapter.RecoverAndResume())
+
+	iface.in[2].responses = [][]byte{{0x12}}
+	status, err := adapter.QueryPaperStatus()
+	require.NoError(t, err)
+	assert.Equal(t, byte(0x12), status)
+}
+
+func TestRealtimeRequestNoInEndpoint(t *testing.T) {
+	dev := newFakePrinter("A")
+	iface := dev.config.interfaces[0]
+	for addr, ep := range iface.setting.Endpoints {
+		if ep.Direction == gousb.EndpointDirectionIn {
+			delete(iface.setting.Endpoints, addr)
+		}
+	}
+
+	adapter, _ := newFakeUSBAdapter(dev)
+	defer adapter.Close()
+	require.NoError(t, adapter.Open())
+
+	require.NoError(t, adapter.RecoverAndClearBuffers())
+	assert.Equal(t, []byte{0x10, 0x05, 0x02}, iface.out[1].data())
+}
+
+func TestUSBAdapterClearBufferDiscardsReply(t *testing.T) {
+	dev := newFakePrinter("A")
+	adapter, _ := newFakeUSBAdapter(dev)
+	defer adapter.Close()
+
+	assert.Error(t, adapter.ClearBuffer())
+	require.NoError(t, adapter.Open())
+
+	// The printer confirms the clear; the reply must not be read as status
+	iface := dev.config.interfaces[0]
+	iface.in[2].responses = [][]byte{{0x37, 0x25, 0x00}}
+	require.NoError(t, adapter.ClearBuffer())
+	assert.Equal(t, []byte{0x10, 0x14, 8, 1, 3, 20, 1, 6, 2, 8}, iface.out[1].data())
+
+	iface.in[2].responses = [][]byte{{0x12}}
+	status, err := adapter.QueryPaperStatus()
+	require.NoError(t, err)
+	assert.Equal(t, byte(0x12), status)
+}
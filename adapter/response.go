@@ -0,0 +1,134 @@
+package adapter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nixxel-company-limited/escpos-usb-server/escpos"
+)
+
+// ErrResponseTimeout is returned when the response to a process ID request
+// does not arrive in time
+var ErrResponseTimeout = errors.New("no response from printer")
+
+// RequestProcessID sends a process ID request (GS ( H) for id and waits up
+// to timeout for the printer's response, which it sends once it has
+// processed everything written before the request. Like AwaitProcessID it
+// does not hold the adapter while waiting.
+func (a *USBAdapter) RequestProcessID(id escpos.ProcessID, timeout time.Duration) error {
+	request, err := escpos.RequestProcessID(id)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	if err := a.checkReadable(); err != nil {
+		a.mu.Unlock()
+		return err
+	}
+	if _, err := a.writeCommand(request); err != nil {
+		a.mu.Unlock()
+		return fmt.Errorf("process ID request failed: %w", err)
+	}
+	a.awaitingResponse++
+	a.mu.Unlock()
+
+	return a.awaitProcessID(id, timeout)
+}
+
+// AwaitProcessID waits up to timeout for the response to a process ID
+// request for id that was already written, e.g. as part of a client's job.
+// Responses to other requests that arrive first are discarded. The adapter
+// is only held for each short read, so writes and status queries go on
+// while it waits; the read loop leaves the responses to it.
+func (a *USBAdapter) AwaitProcessID(id escpos.ProcessID, timeout time.Duration) error {
+	a.mu.Lock()
+	if err := a.checkReadable(); err != nil {
+		a.mu.Unlock()
+		return err
+	}
+	a.awaitingResponse++
+	a.mu.Unlock()
+
+	return a.awaitProcessID(id, timeout)
+}
+
+// checkReadable fails unless the adapter is open with an IN endpoint.
+// Callers must hold a.mu.
+func (a *USBAdapter) checkReadable() error {
+	if !a.isOpen {
+		return errors.New("device not open")
+	}
+	if a.inEndpoint == nil {
+		return ErrNoInEndpoint
+	}
+	return nil
+}
+
+// awaitProcessID reads NUL-terminated replies until the response for id
+// arrives or timeout passes, taking a.mu for one read poll at a time.
+// Callers must have incremented a.awaitingResponse, which it decrements.
+func (a *USBAdapter) awaitProcessID(id escpos.ProcessID, timeout time.Duration) error {
+	defer func() {
+		a.mu.Lock()
+		a.awaitingResponse--
+		a.mu.Unlock()
+	}()
+
+	response := escpos.ProcessIDResponse(id)
+	want := response[:len(response)-1]
+
+	var pending []byte
+	deadline := time.Now().Add(timeout)
+	for {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return fmt.Errorf("%w to process ID %q", ErrResponseTimeout, id[:])
+		}
+
+		data, err := a.pollResponse(min(remaining, readPollTimeout))
+		if err != nil {
+			return err
+		}
+		pending = append(pending, data...)
+		for {
+			i := bytes.IndexByte(pending, 0x00)
+			if i < 0 {
+				break
+			}
+			if bytes.HasSuffix(pending[:i], want) {
+				return nil
+			}
+			pending = pending[i+1:]
+		}
+
+		// Give writers waiting for the adapter their turn
+		if len(data) == 0 {
+			<-a.after(readPollTimeout)
+		}
+	}
+}
+
+// pollResponse reads what arrives on the IN endpoint within timeout. A
+// read that times out returns no data and no error.
+func (a *USBAdapter) pollResponse(timeout time.Duration) ([]byte, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.checkReadable(); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	buf := make([]byte, a.readBufSize())
+	n, err := a.readIn(ctx, buf)
+	if err != nil && ctx.Err() == nil {
+		return nil, fmt.Errorf("response read failed: %w", err)
+	}
+	return buf[:n], nil
+}
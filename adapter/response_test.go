@@ -0,0 +1,104 @@
+package adapter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nixxel-company-limited/escpos-usb-server/escpos"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUSBAdapterRequestProcessID(t *testing.T) {
+	dev := newFakePrinter("A")
+	adapter, _ := newFakeUSBAdapter(dev)
+	require.NoError(t, adapter.Open())
+	defer adapter.Close()
+
+	// The response to an earlier request arrives first and is skipped
+	in := dev.config.interfaces[0].in[2]
+	in.mu.Lock()
+	in.responses = [][]byte{
+		escpos.ProcessIDResponse(escpos.ProcessID{'0', '0', '0', '1'}),
+		escpos.ProcessIDResponse(escpos.ProcessID{'0', '0', '0', '2'}),
+	}
+	in.mu.Unlock()
+
+	id := escpos.ProcessID{'0', '0', '0', '2'}
+	require.NoError(t, adapter.RequestProcessID(id, time.Second))
+
+	request, err := escpos.RequestProcessID(id)
+	require.NoError(t, err)
+	assert.Equal(t, request, dev.config.interfaces[0].out[1].data())
+}
+
+func TestUSBAdapterAwaitProcessIDTimeout(t *testing.T) {
+	dev := newFakePrinter("A")
+	adapter, _ := newFakeUSBAdapter(dev)
+	require.NoError(t, adapter.Open())
+	defer adapter.Close()
+
+	in := dev.config.interfaces[0].in[2]
+	in.mu.Lock()
+	in.responses = [][]byte{escpos.ProcessIDResponse(escpos.ProcessID{'0', '0', '0', '1'})}
+	in.mu.Unlock()
+
+	err := adapter.AwaitProcessID(escpos.ProcessID{'0', '0', '0', '2'}, 20*time.Millisecond)
+	assert.ErrorIs(t, err, ErrResponseTimeout)
+}
+
+func TestUSBAdapterRequestProcessIDInvalid(t *testing.T) {
+	adapter, _ := newFakeUSBAdapter(newFakePrinter("A"))
+	require.NoError(t, adapter.Open())
+	defer adapter.Close()
+
+	assert.Error(t, adapter.RequestProcessID(escpos.ProcessID{0, 0, 0, 0}, time.Second))
+}
+
+func TestUSBAdapterAwaitProcessIDReleasesAdapter(t *testing.T) {
+	dev := newFakePrinter("A")
+	adapter, _ := newFakeUSBAdapter(dev)
+	require.NoError(t, adapter.Open())
+	defer adapter.Close()
+
+	reads := make(chan []byte, 4)
+	adapter.On(EventRead, func(e Event) { reads <- e.Data })
+	adapter.SetReadPollInterval(time.Millisecond)
+	adapter.StartReadLoop()
+	defer adapter.StopReadLoop()
+
+	id := escpos.ProcessID{'0', '0', '0', '1'}
+	done := make(chan error, 1)
+	go func() { done <- adapter.AwaitProcessID(id, 5*time.Second) }()
+
+	// A write goes through while the wait is on
+	written := make(chan error, 1)
+	go func() {
+		_, err := adapter.Write([]byte("job"))
+		written <- err
+	}()
+	select {
+	case err := <-written:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("write waited for the process ID response")
+	}
+
+	// The response goes to the wait, not to the read loop
+	in := dev.config.interfaces[0].in[2]
+	in.mu.Lock()
+	in.responses = [][]byte{escpos.ProcessIDResponse(id)}
+	in.mu.Unlock()
+
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("response not seen")
+	}
+	select {
+	case data := <-reads:
+		t.Fatalf("read loop took %q", data)
+	default:
+	}
+}
@@ -0,0 +1,37 @@
+package adapter
+
+import (
+	"log"
+	"time"
+)
+
+// SetSlowWriteThreshold makes writes that take longer than d count as slow:
+// each is logged, counted in SlowWrites and reported as EventSlowWrite, an
+// early sign of a printer that is struggling, e.g. with a full buffer or a
+// slow mechanism, before writes start failing. The latency covers a whole
+// Write, including flow control waits, so d should allow for the largest
+// jobs sent in one write. Zero, the default, disables the check.
+func (a *USBAdapter) SetSlowWriteThreshold(d time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.slowWriteThreshold = d
+}
+
+// SlowWrites returns how many writes exceeded the slow write threshold
+// since the adapter was created. It does not wait for a write in progress,
+// so metrics can be read while the printer is stuck.
+func (a *USBAdapter) SlowWrites() uint64 {
+	return a.slowWrites.Load()
+}
+
+// checkWriteLatency reports a write of size bytes that took elapsed if it
+// exceeded the slow write threshold. Callers must hold a.mu.
+func (a *USBAdapter) checkWriteLatency(size int, elapsed time.Duration) {
+	if a.slowWriteThreshold <= 0 || elapsed <= a.slowWriteThreshold {
+		return
+	}
+
+	a.slowWrites.Add(1)
+	log.Printf("Slow write: %d bytes took %v (threshold %v)", size, elapsed, a.slowWriteThreshold)
+	a.emit(Event{Type: EventSlowWrite, Device: rawDevice(a.device), Duration: elapsed})
+}
@@ -0,0 +1,86 @@
+package adapter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUSBAdapterSlowWrite(t *testing.T) {
+	dev := newFakePrinter("A")
+	adapter, _ := newFakeUSBAdapter(dev)
+	adapter.SetSlowWriteThreshold(10 * time.Millisecond)
+	require.NoError(t, adapter.Open())
+	defer adapter.Close()
+
+	slow := make(chan Event, 2)
+	adapter.On(EventSlowWrite, func(e Event) { slow <- e })
+
+	// A fast write is not reported
+	_, err := adapter.Write([]byte("fast"))
+	require.NoError(t, err)
+	assert.Zero(t, adapter.SlowWrites())
+
+	ep := dev.config.interfaces[0].out[1]
+	ep.mu.Lock()
+	ep.delay = 30 * time.Millisecond
+	ep.mu.Unlock()
+
+	_, err = adapter.Write([]byte("slow"))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), adapter.SlowWrites())
+
+	select {
+	case e := <-slow:
+		assert.GreaterOrEqual(t, e.Duration, 30*time.Millisecond)
+	case <-time.After(time.Second):
+		t.Fatal("no slow write event")
+	}
+}
+
+func TestUSBAdapterSlowWriteDisabled(t *testing.T) {
+	dev := newFakePrinter("A")
+	adapter, _ := newFakeUSBAdapter(dev)
+	require.NoError(t, adapter.Open())
+	defer adapter.Close()
+
+	ep := dev.config.interfaces[0].out[1]
+	ep.mu.Lock()
+	ep.delay = 20 * time.Millisecond
+	ep.mu.Unlock()
+
+	_, err := adapter.Write([]byte("slow"))
+	require.NoError(t, err)
+	assert.Zero(t, adapter.SlowWrites())
+}
+
+func TestUSBAdapterSlowWritesDuringStalledWrite(t *testing.T) {
+	dev := newFakePrinter("A")
+	adapter, _ := newFakeUSBAdapter(dev)
+	adapter.SetSlowWriteThreshold(10 * time.Millisecond)
+	require.NoError(t, adapter.Open())
+	defer adapter.Close()
+
+	ep := dev.config.interfaces[0].out[1]
+	ep.mu.Lock()
+	ep.stall = true
+	ep.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go adapter.WriteContext(ctx, []byte("stuck"))
+	time.Sleep(20 * time.Millisecond)
+
+	// Reading the counter does not wait for the stuck write
+	read := make(chan uint64)
+	go func() { read <- adapter.SlowWrites() }()
+	select {
+	case n := <-read:
+		assert.Zero(t, n)
+	case <-time.After(time.Second):
+		t.Fatal("SlowWrites blocked behind a write")
+	}
+}
@@ -0,0 +1,40 @@
+package adapter
+
+import (
+	"log"
+
+	"github.com/google/gousb"
+)
+
+// slowLinkJobBytes is the write size above which a printer on a full-speed
+// (12 Mbit/s) or low-speed link triggers a warning
+const slowLinkJobBytes = 64 << 10
+
+// Speed returns the USB speed the printer is connected at, or
+// gousb.SpeedUnknown when no device is selected
+func (a *USBAdapter) Speed() gousb.Speed {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.speed()
+}
+
+// speed returns the selected device's speed. Callers must hold a.mu.
+func (a *USBAdapter) speed() gousb.Speed {
+	if a.device == nil || a.device.Desc() == nil {
+		return gousb.SpeedUnknown
+	}
+	return a.device.Desc().Speed
+}
+
+// warnSlowLink logs, once per Open, that a large write is going to a
+// printer on a full-speed or low-speed link. Callers must hold a.mu.
+func (a *USBAdapter) warnSlowLink(size int) {
+	if size < slowLinkJobBytes || a.slowLinkWarned {
+		return
+	}
+	switch speed := a.speed(); speed {
+	case gousb.SpeedLow, gousb.SpeedFull:
+		log.Printf("Sending %d bytes to a %s-speed USB printer; large rasters will print slowly, consider storing logos in NV memory", size, speed)
+		a.slowLinkWarned = true
+	}
+}
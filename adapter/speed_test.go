@@ -0,0 +1,50 @@
+package adapter
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/google/gousb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUSBAdapterSpeed(t *testing.T) {
+	dev := newFakePrinter("A")
+	dev.desc.Speed = gousb.SpeedHigh
+	a, _ := newFakeUSBAdapter(dev)
+
+	assert.Equal(t, gousb.SpeedHigh, a.Speed())
+
+	dev.desc.Speed = gousb.SpeedFull
+	assert.Equal(t, gousb.SpeedFull, a.Speed())
+}
+
+func TestUSBAdapterSpeedNoDevice(t *testing.T) {
+	a, _ := newFakeUSBAdapter()
+	assert.Equal(t, gousb.SpeedUnknown, a.Speed())
+}
+
+func TestUSBAdapterWarnsLargeJobOnFullSpeed(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	dev := newFakePrinter("A")
+	dev.desc.Speed = gousb.SpeedFull
+	a, _ := newFakeUSBAdapter(dev)
+	require.NoError(t, a.Open())
+	defer a.Close()
+
+	_, err := a.Write(make([]byte, 1024))
+	require.NoError(t, err)
+	assert.NotContains(t, logs.String(), "full-speed")
+
+	_, err = a.Write(make([]byte, slowLinkJobBytes))
+	require.NoError(t, err)
+	_, err = a.Write(make([]byte, slowLinkJobBytes))
+	require.NoError(t, err)
+	assert.Equal(t, 1, bytes.Count(logs.Bytes(), []byte("full-speed USB printer")))
+}
@@ -0,0 +1,173 @@
+package adapter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nixxel-company-limited/escpos-usb-server/escpos"
+)
+
+// Real-time status requests (DLE EOT n)
+const (
+	StatusPrinter byte = 1
+	StatusOffline byte = 2
+	StatusError   byte = 3
+	StatusPaper   byte = 4
+)
+
+// statusParsers decodes the reply to each status request
+var statusParsers = map[byte]func(byte) escpos.Status{
+	StatusPrinter: escpos.ParsePrinterStatus,
+	StatusOffline: escpos.ParseOfflineStatus,
+	StatusError:   escpos.ParseErrorStatus,
+	StatusPaper:   escpos.ParsePaperStatus,
+}
+
+// statusTimeout bounds how long a status query waits for the printer's reply
+const statusTimeout = time.Second
+
+// statusReadSize is the default buffer size of status replies, see
+// SetReadBufferSize. It is at least one full packet of a full speed
+// endpoint so short replies never overflow the transfer.
+const statusReadSize = 64
+
+// QueryStatus sends DLE EOT n and returns the printer's one byte reply
+func (a *USBAdapter) QueryStatus(n byte) (byte, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !a.isOpen {
+		return 0, errors.New("device not open")
+	}
+
+	if a.inEndpoint == nil {
+		return 0, ErrNoInEndpoint
+	}
+
+	return a.queryStatus(n)
+}
+
+// queryStatus implements QueryStatus. Callers must hold a.mu.
+func (a *USBAdapter) queryStatus(n byte) (byte, error) {
+	if _, err := a.writeCommand([]byte{0x10, 0x04, n}); err != nil {
+		return 0, fmt.Errorf("status request failed: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), statusTimeout)
+	defer cancel()
+
+	buf := make([]byte, a.readBufSize())
+	read, err := a.readIn(ctx, buf)
+	if err != nil {
+		return 0, fmt.Errorf("status read failed: %w", err)
+	}
+	if read == 0 {
+		return 0, errors.New("empty status response")
+	}
+
+	return buf[0], nil
+}
+
+// QueryPaperStatus returns the paper roll sensor status (DLE EOT 4)
+func (a *USBAdapter) QueryPaperStatus() (byte, error) {
+	return a.QueryStatus(StatusPaper)
+}
+
+// ReadStatus sends DLE EOT n for one of the Status* requests and returns
+// the decoded reply
+func (a *USBAdapter) ReadStatus(n byte) (escpos.Status, error) {
+	parse, ok := statusParsers[n]
+	if !ok {
+		return escpos.Status{}, fmt.Errorf("unknown status request %d", n)
+	}
+
+	b, err := a.QueryStatus(n)
+	if err != nil {
+		return escpos.Status{}, err
+	}
+	return parse(b), nil
+}
+
+// Printer information requests (GS I n), answered with a NUL terminated
+// "_<text>" block
+const (
+	InfoFirmware     byte = 65
+	InfoManufacturer byte = 66
+	InfoModelName    byte = 67
+	InfoSerialNumber byte = 68
+)
+
+// ReadStatusUntil accumulates bytes from the IN endpoint until terminator
+// arrives or timeout expires, for replies that are not fixed length. The
+// terminator is not included in the result. On timeout the bytes read so
+// far are returned with the error.
+func (a *USBAdapter) ReadStatusUntil(terminator byte, timeout time.Duration) ([]byte, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !a.isOpen {
+		return nil, errors.New("device not open")
+	}
+
+	if a.inEndpoint == nil {
+		return nil, ErrNoInEndpoint
+	}
+
+	return a.readUntil(terminator, timeout)
+}
+
+// readUntil implements ReadStatusUntil. Callers must hold a.mu.
+func (a *USBAdapter) readUntil(terminator byte, timeout time.Duration) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var out []byte
+	buf := make([]byte, a.readBufSize())
+	for {
+		n, err := a.readIn(ctx, buf)
+		if i := bytes.IndexByte(buf[:n], terminator); i >= 0 {
+			return append(out, buf[:i]...), nil
+		}
+		out = append(out, buf[:n]...)
+		if err != nil {
+			return out, fmt.Errorf("status read failed after %d bytes: %w", len(out), err)
+		}
+	}
+}
+
+// QueryPrinterInfo sends GS I n for one of the Info* types and returns the
+// printer's text reply, e.g. the model name for InfoModelName
+func (a *USBAdapter) QueryPrinterInfo(n byte) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !a.isOpen {
+		return "", errors.New("device not open")
+	}
+
+	if a.inEndpoint == nil {
+		return "", ErrNoInEndpoint
+	}
+
+	if _, err := a.writeCommand([]byte{0x1D, 'I', n}); err != nil {
+		return "", fmt.Errorf("info request failed: %w", err)
+	}
+
+	reply, err := a.readUntil(0x00, statusTimeout)
+	if err != nil {
+		return "", err
+	}
+	if len(reply) == 0 || reply[0] != '_' {
+		return "", fmt.Errorf("unexpected info response % x", reply)
+	}
+
+	return string(reply[1:]), nil
+}
+
+// ModelName returns the printer's model name (GS I 67)
+func (a *USBAdapter) ModelName() (string, error) {
+	return a.QueryPrinterInfo(InfoModelName)
+}
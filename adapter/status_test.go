@@ -0,0 +1,125 @@
+package adapter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/gousb"
+	"github.com/nixxel-company-limited/escpos-usb-server/escpos"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryPaperStatus(t *testing.T) {
+	dev := newFakePrinter("A")
+	adapter, _ := newFakeUSBAdapter(dev)
+	defer adapter.Close()
+
+	// Status queries need an open device
+	_, err := adapter.QueryPaperStatus()
+	assert.Error(t, err)
+
+	require.NoError(t, adapter.Open())
+
+	iface := dev.config.interfaces[0]
+	iface.in[2].responses = [][]byte{{0x12}}
+
+	status, err := adapter.QueryPaperStatus()
+	require.NoError(t, err)
+	assert.Equal(t, byte(0x12), status)
+	assert.Equal(t, []byte{0x10, 0x04, 0x04}, iface.out[1].data())
+}
+
+func TestReadStatus(t *testing.T) {
+	dev := newFakePrinter("A")
+	adapter, _ := newFakeUSBAdapter(dev)
+	defer adapter.Close()
+	require.NoError(t, adapter.Open())
+
+	iface := dev.config.interfaces[0]
+	iface.in[2].responses = [][]byte{{0x16}}
+
+	status, err := adapter.ReadStatus(StatusOffline)
+	require.NoError(t, err)
+	assert.Equal(t, escpos.Status{CoverOpen: true}, status)
+	assert.Equal(t, []byte{0x10, 0x04, 0x02}, iface.out[1].data())
+
+	_, err = adapter.ReadStatus(9)
+	assert.Error(t, err)
+}
+
+func TestQueryStatusNoInEndpoint(t *testing.T) {
+	dev := newFakePrinter("A")
+	iface := dev.config.interfaces[0]
+	for addr, ep := range iface.setting.Endpoints {
+		if ep.Direction == gousb.EndpointDirectionIn {
+			delete(iface.setting.Endpoints, addr)
+		}
+	}
+
+	adapter, _ := newFakeUSBAdapter(dev)
+	defer adapter.Close()
+	require.NoError(t, adapter.Open())
+
+	_, err := adapter.QueryPaperStatus()
+	assert.ErrorIs(t, err, ErrNoInEndpoint)
+	assert.Empty(t, iface.out[1].data())
+}
+
+func TestReadStatusUntilFragments(t *testing.T) {
+	dev := newFakePrinter("A")
+	adapter, _ := newFakeUSBAdapter(dev)
+	require.NoError(t, adapter.Open())
+	defer adapter.Close()
+
+	// The reply arrives split across packets, with trailing bytes after
+	// the terminator in the last one
+	dev.config.interfaces[0].in[2].responses = [][]byte{
+		[]byte("_TM-"), []byte("T88"), []byte("V\x00junk"),
+	}
+
+	reply, err := adapter.ReadStatusUntil(0x00, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("_TM-T88V"), reply)
+}
+
+func TestReadStatusUntilTimeout(t *testing.T) {
+	dev := newFakePrinter("A")
+	adapter, _ := newFakeUSBAdapter(dev)
+	require.NoError(t, adapter.Open())
+	defer adapter.Close()
+
+	dev.config.interfaces[0].in[2].responses = [][]byte{[]byte("_TM")}
+
+	reply, err := adapter.ReadStatusUntil(0x00, 50*time.Millisecond)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, []byte("_TM"), reply)
+}
+
+func TestModelName(t *testing.T) {
+	dev := newFakePrinter("A")
+	adapter, _ := newFakeUSBAdapter(dev)
+	require.NoError(t, adapter.Open())
+	defer adapter.Close()
+
+	iface := dev.config.interfaces[0]
+	iface.in[2].responses = [][]byte{[]byte("_TM-T20"), []byte("II\x00")}
+
+	name, err := adapter.ModelName()
+	require.NoError(t, err)
+	assert.Equal(t, "TM-T20II", name)
+	assert.Equal(t, []byte{0x1D, 0x49, 0x43}, iface.out[1].data())
+}
+
+func TestModelNameUnexpectedResponse(t *testing.T) {
+	dev := newFakePrinter("A")
+	adapter, _ := newFakeUSBAdapter(dev)
+	require.NoError(t, adapter.Open())
+	defer adapter.Close()
+
+	dev.config.interfaces[0].in[2].responses = [][]byte{{0x12, 0x00}}
+
+	_, err := adapter.ModelName()
+	assert.Error(t, err)
+}
@@ -0,0 +1,118 @@
+package adapter
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/google/gousb"
+)
+
+// DescribeTopology returns a human readable dump of the printer's USB
+// descriptors: every configuration, interface, alternate setting and
+// endpoint, marking the ones the adapter claimed and writes to. It is the
+// first thing to look at when writes succeed but nothing prints.
+func (a *USBAdapter) DescribeTopology() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.device == nil {
+		return "No device selected\n"
+	}
+
+	var b strings.Builder
+	desc := a.device.Desc()
+	fmt.Fprintf(&b, "Device %s:%s on bus %03d address %03d", desc.Vendor, desc.Product, desc.Bus, desc.Address)
+	if speed := desc.Speed.String(); speed != "" && desc.Speed != gousb.SpeedUnknown {
+		fmt.Fprintf(&b, ", %s speed", speed)
+	}
+	b.WriteString("\n")
+	if product, err := readDescriptor(a.device, a.device.Product); err == nil && product != "" {
+		fmt.Fprintf(&b, "  Product %q\n", product)
+	}
+	if serial, err := readDescriptor(a.device, a.device.SerialNumber); err == nil && serial != "" {
+		fmt.Fprintf(&b, "  Serial %q\n", serial)
+	}
+	if !a.isOpen {
+		b.WriteString("  Not open, no interface claimed\n")
+	}
+
+	// The claimed configuration's descriptor is authoritative; the device
+	// descriptor lists the others
+	configs := make(map[int]gousb.ConfigDesc)
+	maps.Copy(configs, desc.Configs)
+	claimedConfig := -1
+	if a.isOpen && a.config != nil {
+		cfg := a.config.Desc()
+		configs[cfg.Number] = cfg
+		claimedConfig = cfg.Number
+	}
+
+	claimedIface, claimedAlt := -1, -1
+	if a.isOpen && a.iface != nil {
+		setting := a.iface.Setting()
+		claimedIface, claimedAlt = setting.Number, setting.Alternate
+	}
+
+	for _, num := range slices.Sorted(maps.Keys(configs)) {
+		cfg := configs[num]
+		fmt.Fprintf(&b, "  Configuration %d%s\n", num, marker(num == claimedConfig, "active"))
+		for _, iface := range cfg.Interfaces {
+			for _, alt := range iface.AltSettings {
+				claimed := num == claimedConfig && alt.Number == claimedIface && alt.Alternate == claimedAlt
+				fmt.Fprintf(&b, "    Interface %d alt %d: class %s, subclass %d, protocol %s%s\n",
+					alt.Number, alt.Alternate, alt.Class, alt.SubClass, alt.Protocol, marker(claimed, "claimed"))
+				for _, ep := range sortedEndpoints(alt.Endpoints) {
+					fmt.Fprintf(&b, "      Endpoint %d %s %s, max packet %d%s\n",
+						ep.Number, directionName(ep.Direction), ep.TransferType, ep.MaxPacketSize, a.endpointRole(claimed, ep))
+				}
+			}
+		}
+	}
+	return b.String()
+}
+
+// endpointRole describes how the adapter uses an endpoint of the claimed
+// interface. Callers must hold a.mu.
+func (a *USBAdapter) endpointRole(claimed bool, ep gousb.EndpointDesc) string {
+	if !claimed {
+		return ""
+	}
+	if ep.Direction == gousb.EndpointDirectionIn {
+		return marker(a.inEndpoint != nil && ep.Number == a.inEndpointNum, "selected for status")
+	}
+	for i, st := range a.outs {
+		if st.number == ep.Number {
+			if i == 0 {
+				return " (selected for printing)"
+			}
+			return fmt.Sprintf(" (station %d)", i)
+		}
+	}
+	return ""
+}
+
+// sortedEndpoints returns endpoints in address order
+func sortedEndpoints(endpoints map[gousb.EndpointAddress]gousb.EndpointDesc) []gousb.EndpointDesc {
+	var out []gousb.EndpointDesc
+	for _, addr := range slices.Sorted(maps.Keys(endpoints)) {
+		out = append(out, endpoints[addr])
+	}
+	return out
+}
+
+func directionName(d gousb.EndpointDirection) string {
+	if d == gousb.EndpointDirectionIn {
+		return "IN"
+	}
+	return "OUT"
+}
+
+// marker returns " (label)" if set, else nothing
+func marker(set bool, label string) string {
+	if !set {
+		return ""
+	}
+	return " (" + label + ")"
+}
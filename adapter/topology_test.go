@@ -0,0 +1,47 @@
+package adapter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDescribeTopology(t *testing.T) {
+	dev := newFakePrinter("SN-A")
+	dev.product = "TM-T88V"
+	dev.desc.Bus, dev.desc.Address = 1, 4
+	adapter, _ := newFakeUSBAdapter(dev)
+	require.NoError(t, adapter.Open())
+	defer adapter.Close()
+
+	assert.Equal(t, `Device 04b8:0202 on bus 001 address 004
+  Product "TM-T88V"
+  Serial "SN-A"
+  Configuration 1 (active)
+    Interface 0 alt 0: class printer, subclass 0, protocol 0 (claimed)
+      Endpoint 1 OUT bulk, max packet 64 (selected for printing)
+      Endpoint 2 IN bulk, max packet 64 (selected for status)
+`, adapter.DescribeTopology())
+}
+
+func TestDescribeTopologyDuplex(t *testing.T) {
+	adapter, _ := newFakeUSBAdapter(newFakeDuplexPrinter())
+	require.NoError(t, adapter.Open())
+	defer adapter.Close()
+
+	dump := adapter.DescribeTopology()
+	assert.Contains(t, dump, "Endpoint 1 OUT bulk, max packet 64 (selected for printing)\n")
+	assert.Contains(t, dump, "Endpoint 4 OUT bulk, max packet 64 (station 1)\n")
+}
+
+func TestDescribeTopologyClosed(t *testing.T) {
+	adapter, _ := newFakeUSBAdapter(newFakePrinter(""))
+
+	dump := adapter.DescribeTopology()
+	assert.Contains(t, dump, "Not open, no interface claimed")
+	assert.NotContains(t, dump, "selected")
+
+	empty, _ := newFakeUSBAdapter()
+	assert.Equal(t, "No device selected\n", empty.DescribeTopology())
+}
@@ -0,0 +1,106 @@
+package adapter
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+
+	"github.com/google/gousb"
+)
+
+// PreferTransferType makes Open use an OUT endpoint of transfer type t when
+// the printer interface offers one. Without a preference, bulk endpoints are
+// used before interrupt ones. If no endpoint of the preferred type exists,
+// Open falls back to the default choice. Takes effect on the next Open.
+func (a *USBAdapter) PreferTransferType(t gousb.TransferType) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.transferPref = &t
+}
+
+// outStation is a claimed OUT endpoint. Most printers have one; duplex
+// models have one per print station.
+type outStation struct {
+	endpoint      outEndpoint
+	number        int
+	maxPacketSize int
+	transferType  gousb.TransferType
+}
+
+// OutTransferType returns the transfer type of the default OUT endpoint
+func (a *USBAdapter) OutTransferType() gousb.TransferType {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.outs) == 0 {
+		return 0
+	}
+	return a.outs[0].transferType
+}
+
+// outEndpointDescs returns the OUT endpoints of an interface setting in
+// endpoint number order
+func outEndpointDescs(endpoints map[gousb.EndpointAddress]gousb.EndpointDesc) []gousb.EndpointDesc {
+	var outs []gousb.EndpointDesc
+	for _, desc := range endpoints {
+		if desc.Direction == gousb.EndpointDirectionOut {
+			outs = append(outs, desc)
+		}
+	}
+	slices.SortFunc(outs, func(x, y gousb.EndpointDesc) int { return x.Number - y.Number })
+	return outs
+}
+
+// selectOutEndpoint picks the OUT endpoint to print through: the lowest
+// numbered one of the preferred transfer type, else of bulk type, else of
+// interrupt type. Callers must hold a.mu.
+func (a *USBAdapter) selectOutEndpoint(endpoints map[gousb.EndpointAddress]gousb.EndpointDesc) (gousb.EndpointDesc, bool) {
+	outs := outEndpointDescs(endpoints)
+
+	order := []gousb.TransferType{gousb.TransferTypeBulk, gousb.TransferTypeInterrupt}
+	if a.transferPref != nil {
+		order = append([]gousb.TransferType{*a.transferPref}, order...)
+	}
+
+	for i, t := range order {
+		for _, desc := range outs {
+			if desc.TransferType != t {
+				continue
+			}
+			if i > 0 && a.transferPref != nil {
+				log.Printf("No %s OUT endpoint, using %s endpoint %d", *a.transferPref, t, desc.Number)
+			}
+			return desc, true
+		}
+	}
+	return gousb.EndpointDesc{}, false
+}
+
+// writeCommand writes a command outside of a job, such as a status
+// query, to the default OUT endpoint. Callers must hold a.mu.
+func (a *USBAdapter) writeCommand(data []byte) (int, error) {
+	if len(a.outs) == 0 {
+		return 0, errors.New("output endpoint not available")
+	}
+	return a.writeOut(context.Background(), a.outs[0], data)
+}
+
+// writeOut writes data to an OUT endpoint. Interrupt endpoints move at most
+// one packet per transfer, so data is split into max-packet-size chunks for
+// them; bulk endpoints take data in one transfer. Callers must hold a.mu.
+func (a *USBAdapter) writeOut(ctx context.Context, st outStation, data []byte) (int, error) {
+	if st.transferType != gousb.TransferTypeInterrupt || st.maxPacketSize <= 0 {
+		return st.endpoint.WriteContext(ctx, data)
+	}
+
+	written := 0
+	for written < len(data) {
+		end := min(written+st.maxPacketSize, len(data))
+		n, err := st.endpoint.WriteContext(ctx, data[written:end])
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
@@ -0,0 +1,178 @@
+package adapter
+
+import (
+	"testing"
+
+	"github.com/google/gousb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newFakeInterruptPrinter returns a printer whose only OUT endpoint is an
+// interrupt endpoint 3 with 8 byte packets
+func newFakeInterruptPrinter() *fakeDevice {
+	dev := newFakePrinter("INT")
+	dev.config = newFakeConfig(gousb.InterfaceSetting{
+		Number: 0,
+		Class:  gousb.Class(IfaceClassPrinter),
+		Endpoints: map[gousb.EndpointAddress]gousb.EndpointDesc{
+			0x03: {Address: 0x03, Number: 3, Direction: gousb.EndpointDirectionOut, MaxPacketSize: 8, TransferType: gousb.TransferTypeInterrupt},
+		},
+	})
+	return dev
+}
+
+// newFakeDualPrinter returns a printer with a bulk OUT endpoint 1 and an
+// interrupt OUT endpoint 3
+func newFakeDualPrinter() *fakeDevice {
+	dev := newFakePrinter("DUAL")
+	dev.config = newFakeConfig(gousb.InterfaceSetting{
+		Number: 0,
+		Class:  gousb.Class(IfaceClassPrinter),
+		Endpoints: map[gousb.EndpointAddress]gousb.EndpointDesc{
+			0x01: {Address: 0x01, Number: 1, Direction: gousb.EndpointDirectionOut, MaxPacketSize: 64, TransferType: gousb.TransferTypeBulk},
+			0x03: {Address: 0x03, Number: 3, Direction: gousb.EndpointDirectionOut, MaxPacketSize: 8, TransferType: gousb.TransferTypeInterrupt},
+		},
+	})
+	return dev
+}
+
+func TestUSBAdapterInterruptOutEndpoint(t *testing.T) {
+	dev := newFakeInterruptPrinter()
+	a, _ := newFakeUSBAdapter(dev)
+
+	require.NoError(t, a.Open())
+	defer a.Close()
+	assert.Equal(t, gousb.TransferTypeInterrupt, a.OutTransferType())
+
+	data := []byte("twenty bytes of text")
+	n, err := a.Write(data)
+	require.NoError(t, err)
+	assert.Equal(t, len(data), n)
+
+	ep := dev.config.interfaces[0].out[3]
+	assert.Equal(t, data, ep.data())
+	assert.Equal(t, []int{8, 8, 4}, ep.sizes)
+}
+
+func TestUSBAdapterCommandsUseInterruptPackets(t *testing.T) {
+	dev := newFakePrinter("INT")
+	dev.config = newFakeConfig(gousb.InterfaceSetting{
+		Number: 0,
+		Class:  gousb.Class(IfaceClassPrinter),
+		Endpoints: map[gousb.EndpointAddress]gousb.EndpointDesc{
+			0x03: {Address: 0x03, Number: 3, Direction: gousb.EndpointDirectionOut, MaxPacketSize: 2, TransferType: gousb.TransferTypeInterrupt},
+		},
+	})
+	a, _ := newFakeUSBAdapter(dev)
+
+	require.NoError(t, a.Open())
+	defer a.Close()
+
+	// Commands outside a job are split into packets like job data
+	require.NoError(t, a.RealtimeRequest(1))
+	ep := dev.config.interfaces[0].out[3]
+	assert.Equal(t, []byte{0x10, 0x05, 1}, ep.data())
+	assert.Equal(t, []int{2, 1}, ep.sizes)
+}
+
+func TestUSBAdapterPrefersBulkByDefault(t *testing.T) {
+	dev := newFakeDualPrinter()
+	a, _ := newFakeUSBAdapter(dev)
+
+	require.NoError(t, a.Open())
+	defer a.Close()
+	assert.Equal(t, gousb.TransferTypeBulk, a.OutTransferType())
+
+	data := []byte("twenty bytes of text")
+	_, err := a.Write(data)
+	require.NoError(t, err)
+
+	ep := dev.config.interfaces[0].out[1]
+	assert.Equal(t, []int{len(data)}, ep.sizes)
+	assert.Empty(t, dev.config.interfaces[0].out[3].data())
+}
+
+func TestUSBAdapterPreferTransferType(t *testing.T) {
+	dev := newFakeDualPrinter()
+	a, _ := newFakeUSBAdapter(dev)
+	a.PreferTransferType(gousb.TransferTypeInterrupt)
+
+	require.NoError(t, a.Open())
+	defer a.Close()
+	assert.Equal(t, gousb.TransferTypeInterrupt, a.OutTransferType())
+
+	_, err := a.Write([]byte("0123456789"))
+	require.NoError(t, err)
+	assert.Equal(t, []int{8, 2}, dev.config.interfaces[0].out[3].sizes)
+	assert.Empty(t, dev.config.interfaces[0].out[1].data())
+}
+
+func TestUSBAdapterPreferTransferTypeFallsBack(t *testing.T) {
+	dev := newFakeInterruptPrinter()
+	a, _ := newFakeUSBAdapter(dev)
+	a.PreferTransferType(gousb.TransferTypeBulk)
+
+	require.NoError(t, a.Open())
+	defer a.Close()
+	assert.Equal(t, gousb.TransferTypeInterrupt, a.OutTransferType())
+}
+
+// newFakeDuplexPrinter returns a printer with bulk OUT endpoints 1 and 4,
+// one per print station
+func newFakeDuplexPrinter() *fakeDevice {
+	dev := newFakePrinter("DUPLEX")
+	dev.config = newFakeConfig(gousb.InterfaceSetting{
+		Number: 0,
+		Class:  gousb.Class(IfaceClassPrinter),
+		Endpoints: map[gousb.EndpointAddress]gousb.EndpointDesc{
+			0x04: {Address: 0x04, Number: 4, Direction: gousb.EndpointDirectionOut, MaxPacketSize: 64, TransferType: gousb.TransferTypeBulk},
+			0x01: {Address: 0x01, Number: 1, Direction: gousb.EndpointDirectionOut, MaxPacketSize: 64, TransferType: gousb.TransferTypeBulk},
+		},
+	})
+	return dev
+}
+
+func TestUSBAdapterWriteToStation(t *testing.T) {
+	dev := newFakeDuplexPrinter()
+	a, _ := newFakeUSBAdapter(dev)
+
+	_, err := a.WriteTo(1, []byte("early"))
+	assert.Error(t, err)
+
+	require.NoError(t, a.Open())
+	defer a.Close()
+	assert.Equal(t, 2, a.OutEndpointCount())
+
+	_, err = a.Write([]byte("front"))
+	require.NoError(t, err)
+	n, err := a.WriteTo(1, []byte("back"))
+	require.NoError(t, err)
+	assert.Equal(t, 4, n)
+	_, err = a.WriteTo(0, []byte(" again"))
+	require.NoError(t, err)
+
+	iface := dev.config.interfaces[0]
+	assert.Equal(t, []byte("front again"), iface.out[1].data())
+	assert.Equal(t, []byte("back"), iface.out[4].data())
+
+	_, err = a.WriteTo(2, []byte("nowhere"))
+	assert.Error(t, err)
+	_, err = a.WriteTo(-1, []byte("nowhere"))
+	assert.Error(t, err)
+}
+
+func TestUSBAdapterWriteToPreferredStationFirst(t *testing.T) {
+	dev := newFakeDualPrinter()
+	a, _ := newFakeUSBAdapter(dev)
+	a.PreferTransferType(gousb.TransferTypeInterrupt)
+
+	require.NoError(t, a.Open())
+	defer a.Close()
+
+	// The preferred interrupt endpoint is station 0, the bulk one station 1
+	_, err := a.WriteTo(1, []byte("bulk"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("bulk"), dev.config.interfaces[0].out[1].data())
+	assert.Empty(t, dev.config.interfaces[0].out[3].data())
+}
@@ -1,13 +1,18 @@
 package adapter
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
 	"runtime"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/google/gousb"
+	"github.com/nixxel-company-limited/escpos-usb-server/escpos"
 )
 
 // Interface class codes
@@ -19,6 +24,10 @@ const (
 	IfaceClassHub     = 0x09
 )
 
+// ErrNoInEndpoint is returned by operations that need to read from a printer
+// without an IN endpoint
+var ErrNoInEndpoint = errors.New("input endpoint not available")
+
 // EventType represents device events
 type EventType int
 
@@ -28,116 +37,233 @@ const (
 	EventDetach
 	EventData
 	EventClose
+	// EventRead carries data the printer sent unprompted, read by the
+	// loop started with StartReadLoop
+	EventRead
+	// EventStatus carries an automatic status back packet decoded into
+	// Status, see EnableASB
+	EventStatus
+	// EventSlowWrite reports a write that took longer than the threshold
+	// set with SetSlowWriteThreshold, with its Duration
+	EventSlowWrite
 )
 
 // Event represents a device event
 type Event struct {
 	Type   EventType
 	Device *gousb.Device
-	Data   []byte
-	Error  error
+	// Serial and Product are the printer's string descriptors, read once
+	// when it is opened, so listeners can tell printers apart. They are
+	// set on connect, disconnect and close events and empty if the printer
+	// does not report them.
+	Serial  string
+	Product string
+	Data    []byte
+	Error   error
+	// Status is set on EventStatus
+	Status escpos.Status
+	// Duration is set on EventSlowWrite
+	Duration time.Duration
 }
 
 // USBAdapter manages USB printer communication
 type USBAdapter struct {
-	device         *gousb.Device
-	ctx            *gousb.Context
-	outEndpoint    *gousb.OutEndpoint
-	inEndpoint     *gousb.InEndpoint
-	iface          *gousb.Interface
-	eventListeners map[EventType][]func(Event)
-	listenersMutex sync.RWMutex
-	isOpen         bool
-	mu             sync.Mutex
+	device         usbDevice
+	ctx            usbContext
+	selector       deviceSelector
+	inEndpoint     inEndpoint
+	inEndpointNum  int
+	inMaxPacket    int
+	readBufferSize int
+	// readPollInterval and stopReadLoop control the background read loop;
+	// after is time.After, replaced in tests. The loop leaves the IN
+	// endpoint to process ID waits while awaitingResponse is non-zero.
+	readPollInterval time.Duration
+	stopReadLoop     chan struct{}
+	awaitingResponse int
+	after            func(time.Duration) <-chan time.Time
+	serial           string
+	product          string
+	config           usbConfig
+	iface            usbInterface
+	eventListeners   map[EventType][]func(Event)
+	listenersMutex   sync.RWMutex
+	pendingEvents    []Event
+	droppedEvents    uint64
+	dispatching      bool
+	isOpen           bool
+	outs             []outStation
+	transferPref     *gousb.TransferType
+	recoverOverflow  bool
+	allowVendor      bool
+	claimAttempts    int
+	claimDelay       time.Duration
+	charWidth        int
+	maxBandHeight    int
+	dotWidth         int
+	profile          ModelProfile
+	profileKnown     bool
+	profileDetected  bool
+	slowLinkWarned   bool
+	// bufferQuery overrides the profile's; flowControl paces writes by it
+	bufferQuery []byte
+	flowControl bool
+	// codePageQuery overrides the profile's, see SetCodePageQuery
+	codePageQuery []byte
+	// asb picks status packets out of the read loop's data once EnableASB
+	// turned automatic status back on
+	asb *escpos.ASBScanner
+	// slowWriteThreshold and slowWrites, see SetSlowWriteThreshold;
+	// slowWrites is read without a.mu
+	slowWriteThreshold time.Duration
+	slowWrites         atomic.Uint64
+	// adaptiveFlowControl paces writes by the buffer query or real-time
+	// status, or by printerBusy when tests set it; see SetAdaptiveFlowControl
+	adaptiveFlowControl bool
+	printerBusy         func() (bool, error)
+	// opens counts opens, so a write waiting with a.mu released notices a
+	// Reconnect
+	opens uint64
+	// lease is held by a Lease, or by a single write outside one
+	lease chan struct{}
+	mu    sync.Mutex
 }
 
+// maxPendingEvents bounds the events waiting for delivery. When listeners
+// fall this far behind, the oldest pending event is dropped.
+const maxPendingEvents = 1024
+
+// Default retry of a busy interface claim
+const (
+	defaultClaimAttempts = 3
+	defaultClaimDelay    = 200 * time.Millisecond
+)
+
 // NewUSBAdapter creates a new USB adapter instance
 func NewUSBAdapter(vid, pid uint16) (*USBAdapter, error) {
-	ctx := gousb.NewContext()
-	adapter := &USBAdapter{
-		ctx:            ctx,
-		eventListeners: make(map[EventType][]func(Event)),
-	}
+	ctx := newGousbContext()
+	adapter := newUSBAdapter(ctx)
 
 	// Find device by VID/PID
 	device, err := ctx.OpenDeviceWithVIDPID(gousb.ID(vid), gousb.ID(pid))
 	if err != nil || device == nil {
 		// Try to find any printer device
-		devices := FindPrinters(ctx)
-		if len(devices) == 0 {
+		device, err := openAutoPrinter(ctx)
+		if err != nil {
 			ctx.Close()
-			return nil, errors.New("cannot find printer")
+			return nil, err
 		}
-		adapter.device = devices[0]
+		adapter.device = device
 	} else {
 		adapter.device = device
 	}
+	adapter.selector = deviceSelector{vid: gousb.ID(vid), pid: gousb.ID(pid)}
 
 	return adapter, nil
 }
 
-// NewUSBAdapterAuto creates adapter with auto-detection
+// NewUSBAdapterAuto creates adapter with auto-detection. With several
+// printers connected, the policy set with SetAutoSelect picks one.
 func NewUSBAdapterAuto() (*USBAdapter, error) {
-	ctx := gousb.NewContext()
-	adapter := &USBAdapter{
-		ctx:            ctx,
-		eventListeners: make(map[EventType][]func(Event)),
-	}
-
-	devices := FindPrinters(ctx)
-	if len(devices) == 0 {
+	ctx := newGousbContext()
+	device, err := openAutoPrinter(ctx)
+	if err != nil {
 		ctx.Close()
-		return nil, errors.New("cannot find printer")
+		return nil, err
 	}
 
-	adapter.device = devices[0]
+	adapter := newUSBAdapter(ctx)
+	adapter.device = device
 	return adapter, nil
 }
 
+// newUSBAdapter creates an adapter bound to ctx with no device selected yet
+func newUSBAdapter(ctx usbContext) *USBAdapter {
+	return &USBAdapter{
+		ctx:            ctx,
+		eventListeners: make(map[EventType][]func(Event)),
+		claimAttempts:  defaultClaimAttempts,
+		claimDelay:     defaultClaimDelay,
+		after:          time.After,
+		lease:          make(chan struct{}, 1),
+	}
+}
+
 // IsPrinter checks if a device is a printer
 func IsPrinter(dev *gousb.Device) bool {
 	if dev == nil {
 		return false
 	}
+	return isPrinter(gousbDevice{dev})
+}
 
+// isPrinter checks if a device exposes a printer class interface
+func isPrinter(dev usbDevice) bool {
+	if dev == nil {
+		return false
+	}
+	printer, _ := hasPrinterInterface(dev)
+	return printer
+}
+
+// hasPrinterInterface reads the active configuration of dev and reports
+// whether it has a printer class interface. The read fails if the device
+// was unplugged after being opened.
+func hasPrinterInterface(dev usbDevice) (bool, error) {
 	cfg, err := dev.ActiveConfigNum()
 	if err != nil {
-		return false
+		return false, fmt.Errorf("reading active configuration: %w", err)
 	}
 
 	cfgDesc, err := dev.Config(cfg)
 	if err != nil {
-		return false
+		return false, fmt.Errorf("reading configuration %d: %w", cfg, err)
 	}
 	defer cfgDesc.Close()
 
-	for _, iface := range cfgDesc.Desc.Interfaces {
+	for _, iface := range cfgDesc.Desc().Interfaces {
 		log.Println("Interface: ", iface.String())
 		for _, alt := range iface.AltSettings {
 			if alt.Class == IfaceClassPrinter {
-				return true
+				return true, nil
 			}
 		}
 	}
 
-	return false
+	return false, nil
 }
 
 // FindPrinters returns all USB printer devices
 func FindPrinters(ctx *gousb.Context) []*gousb.Device {
-	var printers []*gousb.Device
+	printers := []*gousb.Device{}
+	for _, dev := range findPrinters(gousbContext{ctx}) {
+		printers = append(printers, dev.raw())
+	}
+	return printers
+}
+
+// findPrinters opens every device on ctx and keeps the printers, closing
+// the others. Devices unplugged while enumerating are skipped: a device
+// that could not be opened is missing from the devices OpenDevices
+// returns along with its error, and one whose descriptors cannot be read
+// is closed.
+func findPrinters(ctx usbContext) []usbDevice {
+	var printers []usbDevice
 
 	devices, err := ctx.OpenDevices(func(desc *gousb.DeviceDesc) bool {
 		return true // Check all devices
 	})
-
 	if err != nil {
-		return printers
+		debugf("Opening USB devices: %v; checking the %d opened", err, len(devices))
 	}
 
 	for _, dev := range devices {
-		log.Println("Found device: ", dev.Desc)
-		if IsPrinter(dev) {
+		log.Println("Found device: ", dev.Desc())
+		printer, err := hasPrinterInterface(dev)
+		if err != nil {
+			debugf("Skipping device %s: %v", dev.Desc(), err)
+		}
+		if printer {
 			printers = append(printers, dev)
 		} else {
 			dev.Close()
@@ -161,6 +287,15 @@ func GetDeviceByVIDPID(ctx *gousb.Context, vid, pid uint16) (*gousb.Device, erro
 
 // GetDeviceBySerial opens a device by serial number
 func GetDeviceBySerial(ctx *gousb.Context, serial string) (*gousb.Device, error) {
+	dev, err := getDeviceBySerial(gousbContext{ctx}, serial)
+	if err != nil {
+		return nil, err
+	}
+	return dev.raw(), nil
+}
+
+// getDeviceBySerial opens the device on ctx whose serial number matches
+func getDeviceBySerial(ctx usbContext, serial string) (usbDevice, error) {
 	devices, err := ctx.OpenDevices(func(desc *gousb.DeviceDesc) bool {
 		return true
 	})
@@ -168,18 +303,16 @@ func GetDeviceBySerial(ctx *gousb.Context, serial string) (*gousb.Device, error)
 		return nil, err
 	}
 
-	for _, dev := range devices {
-		s, err := dev.SerialNumber()
+	for i, dev := range devices {
+		s, err := readDescriptor(dev, dev.SerialNumber)
 		if err == nil && s == serial {
-			// Close other devices
-			for _, d := range devices {
-				if d != dev {
-					d.Close()
-				}
+			// Close the devices not checked yet; the others already are
+			for _, d := range devices[i+1:] {
+				closeDevice(d)
 			}
 			return dev, nil
 		}
-		dev.Close()
+		closeDevice(dev)
 	}
 
 	return nil, errors.New("device with serial number not found")
@@ -193,18 +326,71 @@ func (a *USBAdapter) On(eventType EventType, handler func(Event)) {
 	a.eventListeners[eventType] = append(a.eventListeners[eventType], handler)
 }
 
-// emit triggers an event
-func (a *USBAdapter) emit(event Event) {
+// DroppedEvents returns how many events were discarded because listeners
+// could not keep up
+func (a *USBAdapter) DroppedEvents() uint64 {
 	a.listenersMutex.RLock()
 	defer a.listenersMutex.RUnlock()
+	return a.droppedEvents
+}
+
+// emit queues an event for delivery. Events are delivered on a separate
+// goroutine, one at a time and in the order they were emitted, so listeners
+// always observe e.g. EventDisconnect before the EventConnect that follows it.
+// At most maxPendingEvents wait for delivery; beyond that the oldest is
+// dropped, so slow listeners cannot make a busy printer exhaust memory.
+func (a *USBAdapter) emit(event Event) {
+	a.listenersMutex.Lock()
+	if len(a.pendingEvents) >= maxPendingEvents {
+		a.pendingEvents[0] = Event{}
+		a.pendingEvents = a.pendingEvents[1:]
+		a.droppedEvents++
+		if a.droppedEvents == 1 {
+			log.Printf("Event listeners falling behind, dropping oldest events")
+		}
+	}
+	a.pendingEvents = append(a.pendingEvents, event)
+	start := !a.dispatching
+	a.dispatching = true
+	a.listenersMutex.Unlock()
+
+	if start {
+		go a.dispatchEvents()
+	}
+}
+
+// dispatchEvents delivers queued events until the queue is empty
+func (a *USBAdapter) dispatchEvents() {
+	for {
+		a.listenersMutex.Lock()
+		if len(a.pendingEvents) == 0 {
+			a.dispatching = false
+			a.listenersMutex.Unlock()
+			return
+		}
+		event := a.pendingEvents[0]
+		a.pendingEvents[0] = Event{}
+		a.pendingEvents = a.pendingEvents[1:]
+		listeners := append([]func(Event){}, a.eventListeners[event.Type]...)
+		a.listenersMutex.Unlock()
 
-	if listeners, ok := a.eventListeners[event.Type]; ok {
 		for _, handler := range listeners {
-			go handler(event)
+			callHandler(handler, event)
 		}
 	}
 }
 
+// callHandler runs an event listener, recovering from a panic so a buggy
+// listener cannot crash the process or stop later events from being delivered
+func callHandler(handler func(Event), event Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Event handler for event type %d panicked: %v\n%s", event.Type, r, debug.Stack())
+		}
+	}()
+	handler(event)
+}
+
 // Open opens the USB device and claims the interface
 func (a *USBAdapter) Open() error {
 	a.mu.Lock()
@@ -214,13 +400,39 @@ func (a *USBAdapter) Open() error {
 		return errors.New("device already open")
 	}
 
+	return a.open()
+}
+
+// OpenIfNeeded opens the device unless it is already open. Unlike Open it
+// returns nil for an open device, so concurrent callers all succeed and the
+// interface is claimed once.
+func (a *USBAdapter) OpenIfNeeded() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.isOpen {
+		return nil
+	}
+
+	return a.open()
+}
+
+// open claims the printer interface of a.device. Callers must hold a.mu.
+func (a *USBAdapter) open() error {
 	if a.device == nil {
 		return errors.New("device not found")
 	}
 
-	// Set auto-detach kernel driver on Linux
+	// Set auto-detach kernel driver on Linux. Some kernels or permission
+	// setups reject it, in which case the driver is detached explicitly
+	// from the printer interface before claiming it.
+	autoDetachFailed := false
 	if runtime.GOOS == "linux" {
-		a.device.SetAutoDetach(true)
+		if err := a.device.SetAutoDetach(true); err != nil {
+			log.Printf("Kernel driver auto-detach unavailable, detaching explicitly: %v", err)
+			a.device.SetAutoDetach(false)
+			autoDetachFailed = true
+		}
 	}
 
 	// Get active configuration
@@ -233,62 +445,217 @@ func (a *USBAdapter) Open() error {
 	if err != nil {
 		return fmt.Errorf("failed to get config: %w", err)
 	}
-	defer cfg.Close()
 
 	// Find printer interface
-	var printerIfaceNum int = -1
-	for _, iface := range cfg.Desc.Interfaces {
-		for _, alt := range iface.AltSettings {
-			if alt.Class == IfaceClassPrinter {
-				printerIfaceNum = iface.Number
-				break
-			}
-		}
-		if printerIfaceNum >= 0 {
-			break
-		}
+	setting, err := findPrinterInterface(cfg.Desc(), a.allowVendor)
+	if err != nil {
+		cfg.Close()
+		return err
 	}
+	printerIfaceNum := setting.Number
 
-	if printerIfaceNum < 0 {
-		return errors.New("no printer interface found")
+	if autoDetachFailed {
+		if err := a.device.DetachKernelDriver(printerIfaceNum); err != nil {
+			log.Printf("Failed to detach kernel driver from interface %d: %v", printerIfaceNum, err)
+		}
 	}
 
 	// Claim interface
-	iface, err := cfg.Interface(printerIfaceNum, 0)
+	iface, err := a.claimInterface(cfg, printerIfaceNum, setting.Alternate)
 	if err != nil {
+		cfg.Close()
+		if autoDetachFailed && isBusy(err) {
+			return busyError(printerIfaceNum, err)
+		}
+		if isAccessDenied(err) {
+			return accessError(printerIfaceNum, err)
+		}
 		return fmt.Errorf("failed to claim interface: %w", err)
 	}
+	if err := checkClaimedInterface(setting, iface.Setting()); err != nil {
+		iface.Close()
+		cfg.Close()
+		return err
+	}
 
+	a.config = cfg
 	a.iface = iface
 
-	// Find endpoints
-	for _, epDesc := range iface.Setting.Endpoints {
-		if epDesc.Direction == gousb.EndpointDirectionOut && a.outEndpoint == nil {
-			ep, err := iface.OutEndpoint(epDesc.Number)
-			if err == nil {
-				a.outEndpoint = ep
+	// Find endpoints. The selected OUT endpoint is the default; any others,
+	// e.g. the second station of a duplex printer, follow by number.
+	if epDesc, ok := a.selectOutEndpoint(iface.Setting().Endpoints); ok {
+		ep, err := iface.OutEndpoint(epDesc.Number)
+		if err == nil {
+			a.outs = append(a.outs, outStation{ep, epDesc.Number, epDesc.MaxPacketSize, epDesc.TransferType})
+			for _, other := range outEndpointDescs(iface.Setting().Endpoints) {
+				if other.Number == epDesc.Number {
+					continue
+				}
+				if ep, err := iface.OutEndpoint(other.Number); err == nil {
+					a.outs = append(a.outs, outStation{ep, other.Number, other.MaxPacketSize, other.TransferType})
+				}
 			}
 		}
+	}
+	for _, epDesc := range iface.Setting().Endpoints {
 		if epDesc.Direction == gousb.EndpointDirectionIn && a.inEndpoint == nil {
 			ep, err := iface.InEndpoint(epDesc.Number)
 			if err == nil {
 				a.inEndpoint = ep
+				a.inEndpointNum = epDesc.Number
+				a.inMaxPacket = epDesc.MaxPacketSize
 			}
 		}
 	}
 
-	if a.outEndpoint == nil {
+	if len(a.outs) == 0 {
+		a.release()
 		return errors.New("cannot find output endpoint from printer")
 	}
 
+	// Read once: string descriptors cost a control transfer each
+	a.product, a.serial = readDescriptors(a.device)
+
 	a.isOpen = true
-	a.emit(Event{Type: EventConnect, Device: a.device})
+	a.opens++
+	a.emit(Event{Type: EventConnect, Device: rawDevice(a.device), Serial: a.serial, Product: a.product})
+
+	return nil
+}
+
+// SetClaimRetry configures how often Open tries to claim the printer
+// interface while it is reported busy or access to it is denied, e.g. right
+// after plug-in while a kernel driver still holds it or before udev has
+// applied its permissions. Other claim errors are not retried.
+func (a *USBAdapter) SetClaimRetry(attempts int, delay time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.claimAttempts = max(attempts, 1)
+	a.claimDelay = delay
+}
+
+// claimInterface claims interface num in alternate setting alt, retrying
+// while it is busy or access is denied. Callers must hold a.mu.
+func (a *USBAdapter) claimInterface(cfg usbConfig, num, alt int) (usbInterface, error) {
+	for attempt := 1; ; attempt++ {
+		iface, err := cfg.Interface(num, alt)
+		if err == nil || attempt >= a.claimAttempts {
+			return iface, err
+		}
+		switch {
+		case isBusy(err):
+			log.Printf("Interface %d busy (attempt %d/%d), retrying in %v", num, attempt, a.claimAttempts, a.claimDelay)
+		case isAccessDenied(err):
+			log.Printf("Access to interface %d denied (attempt %d/%d), retrying in %v for udev to apply permissions", num, attempt, a.claimAttempts, a.claimDelay)
+		default:
+			return iface, err
+		}
+		time.Sleep(a.claimDelay)
+	}
+}
+
+// release gives up the claimed interface and config. Callers must hold a.mu.
+func (a *USBAdapter) release() error {
+	// gousb reports no error releasing an interface; one failing to be
+	// released surfaces when the config is closed
+	if a.iface != nil {
+		a.iface.Close()
+		a.iface = nil
+	}
+	var err error
+	if a.config != nil {
+		if cerr := a.config.Close(); cerr != nil {
+			err = fmt.Errorf("close config: %w", cerr)
+		}
+		a.config = nil
+	}
+	a.outs = nil
+	a.inEndpoint = nil
+	a.inMaxPacket = 0
+	a.profileDetected = false
+	a.slowLinkWarned = false
+	return err
+}
+
+// Reconnect drops the current device handle and opens the printer again,
+// e.g. after it was unplugged or power-cycled. The printer is found by the
+// criterion the adapter was created with, serial number, product string,
+// bus and address or VID and PID, so a host with several printers gets the
+// same unit back. An adapter created by auto-detection takes the first
+// printer found.
+//
+// Listeners registered with On are kept. EventDisconnect is emitted with the
+// old device, then EventConnect with the new one once it is open, so the
+// Device field of the connect event always refers to the fresh handle.
+func (a *USBAdapter) Reconnect() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.ctx == nil {
+		return errors.New("adapter closed")
+	}
+
+	if old := a.device; old != nil {
+		a.release()
+		a.isOpen = false
+		closeDevice(old)
+		a.device = nil
+		a.emit(Event{Type: EventDisconnect, Device: rawDevice(old), Serial: a.serial, Product: a.product})
+	}
+
+	dev, err := a.selector.find(a.ctx)
+	if err != nil {
+		return fmt.Errorf("reconnect failed: %w", err)
+	}
+	a.device = dev
+
+	if err := a.open(); err != nil {
+		return fmt.Errorf("reconnect failed: %w", err)
+	}
 
 	return nil
 }
 
 // Write sends data to the printer
 func (a *USBAdapter) Write(data []byte) (int, error) {
+	return a.WriteContext(context.Background(), data)
+}
+
+// WriteContext sends data to the printer, aborting the transfer when ctx is
+// done. The error then wraps ctx.Err().
+func (a *USBAdapter) WriteContext(ctx context.Context, data []byte) (int, error) {
+	if err := a.acquireWrite(ctx); err != nil {
+		return 0, err
+	}
+	defer a.releaseWrite()
+	return a.writeTo(ctx, 0, data)
+}
+
+// WriteTo sends data to one print station of a printer with several OUT
+// endpoints. Station 0 is the endpoint Write uses; the others follow in
+// endpoint number order. See OutEndpointCount.
+func (a *USBAdapter) WriteTo(endpointIndex int, data []byte) (int, error) {
+	ctx := context.Background()
+	if err := a.acquireWrite(ctx); err != nil {
+		return 0, err
+	}
+	defer a.releaseWrite()
+	return a.writeTo(ctx, endpointIndex, data)
+}
+
+// OutEndpointCount returns how many OUT endpoints the open printer has
+func (a *USBAdapter) OutEndpointCount() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.outs)
+}
+
+// writeTo implements WriteContext and WriteTo
+func (a *USBAdapter) writeTo(ctx context.Context, index int, data []byte) (int, error) {
+	// Resolved before locking, since detecting the model queries the printer
+	query := a.flowControlQuery()
+	adaptiveQuery, adaptive := a.adaptiveQuery()
+
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
@@ -296,15 +663,39 @@ func (a *USBAdapter) Write(data []byte) (int, error) {
 		return 0, errors.New("device not open")
 	}
 
-	if a.outEndpoint == nil {
+	if len(a.outs) == 0 {
 		return 0, errors.New("output endpoint not available")
 	}
+	if index < 0 || index >= len(a.outs) {
+		return 0, fmt.Errorf("output endpoint %d not available, printer has %d", index, len(a.outs))
+	}
+	st := a.outs[index]
 
 	a.emit(Event{Type: EventData, Data: data})
-
-	n, err := a.outEndpoint.Write(data)
+	a.warnSlowLink(len(data))
+
+	var n int
+	var err error
+	start := time.Now()
+	switch {
+	case query != nil && a.inEndpoint != nil:
+		n, err = a.writePaced(ctx, st, func() (int, error) { return a.bufferFree(query) }, data)
+	case adaptive && a.inEndpoint != nil:
+		n, err = a.writePaced(ctx, st, a.adaptiveRoom(adaptiveQuery), data)
+	default:
+		n, err = a.writeOut(ctx, st, data)
+	}
+	a.checkWriteLatency(len(data), time.Since(start))
+	if err != nil && isOverflow(err) {
+		log.Printf("USB overflow after writing %d of %d bytes: %v", n, len(data), err)
+		if a.recoverOverflow {
+			retried, retryErr := a.retryAfterOverflow(ctx, st, data[n:])
+			n += retried
+			err = retryErr
+		}
+	}
 	if err != nil {
-		return n, fmt.Errorf("write failed: %w", err)
+		return n, newUSBError("write", err)
 	}
 
 	return n, nil
@@ -320,53 +711,55 @@ func (a *USBAdapter) Read(buf []byte) (int, error) {
 	}
 
 	if a.inEndpoint == nil {
-		return 0, errors.New("input endpoint not available")
+		return 0, ErrNoInEndpoint
 	}
 
 	n, err := a.inEndpoint.Read(buf)
 	if err != nil {
-		return n, fmt.Errorf("read failed: %w", err)
+		return n, newUSBError("read", err)
 	}
 
 	return n, nil
 }
 
-// Close closes the USB device
+// Close closes the USB device and the libusb context, also after a failed
+// Reconnect left the device closed. Failures releasing the claimed config,
+// closing the device and closing the libusb context are joined with
+// errors.Join, so each can be checked with errors.Is or errors.As. The
+// adapter cannot be reopened or reconnected afterwards.
 func (a *USBAdapter) Close() error {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	if !a.isOpen {
-		return nil
-	}
+	a.stopReadLoopLocked()
 
 	var errs []error
-
-	if a.iface != nil {
-		a.iface.Close()
-		a.iface = nil
+	wasOpen := a.isOpen
+	if wasOpen {
+		errs = append(errs, a.release())
 	}
 
-	if a.device != nil {
-		if err := a.device.Close(); err != nil {
-			errs = append(errs, err)
+	device := a.device
+	if device != nil {
+		if err := closeDevice(device); err != nil {
+			errs = append(errs, fmt.Errorf("close device: %w", err))
 		}
+		a.device = nil
 	}
 
 	if a.ctx != nil {
 		if err := a.ctx.Close(); err != nil {
-			errs = append(errs, err)
+			errs = append(errs, fmt.Errorf("close context: %w", err))
 		}
+		a.ctx = nil
 	}
 
 	a.isOpen = false
-	a.emit(Event{Type: EventClose, Device: a.device})
-
-	if len(errs) > 0 {
-		return fmt.Errorf("close errors: %v", errs)
+	if wasOpen {
+		a.emit(Event{Type: EventClose, Device: rawDevice(device), Serial: a.serial, Product: a.product})
 	}
 
-	return nil
+	return errors.Join(errs...)
 }
 
 // IsOpen returns whether the device is open
@@ -378,5 +771,7 @@ func (a *USBAdapter) IsOpen() bool {
 
 // GetDevice returns the underlying USB device
 func (a *USBAdapter) GetDevice() *gousb.Device {
-	return a.device
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return rawDevice(a.device)
 }
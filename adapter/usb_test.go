@@ -1,7 +1,14 @@
 package adapter
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/google/gousb"
 	"github.com/stretchr/testify/assert"
@@ -118,6 +125,59 @@ func TestUSBAdapterOpenClose(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestUSBAdapterCloseJoinsErrors(t *testing.T) {
+	dev := newFakePrinter("A")
+	adapter, ctx := newFakeUSBAdapter(dev)
+	require.NoError(t, adapter.Open())
+
+	errConfig := errors.New("config busy")
+	errContext := errors.New("context busy")
+	dev.config.closeErr = errConfig
+	dev.closeErr = gousb.ErrorNoDevice
+	ctx.closeErr = errContext
+
+	err := adapter.Close()
+	require.Error(t, err)
+	assert.ErrorIs(t, err, errConfig)
+	assert.ErrorIs(t, err, gousb.ErrorNoDevice)
+	assert.ErrorIs(t, err, errContext)
+	var usbErr gousb.Error
+	require.ErrorAs(t, err, &usbErr)
+	assert.Equal(t, gousb.ErrorNoDevice, usbErr)
+
+	assert.Contains(t, err.Error(), "close config: config busy")
+	assert.Contains(t, err.Error(), "close context: context busy")
+	assert.False(t, adapter.IsOpen())
+}
+
+func TestUSBAdapterOpenIfNeededConcurrent(t *testing.T) {
+	dev := newFakePrinter("A")
+	adapter, _ := newFakeUSBAdapter(dev)
+	defer adapter.Close()
+
+	const callers = 20
+	errs := make(chan error, callers)
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- OpenIfNeeded(adapter)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+	assert.True(t, adapter.IsOpen())
+	assert.Equal(t, 1, dev.config.claims)
+
+	// The strict Open still rejects an open device
+	assert.Error(t, adapter.Open())
+}
+
 func TestUSBAdapterWrite(t *testing.T) {
 	adapter, err := NewUSBAdapterAuto()
 	if err != nil {
@@ -296,3 +356,348 @@ func TestGetDevice(t *testing.T) {
 	device := adapter.GetDevice()
 	assert.NotNil(t, device)
 }
+
+func TestUSBAdapterReconnect(t *testing.T) {
+	first := newFakePrinter("A")
+	adapter, ctx := newFakeUSBAdapter(first)
+	defer adapter.Close()
+
+	var mu sync.Mutex
+	var events []Event
+	record := func(e Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, e)
+	}
+	adapter.On(EventConnect, record)
+	adapter.On(EventDisconnect, record)
+
+	require.NoError(t, adapter.Open())
+
+	// The printer is power-cycled and comes back as a new device handle
+	second := newFakePrinter("A")
+	ctx.mu.Lock()
+	ctx.devices = []*fakeDevice{second}
+	ctx.mu.Unlock()
+
+	require.NoError(t, adapter.Reconnect())
+	assert.True(t, adapter.IsOpen())
+	assert.True(t, first.isClosed())
+	assert.Same(t, second.handle, adapter.GetDevice())
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(events) == 3
+	}, time.Second, 10*time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, EventConnect, events[0].Type)
+	assert.Same(t, first.handle, events[0].Device)
+	assert.Equal(t, EventDisconnect, events[1].Type)
+	assert.Same(t, first.handle, events[1].Device)
+	assert.Equal(t, EventConnect, events[2].Type)
+	assert.Same(t, second.handle, events[2].Device)
+
+	// Writes now reach the new device
+	_, err := adapter.Write([]byte("after"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("after"), second.config.interfaces[0].out[1].data())
+}
+
+func TestUSBAdapterReconnectMatchesOriginalSerial(t *testing.T) {
+	other, original := newFakePrinter("SN-B"), newFakePrinter("SN-A")
+	adapter, ctx := newFakeUSBAdapter(original)
+	adapter.selector = deviceSelector{serial: "SN-A"}
+	defer adapter.Close()
+	require.NoError(t, adapter.Open())
+
+	// After the power cycle another printer enumerates first
+	replugged := newFakePrinter("SN-A")
+	ctx.mu.Lock()
+	ctx.devices = []*fakeDevice{other, replugged}
+	ctx.mu.Unlock()
+
+	require.NoError(t, adapter.Reconnect())
+	assert.Same(t, replugged.handle, adapter.GetDevice())
+	assert.True(t, other.isClosed())
+}
+
+func TestUSBAdapterReconnectMatchesOriginalAddress(t *testing.T) {
+	original := newFakePrinter("")
+	original.desc.Bus, original.desc.Address = 1, 7
+	adapter, ctx := newFakeUSBAdapter(original)
+	adapter.selector = deviceSelector{bus: 1, address: 7}
+	defer adapter.Close()
+	require.NoError(t, adapter.Open())
+
+	other := newFakePrinter("")
+	other.desc.Bus, other.desc.Address = 1, 3
+	ctx.mu.Lock()
+	ctx.devices = []*fakeDevice{other, original}
+	ctx.mu.Unlock()
+
+	require.NoError(t, adapter.Reconnect())
+	assert.Same(t, original.handle, adapter.GetDevice())
+}
+
+func TestUSBAdapterReconnectOriginalSerialGone(t *testing.T) {
+	adapter, ctx := newFakeUSBAdapter(newFakePrinter("SN-A"))
+	adapter.selector = deviceSelector{serial: "SN-A"}
+	defer adapter.Close()
+	require.NoError(t, adapter.Open())
+
+	// Only a different printer is left; it must not be taken over
+	ctx.mu.Lock()
+	ctx.devices = []*fakeDevice{newFakePrinter("SN-B")}
+	ctx.mu.Unlock()
+
+	assert.Error(t, adapter.Reconnect())
+	assert.False(t, adapter.IsOpen())
+}
+
+func TestUSBAdapterReconnectNoPrinter(t *testing.T) {
+	adapter, ctx := newFakeUSBAdapter(newFakePrinter("A"))
+	defer adapter.Close()
+	require.NoError(t, adapter.Open())
+
+	// The printer never comes back
+	ctx.mu.Lock()
+	ctx.devices = nil
+	ctx.mu.Unlock()
+
+	err := adapter.Reconnect()
+	assert.Error(t, err)
+	assert.False(t, adapter.IsOpen())
+}
+
+func TestUSBAdapterCloseAfterFailedReconnect(t *testing.T) {
+	adapter, ctx := newFakeUSBAdapter(newFakePrinter("A"))
+	require.NoError(t, adapter.Open())
+
+	ctx.mu.Lock()
+	ctx.devices = nil
+	ctx.mu.Unlock()
+	require.Error(t, adapter.Reconnect())
+
+	// The libusb context is closed even though the device already was
+	require.NoError(t, adapter.Close())
+	ctx.mu.Lock()
+	closed := ctx.closed
+	ctx.mu.Unlock()
+	assert.True(t, closed)
+
+	assert.ErrorContains(t, adapter.Reconnect(), "adapter closed")
+}
+
+func TestUSBAdapterClaimRetryBusy(t *testing.T) {
+	dev := newFakePrinter("A")
+	dev.config.claimErrs = []error{gousb.ErrorBusy, gousb.ErrorBusy}
+	a, _ := newFakeUSBAdapter(dev)
+	a.SetClaimRetry(3, time.Millisecond)
+
+	require.NoError(t, a.Open())
+	defer a.Close()
+
+	assert.Empty(t, dev.config.claimErrs)
+	assert.True(t, a.IsOpen())
+}
+
+func TestUSBAdapterClaimRetryExhausted(t *testing.T) {
+	dev := newFakePrinter("A")
+	dev.config.claimErrs = []error{gousb.ErrorBusy, gousb.ErrorBusy, gousb.ErrorBusy}
+	a, _ := newFakeUSBAdapter(dev)
+	a.SetClaimRetry(2, time.Millisecond)
+
+	err := a.Open()
+	assert.ErrorIs(t, err, gousb.ErrorBusy)
+	assert.Len(t, dev.config.claimErrs, 1)
+	assert.False(t, a.IsOpen())
+}
+
+func TestUSBAdapterClaimRetryOnlyBusyOrAccess(t *testing.T) {
+	dev := newFakePrinter("A")
+	dev.config.claimErrs = []error{gousb.ErrorIO, gousb.ErrorBusy}
+	a, _ := newFakeUSBAdapter(dev)
+	a.SetClaimRetry(3, time.Millisecond)
+
+	err := a.Open()
+	assert.ErrorIs(t, err, gousb.ErrorIO)
+	assert.Len(t, dev.config.claimErrs, 1)
+}
+
+func TestUSBAdapterClaimRetryAccessDenied(t *testing.T) {
+	dev := newFakePrinter("A")
+	// gousb flattens the libusb error into the message when claiming
+	dev.config.claimErrs = []error{
+		fmt.Errorf("failed to claim interface 0: %v", gousb.ErrorAccess),
+		gousb.ErrorAccess,
+	}
+	a, _ := newFakeUSBAdapter(dev)
+	a.SetClaimRetry(3, time.Millisecond)
+
+	require.NoError(t, a.Open())
+	defer a.Close()
+
+	assert.Empty(t, dev.config.claimErrs)
+	assert.True(t, a.IsOpen())
+}
+
+func TestUSBAdapterClaimRetryAccessDeniedExhausted(t *testing.T) {
+	dev := newFakePrinter("A")
+	dev.config.claimErrs = []error{gousb.ErrorAccess, gousb.ErrorAccess, gousb.ErrorAccess}
+	a, _ := newFakeUSBAdapter(dev)
+	a.SetClaimRetry(2, time.Millisecond)
+
+	err := a.Open()
+	assert.ErrorIs(t, err, gousb.ErrorAccess)
+	assert.Contains(t, err.Error(), "udev rule")
+	assert.Len(t, dev.config.claimErrs, 1)
+	assert.False(t, a.IsOpen())
+}
+
+func TestUSBAdapterPanickingHandler(t *testing.T) {
+	dev := newFakePrinter("A")
+	adapter, _ := newFakeUSBAdapter(dev)
+	defer adapter.Close()
+
+	var mu sync.Mutex
+	var received [][]byte
+	adapter.On(EventData, func(e Event) {
+		panic("buggy listener")
+	})
+	adapter.On(EventData, func(e Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, e.Data)
+	})
+
+	require.NoError(t, adapter.Open())
+
+	_, err := adapter.Write([]byte("one"))
+	require.NoError(t, err)
+	_, err = adapter.Write([]byte("two"))
+	require.NoError(t, err)
+
+	// Both events still reach the other listener, in order
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(received) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	mu.Lock()
+	assert.Equal(t, [][]byte{[]byte("one"), []byte("two")}, received)
+	mu.Unlock()
+	assert.True(t, adapter.IsOpen())
+}
+
+func TestUSBAdapterEventFloodDropsOldest(t *testing.T) {
+	dev := newFakePrinter("A")
+	adapter, _ := newFakeUSBAdapter(dev)
+	defer adapter.Close()
+
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var received [][]byte
+	adapter.On(EventData, func(e Event) {
+		<-release
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, e.Data)
+	})
+
+	goroutines := runtime.NumGoroutine()
+	const flood = 10 * maxPendingEvents
+	for i := 0; i < flood; i++ {
+		adapter.emit(Event{Type: EventData, Data: []byte(strconv.Itoa(i))})
+	}
+
+	// One dispatcher, however many events were emitted
+	assert.LessOrEqual(t, runtime.NumGoroutine(), goroutines+1)
+
+	adapter.listenersMutex.RLock()
+	pending := len(adapter.pendingEvents)
+	adapter.listenersMutex.RUnlock()
+	assert.LessOrEqual(t, pending, maxPendingEvents)
+
+	close(release)
+	assert.Eventually(t, func() bool {
+		adapter.listenersMutex.RLock()
+		defer adapter.listenersMutex.RUnlock()
+		return !adapter.dispatching
+	}, time.Second, 10*time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	// The first event was taken by the blocked listener before the flood
+	// filled the queue; the newest events all arrive
+	assert.Equal(t, uint64(flood-len(received)), adapter.DroppedEvents())
+	assert.Equal(t, []byte(strconv.Itoa(flood-1)), received[len(received)-1])
+	assert.LessOrEqual(t, len(received), maxPendingEvents+1)
+}
+
+func TestUSBAdapterWriteContextCancelled(t *testing.T) {
+	dev := newFakePrinter("A")
+	a, _ := newFakeUSBAdapter(dev)
+	require.NoError(t, a.Open())
+	defer a.Close()
+
+	ep := dev.config.interfaces[0].out[1]
+	ep.stall = true
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	n, err := a.WriteContext(ctx, []byte("stuck"))
+	assert.Zero(t, n)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	var usbErr *USBError
+	require.ErrorAs(t, err, &usbErr)
+	assert.Equal(t, gousb.TransferTimedOut, usbErr.Code)
+}
+
+func TestUSBAdapterEventsCarryDeviceStrings(t *testing.T) {
+	dev := newFakePrinter("SN-A")
+	dev.product = "TM-T88V"
+	adapter, _ := newFakeUSBAdapter(dev)
+
+	events := make(chan Event, 2)
+	adapter.On(EventConnect, func(e Event) { events <- e })
+	adapter.On(EventClose, func(e Event) { events <- e })
+
+	require.NoError(t, adapter.Open())
+	require.NoError(t, adapter.Close())
+
+	for _, want := range []EventType{EventConnect, EventClose} {
+		select {
+		case e := <-events:
+			assert.Equal(t, want, e.Type)
+			assert.Same(t, dev.handle, e.Device)
+			assert.Equal(t, "SN-A", e.Serial)
+			assert.Equal(t, "TM-T88V", e.Product)
+		case <-time.After(time.Second):
+			t.Fatalf("no %v event", want)
+		}
+	}
+}
+
+func TestFindPrintersSkipsDeviceGoneMidEnumeration(t *testing.T) {
+	a := newFakePrinter("A")
+	gone := newFakePrinter("gone")
+	gone.configErr = gousb.ErrorNoDevice
+	b := newFakePrinter("B")
+	// A fourth device could not even be opened
+	ctx := &fakeContext{devices: []*fakeDevice{a, gone, b}, openErr: gousb.ErrorNoDevice}
+
+	printers := findPrinters(ctx)
+
+	require.Len(t, printers, 2)
+	assert.Same(t, a, printers[0])
+	assert.Same(t, b, printers[1])
+	assert.True(t, gone.isClosed(), "the vanished device's handle should be closed")
+	assert.False(t, a.isClosed())
+	assert.False(t, b.isClosed())
+}
@@ -0,0 +1,90 @@
+package escpos
+
+// Automatic status back (ASB) makes the printer send a 4-byte status
+// packet whenever one of the enabled statuses changes, instead of being
+// polled with DLE EOT. The masks select the statuses, see EnableASB.
+const (
+	ASBDrawer     byte = 0x01
+	ASBOnline     byte = 0x02
+	ASBError      byte = 0x04
+	ASBPaperRoll  byte = 0x08
+	ASBAllStatus       = ASBDrawer | ASBOnline | ASBError | ASBPaperRoll
+	asbPacketSize      = 4
+)
+
+// EnableASB enables automatic status back for the statuses in mask (GS a
+// n); zero disables it. The printer sends a packet right away and then on
+// every change.
+func EnableASB(mask byte) []byte {
+	return []byte{GS, 'a', mask}
+}
+
+// ParseASB decodes a 4-byte automatic status back packet. The second
+// result is false if p is not one.
+func ParseASB(p []byte) (Status, bool) {
+	if len(p) != asbPacketSize || !isASBHeader(p[0]) {
+		return Status{}, false
+	}
+	for _, b := range p[1:] {
+		if !isASBTrailer(b) {
+			return Status{}, false
+		}
+	}
+
+	return Status{
+		DrawerOpen:           p[0]&0x04 != 0,
+		Offline:              p[0]&0x08 != 0,
+		CoverOpen:            p[0]&0x20 != 0,
+		PaperFeeding:         p[0]&0x40 != 0,
+		FeedButton:           p[1]&0x02 != 0,
+		RecoverableError:     p[1]&0x0C != 0,
+		Error:                p[1]&0x20 != 0,
+		AutoRecoverableError: p[1]&0x40 != 0,
+		PaperNearEnd:         p[2]&0x03 != 0,
+		PaperEnd:             p[2]&0x0C != 0,
+	}, true
+}
+
+// isASBHeader reports whether b can start an ASB packet: bits 0, 1 and 7
+// clear and bit 4 set
+func isASBHeader(b byte) bool {
+	return b&0x93 == 0x10
+}
+
+// isASBTrailer reports whether b can follow the first byte of an ASB
+// packet: bits 4 and 7 clear
+func isASBTrailer(b byte) bool {
+	return b&0x90 == 0
+}
+
+// ASBScanner picks automatic status back packets out of the bytes a
+// printer sends, which may split a packet across reads. The zero value is
+// ready to use.
+type ASBScanner struct {
+	pending []byte
+}
+
+// Scan returns the statuses of the packets completed by data and the
+// bytes that are not part of one. A packet still incomplete at the end of
+// data is kept for the next call.
+func (s *ASBScanner) Scan(data []byte) (statuses []Status, other []byte) {
+	for _, b := range data {
+		if len(s.pending) > 0 && !isASBTrailer(b) {
+			// Not a packet after all
+			other = append(other, s.pending...)
+			s.pending = s.pending[:0]
+		}
+		if len(s.pending) == 0 && !isASBHeader(b) {
+			other = append(other, b)
+			continue
+		}
+
+		s.pending = append(s.pending, b)
+		if len(s.pending) == asbPacketSize {
+			status, _ := ParseASB(s.pending)
+			statuses = append(statuses, status)
+			s.pending = s.pending[:0]
+		}
+	}
+	return statuses, other
+}
@@ -0,0 +1,69 @@
+package escpos
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnableASB(t *testing.T) {
+	assert.Equal(t, []byte{0x1D, 'a', 0x0F}, EnableASB(ASBAllStatus))
+	assert.Equal(t, []byte{0x1D, 'a', 0x00}, EnableASB(0))
+}
+
+func TestParseASB(t *testing.T) {
+	tests := []struct {
+		name     string
+		packet   []byte
+		expected Status
+	}{
+		{"ready", []byte{0x10, 0x00, 0x00, 0x00}, Status{}},
+		{"drawer open", []byte{0x14, 0x00, 0x00, 0x00}, Status{DrawerOpen: true}},
+		{"offline cover open", []byte{0x38, 0x00, 0x00, 0x00}, Status{Offline: true, CoverOpen: true}},
+		{"feeding with button", []byte{0x58, 0x02, 0x00, 0x00}, Status{Offline: true, PaperFeeding: true, FeedButton: true}},
+		{"autocutter error", []byte{0x18, 0x08, 0x00, 0x00}, Status{Offline: true, RecoverableError: true}},
+		{"unrecoverable error", []byte{0x18, 0x20, 0x00, 0x00}, Status{Offline: true, Error: true}},
+		{"auto recoverable error", []byte{0x18, 0x40, 0x00, 0x00}, Status{Offline: true, AutoRecoverableError: true}},
+		{"paper near end", []byte{0x10, 0x00, 0x03, 0x00}, Status{PaperNearEnd: true}},
+		{"paper end", []byte{0x18, 0x00, 0x0C, 0x00}, Status{Offline: true, PaperEnd: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, ok := ParseASB(tt.packet)
+			assert.True(t, ok)
+			assert.Equal(t, tt.expected, status)
+		})
+	}
+}
+
+func TestParseASBRejectsOtherData(t *testing.T) {
+	for _, p := range [][]byte{
+		{0x10, 0x00, 0x00},
+		{0x12, 0x00, 0x00, 0x00}, // DLE EOT reply
+		{0x10, 0x00, 0x10, 0x00},
+		{0x90, 0x00, 0x00, 0x00},
+	} {
+		_, ok := ParseASB(p)
+		assert.False(t, ok, "% x", p)
+	}
+}
+
+func TestASBScanner(t *testing.T) {
+	var s ASBScanner
+
+	// A packet split across reads is completed by the next one
+	statuses, other := s.Scan([]byte{0x14, 0x00})
+	assert.Empty(t, statuses)
+	assert.Empty(t, other)
+
+	statuses, other = s.Scan([]byte{0x00, 0x00, 0x10, 0x00, 0x00, 0x00})
+	assert.Equal(t, []Status{{DrawerOpen: true}, {}}, statuses)
+	assert.Empty(t, other)
+
+	// Bytes around packets, and a header not followed by a packet, are
+	// passed through
+	statuses, other = s.Scan([]byte{0x12, 0x10, 0x00, 0x00, 0x00, 0x10, 0x31})
+	assert.Equal(t, []Status{{}}, statuses)
+	assert.Equal(t, []byte{0x12, 0x10, 0x31}, other)
+}
@@ -0,0 +1,143 @@
+package escpos
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Symbology is a GS k barcode system (format 2, m = 65-73)
+type Symbology byte
+
+const (
+	UPCA    Symbology = 65
+	UPCE    Symbology = 66
+	EAN13   Symbology = 67
+	EAN8    Symbology = 68
+	Code39  Symbology = 69
+	ITF     Symbology = 70
+	Codabar Symbology = 71
+	Code93  Symbology = 72
+	Code128 Symbology = 73
+)
+
+var symbologyNames = map[string]Symbology{
+	"UPC-A":   UPCA,
+	"UPC-E":   UPCE,
+	"EAN13":   EAN13,
+	"EAN8":    EAN8,
+	"CODE39":  Code39,
+	"ITF":     ITF,
+	"CODABAR": Codabar,
+	"CODE93":  Code93,
+	"CODE128": Code128,
+}
+
+// ParseSymbology parses a barcode system name such as "EAN13" or "CODE128"
+func ParseSymbology(name string) (Symbology, error) {
+	sym, ok := symbologyNames[strings.ToUpper(name)]
+	if !ok {
+		return 0, fmt.Errorf("unknown barcode symbology %q", name)
+	}
+	return sym, nil
+}
+
+// HRIPosition is where the human readable digits are printed (GS H n)
+type HRIPosition byte
+
+const (
+	HRINone  HRIPosition = 0
+	HRIAbove HRIPosition = 1
+	HRIBelow HRIPosition = 2
+	HRIBoth  HRIPosition = 3
+)
+
+// BarcodeHeight sets the barcode height in dots, 1-255 (GS h n)
+func BarcodeHeight(dots byte) []byte {
+	return []byte{GS, 'h', dots}
+}
+
+// BarcodeWidth sets the module width, 2-6 on most printers (GS w n)
+func BarcodeWidth(n byte) []byte {
+	return []byte{GS, 'w', n}
+}
+
+// BarcodeHRI selects the human readable interpretation position (GS H n)
+func BarcodeHRI(pos HRIPosition) []byte {
+	return []byte{GS, 'H', byte(pos)}
+}
+
+// Barcode prints data as a barcode (GS k m n d1...dn). Data is checked
+// against the character set and length rules of the symbology. CODE128 data
+// without a code set selector is printed with code set B.
+func Barcode(sym Symbology, data string) ([]byte, error) {
+	if sym == Code128 && !strings.HasPrefix(data, "{") {
+		data = "{B" + data
+	}
+	if err := validateBarcode(sym, data); err != nil {
+		return nil, err
+	}
+
+	out := []byte{GS, 'k', byte(sym), byte(len(data))}
+	return append(out, data...), nil
+}
+
+// validateBarcode checks data against the rules of sym
+func validateBarcode(sym Symbology, data string) error {
+	if data == "" {
+		return errors.New("barcode data is empty")
+	}
+	if len(data) > 255 {
+		return fmt.Errorf("barcode data is %d bytes, max 255", len(data))
+	}
+
+	switch sym {
+	case UPCA:
+		return checkDigits(data, 11, 12)
+	case UPCE:
+		if err := checkDigits(data, 6, 8); err == nil {
+			return nil
+		}
+		return checkDigits(data, 11, 12)
+	case EAN13:
+		return checkDigits(data, 12, 13)
+	case EAN8:
+		return checkDigits(data, 7, 8)
+	case Code39:
+		return checkCharset(data, "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ -$%./+*")
+	case ITF:
+		if len(data)%2 != 0 {
+			return errors.New("ITF data must have an even number of digits")
+		}
+		return checkDigits(data, 2, 255)
+	case Codabar:
+		return checkCharset(data, "0123456789ABCDabcd$+-./:")
+	case Code93, Code128:
+		for i := 0; i < len(data); i++ {
+			if data[i] > 127 {
+				return fmt.Errorf("invalid barcode character %q", data[i])
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown barcode symbology %d", sym)
+	}
+}
+
+// checkDigits requires min to max decimal digits
+func checkDigits(data string, min, max int) error {
+	if len(data) < min || len(data) > max {
+		return fmt.Errorf("barcode needs %d-%d digits, got %d", min, max, len(data))
+	}
+	return checkCharset(data, "0123456789")
+}
+
+// checkCharset requires every byte of data to be in charset
+func checkCharset(data, charset string) error {
+	for i := 0; i < len(data); i++ {
+		if strings.IndexByte(charset, data[i]) < 0 {
+			return fmt.Errorf("invalid barcode character %q", data[i])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package escpos
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBarcode(t *testing.T) {
+	testCases := []struct {
+		name     string
+		sym      Symbology
+		data     string
+		expected []byte
+	}{
+		{"EAN13", EAN13, "400638133393", append([]byte{0x1D, 0x6B, 0x43, 12}, "400638133393"...)},
+		{"Code39", Code39, "ABC-123", append([]byte{0x1D, 0x6B, 0x45, 7}, "ABC-123"...)},
+		{"Code128DefaultSet", Code128, "Order42", append([]byte{0x1D, 0x6B, 0x49, 9}, "{BOrder42"...)},
+		{"Code128ExplicitSet", Code128, "{C1234", append([]byte{0x1D, 0x6B, 0x49, 6}, "{C1234"...)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := Barcode(tc.sym, tc.data)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, data)
+		})
+	}
+}
+
+func TestBarcodeInvalid(t *testing.T) {
+	testCases := []struct {
+		name string
+		sym  Symbology
+		data string
+	}{
+		{"Empty", EAN13, ""},
+		{"EAN13TooShort", EAN13, "12345"},
+		{"EAN13Letters", EAN13, "40063813339A"},
+		{"ITFOdd", ITF, "123"},
+		{"Code39Lowercase", Code39, "abc"},
+		{"UnknownSymbology", Symbology(1), "123"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Barcode(tc.sym, tc.data)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestBarcodeSettings(t *testing.T) {
+	assert.Equal(t, []byte{0x1D, 0x68, 80}, BarcodeHeight(80))
+	assert.Equal(t, []byte{0x1D, 0x77, 3}, BarcodeWidth(3))
+	assert.Equal(t, []byte{0x1D, 0x48, 2}, BarcodeHRI(HRIBelow))
+}
+
+func TestParseSymbology(t *testing.T) {
+	sym, err := ParseSymbology("ean13")
+	require.NoError(t, err)
+	assert.Equal(t, EAN13, sym)
+
+	_, err = ParseSymbology("PDF417")
+	assert.Error(t, err)
+}
@@ -0,0 +1,71 @@
+package escpos
+
+// Builder assembles a print job from commands. Methods can be chained; the
+// first invalid command is reported by Bytes and later calls are ignored.
+type Builder struct {
+	buf []byte
+	err error
+}
+
+// NewBuilder returns a Builder for a job starting with Init
+func NewBuilder() *Builder {
+	return &Builder{buf: Init()}
+}
+
+// Raw appends raw bytes
+func (b *Builder) Raw(data []byte) *Builder {
+	if b.err == nil {
+		b.buf = append(b.buf, data...)
+	}
+	return b
+}
+
+// Text appends text followed by a line feed
+func (b *Builder) Text(line string) *Builder {
+	if b.err == nil {
+		b.buf = append(b.buf, line...)
+		b.buf = append(b.buf, LF)
+	}
+	return b
+}
+
+// Feed feeds n lines
+func (b *Builder) Feed(n byte) *Builder {
+	return b.Raw(Feed(n))
+}
+
+// Cut performs a full cut
+func (b *Builder) Cut() *Builder {
+	return b.Raw(Cut())
+}
+
+// TextSize sets the character size multipliers, see TextSize
+func (b *Builder) TextSize(widthMul, heightMul int) *Builder {
+	return b.add(TextSize(widthMul, heightMul))
+}
+
+// QRCode appends a QR code, see QRCode
+func (b *Builder) QRCode(data string, size int, ecc ECCLevel) *Builder {
+	return b.add(QRCode(data, size, ecc))
+}
+
+// Barcode appends a barcode, see Barcode
+func (b *Builder) Barcode(sym Symbology, data string) *Builder {
+	return b.add(Barcode(sym, data))
+}
+
+// Bytes returns the job, or the first error encountered while building it
+func (b *Builder) Bytes() ([]byte, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	return b.buf, nil
+}
+
+// add appends the result of a validating command helper
+func (b *Builder) add(data []byte, err error) *Builder {
+	if b.err == nil && err != nil {
+		b.err = err
+	}
+	return b.Raw(data)
+}
@@ -0,0 +1,36 @@
+package escpos
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuilder(t *testing.T) {
+	data, err := NewBuilder().
+		Text("Hello").
+		Barcode(EAN8, "1234567").
+		Feed(2).
+		Cut().
+		Bytes()
+	require.NoError(t, err)
+
+	expected := []byte{0x1B, 0x40}
+	expected = append(expected, "Hello\n"...)
+	expected = append(expected, 0x1D, 0x6B, 0x44, 7)
+	expected = append(expected, "1234567"...)
+	expected = append(expected, 0x1B, 0x64, 2)
+	expected = append(expected, 0x1D, 0x56, 0x41, 0x00)
+	assert.Equal(t, expected, data)
+}
+
+func TestBuilderKeepsFirstError(t *testing.T) {
+	data, err := NewBuilder().
+		QRCode("", 6, ECCMedium).
+		Barcode(EAN13, "x").
+		Text("ignored").
+		Bytes()
+	assert.ErrorContains(t, err, "QR code data is empty")
+	assert.Nil(t, data)
+}
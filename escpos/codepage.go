@@ -0,0 +1,89 @@
+package escpos
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// EncodeText converts UTF-8 text to code page PC437, the table printers
+// select at power-on (ESC t 0). Characters PC437 lacks print as '?', and
+// CRLF line breaks become LF.
+func EncodeText(text string) []byte {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+
+	out := make([]byte, 0, len(text))
+	for _, r := range text {
+		if r < 0x80 {
+			out = append(out, byte(r))
+			continue
+		}
+		b, ok := charmap.CodePage437.EncodeRune(r)
+		if !ok {
+			b = '?'
+		}
+		out = append(out, b)
+	}
+	return out
+}
+
+// CodePage is a character code table number as selected with ESC t
+type CodePage byte
+
+// Character code tables common to ESC/POS printers
+const (
+	CodePagePC437    CodePage = 0
+	CodePageKatakana CodePage = 1
+	CodePagePC850    CodePage = 2
+	CodePagePC860    CodePage = 3
+	CodePagePC863    CodePage = 4
+	CodePagePC865    CodePage = 5
+	CodePageWPC1252  CodePage = 16
+	CodePagePC866    CodePage = 17
+	CodePagePC852    CodePage = 18
+	CodePagePC858    CodePage = 19
+)
+
+var codePageNames = map[CodePage]string{
+	CodePagePC437:    "PC437",
+	CodePageKatakana: "Katakana",
+	CodePagePC850:    "PC850",
+	CodePagePC860:    "PC860",
+	CodePagePC863:    "PC863",
+	CodePagePC865:    "PC865",
+	CodePageWPC1252:  "WPC1252",
+	CodePagePC866:    "PC866",
+	CodePagePC852:    "PC852",
+	CodePagePC858:    "PC858",
+}
+
+func (cp CodePage) String() string {
+	if name, ok := codePageNames[cp]; ok {
+		return name
+	}
+	return fmt.Sprintf("code page %d", byte(cp))
+}
+
+// SelectCodePage selects the character code table (ESC t n)
+func SelectCodePage(cp CodePage) []byte {
+	return []byte{ESC, 't', byte(cp)}
+}
+
+// ParseCodePageReply decodes a printer's reply to a code page query: the
+// table number in ASCII decimal, optionally preceded by a header and
+// setting number ending in the separator 0x1F, as in Epson's transmission
+// of customized values. The NUL terminating the reply must be stripped.
+func ParseCodePageReply(reply []byte) (CodePage, error) {
+	value := reply
+	if i := bytes.LastIndexByte(reply, 0x1F); i >= 0 {
+		value = reply[i+1:]
+	}
+	n, err := strconv.ParseUint(string(value), 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected code page reply % x", reply)
+	}
+	return CodePage(n), nil
+}
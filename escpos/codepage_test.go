@@ -0,0 +1,36 @@
+package escpos
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeText(t *testing.T) {
+	assert.Equal(t, []byte("Total\n"), EncodeText("Total\r\n"))
+	// é and £ are in PC437, € is not
+	assert.Equal(t, []byte{'C', 'a', 'f', 0x82, ' ', 0x9C, '3', ' ', '?'}, EncodeText("Café £3 €"))
+}
+
+func TestSelectCodePage(t *testing.T) {
+	assert.Equal(t, []byte{0x1B, 't', 16}, SelectCodePage(CodePageWPC1252))
+	assert.Equal(t, "WPC1252", CodePageWPC1252.String())
+	assert.Equal(t, "code page 99", CodePage(99).String())
+}
+
+func TestParseCodePageReply(t *testing.T) {
+	cp, err := ParseCodePageReply([]byte("19"))
+	require.NoError(t, err)
+	assert.Equal(t, CodePagePC858, cp)
+
+	// Customized value transmission: header, setting number, separator
+	cp, err = ParseCodePageReply([]byte{0x37, 0x27, '8', 0x1F, '2'})
+	require.NoError(t, err)
+	assert.Equal(t, CodePagePC850, cp)
+
+	_, err = ParseCodePageReply(nil)
+	assert.Error(t, err)
+	_, err = ParseCodePageReply([]byte("300"))
+	assert.Error(t, err)
+}
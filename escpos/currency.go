@@ -0,0 +1,70 @@
+package escpos
+
+import (
+	"strconv"
+	"strings"
+)
+
+// CurrencyFormat formats prices given in minor units, e.g. cents, for
+// receipt items
+type CurrencyFormat struct {
+	// Symbol is printed before the amount, e.g. "$", or after it with
+	// SymbolAfter, e.g. " €" (include the space if one is wanted)
+	Symbol      string
+	SymbolAfter bool
+	// Thousands groups the integer digits by three, e.g. ","; empty
+	// prints them ungrouped
+	Thousands string
+	// Decimal separates the fraction; empty uses "."
+	Decimal string
+	// Decimals is the number of minor unit digits, e.g. 2 for cents. A
+	// price of 123456 with 2 decimals is 1234.56.
+	Decimals int
+}
+
+// Format formats price, in minor units, e.g. "$1,234.56" or "-$3.50"
+func (f CurrencyFormat) Format(price int64) string {
+	negative := price < 0
+	digits := strconv.FormatUint(absUint(price), 10)
+
+	// Pad so there is at least one integer digit
+	if len(digits) <= f.Decimals {
+		digits = strings.Repeat("0", f.Decimals-len(digits)+1) + digits
+	}
+	integer, fraction := digits[:len(digits)-f.Decimals], digits[len(digits)-f.Decimals:]
+
+	var b strings.Builder
+	if negative {
+		b.WriteByte('-')
+	}
+	if !f.SymbolAfter {
+		b.WriteString(f.Symbol)
+	}
+	for i, d := range integer {
+		if i > 0 && f.Thousands != "" && (len(integer)-i)%3 == 0 {
+			b.WriteString(f.Thousands)
+		}
+		b.WriteRune(d)
+	}
+	if f.Decimals > 0 {
+		decimal := f.Decimal
+		if decimal == "" {
+			decimal = "."
+		}
+		b.WriteString(decimal)
+		b.WriteString(fraction)
+	}
+	if f.SymbolAfter {
+		b.WriteString(f.Symbol)
+	}
+	return b.String()
+}
+
+// absUint returns the magnitude of n, which unlike -n also works for the
+// smallest int64
+func absUint(n int64) uint64 {
+	if n < 0 {
+		return uint64(-(n + 1)) + 1
+	}
+	return uint64(n)
+}
@@ -0,0 +1,38 @@
+package escpos
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCurrencyFormat(t *testing.T) {
+	dollars := CurrencyFormat{Symbol: "$", Thousands: ",", Decimals: 2}
+	euros := CurrencyFormat{Symbol: " €", SymbolAfter: true, Thousands: ".", Decimal: ",", Decimals: 2}
+	yen := CurrencyFormat{Symbol: "¥", Thousands: ","}
+
+	tests := []struct {
+		name     string
+		format   CurrencyFormat
+		price    int64
+		expected string
+	}{
+		{"zero", dollars, 0, "$0.00"},
+		{"cents", dollars, 5, "$0.05"},
+		{"below a thousand", dollars, 99999, "$999.99"},
+		{"thousands", dollars, 123456, "$1,234.56"},
+		{"millions", dollars, 123456789, "$1,234,567.89"},
+		{"negative", dollars, -350, "-$3.50"},
+		{"symbol after", euros, 1234550, "12.345,50 €"},
+		{"no decimals", yen, 1234567, "¥1,234,567"},
+		{"no grouping", CurrencyFormat{Decimals: 3}, 1234567, "1234.567"},
+		{"smallest", CurrencyFormat{}, math.MinInt64, "-9223372036854775808"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.format.Format(tt.price))
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package escpos
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+)
+
+// PatternKind selects a print-head diagnostic pattern
+type PatternKind int
+
+const (
+	// PatternSolid is a solid black band; white streaks through it point
+	// to dead heating elements
+	PatternSolid PatternKind = iota
+	// PatternCheckerboard alternates 8 dot squares, showing elements that
+	// stick on or off and uneven paper feed
+	PatternCheckerboard
+	// PatternGradient ramps from white to black across the head using an
+	// ordered dither, showing banding and uneven density
+	PatternGradient
+)
+
+// Diagnostic pattern geometry in dots
+const (
+	patternHeight = 96
+	checkerSize   = 8
+)
+
+// bayer4 is a 4x4 ordered dither matrix scaled to 0-255
+var bayer4 = [4][4]uint8{
+	{0, 128, 32, 160},
+	{192, 64, 224, 96},
+	{48, 176, 16, 144},
+	{240, 112, 208, 80},
+}
+
+// DiagnosticPattern returns a raster test pattern widthDots wide, e.g. 576
+// for an 80mm head, for a technician to print and inspect
+func DiagnosticPattern(kind PatternKind, widthDots int) ([]byte, error) {
+	if widthDots < 1 || widthDots > RasterMaxWidthBytes*8 {
+		return nil, fmt.Errorf("pattern width %d out of range 1-%d", widthDots, RasterMaxWidthBytes*8)
+	}
+
+	img := image.NewGray(image.Rect(0, 0, widthDots, patternHeight))
+	for y := 0; y < patternHeight; y++ {
+		for x := 0; x < widthDots; x++ {
+			var black bool
+			switch kind {
+			case PatternSolid:
+				black = true
+			case PatternCheckerboard:
+				black = (x/checkerSize+y/checkerSize)%2 == 0
+			case PatternGradient:
+				level := x * 256 / widthDots
+				black = level > int(bayer4[y%4][x%4])
+			default:
+				return nil, fmt.Errorf("unknown pattern kind %d", kind)
+			}
+			if !black {
+				img.SetGray(x, y, color.Gray{Y: 0xFF})
+			}
+		}
+	}
+
+	return RasterImageBanded(img, RasterOptions{}, DefaultMaxBandHeight)
+}
@@ -0,0 +1,53 @@
+package escpos
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiagnosticPattern(t *testing.T) {
+	testCases := []struct {
+		name string
+		kind PatternKind
+	}{
+		{"pattern_solid", PatternSolid},
+		{"pattern_checkerboard", PatternCheckerboard},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := DiagnosticPattern(tc.kind, 32)
+			require.NoError(t, err)
+			assert.Equal(t, []byte{0x1D, 'v', '0', 0, 4, 0, 96, 0}, data[:8])
+			assertGolden(t, tc.name, data)
+		})
+	}
+}
+
+func TestDiagnosticPatternRows(t *testing.T) {
+	solid, err := DiagnosticPattern(PatternSolid, 16)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0xFF, 0xFF}, solid[8:10])
+
+	checker, err := DiagnosticPattern(PatternCheckerboard, 16)
+	require.NoError(t, err)
+	// Rows 0-7 start black, rows 8-15 start white
+	assert.Equal(t, []byte{0xFF, 0x00}, checker[8:10])
+	assert.Equal(t, []byte{0x00, 0xFF}, checker[8+8*2:8+8*2+2])
+
+	gradient, err := DiagnosticPattern(PatternGradient, 64)
+	require.NoError(t, err)
+	// White at the left edge, black at the right
+	assert.Zero(t, gradient[8]&0x80)
+	assert.Equal(t, byte(0xFF), gradient[8+7])
+}
+
+func TestDiagnosticPatternInvalid(t *testing.T) {
+	_, err := DiagnosticPattern(PatternKind(9), 32)
+	assert.Error(t, err)
+
+	_, err = DiagnosticPattern(PatternSolid, 0)
+	assert.Error(t, err)
+}
@@ -0,0 +1,58 @@
+// Package escpos builds ESC/POS command sequences for thermal receipt printers.
+//
+// Command helpers return the raw bytes of a single command so they can be
+// concatenated into a job and written to an adapter.Adapter.
+package escpos
+
+// Control codes used to build commands
+const (
+	LF  byte = 0x0A
+	FF  byte = 0x0C
+	DLE byte = 0x10
+	ESC byte = 0x1B
+	GS  byte = 0x1D
+)
+
+// Init resets the printer to its power-on settings (ESC @)
+func Init() []byte {
+	return []byte{ESC, '@'}
+}
+
+// ClearBuffer discards the data in the printer's receive and print buffers
+// (DLE DC4 8 1 3 20 1 6 2 8). It is a real-time command, executed as soon
+// as it arrives even if the buffer holds an unfinished command. The printer
+// answers with 37H 25H NUL once the buffers are clear.
+func ClearBuffer() []byte {
+	return []byte{DLE, 0x14, 8, 1, 3, 20, 1, 6, 2, 8}
+}
+
+// Feed prints the buffer and feeds n lines (ESC d n)
+func Feed(n byte) []byte {
+	return []byte{ESC, 'd', n}
+}
+
+// Cut feeds the paper to the cutting position and performs a full cut
+// (GS V 65 0)
+func Cut() []byte {
+	return []byte{GS, 'V', 65, 0}
+}
+
+// PartialCut feeds the paper to the cutting position and performs a partial
+// cut, leaving one point uncut (GS V 66 0)
+func PartialCut() []byte {
+	return []byte{GS, 'V', 66, 0}
+}
+
+// FeedPartialCut feeds the paper to the cutting position plus n motion
+// units and performs a partial cut (GS V 66 n)
+func FeedPartialCut(n byte) []byte {
+	return []byte{GS, 'V', 66, n}
+}
+
+// boolByte encodes an on/off command parameter
+func boolByte(on bool) byte {
+	if on {
+		return 1
+	}
+	return 0
+}
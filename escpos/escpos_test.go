@@ -0,0 +1,15 @@
+package escpos
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBasicCommands(t *testing.T) {
+	assert.Equal(t, []byte{0x1B, 0x40}, Init())
+	assert.Equal(t, []byte{0x1B, 0x64, 0x03}, Feed(3))
+	assert.Equal(t, []byte{0x1D, 0x56, 0x41, 0x00}, Cut())
+	assert.Equal(t, []byte{0x1D, 0x56, 0x42, 0x00}, PartialCut())
+	assert.Equal(t, []byte{0x10, 0x14, 0x08, 0x01, 0x03, 0x14, 0x01, 0x06, 0x02, 0x08}, ClearBuffer())
+}
@@ -0,0 +1,77 @@
+package escpos
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ECCLevel is the QR code error correction level
+type ECCLevel byte
+
+const (
+	ECCLow      ECCLevel = 48 // L, ~7% recovery
+	ECCMedium   ECCLevel = 49 // M, ~15% recovery
+	ECCQuartile ECCLevel = 50 // Q, ~25% recovery
+	ECCHigh     ECCLevel = 51 // H, ~30% recovery
+)
+
+// QR code limits
+const (
+	QRMinSize = 1
+	QRMaxSize = 16
+	// QRMaxData is the capacity of a model 2 symbol at ECC level L
+	QRMaxData = 7089
+)
+
+// ParseECC parses an error correction level name (L, M, Q or H)
+func ParseECC(name string) (ECCLevel, error) {
+	switch strings.ToUpper(name) {
+	case "L":
+		return ECCLow, nil
+	case "M":
+		return ECCMedium, nil
+	case "Q":
+		return ECCQuartile, nil
+	case "H":
+		return ECCHigh, nil
+	default:
+		return 0, fmt.Errorf("invalid QR error correction level %q", name)
+	}
+}
+
+// QRCode encodes and prints data as a model 2 QR code with the given module
+// size in dots (1-16), using the GS ( k functions 165, 167, 169, 180 and 181
+func QRCode(data string, size int, ecc ECCLevel) ([]byte, error) {
+	if data == "" {
+		return nil, errors.New("QR code data is empty")
+	}
+	if len(data) > QRMaxData {
+		return nil, fmt.Errorf("QR code data is %d bytes, max %d", len(data), QRMaxData)
+	}
+	if size < QRMinSize || size > QRMaxSize {
+		return nil, fmt.Errorf("QR code size %d out of range %d-%d", size, QRMinSize, QRMaxSize)
+	}
+	if ecc < ECCLow || ecc > ECCHigh {
+		return nil, fmt.Errorf("invalid QR error correction level %d", ecc)
+	}
+
+	out := qrFunction('A', 50, 0)                     // fn 165: model 2
+	out = append(out, qrFunction('C', byte(size))...) // fn 167: module size
+	out = append(out, qrFunction('E', byte(ecc))...)  // fn 169: error correction
+
+	// fn 180: store the data in the symbol storage area
+	stored := len(data) + 3
+	out = append(out, GS, '(', 'k', byte(stored), byte(stored>>8), '1', 'P', '0')
+	out = append(out, data...)
+
+	out = append(out, qrFunction('Q', '0')...) // fn 181: print the symbol
+	return out, nil
+}
+
+// qrFunction encodes a fixed-size GS ( k function for the QR symbol (cn 49)
+func qrFunction(fn byte, params ...byte) []byte {
+	n := len(params) + 2
+	out := []byte{GS, '(', 'k', byte(n), byte(n >> 8), '1', fn}
+	return append(out, params...)
+}
@@ -0,0 +1,60 @@
+package escpos
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQRCode(t *testing.T) {
+	data, err := QRCode("hello", 6, ECCMedium)
+	require.NoError(t, err)
+
+	expected := []byte{
+		0x1D, 0x28, 0x6B, 0x04, 0x00, 0x31, 0x41, 0x32, 0x00, // model 2
+		0x1D, 0x28, 0x6B, 0x03, 0x00, 0x31, 0x43, 0x06, // size 6
+		0x1D, 0x28, 0x6B, 0x03, 0x00, 0x31, 0x45, 0x31, // ECC M
+		0x1D, 0x28, 0x6B, 0x08, 0x00, 0x31, 0x50, 0x30, 'h', 'e', 'l', 'l', 'o', // store
+		0x1D, 0x28, 0x6B, 0x03, 0x00, 0x31, 0x51, 0x30, // print
+	}
+	assert.Equal(t, expected, data)
+}
+
+func TestQRCodeLongDataLength(t *testing.T) {
+	data, err := QRCode(strings.Repeat("x", 300), 4, ECCLow)
+	require.NoError(t, err)
+
+	// 300 + 3 = 0x012F, little endian
+	store := data[25:33]
+	assert.Equal(t, []byte{0x1D, 0x28, 0x6B, 0x2F, 0x01, 0x31, 0x50, 0x30}, store)
+}
+
+func TestQRCodeInvalid(t *testing.T) {
+	_, err := QRCode("", 6, ECCMedium)
+	assert.Error(t, err)
+
+	_, err = QRCode("x", 0, ECCMedium)
+	assert.Error(t, err)
+
+	_, err = QRCode("x", 17, ECCMedium)
+	assert.Error(t, err)
+
+	_, err = QRCode("x", 6, ECCLevel(7))
+	assert.Error(t, err)
+
+	_, err = QRCode(strings.Repeat("x", QRMaxData+1), 6, ECCLow)
+	assert.Error(t, err)
+}
+
+func TestParseECC(t *testing.T) {
+	for name, expected := range map[string]ECCLevel{"L": ECCLow, "m": ECCMedium, "Q": ECCQuartile, "H": ECCHigh} {
+		ecc, err := ParseECC(name)
+		require.NoError(t, err)
+		assert.Equal(t, expected, ecc)
+	}
+
+	_, err := ParseECC("X")
+	assert.Error(t, err)
+}
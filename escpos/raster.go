@@ -0,0 +1,165 @@
+package escpos
+
+import (
+	"errors"
+	"fmt"
+	"image"
+)
+
+// RasterScale selects the GS v 0 print mode
+type RasterScale byte
+
+const (
+	RasterNormal       RasterScale = 0
+	RasterDoubleWidth  RasterScale = 1
+	RasterDoubleHeight RasterScale = 2
+	RasterQuadruple    RasterScale = 3
+)
+
+// Raster image limits. GS v 0 encodes the width in bytes and the height in
+// dots as 16 bit values.
+const (
+	RasterMaxWidthBytes = 0xFFFF
+	RasterMaxHeight     = 0xFFFF
+	// DefaultMaxBandHeight is a band height that fits the image buffer of
+	// common 80mm printers at full width
+	DefaultMaxBandHeight = 256
+)
+
+// defaultThreshold is the luminance below which a pixel prints black
+const defaultThreshold = 128
+
+// ErrImageTooWide is returned for an image wider than RasterOptions.MaxWidth
+var ErrImageTooWide = errors.New("image is wider than the print head")
+
+// RasterOptions controls how an image is converted to a raster command
+type RasterOptions struct {
+	// Threshold is the 8 bit luminance below which a pixel prints; zero
+	// uses 128
+	Threshold uint8
+	// Scale enlarges the printed image
+	Scale RasterScale
+	// MaxWidth is the print head width in dots, e.g. 576 for 80mm paper.
+	// An image printing wider fails with ErrImageTooWide unless FitWidth
+	// is set. Zero disables the check.
+	MaxWidth int
+	// FitWidth scales an over-wide image down to MaxWidth, keeping its
+	// aspect ratio, instead of rejecting it
+	FitWidth bool
+}
+
+// RasterImage prints img as a single raster bit image (GS v 0). Pixels are
+// printed black when darker than the threshold; transparent pixels are
+// white. The width is padded to a multiple of 8 dots.
+func RasterImage(img image.Image, opts RasterOptions) ([]byte, error) {
+	bits, widthBytes, height, err := rasterize(img, opts)
+	if err != nil {
+		return nil, err
+	}
+	if height > RasterMaxHeight {
+		return nil, fmt.Errorf("image is %d dots tall, max %d", height, RasterMaxHeight)
+	}
+	return rasterBand(opts.Scale, widthBytes, bits), nil
+}
+
+// RasterImageBanded prints img as consecutive GS v 0 bands of at most
+// maxBandHeight dots, so a tall image never exceeds the printer's image
+// buffer. The bands print back to back without gaps.
+func RasterImageBanded(img image.Image, opts RasterOptions, maxBandHeight int) ([]byte, error) {
+	if maxBandHeight < 1 || maxBandHeight > RasterMaxHeight {
+		return nil, fmt.Errorf("band height %d out of range 1-%d", maxBandHeight, RasterMaxHeight)
+	}
+
+	bits, widthBytes, _, err := rasterize(img, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []byte
+	bandSize := widthBytes * maxBandHeight
+	for start := 0; start < len(bits); start += bandSize {
+		end := min(start+bandSize, len(bits))
+		out = append(out, rasterBand(opts.Scale, widthBytes, bits[start:end])...)
+	}
+	return out, nil
+}
+
+// rasterize converts img to rows of packed bits, most significant bit
+// leftmost, returning the bits with the row width in bytes and the height
+func rasterize(img image.Image, opts RasterOptions) ([]byte, int, int, error) {
+	if opts.Scale > RasterQuadruple {
+		return nil, 0, 0, fmt.Errorf("invalid raster scale %d", opts.Scale)
+	}
+
+	bounds := img.Bounds()
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+	if srcWidth == 0 || srcHeight == 0 {
+		return nil, 0, 0, errors.New("image is empty")
+	}
+
+	width, height, err := fitWidth(srcWidth, srcHeight, opts)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	widthBytes := (width + 7) / 8
+	if widthBytes > RasterMaxWidthBytes {
+		return nil, 0, 0, fmt.Errorf("image is %d dots wide, max %d", width, RasterMaxWidthBytes*8)
+	}
+
+	threshold := uint32(opts.Threshold)
+	if threshold == 0 {
+		threshold = defaultThreshold
+	}
+
+	bits := make([]byte, widthBytes*height)
+	// Nearest neighbour sampling when the image was scaled to fit
+	for y := 0; y < height; y++ {
+		srcY := y * srcHeight / height
+		for x := 0; x < width; x++ {
+			srcX := x * srcWidth / width
+			if luminance(img, bounds.Min.X+srcX, bounds.Min.Y+srcY) < threshold {
+				bits[y*widthBytes+x/8] |= 0x80 >> (x % 8)
+			}
+		}
+	}
+	return bits, widthBytes, height, nil
+}
+
+// fitWidth returns the size to rasterize an image at so it prints within
+// opts.MaxWidth, allowing for double width scaling
+func fitWidth(width, height int, opts RasterOptions) (int, int, error) {
+	if opts.MaxWidth <= 0 {
+		return width, height, nil
+	}
+
+	maxWidth := opts.MaxWidth
+	if opts.Scale&RasterDoubleWidth != 0 {
+		maxWidth /= 2
+	}
+	if width <= maxWidth {
+		return width, height, nil
+	}
+	if !opts.FitWidth || maxWidth < 1 {
+		return 0, 0, fmt.Errorf("%w: %d dots, head is %d", ErrImageTooWide, width, maxWidth)
+	}
+	return maxWidth, max(height*maxWidth/width, 1), nil
+}
+
+// luminance returns the 8 bit luminance of a pixel composited over white
+func luminance(img image.Image, x, y int) uint32 {
+	r, g, b, a := img.At(x, y).RGBA()
+	// Colors are alpha-premultiplied; adding the uncovered part of white
+	// composites them over paper
+	white := 0xFFFF - a
+	lum := (299*(r+white) + 587*(g+white) + 114*(b+white)) / 1000
+	return lum >> 8
+}
+
+// rasterBand encodes one GS v 0 command for rows of widthBytes each
+func rasterBand(scale RasterScale, widthBytes int, bits []byte) []byte {
+	height := len(bits) / widthBytes
+	out := []byte{GS, 'v', '0', byte(scale),
+		byte(widthBytes), byte(widthBytes >> 8),
+		byte(height), byte(height >> 8)}
+	return append(out, bits...)
+}
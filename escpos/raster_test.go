@@ -0,0 +1,120 @@
+package escpos
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stripes returns a white image of width x height with every other row
+// black in its first columns dots
+func stripes(width, height, columns int) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetGray(x, y, color.Gray{Y: 0xFF})
+			if y%2 == 0 && x < columns {
+				img.SetGray(x, y, color.Gray{Y: 0})
+			}
+		}
+	}
+	return img
+}
+
+func TestRasterImage(t *testing.T) {
+	data, err := RasterImage(stripes(10, 3, 9), RasterOptions{})
+	require.NoError(t, err)
+
+	assert.Equal(t, []byte{
+		0x1D, 'v', '0', 0, 2, 0, 3, 0,
+		0xFF, 0x80,
+		0x00, 0x00,
+		0xFF, 0x80,
+	}, data)
+}
+
+func TestRasterImageTransparentIsWhite(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 8, 1))
+	img.Set(0, 0, color.NRGBA{A: 0xFF})
+
+	data, err := RasterImage(img, RasterOptions{Scale: RasterDoubleWidth})
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x1D, 'v', '0', 1, 1, 0, 1, 0, 0x80}, data)
+}
+
+func TestRasterImageBanded(t *testing.T) {
+	img := stripes(16, 50, 16)
+
+	data, err := RasterImageBanded(img, RasterOptions{}, 20)
+	require.NoError(t, err)
+
+	// Three bands of 20, 20 and 10 rows, each with its own header
+	var heights []int
+	for len(data) > 0 {
+		require.GreaterOrEqual(t, len(data), 8)
+		assert.Equal(t, []byte{0x1D, 'v', '0', 0, 2, 0}, data[:6])
+		height := int(data[6]) | int(data[7])<<8
+		heights = append(heights, height)
+
+		band := data[8 : 8+2*height]
+		assert.Equal(t, []byte{0xFF, 0xFF, 0x00, 0x00}, band[:4])
+		data = data[8+2*height:]
+	}
+	assert.Equal(t, []int{20, 20, 10}, heights)
+	assert.Empty(t, Validate(append(mustRaster(t, img, 20), Cut()...)))
+}
+
+func TestRasterImageBandedFitsOneBand(t *testing.T) {
+	img := stripes(8, 4, 8)
+
+	single, err := RasterImage(img, RasterOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, single, mustRaster(t, img, DefaultMaxBandHeight))
+}
+
+func TestRasterImageInvalid(t *testing.T) {
+	_, err := RasterImage(image.NewGray(image.Rect(0, 0, 0, 0)), RasterOptions{})
+	assert.Error(t, err)
+
+	_, err = RasterImage(stripes(8, 1, 8), RasterOptions{Scale: 4})
+	assert.Error(t, err)
+
+	_, err = RasterImageBanded(stripes(8, 1, 8), RasterOptions{}, 0)
+	assert.Error(t, err)
+}
+
+func TestRasterImageTooWide(t *testing.T) {
+	_, err := RasterImage(stripes(600, 2, 600), RasterOptions{MaxWidth: 576})
+	assert.ErrorIs(t, err, ErrImageTooWide)
+
+	// Double width prints each dot twice
+	_, err = RasterImage(stripes(300, 2, 300), RasterOptions{MaxWidth: 576, Scale: RasterDoubleWidth})
+	assert.ErrorIs(t, err, ErrImageTooWide)
+
+	_, err = RasterImage(stripes(576, 2, 576), RasterOptions{MaxWidth: 576})
+	assert.NoError(t, err)
+}
+
+func TestRasterImageFitWidth(t *testing.T) {
+	// 32x8 with every other row black in the left half, scaled to 16x4
+	data, err := RasterImage(stripes(32, 8, 16), RasterOptions{MaxWidth: 16, FitWidth: true})
+	require.NoError(t, err)
+
+	assert.Equal(t, []byte{
+		0x1D, 'v', '0', 0, 2, 0, 4, 0,
+		0xFF, 0x00,
+		0xFF, 0x00,
+		0xFF, 0x00,
+		0xFF, 0x00,
+	}, data)
+}
+
+func mustRaster(t *testing.T, img image.Image, maxBandHeight int) []byte {
+	t.Helper()
+	data, err := RasterImageBanded(img, RasterOptions{}, maxBandHeight)
+	require.NoError(t, err)
+	return data
+}
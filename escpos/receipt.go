@@ -0,0 +1,256 @@
+package escpos
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Rotation is the orientation of a rendered Receipt on the paper
+type Rotation int
+
+const (
+	// RotateNone prints top to bottom as usual
+	RotateNone Rotation = 0
+	// Rotate90 lays the receipt out sideways using page mode, for landscape labels
+	Rotate90 Rotation = 90
+	// Rotate180 prints the receipt upside down, last line first, so it
+	// reads correctly when the paper is turned around
+	Rotate180 Rotation = 180
+)
+
+// ErrIncompatibleRotation is returned when rotation modes that the printer
+// cannot combine are requested together
+var ErrIncompatibleRotation = errors.New("incompatible rotation modes")
+
+// DefaultCharWidth is the font A line width used when neither the receipt
+// nor the printer specify one (80mm paper)
+const DefaultCharWidth = 48
+
+// CharWidther is implemented by adapters that know how many font A
+// characters fit on a line, such as adapter.USBAdapter
+type CharWidther interface {
+	CharWidth() int
+}
+
+// Receipt is a simple text receipt: free text lines followed by items laid
+// out in two columns and an optional total
+type Receipt struct {
+	Lines []string
+	Items []Item
+	// Total is printed after the items in double width and height
+	// characters, e.g. the amount due. Nil prints no total.
+	Total *Item
+	// Width is the number of font A characters per line. Zero uses the
+	// printer's width with RenderFor, or DefaultCharWidth.
+	Width int
+	// Font used for the whole receipt. Font B fits more columns.
+	Font Font
+	// Rotation of the whole receipt
+	Rotation Rotation
+	// RotateChars rotates each character 90° clockwise (ESC V). Only
+	// supported with RotateNone.
+	RotateChars bool
+	// Currency formats the Price of items and the total that have no
+	// Amount. Nil prints such items without an amount.
+	Currency *CurrencyFormat
+	// WrapNames continues item names that do not fit beside the amount on
+	// the following lines, instead of truncating them
+	WrapNames bool
+}
+
+// Item is a receipt row with a left-aligned name and right-aligned amount
+type Item struct {
+	Name string
+	// Amount is printed as is. If empty, Price is formatted with the
+	// receipt's Currency instead.
+	Amount string
+	// Price in minor units, e.g. cents, see CurrencyFormat
+	Price int64
+}
+
+// amount returns the text to print in the item's amount column
+func (i Item) amount(currency *CurrencyFormat) string {
+	if i.Amount != "" || currency == nil {
+		return i.Amount
+	}
+	return currency.Format(i.Price)
+}
+
+// receiptLine is a laid out line of text
+type receiptLine struct {
+	text string
+	// large lines are printed in double size characters
+	large bool
+}
+
+// totalSize is the character size multiplier of the total line
+const totalSize = 2
+
+// Validate checks that the receipt's rotation modes can be combined
+func (r Receipt) Validate() error {
+	switch r.Rotation {
+	case RotateNone:
+		return nil
+	case Rotate90, Rotate180:
+		if r.RotateChars {
+			// ESC V is ignored in page mode and undefined with ESC {
+			return fmt.Errorf("%w: character rotation with %d° layout", ErrIncompatibleRotation, r.Rotation)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported rotation %d°", r.Rotation)
+	}
+}
+
+// RenderFor encodes the receipt using the printer's character width unless
+// the receipt sets its own
+func (r Receipt) RenderFor(printer CharWidther) ([]byte, error) {
+	if r.Width == 0 {
+		r.Width = printer.CharWidth()
+	}
+	return r.Render()
+}
+
+// Render encodes the receipt as ESC/POS bytes
+func (r Receipt) Render() ([]byte, error) {
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+
+	width := r.Width
+	if width <= 0 {
+		width = DefaultCharWidth
+	}
+	lines := r.layout(Columns(width, r.Font))
+
+	out := Init()
+	if r.Font != FontA {
+		out = append(out, SelectFont(r.Font)...)
+	}
+
+	switch r.Rotation {
+	case Rotate90:
+		out = append(out, PageMode()...)
+		out = append(out, PrintDirection(DirectionTopToBottom)...)
+		out = appendLines(out, lines)
+		out = append(out, PrintPage()...)
+	case Rotate180:
+		reversed := make([]receiptLine, len(lines))
+		for i, line := range lines {
+			reversed[len(lines)-1-i] = line
+		}
+		out = append(out, UpsideDown(true)...)
+		out = appendLines(out, reversed)
+		out = append(out, UpsideDown(false)...)
+	default:
+		if r.RotateChars {
+			out = append(out, RotateClockwise(true)...)
+		}
+		out = appendLines(out, lines)
+		if r.RotateChars {
+			out = append(out, RotateClockwise(false)...)
+		}
+	}
+
+	if r.Font != FontA {
+		out = append(out, SelectFont(FontA)...)
+	}
+
+	return out, nil
+}
+
+// layout returns the text lines followed by the items and total formatted
+// to columns
+func (r Receipt) layout(columns int) []receiptLine {
+	lines := make([]receiptLine, 0, len(r.Lines)+len(r.Items)+1)
+	for _, line := range r.Lines {
+		lines = append(lines, receiptLine{text: line})
+	}
+	for _, item := range r.Items {
+		amount := item.amount(r.Currency)
+		if !r.WrapNames {
+			lines = append(lines, receiptLine{text: formatColumns(item.Name, amount, columns)})
+			continue
+		}
+		for _, text := range wrapColumns(item.Name, amount, columns) {
+			lines = append(lines, receiptLine{text: text})
+		}
+	}
+	if r.Total != nil {
+		text := formatColumns(r.Total.Name, r.Total.amount(r.Currency), columns/totalSize)
+		lines = append(lines, receiptLine{text: text, large: true})
+	}
+	return lines
+}
+
+// formatColumns left-aligns left and right-aligns right on a line of
+// columns characters, truncating left so at least one space separates them
+func formatColumns(left, right string, columns int) string {
+	l, r := []rune(left), []rune(right)
+	if len(r) >= columns {
+		return string(r[:columns])
+	}
+
+	space := columns - len(r) - 1
+	if len(l) > space {
+		l = l[:space]
+	}
+	return string(l) + strings.Repeat(" ", columns-len(l)-len(r)) + string(r)
+}
+
+// wrapColumns lays out left and right as formatColumns, but continues a
+// left that does not fit on the following lines, breaking at spaces where
+// possible. right goes on the first line.
+func wrapColumns(left, right string, columns int) []string {
+	r := []rune(right)
+	if len(r) >= columns {
+		return []string{string(r[:columns])}
+	}
+
+	words := strings.Fields(left)
+	var lines []string
+	space := columns - len(r) - 1
+	var line []rune
+	for len(words) > 0 {
+		word := []rune(words[0])
+		switch {
+		case len(line) == 0 && len(word) > space:
+			// Break a word longer than the line
+			line, words[0] = word[:space], string(word[space:])
+		case len(line) == 0:
+			line, words = word, words[1:]
+			continue
+		case len(line)+1+len(word) <= space:
+			line = append(append(line, ' '), word...)
+			words = words[1:]
+			continue
+		}
+
+		lines = append(lines, string(line))
+		line = nil
+		space = columns
+	}
+	if len(line) > 0 || len(lines) == 0 {
+		lines = append(lines, string(line))
+	}
+
+	lines[0] = formatColumns(lines[0], right, columns)
+	return lines
+}
+
+// appendLines appends each line followed by a line feed, switching the
+// character size around large lines
+func appendLines(out []byte, lines []receiptLine) []byte {
+	for _, line := range lines {
+		if line.large {
+			out = append(out, textSize(totalSize, totalSize)...)
+		}
+		out = append(out, line.text...)
+		out = append(out, LF)
+		if line.large {
+			out = append(out, textSize(1, 1)...)
+		}
+	}
+	return out
+}
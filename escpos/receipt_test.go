@@ -0,0 +1,198 @@
+package escpos
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// assertGolden compares data against testdata/<name>.golden
+func assertGolden(t *testing.T, name string, data []byte) {
+	t.Helper()
+
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		require.NoError(t, os.WriteFile(path, data, 0o644))
+	}
+
+	expected, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, expected, data)
+}
+
+func TestReceiptRender(t *testing.T) {
+	lines := []string{"SHIPPING LABEL", "Order 1042", "Bin A-7"}
+
+	testCases := []struct {
+		name    string
+		receipt Receipt
+	}{
+		{"receipt_plain", Receipt{Lines: lines}},
+		{"receipt_rotate_chars", Receipt{Lines: lines, RotateChars: true}},
+		{"receipt_rotate90", Receipt{Lines: lines, Rotation: Rotate90}},
+		{"receipt_rotate180", Receipt{Lines: lines, Rotation: Rotate180}},
+		{"receipt_total", Receipt{
+			Lines: []string{"CAFE 12"},
+			Items: []Item{{Name: "Espresso", Amount: "3.50"}, {Name: "Croissant", Amount: "2.80"}},
+			Total: &Item{Name: "TOTAL", Amount: "6.30"},
+			Width: 32,
+		}},
+		{"receipt_total_rotate180", Receipt{
+			Items:    []Item{{Name: "Espresso", Amount: "3.50"}},
+			Total:    &Item{Name: "TOTAL", Amount: "3.50"},
+			Width:    32,
+			Rotation: Rotate180,
+		}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := tc.receipt.Render()
+			require.NoError(t, err)
+			assertGolden(t, tc.name, data)
+		})
+	}
+}
+
+func TestReceiptValidateRotation(t *testing.T) {
+	_, err := Receipt{Rotation: Rotate90, RotateChars: true}.Render()
+	assert.ErrorIs(t, err, ErrIncompatibleRotation)
+
+	_, err = Receipt{Rotation: Rotate180, RotateChars: true}.Render()
+	assert.ErrorIs(t, err, ErrIncompatibleRotation)
+
+	_, err = Receipt{Rotation: 45}.Render()
+	assert.Error(t, err)
+
+	assert.NoError(t, Receipt{RotateChars: true}.Validate())
+}
+
+// fixedWidth is a CharWidther reporting a detected printer width
+type fixedWidth int
+
+func (w fixedWidth) CharWidth() int { return int(w) }
+
+// itemLines returns the rendered item rows of a receipt with no header lines
+func itemLines(t *testing.T, data []byte) []string {
+	t.Helper()
+	text := strings.TrimPrefix(string(data), string(Init()))
+	text = strings.TrimPrefix(text, string(SelectFont(FontB)))
+	text = strings.TrimSuffix(text, string(SelectFont(FontA)))
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+func TestReceiptColumnsAtPrinterWidth(t *testing.T) {
+	receipt := Receipt{Items: []Item{
+		{Name: "Coffee", Amount: "3.50"},
+		{Name: "Blueberry muffin with extra sugar topping", Amount: "12.00"},
+		{Name: "Total", Amount: "15.50"},
+	}}
+
+	testCases := []struct {
+		name    string
+		printer fixedWidth
+		font    Font
+		columns int
+	}{
+		{"42FontA", 42, FontA, 42},
+		{"48FontA", 48, FontA, 48},
+		{"32FontA", 32, FontA, 32},
+		{"32FontB", 32, FontB, 42},
+		{"48FontB", 48, FontB, 64},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := receipt
+			r.Font = tc.font
+			data, err := r.RenderFor(tc.printer)
+			require.NoError(t, err)
+
+			lines := itemLines(t, data)
+			require.Len(t, lines, 3)
+			for i, line := range lines {
+				// Every row fills the line exactly, so amounts line up
+				assert.Len(t, line, tc.columns)
+				assert.True(t, strings.HasSuffix(line, receipt.Items[i].Amount))
+			}
+			assert.True(t, strings.HasPrefix(lines[0], "Coffee "))
+		})
+	}
+}
+
+func TestReceiptExplicitWidthOverridesPrinter(t *testing.T) {
+	data, err := Receipt{Width: 32, Items: []Item{{Name: "Tea", Amount: "2.00"}}}.RenderFor(fixedWidth(48))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Tea" + strings.Repeat(" ", 25) + "2.00"}, itemLines(t, data))
+}
+
+func TestReceiptDefaultWidth(t *testing.T) {
+	data, err := Receipt{Items: []Item{{Name: "Tea", Amount: "2.00"}}}.Render()
+	require.NoError(t, err)
+	assert.Len(t, itemLines(t, data)[0], DefaultCharWidth)
+}
+
+func TestReceiptFontBGolden(t *testing.T) {
+	data, err := Receipt{
+		Lines: []string{"CAFE"},
+		Items: []Item{{Name: "Espresso", Amount: "2.80"}},
+		Width: 32,
+		Font:  FontB,
+	}.Render()
+	require.NoError(t, err)
+	assertGolden(t, "receipt_fontb_32", data)
+}
+
+func TestReceiptPriceColumnsGolden(t *testing.T) {
+	receipt := Receipt{
+		Lines: []string{"HARDWARE STORE"},
+		Items: []Item{
+			{Name: "Screws", Price: 199},
+			{Name: "Cordless hammer drill with two batteries and charger", Price: 1249999},
+			{Name: "Extraordinarilylongproductnamewithoutspaces", Price: 100000000},
+			{Name: "Return", Price: -2500},
+			{Name: "Gift card", Amount: "PAID"},
+		},
+		Total:     &Item{Name: "TOTAL", Price: 101247698},
+		Currency:  &CurrencyFormat{Symbol: "$", Thousands: ",", Decimals: 2},
+		WrapNames: true,
+	}
+
+	for _, width := range []int{32, 48} {
+		t.Run(fmt.Sprint(width), func(t *testing.T) {
+			r := receipt
+			r.Width = width
+			data, err := r.Render()
+			require.NoError(t, err)
+			assertGolden(t, fmt.Sprintf("receipt_prices_%d", width), data)
+		})
+	}
+}
+
+func TestReceiptPriceColumnsTruncated(t *testing.T) {
+	data, err := Receipt{
+		Items:    []Item{{Name: "Cordless hammer drill with two batteries", Price: 1249999}},
+		Currency: &CurrencyFormat{Symbol: "$", Thousands: ",", Decimals: 2},
+		Width:    32,
+	}.Render()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Cordless hammer drill $12,499.99"}, itemLines(t, data))
+}
+
+func TestWrapColumns(t *testing.T) {
+	assert.Equal(t, []string{
+		"Cordless hammer    $12,499.99",
+		"drill with two batteries",
+	}, wrapColumns("Cordless hammer drill with two batteries", "$12,499.99", 29))
+	assert.Equal(t, []string{"Tea     2.00"}, wrapColumns("Tea", "2.00", 12))
+	assert.Equal(t, []string{"        2.00"}, wrapColumns("", "2.00", 12))
+	assert.Equal(t, []string{"Abcdefg 2.00", "hij"}, wrapColumns("Abcdefghij", "2.00", 12))
+}
@@ -0,0 +1,46 @@
+package escpos
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// ProcessIDRequestLen is the length of a process ID request, see
+// RequestProcessID
+const ProcessIDRequestLen = 11
+
+// processIDRequestPrefix is GS ( H with pL pH = 6 0, fn = 48 and m = 48
+var processIDRequestPrefix = []byte{GS, '(', 'H', 6, 0, 48, 48}
+
+// ProcessID identifies a process ID request and its response. Each byte
+// must be in 0x30-0x7A ('0'-'z').
+type ProcessID [4]byte
+
+// RequestProcessID asks the printer to send the process ID response for id
+// once it has processed all data before this command (GS ( H fn = 48), so
+// the host can tell how far the printer got, e.g. that a receipt is printed
+func RequestProcessID(id ProcessID) ([]byte, error) {
+	for _, b := range id {
+		if b < 0x30 || b > 0x7A {
+			return nil, fmt.Errorf("invalid process ID %q, bytes must be in 0x30-0x7A", id[:])
+		}
+	}
+	return append(append([]byte(nil), processIDRequestPrefix...), id[:]...), nil
+}
+
+// ParseProcessIDRequest returns the ID of the process ID request p starts
+// with. The second result is false if p does not start with one.
+func ParseProcessIDRequest(p []byte) (ProcessID, bool) {
+	if len(p) < ProcessIDRequestLen || !bytes.HasPrefix(p, processIDRequestPrefix) {
+		return ProcessID{}, false
+	}
+	var id ProcessID
+	copy(id[:], p[len(processIDRequestPrefix):ProcessIDRequestLen])
+	return id, true
+}
+
+// ProcessIDResponse is the printer's reply to RequestProcessID(id):
+// 37H 22H, the ID, NUL
+func ProcessIDResponse(id ProcessID) []byte {
+	return append(append([]byte{0x37, 0x22}, id[:]...), 0x00)
+}
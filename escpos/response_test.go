@@ -0,0 +1,36 @@
+package escpos
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestProcessID(t *testing.T) {
+	data, err := RequestProcessID(ProcessID{'A', 'B', '1', '2'})
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x1D, '(', 'H', 6, 0, 48, 48, 'A', 'B', '1', '2'}, data)
+	assert.Len(t, data, ProcessIDRequestLen)
+
+	_, err = RequestProcessID(ProcessID{'A', 'B', '1', 0x7F})
+	assert.Error(t, err)
+}
+
+func TestParseProcessIDRequest(t *testing.T) {
+	data, err := RequestProcessID(ProcessID{'0', '0', '4', '2'})
+	require.NoError(t, err)
+
+	id, ok := ParseProcessIDRequest(append(data, "receipt"...))
+	assert.True(t, ok)
+	assert.Equal(t, ProcessID{'0', '0', '4', '2'}, id)
+
+	_, ok = ParseProcessIDRequest(data[:10])
+	assert.False(t, ok)
+	_, ok = ParseProcessIDRequest([]byte{0x1D, '(', 'H', 6, 0, 49, 48, 'A', 'B', 'C', 'D'})
+	assert.False(t, ok)
+}
+
+func TestProcessIDResponse(t *testing.T) {
+	assert.Equal(t, []byte{0x37, 0x22, 'A', 'B', '1', '2', 0x00}, ProcessIDResponse(ProcessID{'A', 'B', '1', '2'}))
+}
@@ -0,0 +1,45 @@
+package escpos
+
+// Direction is the print direction in page mode (ESC T n)
+type Direction byte
+
+const (
+	// DirectionLeftToRight prints from the upper left (no rotation)
+	DirectionLeftToRight Direction = 0
+	// DirectionBottomToTop prints from the lower left (90° counter-clockwise)
+	DirectionBottomToTop Direction = 1
+	// DirectionRightToLeft prints from the lower right (180°)
+	DirectionRightToLeft Direction = 2
+	// DirectionTopToBottom prints from the upper right (90° clockwise)
+	DirectionTopToBottom Direction = 3
+)
+
+// UpsideDown turns upside-down printing on or off (ESC { n). Each line is
+// rotated 180°; it only takes effect at the start of a line in standard mode.
+func UpsideDown(on bool) []byte {
+	return []byte{ESC, '{', boolByte(on)}
+}
+
+// RotateClockwise turns 90° clockwise character rotation on or off (ESC V n).
+// Only the characters are rotated, lines still feed down the paper. It is
+// ignored in page mode and must not be combined with UpsideDown.
+func RotateClockwise(on bool) []byte {
+	return []byte{ESC, 'V', boolByte(on)}
+}
+
+// PageMode switches from standard mode to page mode (ESC L). Data is
+// buffered until PrintPage.
+func PageMode() []byte {
+	return []byte{ESC, 'L'}
+}
+
+// PrintDirection selects the page mode print direction (ESC T n), which
+// rotates the whole page layout
+func PrintDirection(d Direction) []byte {
+	return []byte{ESC, 'T', byte(d)}
+}
+
+// PrintPage prints the page mode buffer and returns to standard mode (FF)
+func PrintPage() []byte {
+	return []byte{FF}
+}
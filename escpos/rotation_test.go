@@ -0,0 +1,29 @@
+package escpos
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotationCommands(t *testing.T) {
+	testCases := []struct {
+		name     string
+		got      []byte
+		expected []byte
+	}{
+		{"UpsideDownOn", UpsideDown(true), []byte{0x1B, 0x7B, 0x01}},
+		{"UpsideDownOff", UpsideDown(false), []byte{0x1B, 0x7B, 0x00}},
+		{"RotateClockwiseOn", RotateClockwise(true), []byte{0x1B, 0x56, 0x01}},
+		{"RotateClockwiseOff", RotateClockwise(false), []byte{0x1B, 0x56, 0x00}},
+		{"PageMode", PageMode(), []byte{0x1B, 0x4C}},
+		{"PrintDirection", PrintDirection(DirectionTopToBottom), []byte{0x1B, 0x54, 0x03}},
+		{"PrintPage", PrintPage(), []byte{0x0C}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, tc.got)
+		})
+	}
+}
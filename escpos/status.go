@@ -0,0 +1,67 @@
+package escpos
+
+// Status is a decoded reply to a real-time status request (DLE EOT n).
+// Each request reports a different set of flags; fields a reply does not
+// cover are left false.
+type Status struct {
+	// DrawerOpen reflects the drawer kick-out connector (pin 3), which most
+	// drawers pull high while open
+	DrawerOpen bool
+	// Offline is set while the printer does not accept print data
+	Offline bool
+	// CoverOpen is set while the roll paper cover is open
+	CoverOpen bool
+	// PaperFeeding is set while paper is fed with the FEED button
+	PaperFeeding bool
+	// FeedButton is set while the FEED button is pressed; only automatic
+	// status back reports it
+	FeedButton bool
+	// PaperNearEnd is set when the roll near-end sensor is triggered
+	PaperNearEnd bool
+	// PaperEnd is set when the printer is out of paper
+	PaperEnd bool
+	// Error is set when an error occurred; from the error status it means
+	// an unrecoverable error
+	Error bool
+	// RecoverableError is set for a mechanism or autocutter error that can
+	// be cleared with DLE ENQ
+	RecoverableError bool
+	// AutoRecoverableError is set for an error the printer clears by
+	// itself, such as the head overheating
+	AutoRecoverableError bool
+}
+
+// ParsePrinterStatus decodes the reply to DLE EOT 1
+func ParsePrinterStatus(b byte) Status {
+	return Status{
+		DrawerOpen: b&0x04 != 0,
+		Offline:    b&0x08 != 0,
+	}
+}
+
+// ParseOfflineStatus decodes the reply to DLE EOT 2
+func ParseOfflineStatus(b byte) Status {
+	return Status{
+		CoverOpen:    b&0x04 != 0,
+		PaperFeeding: b&0x08 != 0,
+		PaperEnd:     b&0x20 != 0,
+		Error:        b&0x40 != 0,
+	}
+}
+
+// ParseErrorStatus decodes the reply to DLE EOT 3
+func ParseErrorStatus(b byte) Status {
+	return Status{
+		RecoverableError:     b&0x0C != 0,
+		Error:                b&0x20 != 0,
+		AutoRecoverableError: b&0x40 != 0,
+	}
+}
+
+// ParsePaperStatus decodes the reply to DLE EOT 4
+func ParsePaperStatus(b byte) Status {
+	return Status{
+		PaperNearEnd: b&0x0C != 0,
+		PaperEnd:     b&0x60 != 0,
+	}
+}
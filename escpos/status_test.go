@@ -0,0 +1,39 @@
+package escpos
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		parse    func(byte) Status
+		b        byte
+		expected Status
+	}{
+		{"printer ready", ParsePrinterStatus, 0x12, Status{}},
+		{"printer drawer open", ParsePrinterStatus, 0x16, Status{DrawerOpen: true}},
+		{"printer offline", ParsePrinterStatus, 0x1A, Status{Offline: true}},
+		{"offline ready", ParseOfflineStatus, 0x12, Status{}},
+		{"offline cover open", ParseOfflineStatus, 0x16, Status{CoverOpen: true}},
+		{"offline feeding", ParseOfflineStatus, 0x1A, Status{PaperFeeding: true}},
+		{"offline paper end", ParseOfflineStatus, 0x32, Status{PaperEnd: true}},
+		{"offline error", ParseOfflineStatus, 0x52, Status{Error: true}},
+		{"error none", ParseErrorStatus, 0x12, Status{}},
+		{"error autocutter", ParseErrorStatus, 0x1A, Status{RecoverableError: true}},
+		{"error unrecoverable", ParseErrorStatus, 0x32, Status{Error: true}},
+		{"error auto recoverable", ParseErrorStatus, 0x52, Status{AutoRecoverableError: true}},
+		{"paper ok", ParsePaperStatus, 0x12, Status{}},
+		{"paper near end", ParsePaperStatus, 0x1E, Status{PaperNearEnd: true}},
+		{"paper end", ParsePaperStatus, 0x72, Status{PaperEnd: true}},
+		{"paper near end and end", ParsePaperStatus, 0x7E, Status{PaperNearEnd: true, PaperEnd: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.parse(tt.b))
+		})
+	}
+}
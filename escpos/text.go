@@ -0,0 +1,51 @@
+package escpos
+
+import "fmt"
+
+// Font is a character font (ESC M n)
+type Font byte
+
+const (
+	// FontA is the default 12x24 dot font
+	FontA Font = 0
+	// FontB is the smaller 9x17 dot font, fitting 4/3 as many columns
+	FontB Font = 1
+)
+
+// SelectFont selects the character font (ESC M n)
+func SelectFont(f Font) []byte {
+	return []byte{ESC, 'M', byte(f)}
+}
+
+// Columns returns how many characters of font f fit on a line that holds
+// fontAWidth characters of font A
+func Columns(fontAWidth int, f Font) int {
+	if f == FontB {
+		// Font A is 12 dots wide, font B 9 dots
+		return fontAWidth * 12 / 9
+	}
+	return fontAWidth
+}
+
+// Character size multiplier limits for TextSize
+const (
+	TextSizeMin = 1
+	TextSizeMax = 8
+)
+
+// TextSize sets the character width and height multipliers, 1-8 each
+// (GS ! n). n packs width-1 in the high nibble and height-1 in the low one.
+func TextSize(widthMul, heightMul int) ([]byte, error) {
+	if widthMul < TextSizeMin || widthMul > TextSizeMax {
+		return nil, fmt.Errorf("text width multiplier %d out of range %d-%d", widthMul, TextSizeMin, TextSizeMax)
+	}
+	if heightMul < TextSizeMin || heightMul > TextSizeMax {
+		return nil, fmt.Errorf("text height multiplier %d out of range %d-%d", heightMul, TextSizeMin, TextSizeMax)
+	}
+	return textSize(widthMul, heightMul), nil
+}
+
+// textSize encodes GS ! n for multipliers known to be in range
+func textSize(widthMul, heightMul int) []byte {
+	return []byte{GS, '!', byte(widthMul-1)<<4 | byte(heightMul-1)}
+}
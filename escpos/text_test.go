@@ -0,0 +1,59 @@
+package escpos
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectFont(t *testing.T) {
+	assert.Equal(t, []byte{0x1B, 0x4D, 0x00}, SelectFont(FontA))
+	assert.Equal(t, []byte{0x1B, 0x4D, 0x01}, SelectFont(FontB))
+}
+
+func TestColumns(t *testing.T) {
+	assert.Equal(t, 48, Columns(48, FontA))
+	assert.Equal(t, 64, Columns(48, FontB))
+	assert.Equal(t, 56, Columns(42, FontB))
+	assert.Equal(t, 42, Columns(32, FontB))
+}
+
+func TestTextSize(t *testing.T) {
+	testCases := []struct {
+		width, height int
+		n             byte
+	}{
+		{1, 1, 0x00},
+		{2, 1, 0x10},
+		{1, 2, 0x01},
+		{2, 2, 0x11},
+		{3, 5, 0x24},
+		{8, 8, 0x77},
+	}
+
+	var all []byte
+	for _, tc := range testCases {
+		data, err := TextSize(tc.width, tc.height)
+		require.NoError(t, err)
+		assert.Equal(t, []byte{0x1D, 0x21, tc.n}, data, "width %d height %d", tc.width, tc.height)
+		all = append(all, data...)
+	}
+	assertGolden(t, "text_size", all)
+}
+
+func TestTextSizeOutOfRange(t *testing.T) {
+	for _, size := range [][2]int{{0, 1}, {1, 0}, {9, 1}, {1, 9}, {-1, 2}} {
+		_, err := TextSize(size[0], size[1])
+		assert.Error(t, err, "width %d height %d", size[0], size[1])
+	}
+}
+
+func TestBuilderTextSize(t *testing.T) {
+	data, err := NewBuilder().TextSize(2, 2).Text("TOTAL").TextSize(1, 1).Bytes()
+	require.NoError(t, err)
+	assert.Equal(t, []byte("\x1b@\x1d!\x11TOTAL\n\x1d!\x00"), data)
+
+	_, err = NewBuilder().TextSize(9, 1).Text("ignored").Bytes()
+	assert.Error(t, err)
+}
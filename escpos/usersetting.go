@@ -0,0 +1,110 @@
+package escpos
+
+import (
+	"errors"
+	"fmt"
+)
+
+// User setting commands (GS ( E) change the printer's memory switches and
+// customized values, which are kept in non-volatile memory and survive a
+// power cycle. A wrong value can leave the printer misconfigured until it
+// is reset from its self-test menu, so every helper that writes a setting
+// refuses to run unless passed Unsafe, and validates its arguments.
+//
+// A session starts with EnterUserSettingMode and must end with
+// ExitUserSettingMode, which makes the printer apply the settings and
+// reset. Print data sent during the session is ignored.
+
+// UnsafeOption confirms that a call writes non-volatile printer settings
+type UnsafeOption bool
+
+// Unsafe allows a user setting helper to produce its command
+const Unsafe UnsafeOption = true
+
+// ErrUnsafe is returned by user setting helpers called without Unsafe
+var ErrUnsafe = errors.New("user setting commands change non-volatile printer settings; pass escpos.Unsafe to allow")
+
+// Memory switch numbers for SetMemorySwitch (Msw1-Msw8)
+const (
+	MemorySwitchMin = 1
+	MemorySwitchMax = 8
+)
+
+// Print density limits for SetPrintDensity, in steps of 5% around 100%
+const (
+	PrintDensityMin = -6
+	PrintDensityMax = 6
+)
+
+// customPrintDensity is the customized setting number for print density
+const customPrintDensity = 5
+
+// EnterUserSettingMode starts a user setting session (GS ( E 1 "IN")
+func EnterUserSettingMode(allow UnsafeOption) ([]byte, error) {
+	if !allow {
+		return nil, ErrUnsafe
+	}
+	return userSetting(1, 'I', 'N'), nil
+}
+
+// ExitUserSettingMode ends a user setting session (GS ( E 2 "OUT"). The
+// printer stores the new settings and resets.
+func ExitUserSettingMode() []byte {
+	return userSetting(2, 'O', 'U', 'T')
+}
+
+// SetMemorySwitch sets memory switch sw (1-8) (GS ( E 3). bits lists the
+// eight switch bits from bit 8 down to bit 1, each '0', '1' or 'x' to keep
+// the current value, e.g. "xxxxx1xx" sets only bit 3.
+func SetMemorySwitch(allow UnsafeOption, sw int, bits string) ([]byte, error) {
+	if !allow {
+		return nil, ErrUnsafe
+	}
+	if sw < MemorySwitchMin || sw > MemorySwitchMax {
+		return nil, fmt.Errorf("memory switch %d out of range %d-%d", sw, MemorySwitchMin, MemorySwitchMax)
+	}
+	if len(bits) != 8 {
+		return nil, fmt.Errorf("memory switch bits %q: need 8 characters, got %d", bits, len(bits))
+	}
+
+	params := []byte{3, byte(sw)}
+	changed := false
+	for i := 0; i < len(bits); i++ {
+		switch bits[i] {
+		case '0', '1':
+			params = append(params, bits[i])
+			changed = true
+		case 'x':
+			// '2' leaves the bit unchanged
+			params = append(params, '2')
+		default:
+			return nil, fmt.Errorf("memory switch bits %q: invalid character %q at %d, expected 0, 1 or x", bits, bits[i], i)
+		}
+	}
+	if !changed {
+		return nil, fmt.Errorf("memory switch bits %q change nothing", bits)
+	}
+
+	return userSetting(params...), nil
+}
+
+// SetPrintDensity sets the customized print density (GS ( E 5 5) to
+// 100% + 5% per step, -6 to +6. Not every model supports the full range.
+func SetPrintDensity(allow UnsafeOption, step int) ([]byte, error) {
+	if !allow {
+		return nil, ErrUnsafe
+	}
+	if step < PrintDensityMin || step > PrintDensityMax {
+		return nil, fmt.Errorf("print density %d out of range %d-%d", step, PrintDensityMin, PrintDensityMax)
+	}
+
+	// Negative steps are sent as 65536 + step
+	n := uint16(int16(step))
+	return userSetting(5, customPrintDensity, byte(n), byte(n>>8)), nil
+}
+
+// userSetting frames a GS ( E command; params starts with the function
+func userSetting(params ...byte) []byte {
+	out := []byte{GS, '(', 'E', byte(len(params)), byte(len(params) >> 8)}
+	return append(out, params...)
+}
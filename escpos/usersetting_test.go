@@ -0,0 +1,75 @@
+package escpos
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserSettingRequiresUnsafe(t *testing.T) {
+	_, err := EnterUserSettingMode(false)
+	assert.ErrorIs(t, err, ErrUnsafe)
+
+	_, err = SetMemorySwitch(false, 1, "xxxxx1xx")
+	assert.ErrorIs(t, err, ErrUnsafe)
+
+	_, err = SetPrintDensity(false, 2)
+	assert.ErrorIs(t, err, ErrUnsafe)
+}
+
+func TestEnterUserSettingMode(t *testing.T) {
+	enter, err := EnterUserSettingMode(Unsafe)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x1D, 0x28, 0x45, 0x03, 0x00, 0x01, 'I', 'N'}, enter)
+	assertGolden(t, "user_setting_enter", enter)
+
+	assert.Equal(t, []byte{0x1D, 0x28, 0x45, 0x04, 0x00, 0x02, 'O', 'U', 'T'}, ExitUserSettingMode())
+}
+
+func TestSetMemorySwitch(t *testing.T) {
+	enter, err := EnterUserSettingMode(Unsafe)
+	require.NoError(t, err)
+
+	// Clear Msw1 bit 3, leaving the other bits alone
+	msw, err := SetMemorySwitch(Unsafe, 1, "xxxxx0xx")
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x1D, 0x28, 0x45, 0x0A, 0x00, 0x03, 0x01, '2', '2', '2', '2', '2', '0', '2', '2'}, msw)
+
+	job := append(append(enter, msw...), ExitUserSettingMode()...)
+	assertGolden(t, "user_setting_msw", job)
+}
+
+func TestSetMemorySwitchInvalid(t *testing.T) {
+	testCases := []struct {
+		sw   int
+		bits string
+	}{
+		{0, "xxxxx1xx"},
+		{9, "xxxxx1xx"},
+		{1, "xxxx1xx"},
+		{1, "xxxxx1xxx"},
+		{1, "xxxxx2xx"},
+		{1, "xxxxxxxx"},
+	}
+
+	for _, tc := range testCases {
+		_, err := SetMemorySwitch(Unsafe, tc.sw, tc.bits)
+		assert.Error(t, err, "switch %d bits %q", tc.sw, tc.bits)
+	}
+}
+
+func TestSetPrintDensity(t *testing.T) {
+	data, err := SetPrintDensity(Unsafe, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x1D, 0x28, 0x45, 0x04, 0x00, 0x05, 0x05, 0x02, 0x00}, data)
+
+	data, err = SetPrintDensity(Unsafe, -3)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x1D, 0x28, 0x45, 0x04, 0x00, 0x05, 0x05, 0xFD, 0xFF}, data)
+
+	for _, step := range []int{-7, 7} {
+		_, err := SetPrintDensity(Unsafe, step)
+		assert.Error(t, err, "step %d", step)
+	}
+}
@@ -0,0 +1,295 @@
+package escpos
+
+import "fmt"
+
+// IssueKind classifies a problem found by Validate
+type IssueKind int
+
+const (
+	// IssueTruncated is a command cut off by the end of the stream
+	IssueTruncated IssueKind = iota
+	// IssueImageSize is an image command declaring more data than remains
+	IssueImageSize
+	// IssueMissingCut means printed content is not followed by a cut
+	IssueMissingCut
+)
+
+func (k IssueKind) String() string {
+	switch k {
+	case IssueTruncated:
+		return "truncated command"
+	case IssueImageSize:
+		return "image size mismatch"
+	case IssueMissingCut:
+		return "missing cut"
+	default:
+		return fmt.Sprintf("issue %d", int(k))
+	}
+}
+
+// Issue is a suspicious sequence found by Validate
+type Issue struct {
+	// Offset of the command the issue refers to
+	Offset  int
+	Kind    IssueKind
+	Message string
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("offset %d: %s: %s", i.Offset, i.Kind, i.Message)
+}
+
+// Parameter byte counts of fixed-length commands, keyed by the byte
+// following ESC or GS
+var (
+	escParams = map[byte]int{
+		' ': 1, '!': 1, '$': 2, '%': 1, '-': 1, '2': 0, '3': 1, '=': 1,
+		'?': 1, '@': 0, 'D': 0, 'E': 1, 'G': 1, 'J': 1, 'L': 0, 'M': 1,
+		'R': 1, 'S': 0, 'T': 1, 'U': 1, 'V': 1, 'W': 8, '\\': 2, 'a': 1,
+		'd': 1, 'e': 1, 'i': 0, 'm': 0, 'p': 3, 'r': 1, 't': 1, '{': 1,
+	}
+	gsParams = map[byte]int{
+		'!': 1, '$': 2, 'B': 1, 'H': 1, 'I': 1, 'L': 2, 'P': 2, 'W': 2,
+		'\\': 2, 'a': 1, 'b': 1, 'f': 1, 'h': 1, 'r': 1, 'w': 1,
+	}
+)
+
+// validator scans a stream command by command
+type validator struct {
+	data   []byte
+	issues []Issue
+	// printed is set when content was printed since the last cut
+	printed bool
+}
+
+// Validate scans an ESC/POS stream without sending it and reports
+// suspicious sequences: commands truncated by the end of the stream, image
+// commands declaring more data than the stream holds, and printed content
+// without a cut at the end. Unknown commands are skipped. An empty stream
+// has no issues.
+func Validate(data []byte) []Issue {
+	v := &validator{data: data}
+
+	for i := 0; i < len(data); {
+		i = v.next(i)
+	}
+
+	if v.printed {
+		v.report(len(data), IssueMissingCut, "printed content is not followed by a cut")
+	}
+	return v.issues
+}
+
+func (v *validator) report(offset int, kind IssueKind, format string, args ...any) {
+	v.issues = append(v.issues, Issue{Offset: offset, Kind: kind, Message: fmt.Sprintf(format, args...)})
+}
+
+// need checks that n bytes are available at i for the command at start.
+// It returns false and reports the command as truncated otherwise.
+func (v *validator) need(start, i, n int, name string) bool {
+	if i+n <= len(v.data) {
+		return true
+	}
+	v.report(start, IssueTruncated, "%s needs %d more bytes, %d left", name, i+n-len(v.data), len(v.data)-i)
+	return false
+}
+
+// image checks the data length declared by an image command
+func (v *validator) image(start, i, size int, name string) int {
+	if i+size > len(v.data) {
+		v.report(start, IssueImageSize, "%s declares %d bytes of image data, %d left", name, size, len(v.data)-i)
+		return len(v.data)
+	}
+	v.printed = true
+	return i + size
+}
+
+// next validates the command or text byte at i and returns the offset of
+// the following one
+func (v *validator) next(i int) int {
+	switch b := v.data[i]; b {
+	case ESC:
+		return v.esc(i)
+	case GS:
+		return v.gs(i)
+	case DLE:
+		return v.dle(i)
+	case LF, '\r', FF, '\t':
+		return i + 1
+	default:
+		if b >= 0x20 {
+			v.printed = true
+		}
+		return i + 1
+	}
+}
+
+func (v *validator) esc(start int) int {
+	if !v.need(start, start+1, 1, "ESC") {
+		return len(v.data)
+	}
+	cmd := v.data[start+1]
+	i := start + 2
+	name := fmt.Sprintf("ESC %q", cmd)
+
+	switch cmd {
+	case '*':
+		// ESC * m nL nH d1...dk, 1 byte per column in 8-dot modes, 3 in 24-dot
+		if !v.need(start, i, 3, name) {
+			return len(v.data)
+		}
+		m, columns := v.data[i], int(v.data[i+1])|int(v.data[i+2])<<8
+		perColumn := 1
+		if m == 32 || m == 33 {
+			perColumn = 3
+		}
+		return v.image(start, i+3, columns*perColumn, name)
+	case 'c':
+		// ESC c 3/4/5 n
+		if !v.need(start, i, 2, name) {
+			return len(v.data)
+		}
+		return i + 2
+	case 'i', 'm':
+		v.printed = false
+		return i
+	}
+
+	if n, ok := escParams[cmd]; ok {
+		if !v.need(start, i, n, name) {
+			return len(v.data)
+		}
+		return i + n
+	}
+	return i
+}
+
+func (v *validator) gs(start int) int {
+	if !v.need(start, start+1, 1, "GS") {
+		return len(v.data)
+	}
+	cmd := v.data[start+1]
+	i := start + 2
+	name := fmt.Sprintf("GS %q", cmd)
+
+	switch cmd {
+	case 'V':
+		// GS V m, or GS V m n for m = 65, 66 and 97-104
+		if !v.need(start, i, 1, name) {
+			return len(v.data)
+		}
+		m := v.data[i]
+		n := 1
+		if m == 65 || m == 66 || (m >= 97 && m <= 104) {
+			n = 2
+		}
+		if !v.need(start, i, n, name) {
+			return len(v.data)
+		}
+		v.printed = false
+		return i + n
+	case 'v':
+		// GS v 0 m xL xH yL yH d1...dk, k = x bytes * y dots
+		if !v.need(start, i, 6, name) {
+			return len(v.data)
+		}
+		x := int(v.data[i+2]) | int(v.data[i+3])<<8
+		y := int(v.data[i+4]) | int(v.data[i+5])<<8
+		return v.image(start, i+6, x*y, "GS v 0")
+	case 'k':
+		return v.barcode(start, i)
+	case '(':
+		// GS ( fn pL pH d1...dp
+		if !v.need(start, i, 3, name) {
+			return len(v.data)
+		}
+		fn := v.data[i]
+		size := int(v.data[i+1]) | int(v.data[i+2])<<8
+		name = fmt.Sprintf("GS ( %c", fn)
+		if fn == 'L' {
+			return v.image(start, i+3, size, name)
+		}
+		if !v.need(start, i+3, size, name) {
+			return len(v.data)
+		}
+		// GS ( k function 181 prints the stored QR code
+		if fn == 'k' && size >= 3 && v.data[i+4] == 'Q' {
+			v.printed = true
+		}
+		return i + 3 + size
+	case '8':
+		// GS 8 L p1 p2 p3 p4 d1...dp, the large form of GS ( L
+		if !v.need(start, i, 5, name) {
+			return len(v.data)
+		}
+		p := v.data[i+1 : i+5]
+		size := int(p[0]) | int(p[1])<<8 | int(p[2])<<16 | int(p[3])<<24
+		return v.image(start, i+5, size, "GS 8 L")
+	}
+
+	if n, ok := gsParams[cmd]; ok {
+		if !v.need(start, i, n, name) {
+			return len(v.data)
+		}
+		return i + n
+	}
+	return i
+}
+
+// barcode validates GS k m, NUL terminated for m = 0-6, length prefixed for
+// m = 65-79
+func (v *validator) barcode(start, i int) int {
+	if !v.need(start, i, 1, "GS k") {
+		return len(v.data)
+	}
+	m := v.data[i]
+	i++
+
+	if m <= 6 {
+		for ; i < len(v.data); i++ {
+			if v.data[i] == 0 {
+				v.printed = true
+				return i + 1
+			}
+		}
+		v.report(start, IssueTruncated, "GS k barcode data is not NUL terminated")
+		return len(v.data)
+	}
+
+	if !v.need(start, i, 1, "GS k") {
+		return len(v.data)
+	}
+	n := int(v.data[i])
+	if !v.need(start, i+1, n, "GS k") {
+		return len(v.data)
+	}
+	v.printed = true
+	return i + 1 + n
+}
+
+func (v *validator) dle(start int) int {
+	if !v.need(start, start+1, 1, "DLE") {
+		return len(v.data)
+	}
+	i := start + 2
+
+	switch cmd := v.data[start+1]; cmd {
+	case 0x04, 0x05:
+		// DLE EOT n, DLE ENQ n
+		if !v.need(start, i, 1, fmt.Sprintf("DLE %#02x", cmd)) {
+			return len(v.data)
+		}
+		return i + 1
+	case 0x14:
+		// DLE DC4 fn m t, or DLE DC4 8 d1...d7 to clear the buffer
+		n := 3
+		if i < len(v.data) && v.data[i] == 8 {
+			n = 8
+		}
+		if !v.need(start, i, n, "DLE DC4") {
+			return len(v.data)
+		}
+		return i + n
+	}
+	return i
+}
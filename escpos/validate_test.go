@@ -0,0 +1,80 @@
+package escpos
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateWellFormed(t *testing.T) {
+	raster := []byte{GS, 'v', '0', 0, 2, 0, 3, 0, 1, 2, 3, 4, 5, 6}
+
+	b := NewBuilder().
+		Text("hello\n").
+		QRCode("https://example.com", 6, ECCMedium).
+		Barcode(EAN8, "1234567").
+		Raw(raster).
+		Raw([]byte{ESC, '*', 33, 2, 0, 1, 2, 3, 4, 5, 6}).
+		Feed(3).
+		Cut()
+	data, err := b.Bytes()
+	require.NoError(t, err)
+
+	assert.Empty(t, Validate(data))
+}
+
+func TestValidateEmpty(t *testing.T) {
+	assert.Empty(t, Validate(nil))
+}
+
+func TestValidateFeedAfterCut(t *testing.T) {
+	data := append([]byte("receipt"), Cut()...)
+	data = append(data, Feed(2)...)
+	data = append(data, DLE, 0x04, 1)
+
+	assert.Empty(t, Validate(data))
+}
+
+func TestValidateMalformed(t *testing.T) {
+	testCases := []struct {
+		name   string
+		data   []byte
+		kind   IssueKind
+		offset int
+	}{
+		{"MissingCut", []byte("receipt\n"), IssueMissingCut, 8},
+		{"TextAfterCut", append(Cut(), 'x'), IssueMissingCut, 5},
+		{"TruncatedESC", []byte{ESC}, IssueTruncated, 0},
+		{"TruncatedFeed", []byte{ESC, 'd'}, IssueTruncated, 0},
+		{"TruncatedCut", []byte{GS, 'V', 65}, IssueTruncated, 0},
+		{"TruncatedQR", []byte{GS, '(', 'k', 10, 0, 49, 80}, IssueTruncated, 0},
+		{"UnterminatedBarcode", []byte{GS, 'k', 4, '1', '2'}, IssueTruncated, 0},
+		{"RasterTooShort", []byte{GS, 'v', '0', 0, 2, 0, 3, 0, 1, 2}, IssueImageSize, 0},
+		{"BitImageTooShort", []byte{ESC, '*', 33, 2, 0, 1, 2, 3}, IssueImageSize, 0},
+		{"GraphicsTooShort", []byte{GS, '(', 'L', 20, 0, 48, 112}, IssueImageSize, 0},
+		{"TruncatedRasterHeader", []byte{GS, 'v', '0', 0, 2}, IssueTruncated, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			issues := Validate(tc.data)
+			require.NotEmpty(t, issues)
+			assert.Equal(t, tc.kind, issues[0].Kind)
+			assert.Equal(t, tc.offset, issues[0].Offset)
+		})
+	}
+}
+
+func TestValidateReportsOffset(t *testing.T) {
+	data := append(Init(), "text"...)
+	data = append(data, GS, 'v', '0', 0, 1, 0, 1, 0)
+
+	issues := Validate(data)
+	require.Len(t, issues, 2)
+	assert.Equal(t, IssueImageSize, issues[0].Kind)
+	assert.Equal(t, 6, issues[0].Offset)
+	assert.Contains(t, issues[0].String(), "offset 6: image size mismatch")
+	assert.Equal(t, IssueMissingCut, issues[1].Kind)
+	assert.Equal(t, len(data), issues[1].Offset)
+}
@@ -2,7 +2,12 @@ module github.com/nixxel-company-limited/escpos-usb-server
 
 go 1.24
 
-require github.com/google/gousb v1.1.3
+require (
+	github.com/google/gousb v1.1.3
+	github.com/spf13/viper v1.21.0
+	golang.org/x/sys v0.29.0
+	golang.org/x/text v0.28.0
+)
 
 require (
 	github.com/fsnotify/fsnotify v1.9.0 // indirect
@@ -13,11 +18,8 @@ require (
 	github.com/spf13/afero v1.15.0 // indirect
 	github.com/spf13/cast v1.10.0 // indirect
 	github.com/spf13/pflag v1.0.10 // indirect
-	github.com/spf13/viper v1.21.0 // indirect
 	github.com/subosito/gotenv v1.6.0 // indirect
 	go.yaml.in/yaml/v3 v3.0.4 // indirect
-	golang.org/x/sys v0.29.0 // indirect
-	golang.org/x/text v0.28.0 // indirect
 )
 
 require (
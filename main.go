@@ -1,30 +1,357 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
 	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 
+	"github.com/google/gousb"
 	"github.com/nixxel-company-limited/escpos-usb-server/adapter"
 	"github.com/nixxel-company-limited/escpos-usb-server/server"
 	"github.com/spf13/viper"
 )
 
 func main() {
+	// "serve" is accepted as an optional subcommand: serve [--select] [--selftest]
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] == "serve" {
+		args = args[1:]
+	}
+	selectMode := flag.Bool("select", false, "list USB printers, choose one and save it to the config file before serving")
+	selfTest := flag.Bool("selftest", false, "write ESC @ to the printer at startup and exit with an error if that fails (also STARTUP_SELF_TEST)")
+	flag.CommandLine.Parse(args)
+
 	// Initialize Viper to read from environment variables
 	viper.AutomaticEnv()
 	viper.SetDefault("SERVER_ADDRESS", "localhost:9100")
+	viper.SetDefault("HTTP_ADDRESS", "")
+	viper.SetDefault("CONFIG_FILE", ".env")
+	viper.SetDefault("USB_CLAIM_ATTEMPTS", 3)
+	viper.SetDefault("LOG_EMPTY_CONNECTIONS", true)
+	viper.SetDefault("USB_CLAIM_RETRY_DELAY", "200ms")
+	viper.SetDefault("USB_DESCRIPTOR_TIMEOUT", adapter.DefaultDescriptorReadTimeout.String())
+
+	// Optional config file, re-read on SIGHUP
+	viper.SetConfigFile(viper.GetString("CONFIG_FILE"))
+	viper.SetConfigType("env")
+	if err := readConfig(); err != nil {
+		log.Printf("Failed to read config file: %v", err)
+	}
+
+	adapter.SetDescriptorReadTimeout(viper.GetDuration("USB_DESCRIPTOR_TIMEOUT"))
+
+	// Interactive first-run setup on hosts with several printers
+	if *selectMode {
+		if err := selectPrinter(os.Stdin, os.Stdout, adapter.ListPrinters, viper.GetString("CONFIG_FILE")); err != nil {
+			log.Fatalf("Printer selection failed: %v", err)
+		}
+		if err := readConfig(); err != nil {
+			log.Printf("Failed to read config file: %v", err)
+		}
+	}
 
 	// Get server address from environment variable
 	address := viper.GetString("SERVER_ADDRESS")
 	log.Printf("Server will listen on: %s", address)
 
-	device, err := adapter.NewUSBAdapterAuto()
+	if err := adapter.SetUSBDebug(viper.GetInt("USB_DEBUG")); err != nil {
+		log.Printf("Ignoring USB_DEBUG: %v", err)
+	}
+	switch policy := viper.GetString("USB_AUTO_SELECT"); policy {
+	case "", "first":
+	case "require-single":
+		adapter.SetAutoSelect(adapter.RequireSinglePrinter)
+	default:
+		log.Printf("Ignoring USB_AUTO_SELECT %q, expected first or require-single", policy)
+	}
+
+	device, err := selectedPrinter()
 	if err != nil {
 		panic(err)
 	}
-	defer device.Close()
+	selection := printerSelection()
+
+	config, err := loadConfig(address)
+	if err != nil {
+		panic(err)
+	}
+	config.StartupSelfTest = config.StartupSelfTest || *selfTest
+	svr := server.NewFromConfig(device, config)
+	if err := svr.SetFooterTemplate(viper.GetString("JOB_FOOTER_TEMPLATE")); err != nil {
+		log.Printf("Ignoring JOB_FOOTER_TEMPLATE: %v", err)
+	}
+	defer func() { svr.GetAdapter().Close() }()
+
+	// Reload safe-to-change settings on SIGHUP
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			log.Println("SIGHUP received, reloading config")
+			if err := readConfig(); err != nil {
+				log.Printf("Failed to reload config: %v", err)
+				continue
+			}
+			if newAddress := viper.GetString("SERVER_ADDRESS"); newAddress != address {
+				log.Printf("SERVER_ADDRESS changed to %s, restart to apply", newAddress)
+			}
+			svr.ApplySettings(loadSettings())
+
+			// Switch printers without a restart if the selection changed
+			if newSelection := printerSelection(); newSelection != selection {
+				if err := swapPrinter(svr); err != nil {
+					log.Printf("Failed to switch printer: %v", err)
+					continue
+				}
+				selection = newSelection
+			}
+		}
+	}()
+
+	// Optional control port for the administration endpoints, kept off
+	// the print ports
+	if controlAddress := viper.GetString("CONTROL_ADDRESS"); controlAddress != "" {
+		if err := svr.EnableControl(controlAddress, viper.GetString("CONTROL_TOKEN")); err != nil {
+			panic(err)
+		}
+	}
+
+	// Optional HTTP front-end
+	if httpAddress := viper.GetString("HTTP_ADDRESS"); httpAddress != "" {
+		log.Printf("HTTP API will listen on: %s", httpAddress)
+		go func() {
+			if err := http.ListenAndServe(httpAddress, svr.HTTPHandler()); err != nil {
+				log.Printf("HTTP server error: %v", err)
+			}
+		}()
+	}
 
-	svr := server.New(device, address)
-	if err := svr.Start(); err != nil {
+	// Use the socket passed by systemd when socket activated
+	listener, err := activationListener()
+	if err != nil {
+		panic(err)
+	}
+	if listener != nil {
+		log.Printf("Using socket-activated listener on %s", listener.Addr())
+		err = svr.Serve(listener)
+	} else {
+		err = svr.Start()
+	}
+	if err != nil {
 		panic(err)
 	}
 }
+
+// selectedPrinter opens the configured printer, wrapped for failover if
+// PRINTER_FAILOVER_DEVICE is set and for write coalescing if
+// WRITE_COALESCE_WINDOW is set
+func selectedPrinter() (adapter.Adapter, error) {
+	device, err := openPrinter()
+	if err != nil {
+		return nil, err
+	}
+	if path := viper.GetString("PRINTER_FAILOVER_DEVICE"); path != "" {
+		failover, err := withFailover(device, path)
+		if err != nil {
+			device.Close()
+			return nil, err
+		}
+		device = failover
+	}
+	if window := viper.GetDuration("WRITE_COALESCE_WINDOW"); window > 0 {
+		log.Printf("Coalescing printer writes for up to %s", window)
+		device = adapter.NewCoalescingAdapter(device, window)
+	}
+	return device, nil
+}
+
+// printerSelection returns the settings that choose the printer, to detect
+// a reload selecting a different one
+func printerSelection() string {
+	keys := []string{"PRINTER_DEVICE", "PRINTER_FAILOVER_DEVICE", "WRITE_COALESCE_WINDOW", "USB_SERIAL", "USB_PRODUCT", "USB_BUS", "USB_ADDRESS"}
+	values := make([]string, len(keys))
+	for i, key := range keys {
+		values[i] = key + "=" + viper.GetString(key)
+	}
+	return strings.Join(values, " ")
+}
+
+// swapPrinter opens the newly selected printer and hands it to the server
+func swapPrinter(svr *server.Server) error {
+	device, err := selectedPrinter()
+	if err != nil {
+		return err
+	}
+	if err := svr.SwapAdapter(device); err != nil {
+		device.Close()
+		return err
+	}
+	log.Println("Switched to the newly selected printer")
+	return nil
+}
+
+// openPrinter returns the character device adapter for PRINTER_DEVICE if
+// set, otherwise the USB printer pinned by USB_SERIAL, USB_PRODUCT or
+// USB_BUS and USB_ADDRESS, or the first USB printer found through libusb
+func openPrinter() (adapter.Adapter, error) {
+	if path := viper.GetString("PRINTER_DEVICE"); path != "" {
+		log.Printf("Using printer device %s", path)
+		return adapter.NewCharDeviceAdapter(path)
+	}
+
+	device, err := findUSBPrinter()
+	if err != nil {
+		return nil, err
+	}
+	device.SetRecoverOverflow(viper.GetBool("USB_RECOVER_OVERFLOW"))
+	device.AllowVendorInterface(viper.GetBool("USB_ALLOW_VENDOR_INTERFACE"))
+	if err := device.SetReadBufferSize(viper.GetInt("USB_READ_BUFFER_SIZE")); err != nil {
+		log.Printf("Ignoring USB_READ_BUFFER_SIZE: %v", err)
+	}
+	device.SetClaimRetry(viper.GetInt("USB_CLAIM_ATTEMPTS"), viper.GetDuration("USB_CLAIM_RETRY_DELAY"))
+	device.SetSlowWriteThreshold(viper.GetDuration("USB_SLOW_WRITE_THRESHOLD"))
+	switch transfer := viper.GetString("USB_TRANSFER_TYPE"); transfer {
+	case "":
+	case "bulk":
+		device.PreferTransferType(gousb.TransferTypeBulk)
+	case "interrupt":
+		device.PreferTransferType(gousb.TransferTypeInterrupt)
+	default:
+		log.Printf("Ignoring USB_TRANSFER_TYPE %q, expected bulk or interrupt", transfer)
+	}
+	return device, nil
+}
+
+// findUSBPrinter finds the USB printer selected in the config, if any
+func findUSBPrinter() (*adapter.USBAdapter, error) {
+	if serial := viper.GetString("USB_SERIAL"); serial != "" {
+		log.Printf("Using USB printer with serial %s", serial)
+		return adapter.NewUSBAdapterBySerial(serial)
+	}
+	if product := viper.GetString("USB_PRODUCT"); product != "" {
+		log.Printf("Using USB printer with product matching %q", product)
+		return adapter.NewUSBAdapterByProduct(product)
+	}
+	if bus, address := viper.GetInt("USB_BUS"), viper.GetInt("USB_ADDRESS"); bus > 0 && address > 0 {
+		log.Printf("Using USB printer at bus %d address %d", bus, address)
+		return adapter.NewUSBAdapterAt(bus, address)
+	}
+	return adapter.NewUSBAdapterAuto()
+}
+
+// withFailover wraps primary so jobs go to the printer device at path when
+// it fails. With PRINTER_FAILBACK_INTERVAL set, the primary is used again
+// once it recovers.
+func withFailover(primary adapter.Adapter, path string) (adapter.Adapter, error) {
+	secondary, err := adapter.NewCharDeviceAdapter(path)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Failing over to printer device %s", path)
+
+	failover := adapter.NewFailoverAdapter(primary, secondary)
+	if interval := viper.GetDuration("PRINTER_FAILBACK_INTERVAL"); interval > 0 {
+		failover.SetPolicy(adapter.FailoverRevert, interval)
+	}
+	return failover, nil
+}
+
+// activationListener returns the listener passed by systemd socket
+// activation (LISTEN_FDS), or nil when the process was started normally
+func activationListener() (net.Listener, error) {
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	if os.Getenv("LISTEN_FDS") != "1" {
+		return nil, fmt.Errorf("expected exactly one socket from systemd, got LISTEN_FDS=%q", os.Getenv("LISTEN_FDS"))
+	}
+
+	// Passed file descriptors start at 3
+	file := os.NewFile(3, "systemd-socket")
+	defer file.Close()
+	return net.FileListener(file)
+}
+
+// readConfig reads the config file, which is allowed to be missing
+func readConfig() error {
+	err := viper.ReadInConfig()
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// loadConfig builds the server configuration from Viper
+func loadConfig(address string) (server.Config, error) {
+	config := server.DefaultConfig()
+	config.Address = address
+	config.Settings = loadSettings()
+	config.ReuseAddr = viper.GetBool("SERVER_REUSE_ADDR")
+	config.Listen = server.ListenConfig{
+		ReusePort: viper.GetBool("SERVER_REUSE_PORT"),
+		Backlog:   viper.GetInt("SERVER_LISTEN_BACKLOG"),
+	}
+	config.PaperPollInterval = viper.GetDuration("PAPER_POLL_INTERVAL")
+	config.JobBuffering = viper.GetBool("JOB_BUFFERING")
+	config.MaxQueueBytes = viper.GetInt("MAX_QUEUE_BYTES")
+	config.CommitOnlyOnCleanClose = viper.GetBool("COMMIT_ONLY_ON_CLEAN_CLOSE")
+	config.ValidateJobs = viper.GetBool("VALIDATE_JOBS")
+	config.AutoCut = viper.GetBool("AUTO_CUT")
+	config.JobRetries = viper.GetInt("JOB_RETRIES")
+	config.ResumableJobs = viper.GetBool("RESUMABLE_JOBS")
+	config.PerJobWriteTimeout = viper.GetDuration("JOB_WRITE_TIMEOUT")
+	config.OfflineResponse = viper.GetBool("OFFLINE_RESPONSE")
+	config.ResetOnWriteError = viper.GetBool("RESET_ON_WRITE_ERROR")
+	config.ClearBufferBeforeJob = viper.GetBool("CLEAR_BUFFER_BEFORE_JOB")
+	config.LogRateLimit = viper.GetInt("LOG_RATE_LIMIT")
+	config.ResetBetweenClients = viper.GetBool("RESET_BETWEEN_CLIENTS")
+	config.ResponseForwarding = viper.GetDuration("RESPONSE_FORWARD_TIMEOUT")
+	config.KeepalivePing = viper.GetDuration("KEEPALIVE_PING_INTERVAL")
+	config.AutoDetectProtocol = viper.GetBool("AUTO_DETECT_PROTOCOL")
+	config.TCPHealthProbe = viper.GetBool("TCP_HEALTH_PROBE")
+	config.QuietEmptyConnections = !viper.GetBool("LOG_EMPTY_CONNECTIONS")
+	config.StartupSelfTest = viper.GetBool("STARTUP_SELF_TEST")
+	for _, origin := range strings.Split(viper.GetString("WEBSOCKET_ALLOWED_ORIGINS"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			config.WebSocketOrigins = append(config.WebSocketOrigins, origin)
+		}
+	}
+
+	switch protocol := viper.GetString("SERVER_PROTOCOL"); protocol {
+	case "", "raw":
+	case "acked":
+		config.Protocol = server.ProtocolAcked
+	default:
+		log.Printf("Ignoring SERVER_PROTOCOL %q, expected raw or acked", protocol)
+	}
+
+	// Optional on-disk job store for crash recovery
+	if dir := viper.GetString("JOB_STORE_DIR"); dir != "" {
+		store, err := server.NewFileJobStore(dir)
+		if err != nil {
+			return server.Config{}, err
+		}
+		config.JobStore = store
+	}
+
+	return config, nil
+}
+
+// loadSettings builds the runtime server settings from Viper
+func loadSettings() server.Settings {
+	return server.Settings{
+		HandshakeTimeout:     viper.GetDuration("HANDSHAKE_TIMEOUT"),
+		ReadTimeout:          viper.GetDuration("READ_TIMEOUT"),
+		MaxDecompressedBytes: viper.GetInt64("MAX_DECOMPRESSED_BYTES"),
+		InterJobDelay:        viper.GetDuration("INTER_JOB_DELAY"),
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/nixxel-company-limited/escpos-usb-server/adapter"
+)
+
+// Config keys written by --select to pin the chosen printer
+const (
+	keySerial  = "USB_SERIAL"
+	keyBus     = "USB_BUS"
+	keyAddress = "USB_ADDRESS"
+)
+
+// selectPrinter lists the printers found by list, asks the operator on in
+// to pick one and saves the choice to the config file at path
+func selectPrinter(in io.Reader, out io.Writer, list func() []adapter.PrinterInfo, path string) error {
+	printers := list()
+	if len(printers) == 0 {
+		return errors.New("no USB printers found")
+	}
+
+	printer, err := choosePrinter(in, out, printers)
+	if err != nil {
+		return err
+	}
+
+	if err := saveSelection(path, printer); err != nil {
+		return fmt.Errorf("failed to save printer selection: %w", err)
+	}
+	fmt.Fprintf(out, "Saved %s to %s\n", printer, path)
+	return nil
+}
+
+// choosePrinter prints a numbered list of printers and reads the operator's
+// choice, asking again until it is valid
+func choosePrinter(in io.Reader, out io.Writer, printers []adapter.PrinterInfo) (adapter.PrinterInfo, error) {
+	fmt.Fprintln(out, "Detected printers:")
+	for i, printer := range printers {
+		fmt.Fprintf(out, "  [%d] %s\n", i+1, printer)
+	}
+
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprintf(out, "Select a printer (1-%d): ", len(printers))
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return adapter.PrinterInfo{}, err
+			}
+			return adapter.PrinterInfo{}, errors.New("no printer selected")
+		}
+
+		n, err := strconv.Atoi(strings.TrimSpace(scanner.Text()))
+		if err != nil || n < 1 || n > len(printers) {
+			fmt.Fprintf(out, "Invalid choice %q\n", scanner.Text())
+			continue
+		}
+		return printers[n-1], nil
+	}
+}
+
+// saveSelection records printer in the env-format config file at path,
+// by serial number when it has one, else by bus and address. Other lines
+// of the file are kept.
+func saveSelection(path string, printer adapter.PrinterInfo) error {
+	content, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	values := map[string]string{keySerial: printer.Serial, keyBus: "", keyAddress: ""}
+	if printer.Serial == "" {
+		values[keyBus] = strconv.Itoa(printer.Bus)
+		values[keyAddress] = strconv.Itoa(printer.Address)
+	}
+
+	return os.WriteFile(path, []byte(setEnvValues(string(content), values)), 0o644)
+}
+
+// setEnvValues replaces the KEY=value lines of content for the given keys,
+// appending those not present
+func setEnvValues(content string, values map[string]string) string {
+	var lines []string
+	if content != "" {
+		lines = strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	}
+
+	seen := make(map[string]bool)
+	for i, line := range lines {
+		key, _, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if value, known := values[key]; ok && known {
+			lines[i] = key + "=" + value
+			seen[key] = true
+		}
+	}
+	for _, key := range []string{keySerial, keyBus, keyAddress} {
+		if value, known := values[key]; known && !seen[key] {
+			lines = append(lines, key+"="+value)
+		}
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nixxel-company-limited/escpos-usb-server/adapter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testPrinters = []adapter.PrinterInfo{
+	{Bus: 1, Address: 4, VID: 0x04b8, PID: 0x0202, Product: "TM-T88VI", Serial: "SN-A"},
+	{Bus: 2, Address: 7, VID: 0x0416, PID: 0x5011, Product: "POS58"},
+}
+
+func listTestPrinters() []adapter.PrinterInfo { return testPrinters }
+
+func TestSelectPrinterBySerial(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	require.NoError(t, os.WriteFile(path, []byte("# Printer server\nSERVER_ADDRESS=:9100\nUSB_BUS=3\n"), 0o644))
+
+	var out bytes.Buffer
+	require.NoError(t, selectPrinter(strings.NewReader("1\n"), &out, listTestPrinters, path))
+
+	assert.Contains(t, out.String(), "[1] bus 001 address 004  04b8:0202  TM-T88VI  serial SN-A")
+	assert.Contains(t, out.String(), "[2] bus 002 address 007  0416:5011  POS58")
+
+	saved, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "# Printer server\nSERVER_ADDRESS=:9100\nUSB_BUS=\nUSB_SERIAL=SN-A\nUSB_ADDRESS=\n", string(saved))
+}
+
+func TestSelectPrinterByBusAddress(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+
+	var out bytes.Buffer
+	// Invalid answers are asked again
+	require.NoError(t, selectPrinter(strings.NewReader("x\n5\n2\n"), &out, listTestPrinters, path))
+	assert.Equal(t, 2, strings.Count(out.String(), "Invalid choice"))
+
+	saved, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "USB_SERIAL=\nUSB_BUS=2\nUSB_ADDRESS=7\n", string(saved))
+}
+
+func TestSelectPrinterNoAnswer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+
+	err := selectPrinter(strings.NewReader(""), &bytes.Buffer{}, listTestPrinters, path)
+	assert.Error(t, err)
+	assert.NoFileExists(t, path)
+}
+
+func TestSelectPrinterNonePresent(t *testing.T) {
+	none := func() []adapter.PrinterInfo { return nil }
+
+	err := selectPrinter(strings.NewReader("1\n"), &bytes.Buffer{}, none, filepath.Join(t.TempDir(), ".env"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Protocol selects how TCP clients exchange jobs with the server
+type Protocol int
+
+const (
+	// ProtocolRaw passes the connection through to the printer without
+	// replying, like a plain port 9100 printer (the default)
+	ProtocolRaw Protocol = iota
+	// ProtocolAcked buffers each job and replies "ACK <jobid>\n" once it
+	// was written to the printer, or "NAK <jobid> <reason>\n" if it was
+	// not, so clients on a lossy network know when to resend
+	ProtocolAcked
+)
+
+// ackWriteTimeout bounds sending an ACK or NAK to a client
+const ackWriteTimeout = time.Second
+
+// keepalivePing is sent to idle acknowledged connections, see
+// SetKeepalivePing
+const keepalivePing = "PING\n"
+
+// errIncompleteJob is the NAK reason for a job cut short before it ended
+var errIncompleteJob = errors.New("incomplete job")
+
+// SetProtocol selects the TCP protocol. With ProtocolAcked, jobs end when
+// the client shuts down its side of the connection or, if set with
+// SetJobTerminator, at each terminator, so one connection can carry
+// several jobs; each is acknowledged in order.
+func (s *Server) SetProtocol(p Protocol) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.protocol = p
+}
+
+// SetKeepalivePing makes the server send "PING\n" to ProtocolAcked clients
+// every interval, so NAT and firewalls keep idle connections open and a
+// dead peer is noticed when the ping cannot be written. Clients should
+// ignore the line. Pings are never sent to ProtocolRaw clients, whose
+// connection is a one-way passthrough. Zero (the default) disables pings.
+func (s *Server) SetKeepalivePing(interval time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keepalivePing = interval
+}
+
+// replyConn serializes the lines written back to an acknowledged client by
+// its connection handler and keepalive pinger
+type replyConn struct {
+	net.Conn
+	mu sync.Mutex
+}
+
+// reply writes a line to the client under the ack write timeout
+func (c *replyConn) reply(line string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.SetWriteDeadline(time.Now().Add(ackWriteTimeout))
+	_, err := c.Write([]byte(line))
+	return err
+}
+
+// keepalive pings conn every interval until ctx is done. A connection that
+// cannot be pinged is closed, ending its handler.
+func (s *Server) keepalive(ctx context.Context, conn *replyConn, interval time.Duration) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.clock.After(interval):
+		}
+
+		if err := conn.reply(keepalivePing); err != nil {
+			if ctx.Err() == nil {
+				s.logger.Printf("Keepalive to %s failed, closing connection: %v", conn.RemoteAddr(), err)
+				conn.Close()
+			}
+			return
+		}
+	}
+}
+
+// newJobID returns the next buffered job's ID
+func (s *Server) newJobID() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastJobID++
+	return s.lastJobID
+}
+
+// commitAckedJobs commits and acknowledges every job in pending that ends
+// with terminator, returning the bytes after the last one
+func (s *Server) commitAckedJobs(ctx context.Context, conn *replyConn, result *JobResult, pending, terminator []byte) []byte {
+	if len(terminator) == 0 {
+		return pending
+	}
+	for {
+		end := bytes.Index(pending, terminator)
+		if end < 0 {
+			return pending
+		}
+		end += len(terminator)
+		// The queue worker flushed the job, so err covers its buffered end
+		id, err := s.commitJob(ctx, result, pending[:end])
+		s.sendAck(conn, id, err)
+		pending = pending[end:]
+	}
+}
+
+// sendAck replies ACK for a job that was written, or NAK with err as the
+// reason. Errors are logged; the client resends if it gets no reply.
+func (s *Server) sendAck(conn *replyConn, id uint64, err error) {
+	reply := fmt.Sprintf("ACK %d\n", id)
+	if err != nil {
+		// Keep the reason on one line
+		reason := strings.Join(strings.Fields(err.Error()), " ")
+		reply = fmt.Sprintf("NAK %d %s\n", id, reason)
+	}
+
+	if err := conn.reply(reply); err != nil {
+		s.logger.Printf("Error acknowledging job %d to %s: %v", id, conn.RemoteAddr(), err)
+	}
+}
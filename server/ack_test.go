@@ -0,0 +1,150 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sendJob writes data to the server and shuts down the write side, ending
+// the job
+func sendJob(t *testing.T, address string, data string) *net.TCPConn {
+	t.Helper()
+	conn, err := net.Dial("tcp", address)
+	require.NoError(t, err)
+	tcp := conn.(*net.TCPConn)
+	_, err = tcp.Write([]byte(data))
+	require.NoError(t, err)
+	require.NoError(t, tcp.CloseWrite())
+	return tcp
+}
+
+func TestServerAckedJob(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+	server := New(mockAdapter, "127.0.0.1:0")
+	server.SetProtocol(ProtocolAcked)
+
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	conn := sendJob(t, server.BoundAddress(), "receipt")
+	defer conn.Close()
+
+	assert.Equal(t, "ACK 1\n", readReply(t, conn))
+	assert.Equal(t, []byte("receipt"), mockAdapter.writeData)
+
+	conn2 := sendJob(t, server.BoundAddress(), "second")
+	defer conn2.Close()
+	assert.Equal(t, "ACK 2\n", readReply(t, conn2))
+}
+
+func TestServerAckedJobWriteFailure(t *testing.T) {
+	offline := &offlineAdapter{}
+	server := New(offline, "127.0.0.1:0")
+	server.SetProtocol(ProtocolAcked)
+
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+	offline.SetOffline(true)
+
+	conn := sendJob(t, server.BoundAddress(), "receipt")
+	defer conn.Close()
+
+	assert.Equal(t, "NAK 1 device not open\n", readReply(t, conn))
+}
+
+func TestServerAckedJobsWithTerminator(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+	server := New(mockAdapter, "127.0.0.1:0")
+	server.SetProtocol(ProtocolAcked)
+	server.SetJobTerminator([]byte("\x1dV\x00"))
+
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	conn := sendJob(t, server.BoundAddress(), "one\x1dV\x00two\x1dV\x00")
+	defer conn.Close()
+
+	assert.Equal(t, "ACK 1\nACK 2\n", readReply(t, conn))
+	assert.Equal(t, []byte("one\x1dV\x00two\x1dV\x00"), mockAdapter.writeData)
+}
+
+func TestServerAckedIncompleteJob(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+	server := New(mockAdapter, "127.0.0.1:0")
+	server.SetProtocol(ProtocolAcked)
+	server.SetCommitOnlyOnCleanClose(true)
+	server.SetJobTerminator([]byte("\x1dV\x00"))
+	server.SetReadTimeout(50 * time.Millisecond)
+
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	conn, err := net.Dial("tcp", server.BoundAddress())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("half a receipt"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "NAK 1 incomplete job\n", readReply(t, conn))
+	assert.Empty(t, mockAdapter.writeData)
+}
+
+func TestServerAckedKeepalivePing(t *testing.T) {
+	clk := newFakeClock()
+	server := New(&MockAdapter{}, "127.0.0.1:0")
+	server.clock = clk
+	server.SetProtocol(ProtocolAcked)
+	server.SetKeepalivePing(30 * time.Second)
+
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	conn, err := net.Dial("tcp", server.BoundAddress())
+	require.NoError(t, err)
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	require.Eventually(t, func() bool { return clk.Waiters() == 1 }, time.Second, 5*time.Millisecond)
+
+	// Nothing is sent before the interval elapses
+	clk.Advance(29 * time.Second)
+	conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	_, err = reader.ReadString('\n')
+	var netErr net.Error
+	require.True(t, errors.As(err, &netErr) && netErr.Timeout(), "unexpected read result: %v", err)
+
+	for range 2 {
+		clk.Advance(time.Second)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		assert.Equal(t, "PING\n", line)
+
+		require.Eventually(t, func() bool { return clk.Waiters() == 1 }, time.Second, 5*time.Millisecond)
+		clk.Advance(29 * time.Second)
+	}
+}
+
+func TestServerRawNoKeepalivePing(t *testing.T) {
+	server := New(&MockAdapter{}, "127.0.0.1:0")
+	server.SetKeepalivePing(10 * time.Millisecond)
+
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	conn, err := net.Dial("tcp", server.BoundAddress())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	n, err := conn.Read(make([]byte, 16))
+	assert.Zero(t, n)
+	var netErr net.Error
+	assert.True(t, errors.As(err, &netErr) && netErr.Timeout(), "unexpected read result: %v", err)
+}
@@ -0,0 +1,16 @@
+//go:build windows
+
+package server
+
+import (
+	"errors"
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+// isAddrInUse reports whether err is a listen failure because the address
+// is taken. Winsock reports WSAEADDRINUSE rather than syscall.EADDRINUSE.
+func isAddrInUse(err error) bool {
+	return errors.Is(err, windows.WSAEADDRINUSE) || errors.Is(err, syscall.EADDRINUSE)
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nixxel-company-limited/escpos-usb-server/adapter"
+	"github.com/nixxel-company-limited/escpos-usb-server/escpos"
+)
+
+// BufferClearer is implemented by adapters that can clear the printer's
+// receive buffer and consume its reply, such as adapter.USBAdapter
+type BufferClearer interface {
+	ClearBuffer() error
+}
+
+// SetClearBufferBeforeJob makes the server clear the printer's receive
+// buffer (DLE DC4 8) before the job following one that failed or was
+// aborted, so bytes left over from it cannot be taken as the start of the
+// next one. The clear also discards unprinted data, so it is never sent
+// after a job that was written completely, nor between copies. The command
+// is real-time, so it takes effect even behind an unfinished command. A job
+// resumed after a reconnect is not preceded by a clear.
+func (s *Server) SetClearBufferBeforeJob(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clearBufferBeforeJob = enabled
+}
+
+// writeStart writes the first data of a job, clearing the printer's
+// receive buffer before it if SetClearBufferBeforeJob is enabled and the
+// previous job was aborted, and initializing the printer if
+// SetResetBetweenClients is enabled and the job comes from another client
+// than the previous one
+func (s *Server) writeStart(ctx context.Context, data []byte) (int, error) {
+	if err := s.startJob(ctx); err != nil {
+		return 0, err
+	}
+	if err := s.resetForClient(ctx); err != nil {
+		return 0, err
+	}
+	return s.writeData(ctx, data)
+}
+
+// startJob clears the printer's receive buffer if SetClearBufferBeforeJob
+// is enabled and a job was aborted since the last clear
+func (s *Server) startJob(ctx context.Context) error {
+	s.mu.Lock()
+	clear := s.clearBufferBeforeJob && s.clearPending
+	s.mu.Unlock()
+	if !clear {
+		return nil
+	}
+	if err := s.clearBuffer(ctx); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.clearPending = false
+	s.mu.Unlock()
+	return nil
+}
+
+// abortJob records that a job failed or was cut short with data possibly
+// left in the printer, for startJob
+func (s *Server) abortJob() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clearPending = true
+}
+
+// clearBuffer sends the printer DLE DC4 8, through the adapter's
+// BufferClearer if it has one
+func (s *Server) clearBuffer(ctx context.Context) error {
+	s.swapMu.RLock()
+	defer s.swapMu.RUnlock()
+	device := s.printer()
+
+	if clearer, ok := device.(BufferClearer); ok {
+		if err := clearer.ClearBuffer(); err != nil {
+			return fmt.Errorf("clear buffer failed: %w", err)
+		}
+		return nil
+	}
+	if _, err := adapter.WriteContext(ctx, device, escpos.ClearBuffer()); err != nil {
+		return fmt.Errorf("clear buffer failed: %w", err)
+	}
+	return nil
+}
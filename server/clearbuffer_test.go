@@ -0,0 +1,163 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nixxel-company-limited/escpos-usb-server/escpos"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// printJob sends data as one TCP connection and waits for its result
+func printJob(t *testing.T, server *Server, results <-chan JobResult, data string) {
+	t.Helper()
+	conn, err := net.Dial("tcp", server.BoundAddress())
+	require.NoError(t, err)
+	_, err = conn.Write([]byte(data))
+	require.NoError(t, err)
+	conn.Close()
+
+	select {
+	case r := <-results:
+		require.NoError(t, r.Err)
+	case <-time.After(time.Second):
+		t.Fatal("job result was not reported")
+	}
+}
+
+// failOnceAdapter is a MockAdapter whose next write fails once failNext is
+// set
+type failOnceAdapter struct {
+	MockAdapter
+	mu       sync.Mutex
+	failNext bool
+}
+
+func (a *failOnceAdapter) Write(data []byte) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.failNext {
+		a.failNext = false
+		return 0, errors.New("mock write failure")
+	}
+	return a.MockAdapter.Write(data)
+}
+
+func (a *failOnceAdapter) FailNext() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.failNext = true
+}
+
+func TestServerClearBufferAfterFailedJob(t *testing.T) {
+	for _, buffering := range []bool{false, true} {
+		failing := &failOnceAdapter{}
+		server := New(failing, "127.0.0.1:0")
+		server.SetJobBuffering(buffering)
+		server.SetClearBufferBeforeJob(true)
+
+		results := make(chan JobResult, 1)
+		server.OnJobComplete(func(r JobResult) { results <- r })
+		require.NoError(t, server.StartAsync())
+
+		// Jobs written completely are not followed by a clear
+		printJob(t, server, results, "first")
+		printJob(t, server, results, "second")
+
+		failing.FailNext()
+		conn, err := net.Dial("tcp", server.BoundAddress())
+		require.NoError(t, err)
+		_, err = conn.Write([]byte("failed"))
+		require.NoError(t, err)
+		conn.Close()
+		assert.Error(t, (<-results).Err)
+
+		printJob(t, server, results, "third")
+		printJob(t, server, results, "fourth")
+		server.Stop()
+
+		want := append(append([]byte("firstsecond"), escpos.ClearBuffer()...), "thirdfourth"...)
+		assert.Equal(t, want, failing.writeData, "buffering %v", buffering)
+	}
+}
+
+func TestServerClearBufferNotBetweenCopies(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+	server := New(mockAdapter, "127.0.0.1:0")
+	server.SetJobBuffering(true)
+	server.SetClearBufferBeforeJob(true)
+
+	results := make(chan JobResult, 1)
+	server.OnJobComplete(func(r JobResult) { results <- r })
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	server.abortJob()
+	printJob(t, server, results, "COPIES 2\nticket")
+	assert.Equal(t, append(escpos.ClearBuffer(), "ticketticket"...), mockAdapter.writeData)
+}
+
+func TestServerClearBufferDisabled(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+	server := New(mockAdapter, "127.0.0.1:0")
+
+	results := make(chan JobResult, 1)
+	server.OnJobComplete(func(r JobResult) { results <- r })
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	printJob(t, server, results, "job")
+	assert.Equal(t, []byte("job"), mockAdapter.writeData)
+}
+
+func TestHTTPClearBufferAfterFailedJob(t *testing.T) {
+	failing := &failOnceAdapter{}
+	server := newStartedServer(t, failing)
+	server.SetClearBufferBeforeJob(true)
+	handler := server.HTTPHandler()
+
+	print := func(data string) int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/print", bytes.NewReader([]byte(data))))
+		return rec.Code
+	}
+
+	require.Equal(t, http.StatusOK, print("one"))
+	failing.FailNext()
+	require.Equal(t, http.StatusServiceUnavailable, print("failed"))
+	require.Equal(t, http.StatusOK, print("two"))
+
+	assert.Equal(t, append(append([]byte("one"), escpos.ClearBuffer()...), "two"...), failing.writeData)
+}
+
+// clearingAdapter is a MockAdapter that clears its buffer itself
+type clearingAdapter struct {
+	MockAdapter
+	clears int
+}
+
+func (a *clearingAdapter) ClearBuffer() error {
+	a.clears++
+	return nil
+}
+
+func TestServerClearBufferUsesBufferClearer(t *testing.T) {
+	clearing := &clearingAdapter{}
+	server := newStartedServer(t, clearing)
+	server.SetClearBufferBeforeJob(true)
+	server.abortJob()
+
+	rec := httptest.NewRecorder()
+	server.HTTPHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/print", bytes.NewReader([]byte("job"))))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 1, clearing.clears)
+	assert.Equal(t, []byte("job"), clearing.writeData)
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/nixxel-company-limited/escpos-usb-server/escpos"
+)
+
+// maxCodeRequestBytes caps the JSON body of /qr and /barcode
+const maxCodeRequestBytes = 64 << 10
+
+// Defaults for code requests that leave a field out
+const (
+	defaultQRSize = 6
+	defaultQRECC  = "M"
+)
+
+// codeFinish is the optional feed and cut after a printed code
+type codeFinish struct {
+	// Feed is the number of lines fed after the code
+	Feed int `json:"feed"`
+	// Cut cuts the paper after feeding
+	Cut bool `json:"cut"`
+	// Copies is how many times the code is printed, one if zero
+	Copies int `json:"copies"`
+}
+
+// qrRequest is the JSON body of POST /qr
+type qrRequest struct {
+	Data string `json:"data"`
+	Size int    `json:"size"`
+	ECC  string `json:"ecc"`
+	codeFinish
+}
+
+// barcodeRequest is the JSON body of POST /barcode
+type barcodeRequest struct {
+	Data      string `json:"data"`
+	Symbology string `json:"symbology"`
+	// Height in dots and module Width, printer defaults when zero
+	Height int `json:"height"`
+	Width  int `json:"width"`
+	codeFinish
+}
+
+// handleQR prints a QR code built from a JSON request
+func (s *Server) handleQR(w http.ResponseWriter, r *http.Request) {
+	var req qrRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	if req.Size == 0 {
+		req.Size = defaultQRSize
+	}
+	if req.ECC == "" {
+		req.ECC = defaultQRECC
+	}
+	ecc, err := escpos.ParseECC(req.ECC)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	b := escpos.NewBuilder().QRCode(req.Data, req.Size, ecc)
+	s.printCode(w, r, b, req.codeFinish)
+}
+
+// handleBarcode prints a barcode built from a JSON request
+func (s *Server) handleBarcode(w http.ResponseWriter, r *http.Request) {
+	var req barcodeRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	sym, err := escpos.ParseSymbology(req.Symbology)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Height < 0 || req.Height > 255 {
+		http.Error(w, fmt.Sprintf("barcode height %d out of range 1-255", req.Height), http.StatusBadRequest)
+		return
+	}
+	if req.Width < 0 || req.Width == 1 || req.Width > 6 {
+		http.Error(w, fmt.Sprintf("barcode width %d out of range 2-6", req.Width), http.StatusBadRequest)
+		return
+	}
+
+	b := escpos.NewBuilder()
+	if req.Height > 0 {
+		b.Raw(escpos.BarcodeHeight(byte(req.Height)))
+	}
+	if req.Width > 0 {
+		b.Raw(escpos.BarcodeWidth(byte(req.Width)))
+	}
+	b.Barcode(sym, req.Data)
+	s.printCode(w, r, b, req.codeFinish)
+}
+
+// printCode appends the optional feed and cut, then prints the job
+func (s *Server) printCode(w http.ResponseWriter, r *http.Request, b *escpos.Builder, finish codeFinish) {
+	if finish.Feed < 0 || finish.Feed > 255 {
+		http.Error(w, fmt.Sprintf("feed %d out of range 0-255", finish.Feed), http.StatusBadRequest)
+		return
+	}
+	if finish.Feed > 0 {
+		b.Feed(byte(finish.Feed))
+	}
+	if finish.Cut {
+		b.Cut()
+	}
+	copies, err := checkCopies(finish.Copies)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	data, err := b.Bytes()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.printHTTP(w, r, data, copies)
+}
+
+// decodeJSON decodes a small JSON request body, responding with 400 on
+// failure
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	dec := json.NewDecoder(io.LimitReader(r.Body, maxCodeRequestBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		http.Error(w, fmt.Sprintf("invalid JSON body: %v", err), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
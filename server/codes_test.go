@@ -0,0 +1,108 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nixxel-company-limited/escpos-usb-server/escpos"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func postJSON(server *Server, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	server.HTTPHandler().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHTTPQR(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+	server := newStartedServer(t, mockAdapter)
+
+	rec := postJSON(server, "/qr", `{"data": "https://example.com", "size": 6, "ecc": "M", "feed": 3, "cut": true}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	qr, err := escpos.QRCode("https://example.com", 6, escpos.ECCMedium)
+	require.NoError(t, err)
+	expected := append(escpos.Init(), qr...)
+	expected = append(expected, 0x1B, 0x64, 0x03)
+	expected = append(expected, 0x1D, 0x56, 0x41, 0x00)
+	assert.Equal(t, expected, mockAdapter.writeData)
+}
+
+func TestHTTPQRCutWithAutoCut(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+	server := New(mockAdapter, "localhost:0")
+	server.SetAutoCut(true)
+	require.NoError(t, server.StartAsync())
+	t.Cleanup(func() { server.Stop() })
+
+	rec := postJSON(server, "/qr", `{"data": "abc", "cut": true}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	// The job's own cut stands in for the auto-cut
+	qr, err := escpos.QRCode("abc", 6, escpos.ECCMedium)
+	require.NoError(t, err)
+	expected := append(escpos.Init(), qr...)
+	expected = append(expected, escpos.Cut()...)
+	assert.Equal(t, expected, mockAdapter.writeData)
+}
+
+func TestHTTPQRDefaults(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+	server := newStartedServer(t, mockAdapter)
+
+	rec := postJSON(server, "/qr", `{"data": "abc"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	qr, err := escpos.QRCode("abc", 6, escpos.ECCMedium)
+	require.NoError(t, err)
+	assert.Equal(t, append(escpos.Init(), qr...), mockAdapter.writeData)
+}
+
+func TestHTTPBarcode(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+	server := newStartedServer(t, mockAdapter)
+
+	rec := postJSON(server, "/barcode", `{"data": "400638133393", "symbology": "EAN13", "height": 80}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	expected := append(escpos.Init(), 0x1D, 0x68, 80)
+	expected = append(expected, 0x1D, 0x6B, 0x43, 12)
+	expected = append(expected, "400638133393"...)
+	assert.Equal(t, expected, mockAdapter.writeData)
+}
+
+func TestHTTPCodesInvalid(t *testing.T) {
+	testCases := []struct {
+		name string
+		path string
+		body string
+	}{
+		{"QRMalformedJSON", "/qr", `{"data": `},
+		{"QRUnknownField", "/qr", `{"data": "x", "colour": "red"}`},
+		{"QREmptyData", "/qr", `{"data": ""}`},
+		{"QRSizeTooLarge", "/qr", `{"data": "x", "size": 40}`},
+		{"QRBadECC", "/qr", `{"data": "x", "ecc": "Z"}`},
+		{"QRBadFeed", "/qr", `{"data": "x", "feed": 300}`},
+		{"BarcodeUnknownSymbology", "/barcode", `{"data": "123", "symbology": "PDF417"}`},
+		{"BarcodeBadData", "/barcode", `{"data": "12AB", "symbology": "EAN13"}`},
+		{"BarcodeBadWidth", "/barcode", `{"data": "12345670", "symbology": "EAN8", "width": 9}`},
+		{"BarcodeWidthOne", "/barcode", `{"data": "12345670", "symbology": "EAN8", "width": 1}`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockAdapter := &MockAdapter{}
+			server := New(mockAdapter, "localhost:0")
+
+			rec := postJSON(server, tc.path, tc.body)
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.Empty(t, mockAdapter.writeData)
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"github.com/nixxel-company-limited/escpos-usb-server/adapter"
+)
+
+// DefaultAddress is the address in DefaultConfig, the standard raw
+// printing port on loopback
+const DefaultAddress = "localhost:9100"
+
+// Config gathers every server tunable, so a server can be configured in one
+// place, e.g. from Viper. Apart from Address, the zero value of each field
+// is its default, as for the matching setter.
+type Config struct {
+	// Address is the TCP address to listen on, e.g. ":9100"
+	Address string
+	// Logger receives the server log; nil logs to stdout with a [SERVER]
+	// prefix
+	Logger *log.Logger
+	// LogRateLimit caps the log at this many lines per second, see
+	// SetLogRateLimit
+	LogRateLimit int
+
+	// Settings are the runtime settings that ApplySettings can change later
+	Settings
+
+	Protocol           Protocol
+	AutoDetectProtocol bool
+	TCPHealthProbe     bool
+	StartupSelfTest    bool
+	KeepalivePing      time.Duration
+	ReuseAddr          bool
+	Listen             ListenConfig
+	// QuietEmptyConnections stops logging connections that close without
+	// sending data, see SetLogEmptyConnections
+	QuietEmptyConnections bool
+
+	PaperPollInterval time.Duration
+
+	JobBuffering           bool
+	MaxQueueBytes          int
+	CommitOnlyOnCleanClose bool
+	JobTerminator          []byte
+	ValidateJobs           bool
+	JobStore               JobStore
+	JobRetries             int
+	ResumableJobs          bool
+	PerJobWriteTimeout     time.Duration
+
+	AutoCut     bool
+	CutCommand  []byte
+	JobEpilogue []byte
+
+	OfflineResponse      bool
+	ResetOnWriteError    bool
+	ClearBufferBeforeJob bool
+	ResetBetweenClients  bool
+	ResponseForwarding   time.Duration
+
+	// WebSocketOrigins are the browser origins allowed to open /ws besides
+	// the server's own, see SetWebSocketOrigins
+	WebSocketOrigins []string
+}
+
+// DefaultConfig returns a configuration listening on DefaultAddress as a
+// raw passthrough with no timeouts, streaming jobs straight to the printer
+func DefaultConfig() Config {
+	return Config{Address: DefaultAddress, Protocol: ProtocolRaw}
+}
+
+// NewFromConfig creates a server for device configured by cfg
+func NewFromConfig(device adapter.Adapter, cfg Config) *Server {
+	logger := cfg.Logger
+	if logger == nil {
+		logger = log.New(os.Stdout, "[SERVER] ", log.LstdFlags|log.Lmsgprefix)
+	}
+
+	s := &Server{
+		adapter: device,
+		address: cfg.Address,
+		logger:  logger,
+		clock:   realClock{},
+
+		handshakeTimeout:     cfg.HandshakeTimeout,
+		readTimeout:          cfg.ReadTimeout,
+		maxDecompressedBytes: cfg.MaxDecompressedBytes,
+		interJobDelay:        cfg.InterJobDelay,
+
+		protocol:           cfg.Protocol,
+		autoDetectProtocol: cfg.AutoDetectProtocol,
+		tcpHealthProbe:     cfg.TCPHealthProbe,
+		startupSelfTest:    cfg.StartupSelfTest,
+		keepalivePing:      cfg.KeepalivePing,
+		reuseAddr:          cfg.ReuseAddr,
+		listenConfig:       cfg.Listen,
+
+		logEmptyConnections: !cfg.QuietEmptyConnections,
+
+		paperPollInterval: cfg.PaperPollInterval,
+
+		jobBuffering:           cfg.JobBuffering,
+		maxQueueBytes:          cfg.MaxQueueBytes,
+		commitOnlyOnCleanClose: cfg.CommitOnlyOnCleanClose,
+		jobTerminator:          append([]byte(nil), cfg.JobTerminator...),
+		validateJobs:           cfg.ValidateJobs,
+		jobStore:               cfg.JobStore,
+		jobRetries:             cfg.JobRetries,
+		resumableJobs:          cfg.ResumableJobs,
+		jobWriteTimeout:        cfg.PerJobWriteTimeout,
+
+		autoCut:     cfg.AutoCut,
+		cutCommand:  append([]byte(nil), cfg.CutCommand...),
+		jobEpilogue: append([]byte(nil), cfg.JobEpilogue...),
+
+		offlineResponse:      cfg.OfflineResponse,
+		resetOnWriteError:    cfg.ResetOnWriteError,
+		clearBufferBeforeJob: cfg.ClearBufferBeforeJob,
+		resetBetweenClients:  cfg.ResetBetweenClients,
+		responseTimeout:      cfg.ResponseForwarding,
+
+		wsOrigins: append([]string(nil), cfg.WebSocketOrigins...),
+	}
+	s.SetLogRateLimit(cfg.LogRateLimit)
+	return s
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"bytes"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewFromConfig(t *testing.T) {
+	var logs bytes.Buffer
+	store, err := NewFileJobStore(t.TempDir())
+	require.NoError(t, err)
+
+	cfg := Config{
+		Address:      "127.0.0.1:0",
+		Logger:       log.New(&logs, "", 0),
+		LogRateLimit: 100,
+		Settings: Settings{
+			HandshakeTimeout:     time.Second,
+			ReadTimeout:          2 * time.Second,
+			MaxDecompressedBytes: 1 << 20,
+			InterJobDelay:        50 * time.Millisecond,
+		},
+		Protocol:               ProtocolAcked,
+		AutoDetectProtocol:     true,
+		TCPHealthProbe:         true,
+		StartupSelfTest:        true,
+		KeepalivePing:          30 * time.Second,
+		ReuseAddr:              true,
+		Listen:                 ListenConfig{ReusePort: true, Backlog: 1024},
+		QuietEmptyConnections:  true,
+		PaperPollInterval:      time.Minute,
+		JobBuffering:           true,
+		MaxQueueBytes:          1 << 20,
+		CommitOnlyOnCleanClose: true,
+		JobTerminator:          []byte{0x1D, 'V', 0},
+		ValidateJobs:           true,
+		JobStore:               store,
+		JobRetries:             2,
+		ResumableJobs:          true,
+		PerJobWriteTimeout:     5 * time.Second,
+		AutoCut:                true,
+		CutCommand:             []byte{0x1D, 'V', 66, 0},
+		JobEpilogue:            []byte("\n\n"),
+		OfflineResponse:        true,
+		ResetOnWriteError:      true,
+		ClearBufferBeforeJob:   true,
+		ResetBetweenClients:    true,
+		ResponseForwarding:     2 * time.Second,
+	}
+	server := NewFromConfig(&MockAdapter{}, cfg)
+
+	assert.Equal(t, cfg.Settings, server.Settings())
+	assert.Equal(t, "127.0.0.1:0", server.address)
+	assert.Same(t, cfg.Logger, server.logger)
+	assert.Equal(t, 100, server.logLimiter.perSecond)
+	assert.Equal(t, ProtocolAcked, server.protocol)
+	assert.True(t, server.autoDetectProtocol)
+	assert.True(t, server.tcpHealthProbe)
+	assert.True(t, server.startupSelfTest)
+	assert.Equal(t, 30*time.Second, server.keepalivePing)
+	assert.True(t, server.reuseAddr)
+	assert.Equal(t, ListenConfig{ReusePort: true, Backlog: 1024}, server.listenConfig)
+	assert.False(t, server.logEmptyConnections)
+	assert.Equal(t, time.Minute, server.paperPollInterval)
+	assert.True(t, server.jobBuffering)
+	assert.Equal(t, 1<<20, server.maxQueueBytes)
+	assert.True(t, server.commitOnlyOnCleanClose)
+	assert.Equal(t, []byte{0x1D, 'V', 0}, server.jobTerminator)
+	assert.True(t, server.validateJobs)
+	assert.Same(t, store, server.jobStore)
+	assert.Equal(t, 2, server.jobRetries)
+	assert.True(t, server.resumableJobs)
+	assert.Equal(t, 5*time.Second, server.jobWriteTimeout)
+	assert.True(t, server.autoCut)
+	assert.Equal(t, []byte{0x1D, 'V', 66, 0}, server.cutCommand)
+	assert.Equal(t, []byte("\n\n"), server.jobEpilogue)
+	assert.True(t, server.offlineResponse)
+	assert.True(t, server.resetOnWriteError)
+	assert.True(t, server.clearBufferBeforeJob)
+	assert.True(t, server.resetBetweenClients)
+	assert.Equal(t, 2*time.Second, server.responseTimeout)
+
+	// The config's slices are copied
+	cfg.JobEpilogue[0] = 'x'
+	assert.Equal(t, []byte("\n\n"), server.jobEpilogue)
+}
+
+func TestNewFromConfigServes(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+	cfg := DefaultConfig()
+	cfg.Address = "127.0.0.1:0"
+	cfg.Protocol = ProtocolAcked
+	server := NewFromConfig(mockAdapter, cfg)
+
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	conn := sendJob(t, server.BoundAddress(), "receipt")
+	defer conn.Close()
+	assert.Equal(t, "ACK 1\n", readReply(t, conn))
+}
+
+func TestDefaultConfig(t *testing.T) {
+	server := New(&MockAdapter{}, DefaultAddress)
+	fromConfig := NewFromConfig(&MockAdapter{}, DefaultConfig())
+
+	assert.Equal(t, server.Settings(), fromConfig.Settings())
+	assert.Equal(t, server.address, fromConfig.address)
+	assert.Equal(t, server.protocol, fromConfig.protocol)
+}
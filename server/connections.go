@@ -0,0 +1,210 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// maxRecentConnections bounds how many closed connections are remembered
+const maxRecentConnections = 50
+
+// Connection states reported by GET /connections
+const (
+	ConnStateActive   = "active"
+	ConnStatePrinting = "printing"
+	ConnStateClosed   = "closed"
+)
+
+// ConnectionInfo describes an active or recently closed client connection
+type ConnectionInfo struct {
+	RemoteAddr   string    `json:"remote_addr"`
+	BytesSent    int       `json:"bytes_sent"`
+	ConnectedAt  time.Time `json:"connected_at"`
+	LastActivity time.Time `json:"last_activity"`
+	State        string    `json:"state"`
+}
+
+// connRegistry tracks active connections and a bounded history of closed
+// ones. The zero value is ready to use.
+type connRegistry struct {
+	mu     sync.Mutex
+	nextID uint64
+	active map[uint64]*ConnectionInfo
+	// recent holds closed connections, oldest first
+	recent []ConnectionInfo
+}
+
+// open registers a new connection and returns its id
+func (r *connRegistry) open(remoteAddr string, now time.Time) uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.active == nil {
+		r.active = make(map[uint64]*ConnectionInfo)
+	}
+	r.nextID++
+	r.active[r.nextID] = &ConnectionInfo{
+		RemoteAddr:   remoteAddr,
+		ConnectedAt:  now,
+		LastActivity: now,
+		State:        ConnStateActive,
+	}
+	return r.nextID
+}
+
+// received records n bytes sent by the client
+func (r *connRegistry) received(id uint64, n int, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if info, ok := r.active[id]; ok {
+		info.BytesSent += n
+		info.LastActivity = now
+	}
+}
+
+// setState updates the state of an active connection
+func (r *connRegistry) setState(id uint64, state string, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if info, ok := r.active[id]; ok {
+		info.State = state
+		info.LastActivity = now
+	}
+}
+
+// close moves a connection to the recent history
+func (r *connRegistry) close(id uint64, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	info, ok := r.active[id]
+	if !ok {
+		return
+	}
+	delete(r.active, id)
+
+	info.State = ConnStateClosed
+	info.LastActivity = now
+	r.recent = append(r.recent, *info)
+	if len(r.recent) > maxRecentConnections {
+		r.recent = r.recent[len(r.recent)-maxRecentConnections:]
+	}
+}
+
+// list returns active connections in connection order, followed by closed
+// ones, most recently closed first
+func (r *connRegistry) list() []ConnectionInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ids := make([]uint64, 0, len(r.active))
+	for id := range r.active {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	infos := make([]ConnectionInfo, 0, len(r.active)+len(r.recent))
+	for _, id := range ids {
+		infos = append(infos, *r.active[id])
+	}
+	for i := len(r.recent) - 1; i >= 0; i-- {
+		infos = append(infos, r.recent[i])
+	}
+	return infos
+}
+
+// Connections returns the active and recently closed client connections
+func (s *Server) Connections() []ConnectionInfo {
+	return s.connections.list()
+}
+
+// handleConnections lists active and recently closed client connections
+func (s *Server) handleConnections(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]ConnectionInfo{"connections": s.Connections()})
+}
+
+// ConnPhase is the lifecycle phase a ConnEvent reports
+type ConnPhase int
+
+const (
+	// ConnConnected is reported when a client connects
+	ConnConnected ConnPhase = iota
+	// ConnDisconnected is reported when the connection has ended
+	ConnDisconnected
+)
+
+// CloseReason tells why a connection ended
+type CloseReason string
+
+// Close reasons reported by ConnEvent
+const (
+	// CloseEOF: the client closed the connection
+	CloseEOF CloseReason = "eof"
+	// CloseTimeout: the handshake or idle read timeout passed
+	CloseTimeout CloseReason = "timeout"
+	// CloseQuota: the job was refused by a size limit, e.g. ErrQueueFull
+	CloseQuota CloseReason = "quota"
+	// CloseShutdown: the server was stopped
+	CloseShutdown CloseReason = "shutdown"
+	// CloseError: a read, write or protocol error ended the connection
+	CloseError CloseReason = "error"
+)
+
+// ConnEvent describes a TCP client connecting or disconnecting. The byte
+// counts, Duration, Reason and Err are only set on ConnDisconnected.
+type ConnEvent struct {
+	Phase         ConnPhase
+	RemoteAddr    string
+	BytesReceived int
+	BytesWritten  int
+	Duration      time.Duration
+	Reason        CloseReason
+	// Err is the error behind CloseTimeout, CloseQuota and CloseError
+	Err error
+}
+
+// OnConnection sets a callback invoked once when each TCP client connects
+// and once when its connection ends, for dashboards that would otherwise
+// parse the log. It is called from the connection's goroutine, so a slow
+// callback delays that client.
+func (s *Server) OnConnection(handler func(ConnEvent)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onConnection = handler
+}
+
+// notifyConnection passes event to the OnConnection callback, if set
+func (s *Server) notifyConnection(event ConnEvent) {
+	s.mu.Lock()
+	handler := s.onConnection
+	s.mu.Unlock()
+
+	if handler != nil {
+		handler(event)
+	}
+}
+
+// closeReason classifies the outcome of a connection
+func closeReason(err error) CloseReason {
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return CloseEOF
+	case errors.Is(err, ErrServerStopped):
+		return CloseShutdown
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return CloseTimeout
+	case errors.Is(err, ErrQueueFull):
+		return CloseQuota
+	default:
+		return CloseError
+	}
+}
@@ -0,0 +1,181 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// getConnections fetches GET /connections through the HTTP handler
+func getConnections(t *testing.T, server *Server) []ConnectionInfo {
+	rec := httptest.NewRecorder()
+	server.HTTPHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/connections", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var body struct {
+		Connections []ConnectionInfo `json:"connections"`
+	}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+	return body.Connections
+}
+
+func TestHTTPConnections(t *testing.T) {
+	gated := newGatedAdapter()
+	defer gated.Release()
+
+	server := New(gated, "127.0.0.1:0")
+	server.SetJobBuffering(true)
+
+	require.NoError(t, server.StartAsync())
+	address := server.BoundAddress()
+	defer server.Stop()
+
+	conn, err := net.Dial("tcp", address)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("receipt"))
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		conns := getConnections(t, server)
+		return len(conns) == 1 && conns[0].BytesSent == 7
+	}, time.Second, 10*time.Millisecond)
+
+	info := getConnections(t, server)[0]
+	assert.Equal(t, conn.LocalAddr().String(), info.RemoteAddr)
+	assert.Equal(t, ConnStateActive, info.State)
+	assert.False(t, info.ConnectedAt.IsZero())
+	assert.False(t, info.LastActivity.Before(info.ConnectedAt))
+}
+
+func TestHTTPConnectionsRecentlyClosed(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+
+	server := New(mockAdapter, "127.0.0.1:0")
+
+	require.NoError(t, server.StartAsync())
+	address := server.BoundAddress()
+	defer server.Stop()
+
+	conn, err := net.Dial("tcp", address)
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("hello"))
+	require.NoError(t, err)
+	conn.Close()
+
+	require.Eventually(t, func() bool {
+		conns := getConnections(t, server)
+		return len(conns) == 1 && conns[0].State == ConnStateClosed
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 5, getConnections(t, server)[0].BytesSent)
+}
+
+func TestConnRegistryBoundsHistory(t *testing.T) {
+	var r connRegistry
+	now := time.Now()
+
+	active := r.open("active", now)
+	for i := 0; i < maxRecentConnections+5; i++ {
+		r.close(r.open(fmt.Sprintf("client %d", i), now), now)
+	}
+	r.received(active, 3, now)
+
+	infos := r.list()
+	require.Len(t, infos, maxRecentConnections+1)
+	assert.Equal(t, "active", infos[0].RemoteAddr)
+	assert.Equal(t, 3, infos[0].BytesSent)
+	assert.Equal(t, fmt.Sprintf("client %d", maxRecentConnections+4), infos[1].RemoteAddr)
+	assert.Equal(t, ConnStateClosed, infos[1].State)
+}
+
+// connEventRecorder collects ConnEvents from the connection goroutines
+type connEventRecorder struct {
+	mu     sync.Mutex
+	events []ConnEvent
+}
+
+func (r *connEventRecorder) record(e ConnEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+}
+
+func (r *connEventRecorder) Events() []ConnEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]ConnEvent(nil), r.events...)
+}
+
+func TestServerOnConnectionCleanClose(t *testing.T) {
+	server := New(&MockAdapter{}, "127.0.0.1:0")
+	recorder := &connEventRecorder{}
+	server.OnConnection(recorder.record)
+
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	conn := sendJob(t, server.BoundAddress(), "receipt")
+	defer conn.Close()
+
+	require.Eventually(t, func() bool { return len(recorder.Events()) == 2 }, time.Second, 5*time.Millisecond)
+	server.Stop()
+
+	events := recorder.Events()
+	require.Len(t, events, 2)
+	assert.Equal(t, ConnConnected, events[0].Phase)
+	assert.Equal(t, conn.LocalAddr().String(), events[0].RemoteAddr)
+
+	closed := events[1]
+	assert.Equal(t, ConnDisconnected, closed.Phase)
+	assert.Equal(t, conn.LocalAddr().String(), closed.RemoteAddr)
+	assert.Equal(t, CloseEOF, closed.Reason)
+	assert.NoError(t, closed.Err)
+	assert.Equal(t, 7, closed.BytesReceived)
+	assert.Equal(t, 7, closed.BytesWritten)
+	assert.Positive(t, closed.Duration)
+}
+
+func TestServerOnConnectionTimeout(t *testing.T) {
+	server := New(&MockAdapter{}, "127.0.0.1:0")
+	server.SetHandshakeTimeout(20 * time.Millisecond)
+	recorder := &connEventRecorder{}
+	server.OnConnection(recorder.record)
+
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	// The client connects and never sends anything
+	conn, err := net.Dial("tcp", server.BoundAddress())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	require.Eventually(t, func() bool { return len(recorder.Events()) == 2 }, time.Second, 5*time.Millisecond)
+	server.Stop()
+
+	events := recorder.Events()
+	require.Len(t, events, 2)
+	assert.Equal(t, ConnConnected, events[0].Phase)
+	assert.Equal(t, ConnDisconnected, events[1].Phase)
+	assert.Equal(t, CloseTimeout, events[1].Reason)
+	assert.Error(t, events[1].Err)
+	assert.Zero(t, events[1].BytesReceived)
+}
+
+func TestCloseReason(t *testing.T) {
+	assert.Equal(t, CloseEOF, closeReason(nil))
+	assert.Equal(t, CloseShutdown, closeReason(ErrServerStopped))
+	assert.Equal(t, CloseShutdown, closeReason(fmt.Errorf("write interrupted: %w", ErrServerStopped)))
+	assert.Equal(t, CloseQuota, closeReason(fmt.Errorf("%w: 10 byte job", ErrQueueFull)))
+	assert.Equal(t, CloseTimeout, closeReason(os.ErrDeadlineExceeded))
+	assert.Equal(t, CloseError, closeReason(errors.New("broken pipe")))
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg" // registers the decoder for image/jpeg jobs
+	_ "image/png"  // registers the decoder for image/png jobs
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/nixxel-company-limited/escpos-usb-server/adapter"
+	"github.com/nixxel-company-limited/escpos-usb-server/escpos"
+)
+
+// Content types POST /print converts, see printContentType
+const (
+	contentTypeESCPOS = "application/vnd.escpos"
+	contentTypeText   = "text/plain"
+	contentTypePNG    = "image/png"
+	contentTypeJPEG   = "image/jpeg"
+)
+
+// textFeed is how many lines are fed after a text/plain job so it clears
+// the cutter
+const textFeed = 3
+
+// maxImagePixels caps the size of an image/png or image/jpeg job, checked
+// from its header before it is decoded, since a small file can declare
+// dimensions that take gigabytes to decode (decompression bomb guard)
+const maxImagePixels = 16 << 20
+
+var (
+	errUnsupportedContentType = errors.New("unsupported content type")
+	errImageTooLarge          = errors.New("image too large")
+)
+
+// Rasterizer is implemented by adapters that fit images to the printer's
+// head width, such as adapter.USBAdapter
+type Rasterizer interface {
+	RasterImage(img image.Image, opts escpos.RasterOptions) ([]byte, error)
+}
+
+// printContentType returns the media type of a POST /print body. A request
+// without a Content-Type, or with application/octet-stream, is raw ESC/POS
+// like before content types were told apart.
+func printContentType(r *http.Request) (string, error) {
+	header := r.Header.Get("Content-Type")
+	if header == "" {
+		return contentTypeESCPOS, nil
+	}
+
+	mediaType, params, err := mime.ParseMediaType(header)
+	if err != nil {
+		return "", fmt.Errorf("%w %q", errUnsupportedContentType, header)
+	}
+	switch mediaType {
+	case contentTypeESCPOS, "application/octet-stream":
+		return contentTypeESCPOS, nil
+	case contentTypeText:
+		if charset := strings.ToLower(params["charset"]); charset != "" && charset != "utf-8" && charset != "us-ascii" {
+			return "", fmt.Errorf("%w: text/plain with charset %s, expected utf-8", errUnsupportedContentType, charset)
+		}
+		return mediaType, nil
+	case contentTypePNG, contentTypeJPEG:
+		return mediaType, nil
+	default:
+		return "", fmt.Errorf("%w %s", errUnsupportedContentType, mediaType)
+	}
+}
+
+// convertContent turns a text or image body into ESC/POS. Text is
+// encoded to PC437, selected first with ESC t 0 in case an earlier job
+// left another code page selected, and followed by a feed and a cut;
+// images are rasterized to fit the print head.
+func (s *Server) convertContent(contentType string, body io.Reader) ([]byte, error) {
+	data, err := s.readBody(body)
+	if err != nil {
+		return nil, err
+	}
+
+	switch contentType {
+	case contentTypeText:
+		job := append(escpos.SelectCodePage(escpos.CodePagePC437), escpos.EncodeText(string(data))...)
+		if len(job) > 0 && job[len(job)-1] != escpos.LF {
+			job = append(job, escpos.LF)
+		}
+		job = append(job, escpos.Feed(textFeed)...)
+		return append(job, s.closingCut()...), nil
+	default:
+		config, _, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode %s: %w", contentType, err)
+		}
+		if pixels := int64(config.Width) * int64(config.Height); pixels > maxImagePixels {
+			return nil, fmt.Errorf("%w: %dx%d exceeds %d pixels", errImageTooLarge, config.Width, config.Height, maxImagePixels)
+		}
+
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode %s: %w", contentType, err)
+		}
+		return s.rasterize(img)
+	}
+}
+
+// rasterize encodes img for the current printer, scaled down if it is
+// wider than the print head
+func (s *Server) rasterize(img image.Image) ([]byte, error) {
+	opts := escpos.RasterOptions{FitWidth: true}
+
+	s.swapMu.RLock()
+	defer s.swapMu.RUnlock()
+	if r, ok := s.printer().(Rasterizer); ok {
+		return r.RasterImage(img, opts)
+	}
+	opts.MaxWidth = adapter.DefaultDotWidth
+	return escpos.RasterImageBanded(img, opts, escpos.DefaultMaxBandHeight)
+}
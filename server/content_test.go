@@ -0,0 +1,139 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nixxel-company-limited/escpos-usb-server/adapter"
+	"github.com/nixxel-company-limited/escpos-usb-server/escpos"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// postPrint posts body to /print with the given Content-Type
+func postPrint(t *testing.T, server *Server, contentType string, body []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/print", bytes.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	rec := httptest.NewRecorder()
+	server.HTTPHandler().ServeHTTP(rec, req)
+	return rec
+}
+
+// testImage is a 16x2 image with a black left half
+func testImage() image.Image {
+	img := image.NewGray(image.Rect(0, 0, 16, 2))
+	for y := range 2 {
+		for x := range 16 {
+			c := color.Gray{Y: 255}
+			if x < 8 {
+				c.Y = 0
+			}
+			img.SetGray(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestHTTPPrintRawContentTypes(t *testing.T) {
+	job := []byte{0x1B, 0x40, 'h', 'i', 0x0A}
+	for _, contentType := range []string{"", "application/vnd.escpos", "application/octet-stream"} {
+		t.Run(contentType, func(t *testing.T) {
+			mockAdapter := &MockAdapter{}
+			rec := postPrint(t, newStartedServer(t, mockAdapter), contentType, job)
+
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, job, mockAdapter.writeData)
+		})
+	}
+}
+
+func TestHTTPPrintText(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+	rec := postPrint(t, newStartedServer(t, mockAdapter), "text/plain; charset=utf-8", []byte("Café\r\nTotal 3"))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	want := append(escpos.SelectCodePage(escpos.CodePagePC437), "Caf\x82\nTotal 3\n"...)
+	want = append(want, escpos.Feed(textFeed)...)
+	want = append(want, escpos.Cut()...)
+	assert.Equal(t, want, mockAdapter.writeData)
+}
+
+func TestHTTPPrintTextWithAutoCut(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+	server := newStartedServer(t, mockAdapter)
+	server.SetAutoCut(true)
+	rec := postPrint(t, server, "text/plain", []byte("hi\n"))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	// One cut, from auto-cut
+	want := append(escpos.SelectCodePage(escpos.CodePagePC437), "hi\n"...)
+	want = append(want, escpos.Feed(textFeed)...)
+	want = append(want, escpos.Cut()...)
+	assert.Equal(t, want, mockAdapter.writeData)
+}
+
+func TestHTTPPrintImages(t *testing.T) {
+	want, err := escpos.RasterImageBanded(testImage(), escpos.RasterOptions{MaxWidth: adapter.DefaultDotWidth, FitWidth: true}, escpos.DefaultMaxBandHeight)
+	require.NoError(t, err)
+
+	var pngBody, jpegBody bytes.Buffer
+	require.NoError(t, png.Encode(&pngBody, testImage()))
+	require.NoError(t, jpeg.Encode(&jpegBody, testImage(), &jpeg.Options{Quality: 100}))
+
+	for contentType, body := range map[string][]byte{"image/png": pngBody.Bytes(), "image/jpeg": jpegBody.Bytes()} {
+		t.Run(contentType, func(t *testing.T) {
+			mockAdapter := &MockAdapter{}
+			rec := postPrint(t, newStartedServer(t, mockAdapter), contentType, body)
+
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, want, mockAdapter.writeData)
+		})
+	}
+}
+
+func TestHTTPPrintBadImage(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+	rec := postPrint(t, New(mockAdapter, "localhost:0"), "image/png", []byte("not a png"))
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Empty(t, mockAdapter.writeData)
+}
+
+func TestHTTPPrintImageTooLarge(t *testing.T) {
+	// A PNG header declaring 8192x8192 pixels, with no pixel data behind it
+	var body bytes.Buffer
+	require.NoError(t, png.Encode(&body, image.NewGray(image.Rect(0, 0, 1, 1))))
+	header := body.Bytes()[:33]
+	copy(header[16:24], []byte{0, 0, 0x20, 0, 0, 0, 0x20, 0})
+	binary.BigEndian.PutUint32(header[29:33], crc32.ChecksumIEEE(header[12:29]))
+
+	mockAdapter := &MockAdapter{}
+	rec := postPrint(t, New(mockAdapter, "localhost:0"), "image/png", header)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	assert.Contains(t, rec.Body.String(), "8192x8192")
+	assert.Empty(t, mockAdapter.writeData)
+}
+
+func TestHTTPPrintUnsupportedContentType(t *testing.T) {
+	for _, contentType := range []string{"application/pdf", "text/plain; charset=iso-8859-1", "not a type;"} {
+		t.Run(contentType, func(t *testing.T) {
+			mockAdapter := &MockAdapter{}
+			rec := postPrint(t, New(mockAdapter, "localhost:0"), contentType, []byte("data"))
+
+			assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+			assert.Empty(t, mockAdapter.writeData)
+		})
+	}
+}
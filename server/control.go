@@ -0,0 +1,201 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// controlShutdownTimeout bounds how long Stop waits for control requests
+// in flight
+const controlShutdownTimeout = 5 * time.Second
+
+// controlReadHeaderTimeout bounds how long a control client may take to
+// send its request headers
+const controlReadHeaderTimeout = 10 * time.Second
+
+// ControlHandler returns the administration endpoints, for a port separate
+// from the print ports:
+//   - GET  /health       200 while the printer is open, 503 otherwise
+//   - GET  /status, /connections, /metrics, /debug/usb, /debug/trace as
+//     on HTTPHandler
+//   - POST /reprint, /debug/trace as on HTTPHandler
+//
+// If token is set the mutating (POST) endpoints and GET /debug/trace, which
+// serves captured print data, require it as "Authorization: Bearer
+// <token>"; the other read endpoints stay open.
+func (s *Server) ControlHandler(token string) http.Handler {
+	auth := func(h http.HandlerFunc) http.HandlerFunc { return requireToken(token, h) }
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /health", s.handleHealth)
+	mux.HandleFunc("GET /status", s.handleStatus)
+	mux.HandleFunc("GET /connections", s.handleConnections)
+	mux.HandleFunc("GET /metrics", s.handleMetrics)
+	mux.HandleFunc("GET /debug/usb", s.handleDebugUSB)
+	mux.HandleFunc("GET /debug/trace", auth(s.handleTrace))
+	mux.HandleFunc("POST /reprint", auth(s.handleReprint))
+	mux.HandleFunc("POST /debug/trace", auth(s.handleStartTrace))
+	return mux
+}
+
+// EnableControl serves ControlHandler(token) on addr until Stop, and takes
+// the administration endpoints off handlers returned by HTTPHandler, which
+// then answer them with 404, so print clients cannot reach them. addr must
+// differ from the raw print port's address. If the server then fails to
+// start, the control port is closed again.
+func (s *Server) EnableControl(addr, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.control != nil {
+		return errors.New("control port already enabled")
+	}
+	if s.isPrintAddress(addr) {
+		return fmt.Errorf("control address %s is the print port", addr)
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("control port: %w", err)
+	}
+	if token == "" {
+		s.logger.Printf("Control port on %s has no token, anyone who can reach it can reprint and trace", listener.Addr())
+	}
+
+	control := &http.Server{Handler: s.ControlHandler(token), ReadHeaderTimeout: controlReadHeaderTimeout}
+	s.control = control
+	s.controlListener = listener
+	go func() {
+		if err := control.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Printf("Control server error: %v", err)
+		}
+	}()
+	s.logger.Printf("Control endpoints listening on %s", listener.Addr())
+	return nil
+}
+
+// isPrintAddress reports whether addr names the raw print port, as
+// configured or as bound: the same port on an overlapping host. Callers
+// must hold s.mu.
+func (s *Server) isPrintAddress(addr string) bool {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || port == "0" {
+		return false
+	}
+
+	printAddrs := []string{s.address}
+	if s.listener != nil {
+		printAddrs = append(printAddrs, s.listener.Addr().String())
+	}
+	for _, printAddr := range printAddrs {
+		printHost, printPort, err := net.SplitHostPort(printAddr)
+		if err == nil && printPort == port && sameListenHost(host, printHost) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameListenHost reports whether listening on hosts a and b can clash:
+// either listens on all interfaces, or both name the same host, IPs being
+// compared by value so "::1" matches "0:0:0:0:0:0:0:1"
+func sameListenHost(a, b string) bool {
+	ipA, ipB := net.ParseIP(a), net.ParseIP(b)
+	if a == "" || b == "" || (ipA != nil && ipA.IsUnspecified()) || (ipB != nil && ipB.IsUnspecified()) {
+		return true
+	}
+	if ipA != nil && ipB != nil {
+		return ipA.Equal(ipB)
+	}
+	return strings.EqualFold(a, b)
+}
+
+// ControlAddress returns the address the control port listens on, or ""
+// if EnableControl was not called
+func (s *Server) ControlAddress() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.controlListener == nil {
+		return ""
+	}
+	return s.controlListener.Addr().String()
+}
+
+// closeControl shuts the control port down, if enabled
+func (s *Server) closeControl() {
+	s.mu.Lock()
+	control := s.control
+	s.control = nil
+	s.controlListener = nil
+	s.mu.Unlock()
+
+	if control == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), controlShutdownTimeout)
+	defer cancel()
+	if err := control.Shutdown(ctx); err != nil {
+		s.logger.Printf("Error closing control port: %v", err)
+	}
+}
+
+// dropControl closes the control port at once, when the server fails to
+// start. Callers must hold s.mu.
+func (s *Server) dropControl() {
+	if s.control == nil {
+		return
+	}
+	s.control.Close()
+	s.control = nil
+	s.controlListener = nil
+}
+
+// controlEndpoint wraps an administration endpoint of HTTPHandler so it
+// answers 404 once EnableControl moved it to the control port
+func (s *Server) controlEndpoint(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		moved := s.control != nil
+		s.mu.Unlock()
+
+		if moved {
+			http.NotFound(w, r)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// requireToken wraps h to reject requests without the bearer token. An
+// empty token lets every request through.
+func requireToken(token string, h http.HandlerFunc) http.HandlerFunc {
+	if token == "" {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// handleHealth reports whether the printer is open
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if !s.printer().IsOpen() {
+		http.Error(w, "printer offline", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "OK")
+}
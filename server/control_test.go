@@ -0,0 +1,126 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// controlRequest sends a request to h, with the bearer token if set, and
+// returns the status code
+func controlRequest(h http.Handler, method, target, token string) int {
+	req := httptest.NewRequest(method, target, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestControlHandlerMutatingEndpointsRequireToken(t *testing.T) {
+	server := New(&MockAdapter{open: true}, "127.0.0.1:0")
+	handler := server.ControlHandler("secret")
+
+	for _, target := range []string{"/reprint", "/debug/trace?addr=10.0.0.5"} {
+		assert.Equal(t, http.StatusUnauthorized, controlRequest(handler, http.MethodPost, target, ""), target)
+		assert.Equal(t, http.StatusUnauthorized, controlRequest(handler, http.MethodPost, target, "wrong"), target)
+	}
+	// The captured trace is print data, so reading it needs the token too
+	assert.Equal(t, http.StatusUnauthorized, controlRequest(handler, http.MethodGet, "/debug/trace", ""))
+	assert.Equal(t, http.StatusOK, controlRequest(handler, http.MethodGet, "/debug/trace", "secret"))
+	assert.Equal(t, http.StatusNotFound, controlRequest(handler, http.MethodPost, "/reprint", "secret"), "no job to reprint")
+	assert.Equal(t, http.StatusNoContent, controlRequest(handler, http.MethodPost, "/debug/trace?addr=10.0.0.5", "secret"))
+
+	req := httptest.NewRequest(http.MethodPost, "/reprint", nil)
+	req.Header.Set("Authorization", "Basic c2VjcmV0")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "Bearer", rec.Header().Get("WWW-Authenticate"))
+}
+
+func TestControlHandlerReadEndpointsOpen(t *testing.T) {
+	server := New(&MockAdapter{open: true}, "127.0.0.1:0")
+	handler := server.ControlHandler("secret")
+
+	for _, target := range []string{"/health", "/status", "/connections", "/metrics"} {
+		assert.Equal(t, http.StatusOK, controlRequest(handler, http.MethodGet, target, ""), target)
+	}
+	// The print endpoints are not on the control port
+	assert.Equal(t, http.StatusNotFound, controlRequest(handler, http.MethodPost, "/print", "secret"))
+}
+
+func TestControlHandlerWithoutToken(t *testing.T) {
+	server := New(&MockAdapter{}, "127.0.0.1:0")
+	handler := server.ControlHandler("")
+
+	assert.Equal(t, http.StatusNotFound, controlRequest(handler, http.MethodPost, "/reprint", ""), "no job to reprint")
+	assert.Equal(t, http.StatusServiceUnavailable, controlRequest(handler, http.MethodGet, "/health", ""), "printer closed")
+}
+
+func TestServerEnableControl(t *testing.T) {
+	server := New(&MockAdapter{}, "127.0.0.1:0")
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	assert.Error(t, server.EnableControl(server.BoundAddress(), "secret"), "the print port")
+	require.NoError(t, server.EnableControl("127.0.0.1:0", "secret"))
+	assert.Error(t, server.EnableControl("127.0.0.1:0", "secret"), "already enabled")
+
+	base := "http://" + server.ControlAddress()
+	resp, err := http.Get(base + "/health")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = http.Post(base+"/reprint", "", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	// The data port's HTTP front-end no longer serves administration
+	data := server.HTTPHandler()
+	assert.Equal(t, http.StatusNotFound, controlRequest(data, http.MethodGet, "/status", ""))
+	assert.Equal(t, http.StatusNotFound, controlRequest(data, http.MethodPost, "/reprint", "secret"))
+
+	require.NoError(t, server.Stop())
+	assert.Empty(t, server.ControlAddress())
+	_, err = http.Get(base + "/health")
+	assert.Error(t, err)
+}
+
+func TestServerIsPrintAddress(t *testing.T) {
+	server := New(&MockAdapter{}, ":9100")
+
+	for _, addr := range []string{":9100", "0.0.0.0:9100", "127.0.0.1:9100", "[::]:9100", "[::1]:9100"} {
+		assert.True(t, server.isPrintAddress(addr), addr)
+	}
+	for _, addr := range []string{":9101", "127.0.0.1:0", "not an address"} {
+		assert.False(t, server.isPrintAddress(addr), addr)
+	}
+
+	server = New(&MockAdapter{}, "[::1]:9100")
+	assert.True(t, server.isPrintAddress("[0:0:0:0:0:0:0:1]:9100"))
+	assert.True(t, server.isPrintAddress("0.0.0.0:9100"))
+	assert.False(t, server.isPrintAddress("127.0.0.1:9100"))
+}
+
+func TestServerStartFailureClosesControl(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer taken.Close()
+
+	server := New(&MockAdapter{}, taken.Addr().String())
+	require.NoError(t, server.EnableControl("127.0.0.1:0", ""))
+	base := "http://" + server.ControlAddress()
+
+	require.Error(t, server.StartAsync())
+	assert.Empty(t, server.ControlAddress())
+	_, err = http.Get(base + "/health")
+	assert.Error(t, err)
+}
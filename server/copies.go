@@ -0,0 +1,115 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// MaxCopies bounds the copies a single job may ask for
+const MaxCopies = 20
+
+// copiesHeader optionally prefixes a buffered TCP job, e.g. "COPIES 3\n"
+const copiesHeader = "COPIES "
+
+// errInvalidCopies is reported for a copies count outside 1 to MaxCopies
+var errInvalidCopies = errors.New("invalid copies")
+
+// checkCopies validates a requested copies count, where zero means one
+func checkCopies(copies int) (int, error) {
+	switch {
+	case copies == 0:
+		return 1, nil
+	case copies < 0 || copies > MaxCopies:
+		return 0, fmt.Errorf("%w: %d out of range 1-%d", errInvalidCopies, copies, MaxCopies)
+	default:
+		return copies, nil
+	}
+}
+
+// requestCopies returns the copies asked for by an HTTP request's copies
+// query parameter, one if it has none
+func requestCopies(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("copies")
+	if value == "" {
+		return 1, nil
+	}
+	copies, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", errInvalidCopies, value)
+	}
+	if copies == 0 {
+		return 0, fmt.Errorf("%w: 0 out of range 1-%d", errInvalidCopies, MaxCopies)
+	}
+	return checkCopies(copies)
+}
+
+// parseCopiesHeader strips a leading "COPIES <n>\n" line from a job. Data
+// without a well-formed header is returned unchanged as one copy; a count
+// above MaxCopies is capped.
+func parseCopiesHeader(data []byte) (int, []byte) {
+	if !bytes.HasPrefix(data, []byte(copiesHeader)) {
+		return 1, data
+	}
+
+	end := bytes.IndexByte(data, '\n')
+	if end < 0 {
+		return 1, data
+	}
+
+	value := bytes.TrimSpace(data[len(copiesHeader):end])
+	copies, err := strconv.Atoi(string(value))
+	if err != nil || copies < 1 {
+		return 1, data
+	}
+
+	return min(copies, MaxCopies), data[end+1:]
+}
+
+// parseJobHeaders strips the optional PRIORITY and COPIES header lines,
+// in either order, from a buffered job
+func parseJobHeaders(data []byte) (priority, copies int, payload []byte) {
+	priority, copies, payload = PriorityNormal, 1, data
+	for {
+		switch {
+		case bytes.HasPrefix(payload, []byte(priorityHeader)):
+			p, rest := parsePriorityHeader(payload)
+			if len(rest) == len(payload) {
+				return priority, copies, payload
+			}
+			priority, payload = p, rest
+		case bytes.HasPrefix(payload, []byte(copiesHeader)):
+			c, rest := parseCopiesHeader(payload)
+			if len(rest) == len(payload) {
+				return priority, copies, payload
+			}
+			copies, payload = c, rest
+		default:
+			return priority, copies, payload
+		}
+	}
+}
+
+// writeCopies writes the copies of a queued job still to print, pausing
+// for the inter-job delay between them and finishing each but the last
+// with the epilogue. It returns the bytes written over all copies; on
+// failure j.copiesDone tells which copy to resume.
+func (s *Server) writeCopies(j *job) (int, error) {
+	for {
+		written, err := s.writeJob(j)
+		total := j.copiesDone*len(j.data) + written
+		if err != nil || written != len(j.data) {
+			return total, err
+		}
+		j.copiesDone++
+		if j.copiesDone >= max(j.copies, 1) {
+			return total, nil
+		}
+
+		s.completeJob(j.data)
+		j.offset = 0
+		s.settle(s.clock.Now())
+	}
+}
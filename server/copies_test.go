@@ -0,0 +1,123 @@
+package server
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerBufferedJobCopies(t *testing.T) {
+	clk := newFakeClock()
+	clocked := &clockedAdapter{clock: clk}
+	delay := 200 * time.Millisecond
+
+	server := New(clocked, "127.0.0.1:0")
+	server.clock = clk
+	server.SetJobBuffering(true)
+	server.SetInterJobDelay(delay)
+
+	results := make(chan JobResult, 1)
+	server.OnJobComplete(func(r JobResult) { results <- r })
+
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	conn, err := net.Dial("tcp", server.BoundAddress())
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("PRIORITY 2\nCOPIES 3\nreceipt"))
+	require.NoError(t, err)
+	conn.Close()
+
+	// Each copy after the first waits for the inter-job delay
+	for range 2 {
+		require.Eventually(t, func() bool { return clk.Waiters() == 1 }, time.Second, 10*time.Millisecond)
+		clk.Advance(delay)
+	}
+
+	select {
+	case r := <-results:
+		assert.NoError(t, r.Err)
+		assert.Equal(t, 21, r.BytesWritten)
+	case <-time.After(time.Second):
+		t.Fatal("job result was not reported")
+	}
+	assert.Equal(t, []byte("receiptreceiptreceipt"), clocked.Data())
+
+	times := clocked.Times()
+	require.Len(t, times, 3)
+	assert.GreaterOrEqual(t, times[1].Sub(times[0]), delay)
+	assert.GreaterOrEqual(t, times[2].Sub(times[1]), delay)
+}
+
+func TestHTTPPrintCopies(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+	server := newStartedServer(t, mockAdapter)
+
+	req := httptest.NewRequest(http.MethodPost, "/print?copies=3", bytes.NewReader([]byte("\x1b@job")))
+	rec := httptest.NewRecorder()
+	server.HTTPHandler().ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"bytes": 15}`, rec.Body.String())
+	assert.Equal(t, []byte("\x1b@job\x1b@job\x1b@job"), mockAdapter.writeData)
+}
+
+func TestHTTPPrintCopiesOutOfRange(t *testing.T) {
+	for _, copies := range []string{"0", "-1", "21", "many"} {
+		mockAdapter := &MockAdapter{}
+		server := New(mockAdapter, "127.0.0.1:0")
+
+		req := httptest.NewRequest(http.MethodPost, "/print?copies="+copies, bytes.NewReader([]byte("job")))
+		rec := httptest.NewRecorder()
+		server.HTTPHandler().ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code, "copies=%s", copies)
+		assert.Empty(t, mockAdapter.writeData)
+	}
+}
+
+func TestHTTPQRCopies(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+	server := newStartedServer(t, mockAdapter)
+
+	req := httptest.NewRequest(http.MethodPost, "/qr", strings.NewReader(`{"data": "hi", "copies": 2}`))
+	rec := httptest.NewRecorder()
+	server.HTTPHandler().ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	half := len(mockAdapter.writeData) / 2
+	assert.Equal(t, mockAdapter.writeData[:half], mockAdapter.writeData[half:])
+}
+
+func TestParseJobHeaders(t *testing.T) {
+	testCases := []struct {
+		name     string
+		data     string
+		priority int
+		copies   int
+		payload  string
+	}{
+		{"NoHeaders", "\x1b@hello", PriorityNormal, 1, "\x1b@hello"},
+		{"Copies", "COPIES 2\nhello", PriorityNormal, 2, "hello"},
+		{"Both", "COPIES 2\nPRIORITY 5\nhello", 5, 2, "hello"},
+		{"Capped", "COPIES 500\nhello", PriorityNormal, MaxCopies, "hello"},
+		{"Malformed", "COPIES two\nhello", PriorityNormal, 1, "COPIES two\nhello"},
+		{"Zero", "COPIES 0\nhello", PriorityNormal, 1, "COPIES 0\nhello"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			priority, copies, payload := parseJobHeaders([]byte(tc.data))
+			assert.Equal(t, tc.priority, priority)
+			assert.Equal(t, tc.copies, copies)
+			assert.Equal(t, []byte(tc.payload), payload)
+		})
+	}
+}
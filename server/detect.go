@@ -0,0 +1,170 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"time"
+)
+
+// detectedProtocol is the protocol a client's opening bytes identify, see
+// SetAutoDetectProtocol
+type detectedProtocol int
+
+const (
+	// detectedRaw is ESC/POS or anything unrecognized, handled with the
+	// server's Protocol
+	detectedRaw detectedProtocol = iota
+	// detectedLengthPrefixed opens with lengthPrefixMagic
+	detectedLengthPrefixed
+	// detectedJSON opens with a JSON object
+	detectedJSON
+	// detectedAuth opens with an "AUTH " line
+	detectedAuth
+	// detectedHealthProbe sent exactly healthProbeRequest
+	detectedHealthProbe
+)
+
+func (p detectedProtocol) String() string {
+	switch p {
+	case detectedLengthPrefixed:
+		return "length-prefixed"
+	case detectedJSON:
+		return "JSON"
+	case detectedAuth:
+		return "AUTH"
+	case detectedHealthProbe:
+		return "health probe"
+	default:
+		return "raw"
+	}
+}
+
+// Opening bytes recognized by protocol auto-detection
+const (
+	lengthPrefixMagic = "LEN1"
+	authPrefix        = "AUTH "
+)
+
+// TCP health probe request and reply, see SetTCPHealthProbe
+const (
+	healthProbeRequest = "PING\n"
+	healthProbeReply   = "PONG\n"
+)
+
+// ErrUnsupportedProtocol is reported for clients that auto-detection
+// identified as speaking a protocol this server does not handle
+var ErrUnsupportedProtocol = errors.New("unsupported protocol")
+
+// SetAutoDetectProtocol makes the server sniff each TCP connection's first
+// bytes to tell its protocol, so different clients can share one port.
+// Connections opening with ESC/POS (ESC or GS) or anything unrecognized
+// are handled with the Protocol set by SetProtocol. Connections opening
+// with the length-prefix magic "LEN1", a JSON object or an "AUTH " line
+// are recognized, but this server has no handler for them: they get
+// "ERR unsupported protocol <name>\n" and are closed instead of having
+// their framing printed.
+func (s *Server) SetAutoDetectProtocol(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.autoDetectProtocol = enabled
+}
+
+// SetTCPHealthProbe makes a connection that sends exactly "PING\n" get
+// "PONG\n" back and be closed, for load balancers that can only check a
+// TCP port. The probe is not printed or reported as a job. Data that
+// merely starts with "PING\n", or that arrives with more bytes after it,
+// is printed as usual.
+func (s *Server) SetTCPHealthProbe(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tcpHealthProbe = enabled
+}
+
+// detectProtocol classifies a connection by its first bytes, looking for
+// the protocols of SetAutoDetectProtocol if protocols is set and for the
+// health probe if healthProbe is set. The second result is false while
+// first is too short to tell, i.e. it is a proper prefix of one of the
+// recognized openings.
+func detectProtocol(first []byte, protocols, healthProbe bool) (detectedProtocol, bool) {
+	if healthProbe {
+		switch {
+		case string(first) == healthProbeRequest:
+			return detectedHealthProbe, true
+		case bytes.HasPrefix([]byte(healthProbeRequest), first):
+			return detectedRaw, false
+		}
+	}
+	if !protocols {
+		return detectedRaw, len(first) > 0
+	}
+
+	switch {
+	case len(first) == 0:
+		return detectedRaw, false
+	case first[0] == 0x1b || first[0] == 0x1d:
+		return detectedRaw, true
+	case first[0] == '{':
+		return detectedJSON, true
+	case bytes.HasPrefix(first, []byte(lengthPrefixMagic)):
+		return detectedLengthPrefixed, true
+	case bytes.HasPrefix(first, []byte(authPrefix)):
+		return detectedAuth, true
+	case bytes.HasPrefix([]byte(lengthPrefixMagic), first), bytes.HasPrefix([]byte(authPrefix), first):
+		return detectedRaw, false
+	default:
+		return detectedRaw, true
+	}
+}
+
+// sniffProtocol reads from conn until its opening bytes identify the
+// protocol, as detectProtocol, the client stops sending or timeout passes.
+// The returned connection replays the bytes read, and a read error, to its
+// reader.
+func sniffProtocol(conn net.Conn, timeout time.Duration, protocols, healthProbe bool) (net.Conn, detectedProtocol) {
+	if timeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(timeout))
+	}
+
+	var first []byte
+	buf := make([]byte, len(lengthPrefixMagic)+len(authPrefix))
+	emptyReads := 0
+	for {
+		n, err := conn.Read(buf)
+		first = append(first, buf[:n]...)
+		if n == 0 && err == nil {
+			emptyReads++
+			if emptyReads >= maxEmptyReads {
+				err = io.ErrNoProgress
+			}
+		}
+		protocol, decided := detectProtocol(first, protocols, healthProbe)
+		if decided || err != nil {
+			return &sniffedConn{Conn: conn, first: first, err: err}, protocol
+		}
+	}
+}
+
+// sniffedConn is a connection whose opening bytes were read to detect its
+// protocol. Read returns them, then the error that ended sniffing if any,
+// before reading on from the connection.
+type sniffedConn struct {
+	net.Conn
+	first []byte
+	err   error
+}
+
+func (c *sniffedConn) Read(p []byte) (int, error) {
+	if len(c.first) > 0 {
+		n := copy(p, c.first)
+		c.first = c.first[n:]
+		return n, nil
+	}
+	if c.err != nil {
+		err := c.err
+		c.err = nil
+		return 0, err
+	}
+	return c.Conn.Read(p)
+}
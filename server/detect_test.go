@@ -0,0 +1,173 @@
+package server
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectProtocol(t *testing.T) {
+	tests := []struct {
+		name     string
+		first    string
+		protocol detectedProtocol
+		decided  bool
+	}{
+		{"ESC", "\x1b@receipt", detectedRaw, true},
+		{"GS", "\x1dV\x00", detectedRaw, true},
+		{"plain text", "hello", detectedRaw, true},
+		{"JSON", `{"data":"x"}`, detectedJSON, true},
+		{"length prefix", "LEN1\x00\x00\x00\x05", detectedLengthPrefixed, true},
+		{"auth", "AUTH secret\n", detectedAuth, true},
+		{"partial auth", "AU", detectedRaw, false},
+		{"partial magic", "LE", detectedRaw, false},
+		{"diverges from auth", "AUX", detectedRaw, true},
+		{"empty", "", detectedRaw, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			protocol, decided := detectProtocol([]byte(tt.first), true, false)
+			assert.Equal(t, tt.protocol, protocol)
+			assert.Equal(t, tt.decided, decided)
+		})
+	}
+}
+
+func TestServerAutoDetectRawPrints(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+	server := New(mockAdapter, "127.0.0.1:0")
+	server.SetAutoDetectProtocol(true)
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	conn := sendJob(t, server.BoundAddress(), "\x1b@receipt")
+	defer conn.Close()
+	waitForDisconnect(t, conn)
+	server.Stop()
+
+	assert.Equal(t, []byte("\x1b@receipt"), mockAdapter.writeData)
+}
+
+func TestServerAutoDetectKeepsSplitOpening(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+	server := New(mockAdapter, "127.0.0.1:0")
+	server.SetAutoDetectProtocol(true)
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	// "AU" could start an AUTH line until the next bytes arrive
+	conn, err := net.Dial("tcp", server.BoundAddress())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("AU"))
+	require.NoError(t, err)
+	time.Sleep(20 * time.Millisecond)
+	_, err = conn.Write([]byte("DIT REPORT"))
+	require.NoError(t, err)
+	require.NoError(t, conn.(*net.TCPConn).CloseWrite())
+	waitForDisconnect(t, conn)
+	server.Stop()
+
+	assert.Equal(t, []byte("AUDIT REPORT"), mockAdapter.writeData)
+}
+
+func TestServerAutoDetectRejectsUnsupported(t *testing.T) {
+	for _, opening := range []string{`{"data":"x"}`, "AUTH secret\n", "LEN1\x00\x00\x00\x01x"} {
+		t.Run(opening, func(t *testing.T) {
+			mockAdapter := &MockAdapter{}
+			server := New(mockAdapter, "127.0.0.1:0")
+			server.SetAutoDetectProtocol(true)
+
+			results := make(chan JobResult, 1)
+			server.OnJobComplete(func(r JobResult) { results <- r })
+
+			require.NoError(t, server.StartAsync())
+			defer server.Stop()
+
+			conn := sendJob(t, server.BoundAddress(), opening)
+			defer conn.Close()
+
+			reply, err := bufio.NewReader(conn).ReadString('\n')
+			require.NoError(t, err)
+			assert.Contains(t, reply, "ERR unsupported protocol")
+
+			select {
+			case r := <-results:
+				assert.ErrorIs(t, r.Err, ErrUnsupportedProtocol)
+			case <-time.After(time.Second):
+				t.Fatal("no job result")
+			}
+			server.Stop()
+			assert.Empty(t, mockAdapter.writeData)
+		})
+	}
+}
+
+func TestServerWithoutAutoDetectPrintsEverything(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+	server := New(mockAdapter, "127.0.0.1:0")
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	conn := sendJob(t, server.BoundAddress(), `{"data":"x"}`)
+	defer conn.Close()
+	waitForDisconnect(t, conn)
+	server.Stop()
+
+	assert.Equal(t, []byte(`{"data":"x"}`), mockAdapter.writeData)
+}
+
+func TestServerTCPHealthProbe(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+	server := New(mockAdapter, "127.0.0.1:0")
+	server.SetTCPHealthProbe(true)
+
+	results := make(chan JobResult, 2)
+	server.OnJobComplete(func(r JobResult) { results <- r })
+
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	// The probe gets its reply without closing its write side
+	conn, err := net.Dial("tcp", server.BoundAddress())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("PING\n"))
+	require.NoError(t, err)
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "PONG\n", reply)
+	waitForDisconnect(t, conn)
+
+	// Data that goes on after "PING\n" is a job
+	job := sendJob(t, server.BoundAddress(), "PING\n\x1b@receipt")
+	defer job.Close()
+	waitForDisconnect(t, job)
+
+	select {
+	case r := <-results:
+		assert.Equal(t, len("PING\n\x1b@receipt"), r.BytesWritten)
+	case <-time.After(time.Second):
+		t.Fatal("no job result")
+	}
+	server.Stop()
+
+	assert.Equal(t, []byte("PING\n\x1b@receipt"), mockAdapter.writeData)
+	assert.Empty(t, results, "the probe was reported as a job")
+}
+
+// waitForDisconnect reads from conn until the server closes it
+func waitForDisconnect(t *testing.T, conn net.Conn) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 64)
+	for {
+		if _, err := conn.Read(buf); err != nil {
+			return
+		}
+	}
+}
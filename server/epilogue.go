@@ -0,0 +1,162 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/nixxel-company-limited/escpos-usb-server/adapter"
+	"github.com/nixxel-company-limited/escpos-usb-server/escpos"
+)
+
+// SetAutoCut makes the server cut the paper after every job, so clients
+// that never send a cut still get separate receipts. A job that already
+// ends with a cut is not cut again.
+func (s *Server) SetAutoCut(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.autoCut = enabled
+}
+
+// CutCommandSource is implemented by adapters that know the cut command of
+// the printer model, such as adapter.USBAdapter
+type CutCommandSource interface {
+	CutCommand() []byte
+}
+
+// SetCutCommand overrides the bytes auto-cut writes after each job, for
+// printers whose model profile is unknown or wrong. Empty restores the cut
+// from the adapter's model profile, or escpos.Cut if it has none.
+func (s *Server) SetCutCommand(cut []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cutCommand = append([]byte(nil), cut...)
+}
+
+// SetJobEpilogue sets bytes written after every job, e.g. a footer or a
+// paper feed. With auto-cut enabled the cut follows the epilogue.
+func (s *Server) SetJobEpilogue(epilogue []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobEpilogue = append([]byte(nil), epilogue...)
+}
+
+// jobTrailer returns the epilogue and cut to write after job to device.
+// The cut is the one set with SetCutCommand, else the device's. It is left
+// out when there is no epilogue and job already ends with a cut.
+func (s *Server) jobTrailer(device adapter.Adapter, job []byte) []byte {
+	s.mu.Lock()
+	trailer := append([]byte(nil), s.jobEpilogue...)
+	autoCut, override := s.autoCut, s.cutCommand
+	s.mu.Unlock()
+
+	if !autoCut {
+		return trailer
+	}
+	cut := cutFor(device, override)
+	if len(trailer) == 0 && endsWithCut(job, cut) {
+		return nil
+	}
+	return append(trailer, cut...)
+}
+
+// endsWithCut reports whether data ends with cut or any other GS V cut
+func endsWithCut(data, cut []byte) bool {
+	if len(cut) > 0 && bytes.HasSuffix(data, cut) {
+		return true
+	}
+	n := len(data)
+	// GS V m for m = 0, 1, 48 and 49
+	if n >= 3 && data[n-3] == escpos.GS && data[n-2] == 'V' {
+		switch data[n-1] {
+		case 0, 1, 48, 49:
+			return true
+		}
+	}
+	// GS V m n for m = 65, 66 and 97-104
+	if n >= 4 && data[n-4] == escpos.GS && data[n-3] == 'V' {
+		m := data[n-2]
+		return m == 65 || m == 66 || (m >= 97 && m <= 104)
+	}
+	return false
+}
+
+// closingCut returns the cut to end a job the server composes itself, or
+// nil when auto-cut cuts after every job anyway
+func (s *Server) closingCut() []byte {
+	s.mu.Lock()
+	autoCut, override := s.autoCut, s.cutCommand
+	s.mu.Unlock()
+
+	if autoCut {
+		return nil
+	}
+	s.swapMu.RLock()
+	defer s.swapMu.RUnlock()
+	return cutFor(s.printer(), override)
+}
+
+// cutFor returns override if set, else the cut command of device
+func cutFor(device adapter.Adapter, override []byte) []byte {
+	if override != nil {
+		return override
+	}
+	if source, ok := device.(CutCommandSource); ok {
+		return source.CutCommand()
+	}
+	return escpos.Cut()
+}
+
+// finishJob writes the epilogue and auto-cut after job, which was written
+// completely. The adapter is flushed first so the cut cannot overtake job
+// data still buffered in the adapter, and again afterwards so the cut is
+// not held back until the next job.
+func (s *Server) finishJob(job []byte) error {
+	s.swapMu.RLock()
+	defer s.swapMu.RUnlock()
+	device := s.printer()
+
+	trailer := s.jobTrailer(device, job)
+	if len(trailer) == 0 {
+		return nil
+	}
+
+	if err := flushAdapter(device); err != nil {
+		return fmt.Errorf("flush before epilogue failed: %w", err)
+	}
+	if _, err := device.Write(trailer); err != nil {
+		return fmt.Errorf("epilogue write failed: %w", err)
+	}
+	return flushAdapter(device)
+}
+
+// flushJobEnd flushes the adapter at the end of a job's data, so the end
+// of the job is not held back in a coalescing buffer until its timer fires.
+// The buffered bytes are the job's, so a failure to write them is the
+// job's error, wrapped in errWriteFailed, rather than the next client's.
+func (s *Server) flushJobEnd(clientAddr string) error {
+	s.swapMu.RLock()
+	defer s.swapMu.RUnlock()
+	if err := flushAdapter(s.printer()); err != nil {
+		s.logger.Printf("Error flushing job from %s: %v", clientAddr, err)
+		s.abortJob()
+		return fmt.Errorf("%w: flush failed: %w", errWriteFailed, err)
+	}
+	return nil
+}
+
+// flushAdapter flushes adapters that buffer writes
+func flushAdapter(device adapter.Adapter) error {
+	if f, ok := device.(adapter.Flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// completeJob finishes job and logs a failure to do so. The job itself
+// was printed, so its result is not affected. A streamed job too large to
+// keep is passed as nil and so is taken not to end with a cut.
+func (s *Server) completeJob(job []byte) {
+	if err := s.finishJob(job); err != nil {
+		s.logger.Printf("Error finishing job: %v", err)
+	}
+}
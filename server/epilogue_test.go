@@ -0,0 +1,278 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nixxel-company-limited/escpos-usb-server/adapter"
+	"github.com/nixxel-company-limited/escpos-usb-server/escpos"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerNaksJobWhoseFlushFails(t *testing.T) {
+	failing := &failOnceAdapter{}
+	server := New(adapter.NewCoalescingAdapter(failing, time.Hour), "127.0.0.1:0")
+	server.SetProtocol(ProtocolAcked)
+
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	// The job is buffered whole; writing it fails at the job's flush
+	failing.FailNext()
+	conn := sendJob(t, server.BoundAddress(), "receipt")
+	defer conn.Close()
+	assert.True(t, strings.HasPrefix(readReply(t, conn), "NAK 1 "))
+
+	conn2 := sendJob(t, server.BoundAddress(), "second")
+	defer conn2.Close()
+	assert.Equal(t, "ACK 2\n", readReply(t, conn2))
+	assert.Equal(t, []byte("second"), failing.writeData)
+}
+
+func TestServerFlushErrorStaysWithItsJob(t *testing.T) {
+	failing := &failOnceAdapter{}
+	server := New(adapter.NewCoalescingAdapter(failing, time.Hour), "127.0.0.1:0")
+	server.SetReadTimeout(50 * time.Millisecond)
+
+	results := make(chan JobResult, 1)
+	server.OnJobComplete(func(r JobResult) { results <- r })
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	// The first client goes idle mid-job; its buffered bytes fail to write
+	failing.FailNext()
+	conn, err := net.Dial("tcp", server.BoundAddress())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("abandoned"))
+	require.NoError(t, err)
+	assert.Error(t, (<-results).Err)
+
+	printJob(t, server, results, "next")
+	assert.Equal(t, []byte("next"), failing.writeData)
+}
+
+// bufferedAdapter is a MockAdapter that holds writes until Flush, like an
+// adapter coalescing small writes into larger transfers. It records how
+// much had reached the device when the cut was written.
+type bufferedAdapter struct {
+	MockAdapter
+	mu      sync.Mutex
+	pending []byte
+	device  []byte
+	// deviceAtCut is len(device) when a write containing a cut arrived
+	deviceAtCut int
+}
+
+func (a *bufferedAdapter) Write(data []byte) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if bytes.Contains(data, escpos.Cut()) {
+		a.deviceAtCut = len(a.device)
+	}
+	a.pending = append(a.pending, data...)
+	return len(data), nil
+}
+
+func (a *bufferedAdapter) Flush() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.device = append(a.device, a.pending...)
+	a.pending = nil
+	return nil
+}
+
+func (a *bufferedAdapter) Device() []byte {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]byte(nil), a.device...)
+}
+
+func TestServerAutoCutFollowsFlushedJob(t *testing.T) {
+	buffered := &bufferedAdapter{}
+	server := New(buffered, "localhost:0")
+	server.SetAutoCut(true)
+	server.SetJobEpilogue(escpos.Feed(3))
+
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	job := []byte("receipt body\n")
+	require.NoError(t, server.Submit(context.Background(), job))
+
+	want := append(append(append([]byte(nil), job...), escpos.Feed(3)...), escpos.Cut()...)
+	require.Eventually(t, func() bool { return bytes.Equal(buffered.Device(), want) }, time.Second, 10*time.Millisecond)
+
+	// All job data reached the device before the cut was written
+	buffered.mu.Lock()
+	defer buffered.mu.Unlock()
+	assert.Equal(t, len(job), buffered.deviceAtCut)
+}
+
+func TestServerAutoCutStreamedConnection(t *testing.T) {
+	buffered := &bufferedAdapter{}
+
+	server := New(buffered, "127.0.0.1:0")
+	server.SetAutoCut(true)
+
+	results := make(chan JobResult, 1)
+	server.OnJobComplete(func(r JobResult) {
+		results <- r
+	})
+
+	require.NoError(t, server.StartAsync())
+	address := server.BoundAddress()
+	defer server.Stop()
+
+	conn, err := net.Dial("tcp", address)
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("streamed"))
+	require.NoError(t, err)
+	conn.Close()
+
+	select {
+	case r := <-results:
+		assert.Equal(t, 8, r.BytesWritten)
+	case <-time.After(time.Second):
+		t.Fatal("job result was not reported")
+	}
+
+	assert.Equal(t, append([]byte("streamed"), escpos.Cut()...), buffered.Device())
+	buffered.mu.Lock()
+	defer buffered.mu.Unlock()
+	assert.Equal(t, 8, buffered.deviceAtCut)
+}
+
+func TestServerNoTrailerByDefault(t *testing.T) {
+	buffered := &bufferedAdapter{}
+	server := New(buffered, "localhost:0")
+
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	require.NoError(t, server.Submit(context.Background(), []byte("job")))
+	time.Sleep(50 * time.Millisecond)
+
+	// The job is flushed at its end, with nothing after it
+	buffered.mu.Lock()
+	defer buffered.mu.Unlock()
+	assert.Empty(t, buffered.pending)
+	assert.Equal(t, []byte("job"), buffered.device)
+}
+
+func TestServerFlushesCoalescedJobOnClose(t *testing.T) {
+	recording := &recordingAdapter{}
+	server := New(adapter.NewCoalescingAdapter(recording, time.Hour), "127.0.0.1:0")
+
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	conn := sendJob(t, server.BoundAddress(), "receipt")
+	defer conn.Close()
+
+	assert.Eventually(t, func() bool { return recording.Written() == len("receipt") },
+		time.Second, 5*time.Millisecond, "job should not wait for the coalesce window")
+}
+
+func TestServerFlushesCoalescedJobAtTerminator(t *testing.T) {
+	recording := &recordingAdapter{}
+	server := New(adapter.NewCoalescingAdapter(recording, time.Hour), "127.0.0.1:0")
+	server.SetJobTerminator([]byte("\x1dV\x00"))
+
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	conn, err := net.Dial("tcp", server.BoundAddress())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// The terminator is split across two writes
+	_, err = conn.Write([]byte("one\x1d"))
+	require.NoError(t, err)
+	time.Sleep(20 * time.Millisecond)
+	_, err = conn.Write([]byte("V\x00"))
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool { return recording.Written() == len("one\x1dV\x00") },
+		time.Second, 5*time.Millisecond, "job should not wait for the coalesce window")
+}
+
+// profiledAdapter is a bufferedAdapter for a printer model with its own cut
+type profiledAdapter struct {
+	bufferedAdapter
+	cut []byte
+}
+
+func (a *profiledAdapter) CutCommand() []byte {
+	return a.cut
+}
+
+func TestServerAutoCutUsesModelCut(t *testing.T) {
+	for _, model := range []string{"TM-T88V", "TM-U220B"} {
+		t.Run(model, func(t *testing.T) {
+			profile, ok := adapter.LookupProfile(model)
+			require.True(t, ok)
+			require.NotNil(t, profile.CutCommand)
+
+			printer := &profiledAdapter{cut: profile.CutCommand}
+			server := New(printer, "localhost:0")
+			server.SetAutoCut(true)
+			require.NoError(t, server.StartAsync())
+			defer server.Stop()
+
+			require.NoError(t, server.Submit(context.Background(), []byte("job")))
+
+			want := append([]byte("job"), profile.CutCommand...)
+			assert.Eventually(t, func() bool { return bytes.Equal(printer.Device(), want) }, time.Second, 10*time.Millisecond)
+		})
+	}
+}
+
+func TestServerSetCutCommandOverridesModel(t *testing.T) {
+	printer := &profiledAdapter{cut: escpos.PartialCut()}
+	server := New(printer, "localhost:0")
+	server.SetAutoCut(true)
+	server.SetCutCommand(escpos.FeedPartialCut(10))
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	require.NoError(t, server.Submit(context.Background(), []byte("job")))
+
+	want := append([]byte("job"), escpos.FeedPartialCut(10)...)
+	assert.Eventually(t, func() bool { return bytes.Equal(printer.Device(), want) }, time.Second, 10*time.Millisecond)
+}
+
+func TestServerAutoCutSkipsJobEndingWithCut(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		job      []byte
+		epilogue []byte
+		want     []byte
+	}{
+		{"cut", append([]byte("job"), escpos.Cut()...), nil, append([]byte("job"), escpos.Cut()...)},
+		{"other cut", append([]byte("job"), 0x1D, 'V', 1), nil, append([]byte("job"), 0x1D, 'V', 1)},
+		{"epilogue", append([]byte("job"), escpos.Cut()...), []byte("footer"), append(append([]byte("job"), escpos.Cut()...), append([]byte("footer"), escpos.Cut()...)...)},
+		{"no cut", []byte("job V"), nil, append([]byte("job V"), escpos.Cut()...)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			buffered := &bufferedAdapter{}
+			server := New(buffered, "localhost:0")
+			server.SetAutoCut(true)
+			server.SetJobEpilogue(tc.epilogue)
+			require.NoError(t, server.StartAsync())
+			defer server.Stop()
+
+			require.NoError(t, server.Submit(context.Background(), tc.job))
+			assert.Eventually(t, func() bool { return bytes.Equal(buffered.Device(), tc.want) }, time.Second, 10*time.Millisecond)
+			time.Sleep(20 * time.Millisecond)
+			assert.Equal(t, tc.want, buffered.Device())
+		})
+	}
+}
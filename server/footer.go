@@ -0,0 +1,75 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/nixxel-company-limited/escpos-usb-server/escpos"
+)
+
+// footerFeed is how many lines are fed after the footer so it clears the
+// cutter
+const footerFeed = 3
+
+// FooterData is the data a footer template set with SetFooterTemplate is
+// executed with
+type FooterData struct {
+	// Now is when the job was committed
+	Now time.Time
+	// JobID numbers buffered jobs; with the acked protocol it is the ID in
+	// the job's ACK
+	JobID uint64
+	// ClientAddr is the address of the client that sent the job
+	ClientAddr string
+}
+
+// SetFooterTemplate sets a text/template appended to every buffered job,
+// e.g. `Printed {{.Now.Format "2006-01-02 15:04"}} job {{.JobID}}`. See
+// FooterData for the fields. The rendered text is printed as lines, then
+// the paper is fed and cut; with auto-cut the cut is left to the trailer.
+// Streamed jobs get no footer, so this requires job buffering. An empty
+// template removes the footer.
+func (s *Server) SetFooterTemplate(tmpl string) error {
+	var footer *template.Template
+	if tmpl != "" {
+		var err error
+		footer, err = template.New("footer").Parse(tmpl)
+		if err != nil {
+			return fmt.Errorf("invalid footer template: %w", err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.footer = footer
+	return nil
+}
+
+// renderFooter returns the footer to append to a buffered job, or nil if
+// no footer template is set. A template that fails to execute is logged
+// and the job prints without a footer.
+func (s *Server) renderFooter(id uint64, clientAddr string) []byte {
+	s.mu.Lock()
+	tmpl := s.footer
+	s.mu.Unlock()
+
+	if tmpl == nil {
+		return nil
+	}
+
+	var text strings.Builder
+	data := FooterData{Now: s.clock.Now(), JobID: id, ClientAddr: clientAddr}
+	if err := tmpl.Execute(&text, data); err != nil {
+		s.logger.Printf("Error rendering footer for job %d from %s: %v", id, clientAddr, err)
+		return nil
+	}
+
+	footer := []byte(strings.ReplaceAll(text.String(), "\r\n", "\n"))
+	if len(footer) > 0 && footer[len(footer)-1] != escpos.LF {
+		footer = append(footer, escpos.LF)
+	}
+	footer = append(footer, escpos.Feed(footerFeed)...)
+	return append(footer, s.closingCut()...)
+}
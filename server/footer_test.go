@@ -0,0 +1,56 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/nixxel-company-limited/escpos-usb-server/escpos"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerFooterFollowsJob(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+	server := New(mockAdapter, "127.0.0.1:0")
+	server.clock = newFakeClock()
+	server.SetJobBuffering(true)
+	require.NoError(t, server.SetFooterTemplate(`Printed {{.Now.Format "2006-01-02 15:04"}} #{{.JobID}} for {{.ClientAddr}}`))
+
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	conn := sendJob(t, server.BoundAddress(), "receipt\n")
+	defer conn.Close()
+	waitForDisconnect(t, conn)
+	server.Stop()
+
+	want := []byte("receipt\nPrinted 2024-01-01 12:00 #1 for " + conn.LocalAddr().String() + "\n")
+	want = append(want, escpos.Feed(footerFeed)...)
+	want = append(want, escpos.Cut()...)
+	assert.Equal(t, want, mockAdapter.writeData)
+}
+
+func TestServerFooterLeavesCutToAutoCut(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+	server := New(mockAdapter, "127.0.0.1:0")
+	server.SetJobBuffering(true)
+	server.SetAutoCut(true)
+	require.NoError(t, server.SetFooterTemplate("Thank you\n"))
+
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	conn := sendJob(t, server.BoundAddress(), "receipt\n")
+	defer conn.Close()
+	waitForDisconnect(t, conn)
+	server.Stop()
+
+	want := []byte("receipt\nThank you\n")
+	want = append(want, escpos.Feed(footerFeed)...)
+	want = append(want, escpos.Cut()...)
+	assert.Equal(t, want, mockAdapter.writeData)
+}
+
+func TestServerSetFooterTemplateInvalid(t *testing.T) {
+	server := New(&MockAdapter{}, "127.0.0.1:0")
+	assert.Error(t, server.SetFooterTemplate("{{.Now"))
+}
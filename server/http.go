@@ -0,0 +1,404 @@
+package server
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/nixxel-company-limited/escpos-usb-server/escpos"
+)
+
+// defaultMaxDecompressedBytes caps a decoded HTTP print body (zip bomb guard)
+const defaultMaxDecompressedBytes = 32 << 20
+
+// httpChunkSize is how much of a streamed HTTP print body is read before
+// it is written to the adapter
+const httpChunkSize = 32 << 10
+
+var (
+	errUnsupportedEncoding = errors.New("unsupported content encoding")
+	errBodyTooLarge        = errors.New("request body too large")
+	errWriteFailed         = errors.New("write failed")
+)
+
+// HTTPHandler returns an HTTP front-end that forwards print jobs to the adapter.
+//
+// Endpoints:
+//   - POST /print       the job in the request body: raw ESC/POS, or by
+//     Content-Type text/plain (UTF-8, printed and cut) or image/png and
+//     image/jpeg (rasterized); ?copies=n prints it n times
+//   - POST /print-file  multipart upload with the job in the "file" field
+//   - POST /print-and-status  like /print, then reports the printer status
+//   - POST /qr          JSON {"data", "size", "ecc", "feed", "cut", "copies"}
+//   - POST /barcode     JSON {"data", "symbology", "height", "width", "feed", "cut", "copies"}
+//   - POST /reprint     prints the last job again
+//   - GET  /status      server state and the cached paper status
+//   - GET  /connections active and recently closed client connections
+//   - GET  /ws          WebSocket; each binary message is a print job
+//   - GET  /debug/usb   the printer's USB descriptors, for bug reports
+//   - POST /debug/trace?addr=  capture one client's data (stop=1 stops)
+//   - GET  /debug/trace the captured data as hex dumps
+//   - GET  /metrics     queue depth and time-in-queue, Prometheus text format
+//
+// Once EnableControl is called, /reprint, /status, /connections, /debug/*
+// and /metrics are only served on the control port.
+//
+// The raw print endpoints honor Content-Encoding: gzip and deflate, and
+// stream the body to the printer as it arrives rather than buffering it.
+func (s *Server) HTTPHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /print", s.handlePrint)
+	mux.HandleFunc("POST /print-file", s.handlePrintFile)
+	mux.HandleFunc("POST /print-and-status", s.handlePrintAndStatus)
+	mux.HandleFunc("POST /qr", s.handleQR)
+	mux.HandleFunc("POST /barcode", s.handleBarcode)
+	mux.HandleFunc("POST /reprint", s.controlEndpoint(s.handleReprint))
+	mux.HandleFunc("GET /status", s.controlEndpoint(s.handleStatus))
+	mux.HandleFunc("GET /connections", s.controlEndpoint(s.handleConnections))
+	mux.HandleFunc("GET /ws", s.handleWebSocket)
+	mux.HandleFunc("GET /debug/usb", s.controlEndpoint(s.handleDebugUSB))
+	mux.HandleFunc("POST /debug/trace", s.controlEndpoint(s.handleStartTrace))
+	mux.HandleFunc("GET /debug/trace", s.controlEndpoint(s.handleTrace))
+	mux.HandleFunc("GET /metrics", s.controlEndpoint(s.handleMetrics))
+	return mux
+}
+
+// SetMaxDecompressedBytes limits the size of a decoded HTTP print body.
+// Zero restores the default.
+func (s *Server) SetMaxDecompressedBytes(n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxDecompressedBytes = n
+}
+
+// handlePrint forwards the request body to the printer, converting text
+// and images to ESC/POS first
+func (s *Server) handlePrint(w http.ResponseWriter, r *http.Request) {
+	contentType, err := printContentType(r)
+	if err != nil {
+		s.writeHTTPError(w, err)
+		return
+	}
+	copies, err := requestCopies(r)
+	if err != nil {
+		s.writeHTTPError(w, err)
+		return
+	}
+
+	body, err := s.decodeBody(r)
+	if err != nil {
+		s.writeHTTPError(w, err)
+		return
+	}
+	defer body.Close()
+
+	if contentType != contentTypeESCPOS {
+		data, err := s.convertContent(contentType, body)
+		if err != nil {
+			s.writeHTTPError(w, err)
+			return
+		}
+		s.printHTTP(w, r, data, copies)
+		return
+	}
+
+	// Copies are written from memory; a single copy is streamed
+	if copies > 1 {
+		data, err := s.readBody(body)
+		if err != nil {
+			s.writeHTTPError(w, err)
+			return
+		}
+		s.printHTTP(w, r, data, copies)
+		return
+	}
+
+	written, ok := s.streamHTTP(w, r, body)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"bytes": written})
+}
+
+// handlePrintFile forwards the "file" part of a multipart upload to the printer
+func (s *Server) handlePrintFile(w http.ResponseWriter, r *http.Request) {
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+		http.Error(w, "expected multipart/form-data", http.StatusBadRequest)
+		return
+	}
+
+	body, err := s.decodeBody(r)
+	if err != nil {
+		s.writeHTTPError(w, err)
+		return
+	}
+	defer body.Close()
+
+	mr := multipart.NewReader(body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			http.Error(w, "missing file field", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid multipart body: %v", err), http.StatusBadRequest)
+			return
+		}
+		if part.FormName() != "file" {
+			part.Close()
+			continue
+		}
+
+		written, ok := s.streamHTTP(w, r, part)
+		part.Close()
+		if !ok {
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int{"bytes": written})
+		return
+	}
+}
+
+// printHTTP writes copies of a decoded job to the adapter and reports the
+// result
+func (s *Server) printHTTP(w http.ResponseWriter, r *http.Request, data []byte, copies int) {
+	written, ok := s.writeHTTP(w, r, data, copies)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"bytes": written})
+}
+
+// writeHTTP queues copies of a decoded job as one job, so they print
+// together with the inter-job delay between them, and waits until they are
+// written. On failure it responds with 503 and returns false.
+func (s *Server) writeHTTP(w http.ResponseWriter, r *http.Request, data []byte, copies int) (int, bool) {
+	s.logger.Printf("Received %d bytes over HTTP from %s", len(data), r.RemoteAddr)
+
+	written, err := s.printCopies(withClient(r.Context(), r.RemoteAddr), data, copies)
+	if err != nil {
+		s.logger.Printf("Error printing HTTP job from %s: %v", r.RemoteAddr, err)
+		http.Error(w, fmt.Sprintf("write failed: %v", err), http.StatusServiceUnavailable)
+		return written, false
+	}
+	return written, true
+}
+
+// handlePrintAndStatus forwards the request body to the printer, then
+// queries its status so the client learns in one call whether the job went
+// through and whether the printer needs attention
+func (s *Server) handlePrintAndStatus(w http.ResponseWriter, r *http.Request) {
+	body, err := s.decodeBody(r)
+	if err != nil {
+		s.writeHTTPError(w, err)
+		return
+	}
+	defer body.Close()
+
+	written, ok := s.streamHTTP(w, r, body)
+	if !ok {
+		return
+	}
+
+	response := struct {
+		Bytes  int            `json:"bytes"`
+		Status *PrinterStatus `json:"status"`
+		Note   string         `json:"note,omitempty"`
+	}{Bytes: written}
+
+	status, err := s.queryPrinterStatus()
+	if err != nil {
+		s.logger.Printf("Status unavailable after HTTP print: %v", err)
+		response.Note = fmt.Sprintf("status unavailable: %v", err)
+	} else {
+		response.Status = &status
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// streamHTTP writes a decoded body to the adapter in chunks as it is read,
+// so a large upload is never held in memory whole. The body is queued as
+// one job and holds the printer from its first chunk to its last, so other
+// jobs cannot print in the middle of it. A body over the size cap is cut
+// off before the chunk that exceeds it. On failure it responds with an
+// error status and returns false.
+func (s *Server) streamHTTP(w http.ResponseWriter, r *http.Request, body io.Reader) (int, bool) {
+	var printed jobCopy
+	j, err := s.enqueueStream(withClient(r.Context(), r.RemoteAddr), func(ctx context.Context) (int, error) {
+		return s.streamJob(ctx, body, &printed)
+	})
+	if err != nil {
+		s.logger.Printf("Error queueing HTTP job from %s: %v", r.RemoteAddr, err)
+		s.writeHTTPError(w, fmt.Errorf("%w: %w", errWriteFailed, err))
+		return 0, false
+	}
+
+	// The queue worker reads the body, so wait for it even if the client
+	// goes away
+	outcome := <-j.done
+	if outcome.err != nil {
+		s.writeHTTPError(w, outcome.err)
+		return outcome.written, false
+	}
+
+	s.logger.Printf("Wrote %d byte HTTP job from %s to printer", outcome.written, r.RemoteAddr)
+	s.recordLastJob(printed.data)
+	s.completeJob(printed.data)
+	return outcome.written, true
+}
+
+// streamJob streams body to the adapter as the queue's current job and
+// flushes it. A job cut short after part of it was written, such as by a
+// body over the size cap, is followed by a printer reset (ESC @) so the
+// next job does not start inside one of its commands, and the buffer is
+// cleared before the next job if SetClearBufferBeforeJob is enabled.
+func (s *Server) streamJob(ctx context.Context, body io.Reader, printed *jobCopy) (int, error) {
+	written, err := s.streamToAdapter(ctx, body, printed)
+	if err == nil {
+		return written, s.flushJobEnd(jobClient(ctx))
+	}
+	if written > 0 {
+		s.abortJob()
+		if !errors.Is(err, errWriteFailed) {
+			s.resetAborted(ctx)
+		}
+	}
+	return written, err
+}
+
+// resetAborted resets the printer after a job that was cut short. A reset
+// that fails is left to SetResetOnWriteError.
+func (s *Server) resetAborted(ctx context.Context) {
+	ctx = context.WithoutCancel(ctx)
+	if _, err := s.writeData(ctx, escpos.Init()); err != nil {
+		s.logger.Printf("Error resetting printer after aborted job: %v", err)
+		return
+	}
+	s.flushJobEnd(jobClient(ctx))
+}
+
+// streamToAdapter copies body to the adapter a chunk at a time, returning
+// the number of bytes written. Chunks written are also added to printed.
+// Adapter failures are wrapped in errWriteFailed.
+func (s *Server) streamToAdapter(ctx context.Context, body io.Reader, printed *jobCopy) (int, error) {
+	limit := s.maxBodyBytes()
+	buf := make([]byte, httpChunkSize)
+
+	total := 0
+	for {
+		n, readErr := io.ReadFull(body, buf)
+		if n > 0 {
+			if int64(total+n) > limit {
+				return total, errBodyTooLarge
+			}
+			write := s.writeData
+			if total == 0 {
+				write = s.writeStart
+			}
+			written, err := write(ctx, buf[:n])
+			total += written
+			if err != nil {
+				return total, fmt.Errorf("%w: %w", errWriteFailed, err)
+			}
+			printed.add(buf[:n])
+		}
+
+		switch readErr {
+		case nil:
+		case io.EOF, io.ErrUnexpectedEOF:
+			return total, nil
+		default:
+			return total, readErr
+		}
+	}
+}
+
+// TopologyDescriber is implemented by adapters that can dump their USB
+// descriptors, such as adapter.USBAdapter
+type TopologyDescriber interface {
+	DescribeTopology() string
+}
+
+// handleDebugUSB reports the printer's USB topology as plain text
+func (s *Server) handleDebugUSB(w http.ResponseWriter, r *http.Request) {
+	describer, ok := s.printer().(TopologyDescriber)
+	if !ok {
+		http.Error(w, "adapter is not a USB printer", http.StatusNotImplemented)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.WriteString(w, describer.DescribeTopology())
+}
+
+// decodeBody unwraps the request body according to its Content-Encoding
+func (s *Server) decodeBody(r *http.Request) (io.ReadCloser, error) {
+	switch strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))) {
+	case "", "identity":
+		return r.Body, nil
+	case "gzip", "x-gzip":
+		return gzip.NewReader(r.Body)
+	case "deflate":
+		return zlib.NewReader(r.Body)
+	default:
+		return nil, errUnsupportedEncoding
+	}
+}
+
+// maxBodyBytes is the largest decoded HTTP print body or WebSocket message
+// accepted
+func (s *Server) maxBodyBytes() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.maxDecompressedBytes > 0 {
+		return s.maxDecompressedBytes
+	}
+	return defaultMaxDecompressedBytes
+}
+
+// readBody reads a decoded body whole, up to maxBodyBytes
+func (s *Server) readBody(body io.Reader) ([]byte, error) {
+	limit := s.maxBodyBytes()
+	data, err := io.ReadAll(io.LimitReader(body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, errBodyTooLarge
+	}
+	return data, nil
+}
+
+// writeHTTPError maps body decoding errors to HTTP status codes
+func (s *Server) writeHTTPError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errUnsupportedEncoding), errors.Is(err, errUnsupportedContentType):
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+	case errors.Is(err, errBodyTooLarge), errors.Is(err, errImageTooLarge):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, errWriteFailed):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	case errors.Is(err, errInvalidCopies):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,374 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nixxel-company-limited/escpos-usb-server/adapter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+// newStartedServer returns a running server printing to a, since the
+// HTTP print endpoints queue their jobs
+func newStartedServer(t *testing.T, a adapter.Adapter) *Server {
+	t.Helper()
+	server := New(a, "127.0.0.1:0")
+	require.NoError(t, server.StartAsync())
+	t.Cleanup(func() { server.Stop() })
+	return server
+}
+
+func TestHTTPPrint(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+	server := newStartedServer(t, mockAdapter)
+
+	job := []byte{0x1B, 0x40, 'h', 'i', 0x0A}
+	req := httptest.NewRequest(http.MethodPost, "/print", bytes.NewReader(job))
+	rec := httptest.NewRecorder()
+
+	server.HTTPHandler().ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, job, mockAdapter.writeData)
+}
+
+func TestHTTPPrintGzip(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+	server := newStartedServer(t, mockAdapter)
+
+	job := bytes.Repeat([]byte{0x1D, 0x76, 0x30, 0x00}, 1024)
+	req := httptest.NewRequest(http.MethodPost, "/print", bytes.NewReader(gzipBytes(t, job)))
+	req.Header.Set("Content-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+
+	server.HTTPHandler().ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, job, mockAdapter.writeData)
+}
+
+func TestHTTPPrintDeflate(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+	server := newStartedServer(t, mockAdapter)
+
+	job := []byte("deflated receipt\n")
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	_, err := zw.Write(job)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/print", &buf)
+	req.Header.Set("Content-Encoding", "deflate")
+	rec := httptest.NewRecorder()
+
+	server.HTTPHandler().ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, job, mockAdapter.writeData)
+}
+
+func TestHTTPPrintDecompressedSizeCap(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+	server := newStartedServer(t, mockAdapter)
+	server.SetMaxDecompressedBytes(1024)
+
+	// Compresses to a few bytes but expands past the cap
+	job := make([]byte, 64*1024)
+	req := httptest.NewRequest(http.MethodPost, "/print", bytes.NewReader(gzipBytes(t, job)))
+	req.Header.Set("Content-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+
+	server.HTTPHandler().ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	assert.Empty(t, mockAdapter.writeData)
+}
+
+func TestHTTPPrintInvalidEncoding(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+	server := New(mockAdapter, "localhost:0")
+
+	t.Run("Unsupported", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/print", bytes.NewReader([]byte("data")))
+		req.Header.Set("Content-Encoding", "br")
+		rec := httptest.NewRecorder()
+
+		server.HTTPHandler().ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+	})
+
+	t.Run("CorruptGzip", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/print", bytes.NewReader([]byte("not gzip")))
+		req.Header.Set("Content-Encoding", "gzip")
+		rec := httptest.NewRecorder()
+
+		server.HTTPHandler().ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	assert.Empty(t, mockAdapter.writeData)
+}
+
+func TestHTTPPrintFileGzip(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+	server := newStartedServer(t, mockAdapter)
+
+	job := []byte("uploaded receipt\n")
+	var form bytes.Buffer
+	mw := multipart.NewWriter(&form)
+	fw, err := mw.CreateFormFile("file", "receipt.bin")
+	require.NoError(t, err)
+	_, err = fw.Write(job)
+	require.NoError(t, err)
+	require.NoError(t, mw.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/print-file", bytes.NewReader(gzipBytes(t, form.Bytes())))
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("Content-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+
+	server.HTTPHandler().ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, job, mockAdapter.writeData)
+}
+
+// cannedStatusAdapter is a MockAdapter answering status requests from a table
+type cannedStatusAdapter struct {
+	MockAdapter
+	responses map[byte]byte
+	err       error
+}
+
+func (a *cannedStatusAdapter) QueryStatus(n byte) (byte, error) {
+	if a.err != nil {
+		return 0, a.err
+	}
+	return a.responses[n], nil
+}
+
+func TestHTTPPrintAndStatus(t *testing.T) {
+	statusAdapter := &cannedStatusAdapter{
+		responses: map[byte]byte{
+			adapter.StatusPrinter: 0x12,
+			adapter.StatusOffline: 0x16, // cover open
+			adapter.StatusPaper:   0x1E, // near end
+		},
+	}
+	server := newStartedServer(t, statusAdapter)
+
+	req := httptest.NewRequest(http.MethodPost, "/print-and-status", strings.NewReader("receipt\n"))
+	rec := httptest.NewRecorder()
+
+	server.HTTPHandler().ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, []byte("receipt\n"), statusAdapter.writeData)
+	assert.JSONEq(t, `{
+		"bytes": 8,
+		"status": {
+			"offline": false,
+			"drawer_open": false,
+			"cover_open": true,
+			"paper_feeding": false,
+			"error": false,
+			"paper_near_end": true,
+			"paper_end": false
+		}
+	}`, rec.Body.String())
+}
+
+func TestHTTPPrintAndStatusNoInEndpoint(t *testing.T) {
+	statusAdapter := &cannedStatusAdapter{err: adapter.ErrNoInEndpoint}
+	server := newStartedServer(t, statusAdapter)
+
+	req := httptest.NewRequest(http.MethodPost, "/print-and-status", strings.NewReader("receipt\n"))
+	rec := httptest.NewRecorder()
+
+	server.HTTPHandler().ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, []byte("receipt\n"), statusAdapter.writeData)
+	assert.JSONEq(t, `{"bytes": 8, "status": null, "note": "status unavailable: input endpoint not available"}`, rec.Body.String())
+}
+
+func TestHTTPPrintAndStatusWriteFailure(t *testing.T) {
+	statusAdapter := &cannedStatusAdapter{MockAdapter: MockAdapter{failAfter: 1, writeData: []byte{0}}}
+	server := New(statusAdapter, "localhost:0")
+
+	req := httptest.NewRequest(http.MethodPost, "/print-and-status", strings.NewReader("receipt\n"))
+	rec := httptest.NewRecorder()
+
+	server.HTTPHandler().ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+}
+
+func TestHTTPPrintCancelledRequest(t *testing.T) {
+	stalling := &stallingAdapter{started: make(chan struct{})}
+	server := newStartedServer(t, stalling)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodPost, "/print", strings.NewReader("job")).WithContext(ctx)
+	rec := httptest.NewRecorder()
+
+	go func() {
+		<-stalling.started
+		cancel()
+	}()
+	server.HTTPHandler().ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Contains(t, rec.Body.String(), context.Canceled.Error())
+}
+
+// recordingAdapter is a MockAdapter that can be inspected while another
+// goroutine writes to it
+type recordingAdapter struct {
+	MockAdapter
+	mu sync.Mutex
+}
+
+func (a *recordingAdapter) Write(data []byte) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.MockAdapter.Write(data)
+}
+
+func (a *recordingAdapter) Written() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.writeData)
+}
+
+func TestHTTPPrintStreamsBody(t *testing.T) {
+	recording := &recordingAdapter{}
+	server := newStartedServer(t, recording)
+
+	body, upload := io.Pipe()
+	req := httptest.NewRequest(http.MethodPost, "/print", body)
+	rec := httptest.NewRecorder()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		server.HTTPHandler().ServeHTTP(rec, req)
+	}()
+
+	// Each chunk reaches the printer while the upload is still going
+	chunk := bytes.Repeat([]byte{'x'}, httpChunkSize)
+	for i := 1; i <= 3; i++ {
+		_, err := upload.Write(chunk)
+		require.NoError(t, err)
+		require.Eventually(t, func() bool { return recording.Written() == i*httpChunkSize }, time.Second, time.Millisecond)
+	}
+	_, err := upload.Write([]byte("tail"))
+	require.NoError(t, err)
+	upload.Close()
+	<-done
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"bytes": 98308}`, rec.Body.String())
+	assert.Equal(t, 3*httpChunkSize+4, recording.Written())
+}
+
+func TestHTTPPrintStreamSizeCap(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+	server := newStartedServer(t, mockAdapter)
+	server.SetMaxDecompressedBytes(httpChunkSize + 100)
+
+	job := make([]byte, 3*httpChunkSize)
+	req := httptest.NewRequest(http.MethodPost, "/print", bytes.NewReader(job))
+	rec := httptest.NewRecorder()
+
+	server.HTTPHandler().ServeHTTP(rec, req)
+
+	// Streaming stops before the chunk that crosses the cap, and the
+	// printer is reset after the partial job
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	assert.Equal(t, append(make([]byte, httpChunkSize), 0x1B, 0x40), mockAdapter.writeData)
+}
+
+func TestHTTPPrintStreamHoldsQueue(t *testing.T) {
+	recording := &recordingAdapter{}
+	server := newStartedServer(t, recording)
+
+	body, upload := io.Pipe()
+	req := httptest.NewRequest(http.MethodPost, "/print", body)
+	rec := httptest.NewRecorder()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		server.HTTPHandler().ServeHTTP(rec, req)
+	}()
+
+	_, err := upload.Write(bytes.Repeat([]byte{'a'}, httpChunkSize))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return recording.Written() == httpChunkSize }, time.Second, time.Millisecond)
+
+	// A job submitted mid-stream waits for the stream to end
+	queued := make(chan error, 1)
+	go func() {
+		_, err := server.PrintSync(context.Background(), []byte("other"))
+		queued <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, httpChunkSize, recording.Written())
+
+	_, err = upload.Write([]byte("tail"))
+	require.NoError(t, err)
+	upload.Close()
+	<-done
+	require.NoError(t, <-queued)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	recording.mu.Lock()
+	defer recording.mu.Unlock()
+	assert.Equal(t, "tailother", string(recording.writeData[httpChunkSize:]))
+}
+
+// topologyAdapter is a MockAdapter that describes a USB topology
+type topologyAdapter struct {
+	MockAdapter
+}
+
+func (a *topologyAdapter) DescribeTopology() string {
+	return "Device 04b8:0202 on bus 001 address 004\n"
+}
+
+func TestHTTPDebugUSB(t *testing.T) {
+	server := New(&topologyAdapter{}, "localhost:0")
+
+	rec := httptest.NewRecorder()
+	server.HTTPHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/usb", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "Device 04b8:0202 on bus 001 address 004\n", rec.Body.String())
+
+	server = New(&MockAdapter{}, "localhost:0")
+	rec = httptest.NewRecorder()
+	server.HTTPHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/usb", nil))
+	assert.Equal(t, http.StatusNotImplemented, rec.Code)
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+)
+
+// Retry of a listen that failed because the address was still in use
+const (
+	addrInUseAttempts = 5
+	addrInUseDelay    = 200 * time.Millisecond
+)
+
+// ErrAddressInUse is returned by Start and StartAsync when another socket
+// is already listening on the server address
+var ErrAddressInUse = errors.New("address already in use")
+
+// SetReuseAddr retries a listen that fails with "address already in use"
+// a few times, covering restart races where the previous process has not
+// closed its listener yet. It also sets SO_REUSEADDR on Unix, which Go
+// already does for listeners there; that only allows binding while old
+// connections linger in TIME_WAIT, not while another socket listens, so
+// the retries are what cover the race. Takes effect on the next Start.
+func (s *Server) SetReuseAddr(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reuseAddr = enabled
+}
+
+// ListenConfig tunes the listening socket for high connection rates, see
+// SetListenConfig. Both options are only supported on Linux.
+type ListenConfig struct {
+	// ReusePort sets SO_REUSEPORT, so several server processes can listen
+	// on the same port and the kernel spreads connections among them
+	ReusePort bool
+	// Backlog is the length of the queue of connections waiting to be
+	// accepted; zero keeps the system default (net.core.somaxconn), which
+	// also caps larger values
+	Backlog int
+}
+
+// SetListenConfig tunes the listening socket, e.g. a longer accept backlog
+// for bursts of short POS connections, or SO_REUSEPORT to run several
+// processes behind one port. On platforms other than Linux a non-zero
+// config makes Start fail. Takes effect on the next Start.
+func (s *Server) SetListenConfig(cfg ListenConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listenConfig = cfg
+}
+
+// listenTCP listens on s.address, retrying while the address is in use
+// if reuseAddr is set. Callers must hold s.mu, which is released while
+// waiting to retry.
+func (s *Server) listenTCP() (net.Listener, error) {
+	lc := net.ListenConfig{}
+	attempts := 1
+	var controls []func(network, address string, c syscall.RawConn) error
+	if s.reuseAddr {
+		controls = append(controls, reuseAddrControl)
+		attempts = addrInUseAttempts
+	}
+	if s.listenConfig.ReusePort {
+		controls = append(controls, reusePortControl)
+	}
+	lc.Control = func(network, address string, c syscall.RawConn) error {
+		for _, control := range controls {
+			if err := control(network, address, c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for attempt := 1; ; attempt++ {
+		listener, err := lc.Listen(context.Background(), "tcp", s.address)
+		if err == nil && s.listenConfig.Backlog > 0 {
+			if err = setListenBacklog(listener, s.listenConfig.Backlog); err != nil {
+				listener.Close()
+				return nil, err
+			}
+		}
+		if err == nil || !isAddrInUse(err) {
+			return listener, err
+		}
+		if attempt >= attempts {
+			return nil, addrInUseError(s.address, err)
+		}
+		s.logger.Printf("Address %s in use (attempt %d/%d), retrying in %v", s.address, attempt, attempts, addrInUseDelay)
+		s.mu.Unlock()
+		time.Sleep(addrInUseDelay)
+		s.mu.Lock()
+	}
+}
+
+// addrInUseError explains an "address in use" listen failure, naming the process
+// holding the port when it can be found
+func addrInUseError(address string, err error) error {
+	holder := ""
+	if _, port, splitErr := net.SplitHostPort(address); splitErr == nil {
+		if owner := portOwner(port); owner != "" {
+			holder = fmt.Sprintf(" by %s", owner)
+		}
+	}
+	return fmt.Errorf("%w: %s is taken%s; stop the other server or set SERVER_ADDRESS to a free port: %w",
+		ErrAddressInUse, address, holder, err)
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// reusePortControl sets SO_REUSEPORT on a listening socket
+func reusePortControl(network, address string, c syscall.RawConn) error {
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		sockErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+	})
+	if err != nil {
+		return err
+	}
+	if sockErr != nil {
+		return fmt.Errorf("set SO_REUSEPORT: %w", sockErr)
+	}
+	return nil
+}
+
+// setListenBacklog changes the accept backlog of a listening socket by
+// calling listen again, which Linux allows on a socket already listening
+func setListenBacklog(l net.Listener, backlog int) error {
+	tl, ok := l.(*net.TCPListener)
+	if !ok {
+		return fmt.Errorf("cannot set backlog on %T", l)
+	}
+	raw, err := tl.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var listenErr error
+	err = raw.Control(func(fd uintptr) {
+		listenErr = syscall.Listen(int(fd), backlog)
+	})
+	if err != nil {
+		return err
+	}
+	if listenErr != nil {
+		return fmt.Errorf("set listen backlog %d: %w", backlog, listenErr)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerReusePortSharesPort(t *testing.T) {
+	first := New(&MockAdapter{}, "127.0.0.1:0")
+	first.SetListenConfig(ListenConfig{ReusePort: true, Backlog: 512})
+	require.NoError(t, first.StartAsync())
+	defer first.Stop()
+	address := first.BoundAddress()
+
+	second := New(&MockAdapter{}, address)
+	second.SetListenConfig(ListenConfig{ReusePort: true, Backlog: 512})
+	require.NoError(t, second.StartAsync())
+	defer second.Stop()
+
+	// The kernel spreads connections by their source port, so some of a
+	// few dozen land on each server
+	for range 64 {
+		conn, err := net.Dial("tcp", address)
+		require.NoError(t, err)
+		_, err = conn.Write([]byte("x"))
+		require.NoError(t, err)
+		conn.Close()
+	}
+
+	require.Eventually(t, func() bool {
+		return len(first.Connections())+len(second.Connections()) == 64
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.NotEmpty(t, first.Connections())
+	assert.NotEmpty(t, second.Connections())
+}
+
+func TestServerWithoutReusePortCannotSharePort(t *testing.T) {
+	first := New(&MockAdapter{}, "127.0.0.1:0")
+	first.SetListenConfig(ListenConfig{ReusePort: true})
+	require.NoError(t, first.StartAsync())
+	defer first.Stop()
+
+	second := New(&MockAdapter{}, first.BoundAddress())
+	assert.ErrorIs(t, second.StartAsync(), ErrAddressInUse)
+}
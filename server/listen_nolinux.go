@@ -0,0 +1,23 @@
+//go:build !linux
+
+package server
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+// errListenConfigUnsupported is returned by Start for a ListenConfig set
+// on a platform other than Linux
+var errListenConfigUnsupported = errors.New("SO_REUSEPORT and the listen backlog can only be set on Linux")
+
+// reusePortControl is only implemented on Linux
+func reusePortControl(network, address string, c syscall.RawConn) error {
+	return errListenConfigUnsupported
+}
+
+// setListenBacklog is only implemented on Linux
+func setListenBacklog(l net.Listener, backlog int) error {
+	return errListenConfigUnsupported
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package server
+
+import "syscall"
+
+// reuseAddrControl is a no-op where SO_REUSEADDR does not mean "allow
+// rebinding during TIME_WAIT", e.g. on Windows where it allows port theft
+func reuseAddrControl(network, address string, c syscall.RawConn) error {
+	return nil
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerAddressInUse(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer taken.Close()
+	address := taken.Addr().String()
+
+	server := New(&MockAdapter{}, address)
+	err = server.StartAsync()
+
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrAddressInUse)
+	assert.ErrorIs(t, err, syscall.EADDRINUSE)
+	assert.Contains(t, err.Error(), "set SERVER_ADDRESS to a free port")
+	if runtime.GOOS == "linux" {
+		assert.Contains(t, err.Error(), fmt.Sprintf("(pid %d)", os.Getpid()))
+	}
+	assert.False(t, server.IsRunning())
+}
+
+func TestServerReuseAddrRetries(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := taken.Addr().String()
+
+	// The previous owner lets go while the server is retrying
+	go func() {
+		time.Sleep(addrInUseDelay / 2)
+		taken.Close()
+	}()
+
+	server := New(&MockAdapter{}, address)
+	server.SetReuseAddr(true)
+
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+	assert.True(t, server.IsRunning())
+
+	conn, err := net.Dial("tcp", address)
+	require.NoError(t, err)
+	conn.Close()
+}
+
+func TestServerReuseAddrRetriesWithoutLock(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer taken.Close()
+
+	server := New(&MockAdapter{}, taken.Addr().String())
+	server.SetReuseAddr(true)
+
+	started := make(chan error, 1)
+	go func() { started <- server.StartAsync() }()
+
+	// Settings can be read and changed while the listen is retried
+	time.Sleep(addrInUseDelay / 2)
+	unlocked := make(chan struct{})
+	go func() {
+		server.SetAutoCut(true)
+		server.IsRunning()
+		close(unlocked)
+	}()
+	select {
+	case <-unlocked:
+	case <-time.After(addrInUseDelay / 2):
+		t.Fatal("server lock held while retrying the listen")
+	}
+
+	select {
+	case err := <-started:
+		assert.ErrorIs(t, err, ErrAddressInUse)
+	case <-time.After(addrInUseAttempts * addrInUseDelay * 2):
+		t.Fatal("start did not give up")
+	}
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// SetLogRateLimit caps the server log at perSecond lines per second, so a
+// flood of errors, e.g. from a client reconnecting in a loop, cannot fill
+// the disk. Repeats of the previous line are collapsed into a "last
+// message repeated N times" line, and lines over the cap into a
+// "suppressed N log lines" line; both are written with the next line that
+// gets through, or at the latest with the first line of the next second.
+// The limit wraps the output of the server's logger, so other users of a
+// logger passed in Config see it too. Zero removes the limit.
+func (s *Server) SetLogRateLimit(perSecond int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.logLimiter == nil {
+		if perSecond <= 0 {
+			return
+		}
+		// The limiter writes through a logger with the original flags and
+		// prefix, so it compares bare messages rather than timestamps
+		s.logLimiter = &logLimiter{
+			out: log.New(s.logger.Writer(), s.logger.Prefix(), s.logger.Flags()),
+			now: func() time.Time { return s.clock.Now() },
+		}
+		s.logger.SetPrefix("")
+		s.logger.SetFlags(0)
+		s.logger.SetOutput(s.logLimiter)
+	}
+	s.logLimiter.setLimit(perSecond)
+}
+
+// logLimiter is the output of a rate-limited server logger, which gets
+// one Write per log line
+type logLimiter struct {
+	mu        sync.Mutex
+	out       *log.Logger
+	now       func() time.Time
+	perSecond int
+
+	// window is the start of the current second, in which written lines
+	// were written
+	window  time.Time
+	written int
+	// last is the last line written, repeated the number of times it came
+	// again since
+	last     string
+	repeated int
+	// suppressed counts the lines dropped over the limit
+	suppressed int
+}
+
+func (l *logLimiter) setLimit(perSecond int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.perSecond = perSecond
+}
+
+func (l *logLimiter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	line := string(p)
+	if l.perSecond <= 0 {
+		l.flush()
+		l.out.Print(line)
+		return len(p), nil
+	}
+
+	if now := l.now(); now.Sub(l.window) >= time.Second {
+		l.flush()
+		l.window = now
+		l.written = 0
+	}
+
+	if line == l.last {
+		l.repeated++
+		return len(p), nil
+	}
+	if l.written >= l.perSecond {
+		l.suppressed++
+		return len(p), nil
+	}
+
+	l.flush()
+	l.last = line
+	l.written++
+	l.out.Print(line)
+	return len(p), nil
+}
+
+// flush writes the counts of collapsed and suppressed lines. These summary
+// lines do not count against the limit, at most two are written per line
+// that gets through or per second.
+func (l *logLimiter) flush() {
+	if l.repeated > 0 {
+		l.out.Printf("last message repeated %d times", l.repeated)
+		l.repeated = 0
+	}
+	if l.suppressed > 0 {
+		l.out.Printf("suppressed %d log lines over the limit of %d per second", l.suppressed, l.perSecond)
+		l.suppressed = 0
+	}
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogRateLimitCollapsesRepeats(t *testing.T) {
+	var logs bytes.Buffer
+	server := NewWithLogger(&MockAdapter{}, "127.0.0.1:0", log.New(&logs, "[SERVER] ", log.Lmsgprefix))
+	clock := newFakeClock()
+	server.clock = clock
+	server.SetLogRateLimit(5)
+
+	for i := 0; i < 1000; i++ {
+		server.logger.Printf("Error accepting connection: %v", "too many open files")
+	}
+	server.logger.Println("Ready to accept connections")
+
+	assert.Equal(t, []string{
+		"[SERVER] Error accepting connection: too many open files",
+		"[SERVER] last message repeated 999 times",
+		"[SERVER] Ready to accept connections",
+	}, strings.Split(strings.TrimSuffix(logs.String(), "\n"), "\n"))
+}
+
+func TestLogRateLimitCapsLinesPerSecond(t *testing.T) {
+	var logs bytes.Buffer
+	server := NewWithLogger(&MockAdapter{}, "127.0.0.1:0", log.New(&logs, "", 0))
+	clock := newFakeClock()
+	server.clock = clock
+	server.SetLogRateLimit(3)
+
+	for i := 0; i < 100; i++ {
+		server.logger.Printf("Client %d disconnected", i)
+	}
+	assert.Equal(t, "Client 0 disconnected\nClient 1 disconnected\nClient 2 disconnected\n", logs.String())
+
+	// The next second reports what was dropped
+	logs.Reset()
+	clock.Advance(time.Second)
+	server.logger.Println("Client 100 disconnected")
+	assert.Equal(t, "suppressed 97 log lines over the limit of 3 per second\nClient 100 disconnected\n", logs.String())
+}
+
+func TestLogRateLimitRemoved(t *testing.T) {
+	var logs bytes.Buffer
+	server := NewFromConfig(&MockAdapter{}, Config{Logger: log.New(&logs, "", 0), LogRateLimit: 1})
+	server.clock = newFakeClock()
+
+	server.logger.Println("a")
+	server.logger.Println("a")
+	server.SetLogRateLimit(0)
+	server.logger.Println("a")
+	server.logger.Println("a")
+
+	assert.Equal(t, "a\nlast message repeated 1 times\na\na\n", logs.String())
+}
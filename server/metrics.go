@@ -0,0 +1,170 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// queueWaitBuckets are the upper bounds of the time-in-queue histogram
+var queueWaitBuckets = []time.Duration{
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+	30 * time.Second,
+}
+
+// Histogram counts observed durations in buckets
+type Histogram struct {
+	// Bounds are the bucket upper bounds, ascending
+	Bounds []time.Duration
+	// Counts[i] counts observations up to Bounds[i] and above the bound
+	// before it; the extra last entry counts those above every bound
+	Counts []uint64
+	Count  uint64
+	Sum    time.Duration
+}
+
+// observe records one duration
+func (h *Histogram) observe(d time.Duration) {
+	i := 0
+	for i < len(h.Bounds) && d > h.Bounds[i] {
+		i++
+	}
+	h.Counts[i]++
+	h.Count++
+	h.Sum += d
+}
+
+// SlowWriteCounter is implemented by adapters that count writes exceeding
+// a latency threshold, such as adapter.USBAdapter (see its
+// SetSlowWriteThreshold)
+type SlowWriteCounter interface {
+	SlowWrites() uint64
+}
+
+// Metrics is a snapshot of the job queue's metrics
+type Metrics struct {
+	// QueueDepth is the number of jobs waiting to be written, not counting
+	// the one being written
+	QueueDepth int
+	// QueueWait is the time jobs spent queued, from being submitted to
+	// being taken by the queue worker
+	QueueWait Histogram
+	// SlowWrites counts adapter writes over the adapter's slow write
+	// threshold; nil if the adapter does not count them
+	SlowWrites *uint64
+	// EmptyConnections counts TCP connections that ended without sending
+	// any data, e.g. port scans and health checks
+	EmptyConnections uint64
+}
+
+// queueMetrics records the time jobs spend queued and the empty
+// connections. The zero value is ready to use.
+type queueMetrics struct {
+	mu    sync.Mutex
+	wait  *Histogram
+	empty uint64
+}
+
+// observeWait records the time a job spent queued
+func (m *queueMetrics) observeWait(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.wait == nil {
+		m.wait = newQueueWaitHistogram()
+	}
+	m.wait.observe(d)
+}
+
+// countEmptyConnection records a connection that sent no data
+func (m *queueMetrics) countEmptyConnection() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.empty++
+}
+
+// emptyConnections returns the number of connections that sent no data
+func (m *queueMetrics) emptyConnections() uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.empty
+}
+
+// waitHistogram returns a copy of the time-in-queue histogram
+func (m *queueMetrics) waitHistogram() Histogram {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.wait == nil {
+		return *newQueueWaitHistogram()
+	}
+	h := *m.wait
+	h.Bounds = append([]time.Duration(nil), m.wait.Bounds...)
+	h.Counts = append([]uint64(nil), m.wait.Counts...)
+	return h
+}
+
+func newQueueWaitHistogram() *Histogram {
+	return &Histogram{Bounds: queueWaitBuckets, Counts: make([]uint64, len(queueWaitBuckets)+1)}
+}
+
+// Metrics returns the current queue depth, the time-in-queue histogram and
+// the adapter's slow write count, which show whether the printer is keeping
+// up with the jobs sent to it
+func (s *Server) Metrics() Metrics {
+	s.mu.Lock()
+	q := s.queue
+	s.mu.Unlock()
+
+	m := Metrics{
+		QueueWait:        s.metrics.waitHistogram(),
+		EmptyConnections: s.metrics.emptyConnections(),
+	}
+	if q != nil {
+		m.QueueDepth = q.depth()
+	}
+	if counter, ok := s.printer().(SlowWriteCounter); ok {
+		slow := counter.SlowWrites()
+		m.SlowWrites = &slow
+	}
+	return m
+}
+
+// handleMetrics reports the metrics in the Prometheus text format
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	m := s.Metrics()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintln(w, "# HELP escpos_queue_depth Jobs waiting to be written to the printer.")
+	fmt.Fprintln(w, "# TYPE escpos_queue_depth gauge")
+	fmt.Fprintf(w, "escpos_queue_depth %d\n", m.QueueDepth)
+
+	fmt.Fprintln(w, "# HELP escpos_queue_wait_seconds Time jobs spent queued before being written.")
+	fmt.Fprintln(w, "# TYPE escpos_queue_wait_seconds histogram")
+	var cumulative uint64
+	for i, bound := range m.QueueWait.Bounds {
+		cumulative += m.QueueWait.Counts[i]
+		le := strconv.FormatFloat(bound.Seconds(), 'g', -1, 64)
+		fmt.Fprintf(w, "escpos_queue_wait_seconds_bucket{le=%q} %d\n", le, cumulative)
+	}
+	fmt.Fprintf(w, "escpos_queue_wait_seconds_bucket{le=\"+Inf\"} %d\n", m.QueueWait.Count)
+	fmt.Fprintf(w, "escpos_queue_wait_seconds_sum %g\n", m.QueueWait.Sum.Seconds())
+	fmt.Fprintf(w, "escpos_queue_wait_seconds_count %d\n", m.QueueWait.Count)
+
+	fmt.Fprintln(w, "# HELP escpos_empty_connections_total Connections that closed without sending data.")
+	fmt.Fprintln(w, "# TYPE escpos_empty_connections_total counter")
+	fmt.Fprintf(w, "escpos_empty_connections_total %d\n", m.EmptyConnections)
+
+	if m.SlowWrites != nil {
+		fmt.Fprintln(w, "# HELP escpos_slow_writes_total Printer writes slower than the slow write threshold.")
+		fmt.Fprintln(w, "# TYPE escpos_slow_writes_total counter")
+		fmt.Fprintf(w, "escpos_slow_writes_total %d\n", *m.SlowWrites)
+	}
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerMetricsQueueBacklog(t *testing.T) {
+	gated := newGatedAdapter()
+	server := New(gated, "127.0.0.1:0")
+
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	ctx := context.Background()
+
+	// The first job occupies the worker while the rest queue up
+	require.NoError(t, server.Submit(ctx, []byte("first")))
+	require.Eventually(t, func() bool { return server.Metrics().QueueWait.Count == 1 },
+		time.Second, 5*time.Millisecond)
+
+	for _, data := range []string{"second", "third", "fourth"} {
+		require.NoError(t, server.Submit(ctx, []byte(data)))
+	}
+	assert.Equal(t, 3, server.Metrics().QueueDepth)
+
+	time.Sleep(20 * time.Millisecond)
+	gated.Release()
+
+	require.Eventually(t, func() bool { return len(gated.Writes()) == 4 }, time.Second, 5*time.Millisecond)
+	m := server.Metrics()
+	assert.Zero(t, m.QueueDepth)
+	assert.Equal(t, uint64(4), m.QueueWait.Count)
+	assert.GreaterOrEqual(t, m.QueueWait.Sum, 3*20*time.Millisecond, "backlogged jobs waited for the first")
+
+	var total uint64
+	for _, n := range m.QueueWait.Counts {
+		total += n
+	}
+	assert.Equal(t, m.QueueWait.Count, total)
+}
+
+func TestHTTPMetrics(t *testing.T) {
+	server := New(&MockAdapter{}, "127.0.0.1:0")
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	server.metrics.observeWait(30 * time.Millisecond)
+	server.metrics.observeWait(2 * time.Second)
+
+	rec := httptest.NewRecorder()
+	server.HTTPHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	body, err := io.ReadAll(rec.Body)
+	require.NoError(t, err)
+	for _, line := range []string{
+		"escpos_queue_depth 0\n",
+		"escpos_queue_wait_seconds_bucket{le=\"0.01\"} 0\n",
+		"escpos_queue_wait_seconds_bucket{le=\"0.05\"} 1\n",
+		"escpos_queue_wait_seconds_bucket{le=\"1\"} 1\n",
+		"escpos_queue_wait_seconds_bucket{le=\"5\"} 2\n",
+		"escpos_queue_wait_seconds_bucket{le=\"+Inf\"} 2\n",
+		"escpos_queue_wait_seconds_sum 2.03\n",
+		"escpos_queue_wait_seconds_count 2\n",
+	} {
+		assert.Contains(t, string(body), line)
+	}
+}
+
+func TestServerEmptyConnections(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+	var logs syncBuffer
+	server := NewWithLogger(mockAdapter, "127.0.0.1:0", log.New(&logs, "", 0))
+	server.SetLogEmptyConnections(false)
+
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	conn, err := net.Dial("tcp", server.BoundAddress())
+	require.NoError(t, err)
+	empty := conn.LocalAddr().String()
+	conn.Close()
+
+	require.Eventually(t, func() bool { return server.Metrics().EmptyConnections == 1 },
+		time.Second, 5*time.Millisecond)
+	assert.Empty(t, mockAdapter.writeData)
+	assert.NotContains(t, logs.String(), empty)
+
+	// A connection that sends data is still logged, and not counted
+	conn = sendJob(t, server.BoundAddress(), "receipt")
+	sender := conn.LocalAddr().String()
+	waitForDisconnect(t, conn)
+	conn.Close()
+	require.Eventually(t, func() bool { return strings.Contains(logs.String(), "Client disconnected: "+sender) },
+		time.Second, 5*time.Millisecond)
+
+	assert.Contains(t, logs.String(), "Client connected from "+sender)
+	assert.Equal(t, uint64(1), server.Metrics().EmptyConnections)
+
+	rec := httptest.NewRecorder()
+	server.HTTPHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(t, rec.Body.String(), "escpos_empty_connections_total 1\n")
+}
+
+// slowWriteAdapter reports a fixed number of slow writes
+type slowWriteAdapter struct {
+	MockAdapter
+	slow uint64
+}
+
+func (a *slowWriteAdapter) SlowWrites() uint64 { return a.slow }
+
+func TestHTTPMetricsSlowWrites(t *testing.T) {
+	server := New(&slowWriteAdapter{slow: 3}, "127.0.0.1:0")
+
+	rec := httptest.NewRecorder()
+	server.HTTPHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "# TYPE escpos_slow_writes_total counter\nescpos_slow_writes_total 3\n")
+
+	// Adapters that do not count slow writes get no metric
+	rec = httptest.NewRecorder()
+	New(&MockAdapter{}, "127.0.0.1:0").HTTPHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.NotContains(t, rec.Body.String(), "escpos_slow_writes_total")
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/nixxel-company-limited/escpos-usb-server/adapter"
+)
+
+// OfflineResponse is sent to TCP clients turned away because the printer is
+// offline, when enabled with SetOfflineResponse
+const OfflineResponse = "ERR OFFLINE\n"
+
+// offlineWriteTimeout bounds sending OfflineResponse to a client
+const offlineWriteTimeout = time.Second
+
+// ErrPrinterOffline is reported for connections refused because the printer
+// adapter is not open
+var ErrPrinterOffline = errors.New("printer offline")
+
+// SetOfflineResponse makes the server answer TCP clients with
+// OfflineResponse before closing the connection when the printer is
+// offline, either when they connect or when a write fails because the
+// printer went away, so POS software can tell the cashier. Disabled by
+// default to keep the connection a raw passthrough.
+func (s *Server) SetOfflineResponse(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.offlineResponse = enabled
+}
+
+// printerOffline reports whether a write failed because the printer is
+// closed or disconnected
+func (s *Server) printerOffline(err error) bool {
+	return !s.printer().IsOpen() || adapter.IsDisconnect(err)
+}
+
+// sendOffline writes OfflineResponse to a client, ignoring errors since
+// the connection is being closed anyway
+func (s *Server) sendOffline(conn net.Conn) {
+	conn.SetWriteDeadline(time.Now().Add(offlineWriteTimeout))
+	if _, err := conn.Write([]byte(OfflineResponse)); err != nil {
+		s.logger.Printf("Error sending offline response to %s: %v", conn.RemoteAddr(), err)
+	}
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// offlineAdapter is a MockAdapter that can be taken offline, after which it
+// reports closed and fails writes
+type offlineAdapter struct {
+	MockAdapter
+	mu      sync.Mutex
+	offline bool
+}
+
+func (a *offlineAdapter) SetOffline(offline bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.offline = offline
+}
+
+func (a *offlineAdapter) IsOpen() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return !a.offline && a.MockAdapter.IsOpen()
+}
+
+func (a *offlineAdapter) Write(data []byte) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.offline {
+		return 0, errors.New("device not open")
+	}
+	return a.MockAdapter.Write(data)
+}
+
+// readReply reads what the server sends until it closes the connection
+func readReply(t *testing.T, conn net.Conn) string {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	reply, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	return string(reply)
+}
+
+func TestServerOfflineResponseOnConnect(t *testing.T) {
+	offline := &offlineAdapter{}
+	server := New(offline, "127.0.0.1:0")
+	server.SetOfflineResponse(true)
+
+	results := make(chan JobResult, 1)
+	server.OnJobComplete(func(r JobResult) {
+		results <- r
+	})
+
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+	offline.SetOffline(true)
+
+	conn, err := net.Dial("tcp", server.BoundAddress())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	assert.Equal(t, OfflineResponse, readReply(t, conn))
+
+	select {
+	case r := <-results:
+		assert.ErrorIs(t, r.Err, ErrPrinterOffline)
+	case <-time.After(time.Second):
+		t.Fatal("job result was not reported")
+	}
+}
+
+func TestServerOfflineResponseOnWriteFailure(t *testing.T) {
+	offline := &offlineAdapter{}
+	server := New(offline, "127.0.0.1:0")
+	server.SetOfflineResponse(true)
+
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	conn, err := net.Dial("tcp", server.BoundAddress())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("first line\n"))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		offline.mu.Lock()
+		defer offline.mu.Unlock()
+		return len(offline.writeData) > 0
+	}, time.Second, 10*time.Millisecond)
+
+	// The printer goes away mid-job
+	offline.SetOffline(true)
+	_, err = conn.Write([]byte("second line\n"))
+	require.NoError(t, err)
+
+	assert.Equal(t, OfflineResponse, readReply(t, conn))
+}
+
+func TestServerOfflineResponseDisabled(t *testing.T) {
+	offline := &offlineAdapter{}
+	server := New(offline, "127.0.0.1:0")
+
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+	offline.SetOffline(true)
+
+	conn, err := net.Dial("tcp", server.BoundAddress())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("job"))
+	require.NoError(t, err)
+
+	// Raw passthrough: the connection is dropped without a reply
+	assert.Empty(t, readReply(t, conn))
+}
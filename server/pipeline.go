@@ -0,0 +1,47 @@
+package server
+
+import (
+	"fmt"
+)
+
+// Stage transforms the payload of a buffered job, e.g. to normalize line
+// endings, filter commands or re-encode text. It returns the data to
+// print, which may be job itself modified in place; a stage must not keep
+// job after returning. Returning no data drops the job, and an error fails
+// it without printing anything.
+type Stage func(job []byte) ([]byte, error)
+
+// AddStage appends a stage to the pipeline every buffered job passes
+// through before it is queued. Stages run in the order they were added,
+// each on the previous stage's output, after the job's PRIORITY and COPIES
+// headers are stripped and before validation and the footer. Stages see
+// whole jobs, so they only apply with job buffering; streamed connections
+// and HTTP print requests bypass them.
+func (s *Server) AddStage(stage Stage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stages = append(s.stages, stage)
+}
+
+// runStages passes a job through the stages added with AddStage. The job's
+// capacity is capped at its length, so a stage appending to it cannot
+// overwrite data after it in the same buffer, e.g. the connection's next
+// acknowledged job.
+func (s *Server) runStages(job []byte) ([]byte, error) {
+	s.mu.Lock()
+	stages := s.stages
+	s.mu.Unlock()
+
+	job = job[:len(job):len(job)]
+
+	for i, stage := range stages {
+		var err error
+		if job, err = stage(job); err != nil {
+			return nil, fmt.Errorf("job stage %d: %w", i+1, err)
+		}
+		if len(job) == 0 {
+			return nil, nil
+		}
+	}
+	return job, nil
+}
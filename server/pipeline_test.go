@@ -0,0 +1,91 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerStagesApplyInOrder(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+	server := New(mockAdapter, "127.0.0.1:0")
+	server.SetJobBuffering(true)
+	// Normalize line endings, then append a line; the other order would
+	// leave the appended line feed alone
+	server.AddStage(func(job []byte) ([]byte, error) {
+		return bytes.ReplaceAll(job, []byte("\r\n"), []byte("\n")), nil
+	})
+	server.AddStage(func(job []byte) ([]byte, error) {
+		return append(job, "Thank you\r\n"...), nil
+	})
+
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	conn := sendJob(t, server.BoundAddress(), "PRIORITY 1\nreceipt\r\ntotal\r\n")
+	defer conn.Close()
+	waitForDisconnect(t, conn)
+	server.Stop()
+
+	assert.Equal(t, []byte("receipt\ntotal\nThank you\r\n"), mockAdapter.writeData)
+}
+
+func TestServerStageDropsJob(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+	server := New(mockAdapter, "127.0.0.1:0")
+	server.SetJobBuffering(true)
+	server.AddStage(func(job []byte) ([]byte, error) { return nil, nil })
+
+	results := make(chan JobResult, 1)
+	server.OnJobComplete(func(r JobResult) { results <- r })
+
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	conn := sendJob(t, server.BoundAddress(), "test page")
+	defer conn.Close()
+	waitForDisconnect(t, conn)
+
+	result := <-results
+	assert.NoError(t, result.Err)
+	assert.Equal(t, len("test page"), result.BytesDropped)
+	assert.Empty(t, mockAdapter.writeData)
+}
+
+func TestServerStageAppendKeepsNextJob(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+	server := New(mockAdapter, "127.0.0.1:0")
+	server.SetProtocol(ProtocolAcked)
+	server.SetJobTerminator([]byte("|"))
+	server.AddStage(func(job []byte) ([]byte, error) { return append(job, "XX"...), nil })
+
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	// Both jobs arrive in one read, so they share the connection's buffer
+	conn := sendJob(t, server.BoundAddress(), "one|two|")
+	defer conn.Close()
+
+	assert.Equal(t, "ACK 1\nACK 2\n", readReply(t, conn))
+	assert.Equal(t, []byte("one|XXtwo|XX"), mockAdapter.writeData)
+}
+
+func TestServerStageErrorFailsJob(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+	server := New(mockAdapter, "127.0.0.1:0")
+	server.SetJobBuffering(true)
+	server.SetProtocol(ProtocolAcked)
+	errRejected := errors.New("forbidden command")
+	server.AddStage(func(job []byte) ([]byte, error) { return nil, errRejected })
+
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	conn := sendJob(t, server.BoundAddress(), "receipt")
+	defer conn.Close()
+	assert.Equal(t, "NAK 1 job stage 1: forbidden command\n", readReply(t, conn))
+	assert.Empty(t, mockAdapter.writeData)
+}
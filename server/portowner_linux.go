@@ -0,0 +1,76 @@
+//go:build linux
+
+package server
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// tcpListen is the LISTEN state in /proc/net/tcp
+const tcpListen = "0A"
+
+// portOwner returns the name and pid of the process listening on TCP port,
+// or "" when it cannot be found, e.g. because it belongs to another user
+func portOwner(port string) string {
+	inode := listeningInode(port)
+	if inode == "" {
+		return ""
+	}
+	target := "socket:[" + inode + "]"
+
+	procs, err := os.ReadDir("/proc")
+	if err != nil {
+		return ""
+	}
+	for _, proc := range procs {
+		pid, err := strconv.Atoi(proc.Name())
+		if err != nil {
+			continue
+		}
+		fdDir := filepath.Join("/proc", proc.Name(), "fd")
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			if link, err := os.Readlink(filepath.Join(fdDir, fd.Name())); err == nil && link == target {
+				comm, _ := os.ReadFile(filepath.Join("/proc", proc.Name(), "comm"))
+				return fmt.Sprintf("%s (pid %d)", strings.TrimSpace(string(comm)), pid)
+			}
+		}
+	}
+	return ""
+}
+
+// listeningInode returns the socket inode listening on TCP port
+func listeningInode(port string) string {
+	want, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return ""
+	}
+
+	for _, file := range []string{"/proc/net/tcp", "/proc/net/tcp6"} {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		// Fields: sl local_address rem_address st ... inode, addresses as
+		// hex IP:PORT
+		for _, line := range strings.Split(string(data), "\n")[1:] {
+			fields := strings.Fields(line)
+			if len(fields) < 10 || fields[3] != tcpListen {
+				continue
+			}
+			local := fields[1]
+			got, err := strconv.ParseUint(local[strings.LastIndexByte(local, ':')+1:], 16, 16)
+			if err == nil && got == want {
+				return fields[9]
+			}
+		}
+	}
+	return ""
+}
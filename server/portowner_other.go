@@ -0,0 +1,8 @@
+//go:build !linux
+
+package server
+
+// portOwner is only implemented on Linux
+func portOwner(port string) string {
+	return ""
+}
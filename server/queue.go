@@ -0,0 +1,568 @@
+package server
+
+import (
+	"bytes"
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nixxel-company-limited/escpos-usb-server/escpos"
+)
+
+// PriorityNormal is the priority of jobs submitted without one
+const PriorityNormal = 0
+
+// priorityHeader optionally prefixes a buffered TCP job, e.g. "PRIORITY 10\n"
+const priorityHeader = "PRIORITY "
+
+// ErrServerNotRunning is returned when submitting a job to a stopped server
+var ErrServerNotRunning = errors.New("server not running")
+
+// ErrQueueFull is returned when queueing a job would take the queue past
+// its byte limit, see SetMaxQueueBytes
+var ErrQueueFull = errors.New("queue full")
+
+// ErrJobTimeout is returned for a queued job whose write took longer than
+// the per-job write timeout
+var ErrJobTimeout = errors.New("job write timed out")
+
+// job is a unit of work for the queue worker
+type job struct {
+	ctx      context.Context
+	data     []byte
+	priority int
+	seq      uint64
+	// storeID identifies the job in the JobStore, if persisted
+	storeID string
+	// retries counts requeues after the printer disconnected
+	retries int
+	// offset is how much of data was confirmed written before the printer
+	// disconnected, where a resumable job continues
+	offset int
+	// queuedAt is when the job was submitted, for the time-in-queue metric
+	queuedAt time.Time
+	// copies is how many times data is printed, zero meaning once, of
+	// which copiesDone were written
+	copies     int
+	copiesDone int
+	// stream, if set, writes a job whose data the queue never holds, such
+	// as a streamed HTTP body, in place of data
+	stream func(ctx context.Context) (int, error)
+	done   chan jobOutcome
+}
+
+// jobOutcome is the result of writing a job to the adapter
+type jobOutcome struct {
+	written int
+	err     error
+}
+
+// jobHeap orders jobs by descending priority, then submission order
+type jobHeap []*job
+
+func (h jobHeap) Len() int { return len(h) }
+
+func (h jobHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h jobHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *jobHeap) Push(x any) { *h = append(*h, x.(*job)) }
+
+func (h *jobHeap) Pop() any {
+	old := *h
+	n := len(old)
+	j := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return j
+}
+
+// jobQueue is a priority queue of jobs waiting to be written
+type jobQueue struct {
+	mu     sync.Mutex
+	jobs   jobHeap
+	seq    uint64
+	closed bool
+	// bytes is the data held by jobs queued or being written
+	bytes int
+	// ready is signalled whenever a job is pushed or the queue is closed
+	ready chan struct{}
+	// store persists jobs until they are written, if set
+	store JobStore
+}
+
+func newJobQueue(store JobStore) *jobQueue {
+	return &jobQueue{ready: make(chan struct{}, 1), store: store}
+}
+
+// push adds a job, failing if the queue no longer accepts work or, with
+// maxBytes set, if the job would take the bytes held past it
+func (q *jobQueue) push(j *job, maxBytes int) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return ErrServerStopped
+	}
+	if maxBytes > 0 && q.bytes+len(j.data) > maxBytes {
+		return fmt.Errorf("%w: %d byte job, %d of %d bytes in use", ErrQueueFull, len(j.data), q.bytes, maxBytes)
+	}
+
+	q.bytes += len(j.data)
+	q.seq++
+	j.seq = q.seq
+	heap.Push(&q.jobs, j)
+	q.signal()
+	return nil
+}
+
+// requeue puts back a job that was popped, keeping its place ahead of
+// later jobs of the same priority. Unlike push it works on a closed queue,
+// which still drains.
+func (q *jobQueue) requeue(j *job) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	heap.Push(&q.jobs, j)
+	q.signal()
+}
+
+// pop removes the highest priority job. The second result reports whether
+// the worker should keep going (false once closed and drained).
+func (q *jobQueue) pop() (*job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.jobs) == 0 {
+		return nil, !q.closed
+	}
+	return heap.Pop(&q.jobs).(*job), true
+}
+
+// finish releases the bytes of a job that is done with
+func (q *jobQueue) finish(j *job) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.bytes -= len(j.data)
+}
+
+// depth returns the number of jobs waiting to be written
+func (q *jobQueue) depth() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.jobs)
+}
+
+// queuedBytes returns the bytes held by jobs queued or being written
+func (q *jobQueue) queuedBytes() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.bytes
+}
+
+// close stops accepting jobs. Jobs already queued are still written.
+func (q *jobQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.signal()
+}
+
+func (q *jobQueue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// runQueue writes queued jobs to the adapter one at a time until the queue
+// is closed and empty
+func (s *Server) runQueue(q *jobQueue) {
+	defer s.wg.Done()
+
+	var lastJob time.Time
+	for {
+		j, more := q.pop()
+		if j == nil {
+			if !more {
+				return
+			}
+			<-q.ready
+			continue
+		}
+		s.metrics.observeWait(s.clock.Now().Sub(j.queuedAt))
+		s.settle(lastJob)
+		s.runJob(q, j)
+		lastJob = s.clock.Now()
+	}
+}
+
+// SetInterJobDelay makes the queue worker pause for d after a job before
+// writing the next one, so the printer can finish cutting or feeding.
+// Zero (the default) writes jobs back to back.
+func (s *Server) SetInterJobDelay(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.interJobDelay = d
+}
+
+// settle waits until the inter-job delay has passed since lastJob finished
+func (s *Server) settle(lastJob time.Time) {
+	s.mu.Lock()
+	delay := s.interJobDelay
+	s.mu.Unlock()
+
+	if delay <= 0 || lastJob.IsZero() {
+		return
+	}
+	if wait := delay - s.clock.Now().Sub(lastJob); wait > 0 {
+		<-s.clock.After(wait)
+	}
+}
+
+// runJob writes a single job and reports the outcome to its submitter.
+// Jobs that failed to write stay in the store to be replayed, or are
+// requeued if the printer disconnected and comes back.
+func (s *Server) runJob(q *jobQueue, j *job) {
+	if err := j.ctx.Err(); err != nil {
+		s.forgetJob(q.store, j)
+		q.finish(j)
+		j.done <- jobOutcome{err: err}
+		return
+	}
+	if j.stream != nil {
+		s.runStream(q, j)
+		return
+	}
+
+	written, err := s.writeCopies(j)
+	if err != nil {
+		s.logger.Printf("Error writing job to adapter: %v", err)
+		if s.retryAfterDisconnect(q, j, written-j.copiesDone*len(j.data), err) {
+			return
+		}
+	} else {
+		s.logger.Printf("Wrote %d bytes to printer", written)
+		s.forgetJob(q.store, j)
+		if j.copiesDone == max(j.copies, 1) {
+			s.recordLastJob(j.data)
+			s.completeJob(j.data)
+		}
+	}
+	q.finish(j)
+	j.done <- jobOutcome{written: written, err: err}
+}
+
+// runStream writes a streamed job. Its data is not held by the queue, so
+// unlike other jobs it is neither stored nor retried.
+func (s *Server) runStream(q *jobQueue, j *job) {
+	written, err := j.stream(j.ctx)
+	if err != nil {
+		s.logger.Printf("Error streaming job to adapter after %d bytes: %v", written, err)
+	}
+	q.finish(j)
+	j.done <- jobOutcome{written: written, err: err}
+}
+
+// SetPerJobWriteTimeout bounds how long the queue worker spends writing a
+// single job, so a printer stuck on one job does not stall the ones behind
+// it. A job that exceeds d fails with ErrJobTimeout and the worker moves
+// on. Unlike the connection read timeout, this only covers the write.
+// Zero (the default) disables the limit. Requires an adapter implementing
+// adapter.ContextWriter to interrupt a write in progress.
+func (s *Server) SetPerJobWriteTimeout(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobWriteTimeout = d
+}
+
+// JobTimeouts returns how many queued jobs exceeded the per-job write
+// timeout since the server was created
+func (s *Server) JobTimeouts() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.jobTimeouts
+}
+
+// writeJob writes a queued job under the per-job write timeout, if set,
+// and flushes the adapter after it so a failure writing its buffered end
+// fails the job. A resumed job starts at its offset; the bytes before it
+// count as written.
+func (s *Server) writeJob(j *job) (int, error) {
+	s.mu.Lock()
+	timeout := s.jobWriteTimeout
+	s.mu.Unlock()
+
+	data := j.data[j.offset:]
+	write := s.writeData
+	if j.offset == 0 {
+		write = s.writeStart
+	}
+	if timeout <= 0 {
+		written, err := write(j.ctx, data)
+		if err == nil {
+			err = s.flushJobEnd(jobClient(j.ctx))
+		}
+		return j.offset + written, err
+	}
+
+	ctx, cancel := context.WithTimeout(j.ctx, timeout)
+	defer cancel()
+
+	written, err := write(ctx, data)
+	written += j.offset
+	if err != nil && j.ctx.Err() == nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		s.mu.Lock()
+		s.jobTimeouts++
+		s.mu.Unlock()
+		return written, fmt.Errorf("%w after %s (%d of %d bytes written)", ErrJobTimeout, timeout, written, len(j.data))
+	}
+	if err == nil {
+		err = s.flushJobEnd(jobClient(j.ctx))
+	}
+	return written, err
+}
+
+// Submit queues a print job at normal priority
+func (s *Server) Submit(ctx context.Context, data []byte) error {
+	return s.SubmitWithPriority(ctx, data, PriorityNormal)
+}
+
+// SubmitWithPriority queues a print job. Jobs with a higher priority are
+// written first; jobs of equal priority are written in submission order.
+// A job whose context is cancelled before it reaches the printer is skipped.
+func (s *Server) SubmitWithPriority(ctx context.Context, data []byte, priority int) error {
+	_, err := s.enqueue(ctx, data, priority, 1)
+	return err
+}
+
+// PrintSync queues a print job at normal priority and waits until it has
+// been written, returning the number of bytes written. If ctx is cancelled
+// first, PrintSync returns ctx.Err(); a job still waiting in the queue is
+// then skipped, and one being written is aborted if the adapter implements
+// adapter.ContextWriter.
+func (s *Server) PrintSync(ctx context.Context, data []byte) (int, error) {
+	return s.printCopies(ctx, data, 1)
+}
+
+// printCopies queues a job to be printed copies times at normal priority
+// and waits until it has been written, like PrintSync
+func (s *Server) printCopies(ctx context.Context, data []byte, copies int) (int, error) {
+	j, err := s.enqueue(ctx, data, PriorityNormal, copies)
+	if err != nil {
+		return 0, err
+	}
+
+	select {
+	case outcome := <-j.done:
+		return outcome.written, outcome.err
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+// SetMaxQueueBytes caps the job data held by the queue, counting jobs
+// waiting and the one being written, so a few large image jobs cannot
+// exhaust memory. A job that would take the queue past n bytes is turned
+// away with ErrQueueFull; acked clients get a NAK. Zero (the default)
+// leaves the queue unbounded. Jobs replayed from the JobStore on start are
+// always accepted.
+func (s *Server) SetMaxQueueBytes(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxQueueBytes = n
+}
+
+// QueuedBytes returns the job data currently held by the queue
+func (s *Server) QueuedBytes() int {
+	s.mu.Lock()
+	q := s.queue
+	s.mu.Unlock()
+
+	if q == nil {
+		return 0
+	}
+	return q.queuedBytes()
+}
+
+// enqueue adds a job to be printed copies times to the running server's
+// queue
+func (s *Server) enqueue(ctx context.Context, data []byte, priority, copies int) (*job, error) {
+	s.mu.Lock()
+	q := s.queue
+	maxBytes := s.maxQueueBytes
+	s.mu.Unlock()
+
+	if q == nil {
+		return nil, ErrServerNotRunning
+	}
+
+	j := &job{
+		ctx:      ctx,
+		data:     data,
+		priority: priority,
+		queuedAt: s.clock.Now(),
+		copies:   copies,
+		done:     make(chan jobOutcome, 1),
+	}
+	if err := s.persistJob(q.store, j); err != nil {
+		return nil, fmt.Errorf("failed to persist job: %w", err)
+	}
+	if err := q.push(j, maxBytes); err != nil {
+		s.forgetJob(q.store, j)
+		return nil, err
+	}
+	return j, nil
+}
+
+// enqueueStream adds a job written by stream to the running server's queue
+// at normal priority. Its data is not known up front, so it is neither
+// persisted nor counted against the queue's byte limit.
+func (s *Server) enqueueStream(ctx context.Context, stream func(ctx context.Context) (int, error)) (*job, error) {
+	s.mu.Lock()
+	q := s.queue
+	s.mu.Unlock()
+
+	if q == nil {
+		return nil, ErrServerNotRunning
+	}
+
+	j := &job{
+		ctx:      ctx,
+		priority: PriorityNormal,
+		queuedAt: s.clock.Now(),
+		stream:   stream,
+		done:     make(chan jobOutcome, 1),
+	}
+	if err := q.push(j, 0); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// SetJobBuffering makes TCP connections buffer everything the client sends
+// and queue it as one job when the connection ends, instead of streaming it
+// to the printer as it arrives. A buffered job may start with a
+// "PRIORITY <n>\n" header line to set its queue priority and a
+// "COPIES <n>\n" line to print it n times (at most MaxCopies), with the
+// inter-job delay between copies.
+func (s *Server) SetJobBuffering(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobBuffering = enabled
+}
+
+// SetCommitOnlyOnCleanClose makes buffered jobs print only if the client
+// closed the connection cleanly (EOF) or the job ends with the terminator
+// set by SetJobTerminator. Jobs cut short by a reset, a read error or a
+// timeout are discarded instead of printing a truncated receipt. Only
+// applies with job buffering enabled.
+func (s *Server) SetCommitOnlyOnCleanClose(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.commitOnlyOnCleanClose = enabled
+}
+
+// SetJobTerminator sets a byte sequence, e.g. the job's cut command, that
+// marks a buffered job complete even if the connection is not closed
+// cleanly. The terminator is part of the job and is printed.
+func (s *Server) SetJobTerminator(terminator []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobTerminator = append([]byte(nil), terminator...)
+}
+
+// SetValidateJobs makes the server check buffered jobs with escpos.Validate
+// before queueing them and log any issues found. Validation only warns; the
+// job is printed as sent.
+func (s *Server) SetValidateJobs(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.validateJobs = enabled
+}
+
+// commitJob queues a connection's buffered data under the connection's
+// context and waits for it to be written, recording the outcome in result.
+// It returns the job's ID and its own error; empty data is no job and has
+// ID 0.
+func (s *Server) commitJob(ctx context.Context, result *JobResult, data []byte) (uint64, error) {
+	if len(data) == 0 {
+		return 0, nil
+	}
+
+	id := s.newJobID()
+	priority, copies, payload := parseJobHeaders(data)
+
+	received := len(payload)
+	payload, err := s.runStages(payload)
+	if err != nil {
+		s.logger.Printf("Error processing job from %s: %v", result.ClientAddr, err)
+		result.Err = err
+		result.BytesDropped += received
+		return id, err
+	}
+	if len(payload) == 0 {
+		s.logger.Printf("Job from %s dropped by a job stage", result.ClientAddr)
+		result.BytesDropped += received
+		return id, nil
+	}
+
+	s.mu.Lock()
+	validate := s.validateJobs
+	s.mu.Unlock()
+	if validate {
+		for _, issue := range escpos.Validate(payload) {
+			s.logger.Printf("Job from %s: %s", result.ClientAddr, issue)
+		}
+	}
+
+	if footer := s.renderFooter(id, result.ClientAddr); footer != nil {
+		payload = append(append([]byte(nil), payload...), footer...)
+	}
+
+	j, err := s.enqueue(ctx, payload, priority, copies)
+	if err != nil {
+		s.logger.Printf("Error queueing job from %s: %v", result.ClientAddr, err)
+		result.Err = err
+		result.BytesDropped += len(payload) * copies
+		return id, err
+	}
+
+	s.logger.Printf("Queued %d byte job from %s (priority %d, %d copies)", len(payload), result.ClientAddr, priority, copies)
+	outcome := <-j.done
+	result.BytesWritten += outcome.written
+	if outcome.err != nil {
+		result.Err = outcome.err
+		result.BytesDropped += len(payload)*copies - outcome.written
+	}
+	return id, outcome.err
+}
+
+// parsePriorityHeader strips a leading "PRIORITY <n>\n" line from a job.
+// Data without a well-formed header is returned unchanged at normal priority.
+func parsePriorityHeader(data []byte) (int, []byte) {
+	if !bytes.HasPrefix(data, []byte(priorityHeader)) {
+		return PriorityNormal, data
+	}
+
+	end := bytes.IndexByte(data, '\n')
+	if end < 0 {
+		return PriorityNormal, data
+	}
+
+	value := bytes.TrimSpace(data[len(priorityHeader):end])
+	priority, err := strconv.Atoi(string(value))
+	if err != nil {
+		return PriorityNormal, data
+	}
+
+	return priority, data[end+1:]
+}
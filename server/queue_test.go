@@ -0,0 +1,552 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gatedAdapter is a MockAdapter whose writes block until Release is called,
+// recording each write separately
+type gatedAdapter struct {
+	MockAdapter
+	mu     sync.Mutex
+	gate   chan struct{}
+	writes [][]byte
+}
+
+func newGatedAdapter() *gatedAdapter {
+	return &gatedAdapter{gate: make(chan struct{})}
+}
+
+func (a *gatedAdapter) Write(data []byte) (int, error) {
+	<-a.gate
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.writes = append(a.writes, append([]byte(nil), data...))
+	return len(data), nil
+}
+
+func (a *gatedAdapter) Writes() [][]byte {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([][]byte(nil), a.writes...)
+}
+
+func (a *gatedAdapter) Release() {
+	close(a.gate)
+}
+
+func TestServerSubmitWithPriority(t *testing.T) {
+	gated := newGatedAdapter()
+	server := New(gated, "127.0.0.1:0")
+
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	ctx := context.Background()
+
+	// The first job occupies the worker while the rest queue up
+	require.NoError(t, server.Submit(ctx, []byte("long reprint")))
+	time.Sleep(50 * time.Millisecond)
+
+	require.NoError(t, server.SubmitWithPriority(ctx, []byte("receipt 1"), PriorityNormal))
+	require.NoError(t, server.SubmitWithPriority(ctx, []byte("kitchen 1"), 10))
+	require.NoError(t, server.SubmitWithPriority(ctx, []byte("receipt 2"), PriorityNormal))
+	require.NoError(t, server.SubmitWithPriority(ctx, []byte("kitchen 2"), 10))
+	require.NoError(t, server.SubmitWithPriority(ctx, []byte("low"), -5))
+
+	gated.Release()
+
+	require.Eventually(t, func() bool { return len(gated.Writes()) == 6 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, [][]byte{
+		[]byte("long reprint"),
+		[]byte("kitchen 1"),
+		[]byte("kitchen 2"),
+		[]byte("receipt 1"),
+		[]byte("receipt 2"),
+		[]byte("low"),
+	}, gated.Writes())
+}
+
+func TestServerSubmitNotRunning(t *testing.T) {
+	server := New(&MockAdapter{}, "localhost:0")
+
+	err := server.Submit(context.Background(), []byte("job"))
+	assert.ErrorIs(t, err, ErrServerNotRunning)
+}
+
+func TestServerSubmitCancelledJobSkipped(t *testing.T) {
+	gated := newGatedAdapter()
+	server := New(gated, "127.0.0.1:0")
+
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	require.NoError(t, server.Submit(context.Background(), []byte("first")))
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	require.NoError(t, server.Submit(ctx, []byte("cancelled")))
+	require.NoError(t, server.Submit(context.Background(), []byte("last")))
+	cancel()
+
+	gated.Release()
+
+	require.Eventually(t, func() bool { return len(gated.Writes()) == 2 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, [][]byte{[]byte("first"), []byte("last")}, gated.Writes())
+}
+
+func TestServerBufferedTCPPriorityHeader(t *testing.T) {
+	gated := newGatedAdapter()
+
+	server := New(gated, "127.0.0.1:0")
+	server.SetJobBuffering(true)
+
+	require.NoError(t, server.StartAsync())
+	address := server.BoundAddress()
+	defer server.Stop()
+
+	// Occupy the worker so the TCP jobs queue up behind it
+	require.NoError(t, server.Submit(context.Background(), []byte("busy")))
+	time.Sleep(50 * time.Millisecond)
+
+	send := func(data string) {
+		conn, err := net.Dial("tcp", address)
+		require.NoError(t, err)
+		_, err = conn.Write([]byte(data))
+		require.NoError(t, err)
+		conn.Close()
+	}
+
+	send("normal job")
+	time.Sleep(50 * time.Millisecond)
+	send("PRIORITY 5\nurgent job")
+	time.Sleep(50 * time.Millisecond)
+
+	gated.Release()
+
+	require.Eventually(t, func() bool { return len(gated.Writes()) == 3 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, [][]byte{
+		[]byte("busy"),
+		[]byte("urgent job"),
+		[]byte("normal job"),
+	}, gated.Writes())
+}
+
+func TestParsePriorityHeader(t *testing.T) {
+	testCases := []struct {
+		name     string
+		data     string
+		priority int
+		payload  string
+	}{
+		{"NoHeader", "\x1b@hello", PriorityNormal, "\x1b@hello"},
+		{"Header", "PRIORITY 7\n\x1b@hello", 7, "\x1b@hello"},
+		{"Negative", "PRIORITY -2\nlow", -2, "low"},
+		{"Malformed", "PRIORITY high\ndata", PriorityNormal, "PRIORITY high\ndata"},
+		{"Unterminated", "PRIORITY 3", PriorityNormal, "PRIORITY 3"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			priority, payload := parsePriorityHeader([]byte(tc.data))
+			assert.Equal(t, tc.priority, priority)
+			assert.Equal(t, []byte(tc.payload), payload)
+		})
+	}
+}
+
+// clockedAdapter is a MockAdapter recording the clock time of each write
+// along with the data
+type clockedAdapter struct {
+	MockAdapter
+	clock *fakeClock
+	mu    sync.Mutex
+	times []time.Time
+}
+
+func (a *clockedAdapter) Write(data []byte) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.times = append(a.times, a.clock.Now())
+	return a.MockAdapter.Write(data)
+}
+
+func (a *clockedAdapter) Data() []byte {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]byte(nil), a.writeData...)
+}
+
+func (a *clockedAdapter) Times() []time.Time {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]time.Time(nil), a.times...)
+}
+
+func TestServerInterJobDelay(t *testing.T) {
+	clk := newFakeClock()
+	clocked := &clockedAdapter{clock: clk}
+	delay := 500 * time.Millisecond
+
+	server := New(clocked, "127.0.0.1:0")
+	server.clock = clk
+	server.SetInterJobDelay(delay)
+
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	ctx := context.Background()
+	require.NoError(t, server.Submit(ctx, []byte("first")))
+	require.NoError(t, server.Submit(ctx, []byte("second")))
+
+	// The second job waits for the delay after the first
+	require.Eventually(t, func() bool { return clk.Waiters() == 1 }, time.Second, 10*time.Millisecond)
+	assert.Len(t, clocked.Times(), 1)
+
+	clk.Advance(delay - time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	assert.Len(t, clocked.Times(), 1)
+
+	clk.Advance(time.Millisecond)
+	require.Eventually(t, func() bool { return len(clocked.Times()) == 2 }, time.Second, 10*time.Millisecond)
+
+	times := clocked.Times()
+	assert.GreaterOrEqual(t, times[1].Sub(times[0]), delay)
+}
+
+// sendAndReset writes data, waits for the server to read it, then closes the
+// connection with a TCP reset instead of a clean FIN
+func sendAndReset(t *testing.T, address string, data []byte) {
+	conn, err := net.Dial("tcp", address)
+	require.NoError(t, err)
+	_, err = conn.Write(data)
+	require.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+
+	require.NoError(t, conn.(*net.TCPConn).SetLinger(0))
+	conn.Close()
+}
+
+func TestServerCommitOnlyOnCleanClose(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+
+	server := New(mockAdapter, "127.0.0.1:0")
+	server.SetJobBuffering(true)
+	server.SetCommitOnlyOnCleanClose(true)
+
+	results := make(chan JobResult, 1)
+	server.OnJobComplete(func(r JobResult) {
+		results <- r
+	})
+
+	require.NoError(t, server.StartAsync())
+	address := server.BoundAddress()
+	defer server.Stop()
+
+	sendAndReset(t, address, []byte("half a rece"))
+
+	select {
+	case r := <-results:
+		assert.Error(t, r.Err)
+		assert.Equal(t, 11, r.BytesDropped)
+		assert.Zero(t, r.BytesWritten)
+		assert.True(t, r.Partial)
+	case <-time.After(time.Second):
+		t.Fatal("job result was not reported")
+	}
+	assert.Empty(t, mockAdapter.writeData)
+
+	// A clean close still commits the job
+	conn, err := net.Dial("tcp", address)
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("full receipt"))
+	require.NoError(t, err)
+	conn.Close()
+
+	select {
+	case r := <-results:
+		assert.NoError(t, r.Err)
+		assert.Equal(t, 12, r.BytesWritten)
+	case <-time.After(time.Second):
+		t.Fatal("job result was not reported")
+	}
+	assert.Equal(t, []byte("full receipt"), mockAdapter.writeData)
+}
+
+func TestServerCommitOnTerminatorAfterReset(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+	cut := []byte{0x1D, 0x56, 0x41, 0x00}
+
+	server := New(mockAdapter, "127.0.0.1:0")
+	server.SetJobBuffering(true)
+	server.SetCommitOnlyOnCleanClose(true)
+	server.SetJobTerminator(cut)
+
+	results := make(chan JobResult, 1)
+	server.OnJobComplete(func(r JobResult) {
+		results <- r
+	})
+
+	require.NoError(t, server.StartAsync())
+	address := server.BoundAddress()
+	defer server.Stop()
+
+	job := append([]byte("receipt"), cut...)
+	sendAndReset(t, address, job)
+
+	select {
+	case r := <-results:
+		assert.Equal(t, len(job), r.BytesWritten)
+		assert.Zero(t, r.BytesDropped)
+	case <-time.After(time.Second):
+		t.Fatal("job result was not reported")
+	}
+	assert.Equal(t, job, mockAdapter.writeData)
+}
+
+// syncBuffer is a bytes.Buffer safe to read while a logger writes to it
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestServerValidateJobs(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+	var logs syncBuffer
+
+	server := New(mockAdapter, "127.0.0.1:0")
+	server.logger = log.New(&logs, "", 0)
+	server.SetJobBuffering(true)
+	server.SetValidateJobs(true)
+
+	results := make(chan JobResult, 1)
+	server.OnJobComplete(func(r JobResult) {
+		results <- r
+	})
+
+	require.NoError(t, server.StartAsync())
+	address := server.BoundAddress()
+	defer server.Stop()
+
+	// No cut at the end: logged, but still printed
+	conn, err := net.Dial("tcp", address)
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("receipt\n"))
+	require.NoError(t, err)
+	conn.Close()
+
+	select {
+	case r := <-results:
+		assert.NoError(t, r.Err)
+		assert.Equal(t, 8, r.BytesWritten)
+	case <-time.After(time.Second):
+		t.Fatal("job result was not reported")
+	}
+	assert.Contains(t, logs.String(), "missing cut")
+}
+
+func TestServerPrintSync(t *testing.T) {
+	gated := newGatedAdapter()
+	server := New(gated, "localhost:0")
+
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	type result struct {
+		n   int
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		n, err := server.PrintSync(context.Background(), []byte("receipt"))
+		done <- result{n, err}
+	}()
+
+	// Blocks while the adapter has not written the job
+	select {
+	case <-done:
+		t.Fatal("PrintSync returned before the job was written")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	gated.Release()
+
+	select {
+	case r := <-done:
+		assert.NoError(t, r.err)
+		assert.Equal(t, 7, r.n)
+	case <-time.After(time.Second):
+		t.Fatal("PrintSync did not return")
+	}
+	assert.Equal(t, [][]byte{[]byte("receipt")}, gated.Writes())
+}
+
+func TestServerPrintSyncCancelled(t *testing.T) {
+	gated := newGatedAdapter()
+	server := New(gated, "localhost:0")
+
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	// Occupy the worker so the synchronous job waits in the queue
+	require.NoError(t, server.Submit(context.Background(), []byte("busy")))
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	n, err := server.PrintSync(ctx, []byte("too late"))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Zero(t, n)
+
+	gated.Release()
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, [][]byte{[]byte("busy")}, gated.Writes())
+}
+
+func TestServerPrintSyncNotRunning(t *testing.T) {
+	server := New(&MockAdapter{}, "localhost:0")
+
+	_, err := server.PrintSync(context.Background(), []byte("job"))
+	assert.ErrorIs(t, err, ErrServerNotRunning)
+}
+
+// hangingAdapter is a MockAdapter whose context-aware writes of hang block
+// until their context is done; other jobs are written normally
+type hangingAdapter struct {
+	MockAdapter
+	hang []byte
+	mu   sync.Mutex
+}
+
+func (a *hangingAdapter) WriteContext(ctx context.Context, data []byte) (int, error) {
+	if bytes.Equal(data, a.hang) {
+		<-ctx.Done()
+		return 0, ctx.Err()
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.MockAdapter.Write(data)
+}
+
+func (a *hangingAdapter) Written() []byte {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]byte(nil), a.writeData...)
+}
+
+func TestServerPerJobWriteTimeout(t *testing.T) {
+	hanging := &hangingAdapter{hang: []byte("stuck")}
+	server := New(hanging, "localhost:0")
+	server.SetPerJobWriteTimeout(50 * time.Millisecond)
+
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	stuck := make(chan error, 1)
+	go func() {
+		_, err := server.PrintSync(context.Background(), []byte("stuck"))
+		stuck <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	// The job behind the stuck one still prints
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	n, err := server.PrintSync(ctx, []byte("next"))
+	require.NoError(t, err)
+	assert.Equal(t, 4, n)
+	assert.Equal(t, []byte("next"), hanging.Written())
+
+	err = <-stuck
+	assert.ErrorIs(t, err, ErrJobTimeout)
+	assert.Equal(t, 1, server.JobTimeouts())
+}
+
+func TestServerPerJobWriteTimeoutCancelledJob(t *testing.T) {
+	hanging := &hangingAdapter{hang: []byte("stuck")}
+	server := New(hanging, "localhost:0")
+	server.SetPerJobWriteTimeout(time.Second)
+
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	// A job cancelled by its submitter is not counted as a timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := server.PrintSync(ctx, []byte("stuck"))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	_, err = server.PrintSync(context.Background(), []byte("next"))
+	require.NoError(t, err)
+	assert.Zero(t, server.JobTimeouts())
+}
+
+func TestServerMaxQueueBytes(t *testing.T) {
+	gated := newGatedAdapter()
+	server := New(gated, "127.0.0.1:0")
+	server.SetMaxQueueBytes(25)
+
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	ctx := context.Background()
+	image := bytes.Repeat([]byte{0xFF}, 10)
+
+	// The job being written still counts against the limit
+	require.NoError(t, server.Submit(ctx, image))
+	require.NoError(t, server.Submit(ctx, image))
+	assert.Equal(t, 20, server.QueuedBytes())
+
+	// Only three jobs, but the bytes would exceed the limit
+	err := server.Submit(ctx, image)
+	assert.ErrorIs(t, err, ErrQueueFull)
+	_, err = server.PrintSync(ctx, image)
+	assert.ErrorIs(t, err, ErrQueueFull)
+
+	// A smaller job still fits
+	require.NoError(t, server.Submit(ctx, []byte("small")))
+	assert.Equal(t, 25, server.QueuedBytes())
+
+	gated.Release()
+	require.Eventually(t, func() bool { return len(gated.Writes()) == 3 }, time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool { return server.QueuedBytes() == 0 }, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, server.Submit(ctx, image))
+}
+
+func TestServerMaxQueueBytesAckedNak(t *testing.T) {
+	server := New(&MockAdapter{}, "127.0.0.1:0")
+	server.SetProtocol(ProtocolAcked)
+	server.SetMaxQueueBytes(4)
+
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	conn := sendJob(t, server.BoundAddress(), "receipt")
+	defer conn.Close()
+
+	assert.Equal(t, "NAK 1 queue full: 7 byte job, 0 of 4 bytes in use\n", readReply(t, conn))
+}
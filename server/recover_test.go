@@ -0,0 +1,114 @@
+package server
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerRecoversConnectionPanic(t *testing.T) {
+	recording := &recordingAdapter{}
+	server := New(recording, "127.0.0.1:0")
+
+	// The first connection's hook panics
+	var conns atomic.Int32
+	server.SetConnContext(func(ctx context.Context, c net.Conn) context.Context {
+		if conns.Add(1) == 1 {
+			panic("buggy hook")
+		}
+		return ctx
+	})
+
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	first, err := net.Dial("tcp", server.BoundAddress())
+	require.NoError(t, err)
+	defer first.Close()
+	_, err = first.Write([]byte("lost"))
+	require.NoError(t, err)
+	// The panicking connection is closed rather than left hanging
+	waitForDisconnect(t, first)
+
+	second, err := net.Dial("tcp", server.BoundAddress())
+	require.NoError(t, err)
+	_, err = second.Write([]byte("printed"))
+	require.NoError(t, err)
+	second.Close()
+
+	require.Eventually(t, func() bool { return recording.Written() == 7 }, time.Second, 10*time.Millisecond)
+	assert.True(t, server.IsRunning())
+}
+
+// panickingListener panics on its first Accept
+type panickingListener struct {
+	net.Listener
+	once sync.Once
+}
+
+func (l *panickingListener) Accept() (net.Conn, error) {
+	l.once.Do(func() { panic("accept bug") })
+	return l.Listener.Accept()
+}
+
+func TestServerRecoversAcceptPanic(t *testing.T) {
+	recording := &recordingAdapter{}
+	server := New(recording, "127.0.0.1:0")
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go server.Serve(&panickingListener{Listener: l})
+	defer server.Stop()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("job"))
+	require.NoError(t, err)
+	conn.Close()
+
+	require.Eventually(t, func() bool { return recording.Written() == 3 }, time.Second, 10*time.Millisecond)
+}
+
+func TestServerReportsConnectionPanic(t *testing.T) {
+	server := New(&recordingAdapter{}, "127.0.0.1:0")
+	server.SetConnContext(func(ctx context.Context, c net.Conn) context.Context {
+		panic("buggy hook")
+	})
+
+	results := make(chan JobResult, 1)
+	server.OnJobComplete(func(r JobResult) { results <- r })
+	disconnects := make(chan ConnEvent, 1)
+	server.OnConnection(func(e ConnEvent) {
+		if e.Phase == ConnDisconnected {
+			disconnects <- e
+		}
+	})
+
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	conn, err := net.Dial("tcp", server.BoundAddress())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// The panic is reported as an error, not as a clean close
+	select {
+	case r := <-results:
+		assert.ErrorIs(t, r.Err, errConnectionPanic)
+	case <-time.After(time.Second):
+		t.Fatal("job not reported")
+	}
+	select {
+	case e := <-disconnects:
+		assert.Equal(t, CloseError, e.Reason)
+		assert.ErrorIs(t, e.Err, errConnectionPanic)
+	case <-time.After(time.Second):
+		t.Fatal("disconnect not reported")
+	}
+}
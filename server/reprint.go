@@ -0,0 +1,87 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// maxReprintBytes bounds the job kept for ReprintLast. Larger jobs, e.g.
+// long image printouts, are not kept.
+const maxReprintBytes = 1 << 20
+
+// ErrNoLastJob is returned by ReprintLast before any job was printed
+var ErrNoLastJob = errors.New("no job to reprint")
+
+// ReprintLast sends the last job that was written completely to the
+// printer again, e.g. after a paper jam. Only that one job is kept, up to
+// 1 MiB; a connection streamed without job buffering counts as one job. The
+// reprint is queued like any other job and waits until it is written.
+func (s *Server) ReprintLast() error {
+	_, err := s.reprintLast()
+	return err
+}
+
+// reprintLast reprints the last job, returning the number of bytes written
+func (s *Server) reprintLast() (int, error) {
+	s.mu.Lock()
+	data := s.lastJob
+	s.mu.Unlock()
+
+	if data == nil {
+		return 0, ErrNoLastJob
+	}
+
+	s.logger.Printf("Reprinting last job (%d bytes)", len(data))
+	return s.PrintSync(context.Background(), data)
+}
+
+// recordLastJob keeps a copy of a job that was written completely for
+// ReprintLast
+func (s *Server) recordLastJob(data []byte) {
+	if len(data) == 0 || len(data) > maxReprintBytes {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastJob = append([]byte(nil), data...)
+}
+
+// jobCopy accumulates a job streamed to the printer in pieces for
+// ReprintLast, giving up once it grows past maxReprintBytes
+type jobCopy struct {
+	data     []byte
+	tooLarge bool
+}
+
+func (c *jobCopy) add(p []byte) {
+	if c.tooLarge {
+		return
+	}
+	if len(c.data)+len(p) > maxReprintBytes {
+		c.data = nil
+		c.tooLarge = true
+		return
+	}
+	c.data = append(c.data, p...)
+}
+
+// handleReprint reprints the last job
+func (s *Server) handleReprint(w http.ResponseWriter, r *http.Request) {
+	written, err := s.reprintLast()
+	switch {
+	case errors.Is(err, ErrNoLastJob):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		s.logger.Printf("Error reprinting last job: %v", err)
+		http.Error(w, fmt.Sprintf("reprint failed: %v", err), http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"bytes": written})
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerReprintLast(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+	server := New(mockAdapter, "127.0.0.1:0")
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	assert.ErrorIs(t, server.ReprintLast(), ErrNoLastJob)
+
+	ctx := context.Background()
+	_, err := server.PrintSync(ctx, []byte("first"))
+	require.NoError(t, err)
+	_, err = server.PrintSync(ctx, []byte("receipt"))
+	require.NoError(t, err)
+
+	require.NoError(t, server.ReprintLast())
+	assert.Equal(t, []byte("firstreceiptreceipt"), mockAdapter.writeData)
+}
+
+func TestServerReprintLastStreamedJob(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+	server := New(mockAdapter, "127.0.0.1:0")
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	conn := sendJob(t, server.BoundAddress(), "\x1b@receipt")
+	defer conn.Close()
+	waitForDisconnect(t, conn)
+
+	require.Eventually(t, func() bool { return server.ReprintLast() == nil }, time.Second, 5*time.Millisecond)
+	server.Stop()
+	assert.Equal(t, []byte("\x1b@receipt\x1b@receipt"), mockAdapter.writeData)
+}
+
+func TestServerReprintSkipsOversizedJob(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+	server := New(mockAdapter, "127.0.0.1:0")
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	ctx := context.Background()
+	_, err := server.PrintSync(ctx, []byte("receipt"))
+	require.NoError(t, err)
+	_, err = server.PrintSync(ctx, bytes.Repeat([]byte("x"), maxReprintBytes+1))
+	require.NoError(t, err)
+
+	// The large job is not kept, nor does it evict the receipt before it
+	mockAdapter.writeData = nil
+	require.NoError(t, server.ReprintLast())
+	assert.Equal(t, []byte("receipt"), mockAdapter.writeData)
+}
+
+func TestHTTPReprint(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+	server := New(mockAdapter, "127.0.0.1:0")
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	rec := httptest.NewRecorder()
+	server.HTTPHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/reprint", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = httptest.NewRecorder()
+	server.HTTPHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/print", bytes.NewReader([]byte("receipt"))))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	server.HTTPHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/reprint", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"bytes": 7}`, rec.Body.String())
+	assert.Equal(t, []byte("receiptreceipt"), mockAdapter.writeData)
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/nixxel-company-limited/escpos-usb-server/adapter"
+	"github.com/nixxel-company-limited/escpos-usb-server/escpos"
+)
+
+// SetResetBetweenClients makes the server initialize the printer (ESC @)
+// before a job from a different client than the previous job, so
+// formatting one client left on, such as bold, alignment or a code page,
+// does not carry over into another client's receipt. Clients are told
+// apart by host, so one client reconnecting per job is not reset; jobs
+// submitted in-process, e.g. with PrintSync, count as one more client.
+func (s *Server) SetResetBetweenClients(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.resetBetweenClients = enabled
+}
+
+// clientKey is the context key of the client a job comes from
+type clientKey struct{}
+
+// withClient records in ctx that the job written under it comes from
+// clientAddr
+func withClient(ctx context.Context, clientAddr string) context.Context {
+	return context.WithValue(ctx, clientKey{}, clientAddr)
+}
+
+// jobClient returns the host of the client recorded in ctx with
+// withClient, or "" for a job submitted in-process
+func jobClient(ctx context.Context) string {
+	addr, _ := ctx.Value(clientKey{}).(string)
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// switchClient records the client of a job about to be written, returning
+// true if the printer should be reset because the previous job came from
+// another client and SetResetBetweenClients is enabled
+func (s *Server) switchClient(ctx context.Context) bool {
+	client := jobClient(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switched := s.lastClientSet && s.lastClient != client
+	s.lastClient, s.lastClientSet = client, true
+	return switched && s.resetBetweenClients
+}
+
+// resetForClient initializes the printer before a job from another client
+func (s *Server) resetForClient(ctx context.Context) error {
+	if !s.switchClient(ctx) {
+		return nil
+	}
+
+	s.swapMu.RLock()
+	defer s.swapMu.RUnlock()
+	if _, err := adapter.WriteContext(ctx, s.printer(), escpos.Init()); err != nil {
+		return fmt.Errorf("printer reset between clients failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/nixxel-company-limited/escpos-usb-server/escpos"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// printJobFrom sends data as one TCP connection from the loopback address
+// ip and waits for its result
+func printJobFrom(t *testing.T, server *Server, results <-chan JobResult, ip, data string) {
+	t.Helper()
+	dialer := net.Dialer{LocalAddr: &net.TCPAddr{IP: net.ParseIP(ip)}}
+	conn, err := dialer.Dial("tcp", server.BoundAddress())
+	require.NoError(t, err)
+	_, err = conn.Write([]byte(data))
+	require.NoError(t, err)
+	conn.Close()
+
+	select {
+	case r := <-results:
+		require.NoError(t, r.Err)
+	case <-time.After(time.Second):
+		t.Fatal("job result was not reported")
+	}
+}
+
+func TestServerResetBetweenClients(t *testing.T) {
+	for _, buffering := range []bool{false, true} {
+		mockAdapter := &MockAdapter{}
+		server := New(mockAdapter, "127.0.0.1:0")
+		server.SetJobBuffering(buffering)
+		server.SetResetBetweenClients(true)
+
+		results := make(chan JobResult, 1)
+		server.OnJobComplete(func(r JobResult) { results <- r })
+		require.NoError(t, server.StartAsync())
+
+		printJobFrom(t, server, results, "127.0.0.1", "one")
+		printJobFrom(t, server, results, "127.0.0.1", "two")
+		printJobFrom(t, server, results, "127.0.0.2", "three")
+		printJobFrom(t, server, results, "127.0.0.1", "four")
+		server.Stop()
+
+		init := string(escpos.Init())
+		assert.Equal(t, "onetwo"+init+"three"+init+"four", string(mockAdapter.writeData), "buffering %v", buffering)
+	}
+}
+
+func TestServerResetBetweenClientsDisabled(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+	server := New(mockAdapter, "127.0.0.1:0")
+
+	results := make(chan JobResult, 1)
+	server.OnJobComplete(func(r JobResult) { results <- r })
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	printJobFrom(t, server, results, "127.0.0.1", "one")
+	printJobFrom(t, server, results, "127.0.0.2", "two")
+	assert.Equal(t, "onetwo", string(mockAdapter.writeData))
+}
+
+func TestServerResetBetweenClientsInProcess(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+	server := New(mockAdapter, "127.0.0.1:0")
+	server.SetResetBetweenClients(true)
+
+	results := make(chan JobResult, 1)
+	server.OnJobComplete(func(r JobResult) { results <- r })
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	printJobFrom(t, server, results, "127.0.0.1", "one")
+	_, err := server.PrintSync(context.Background(), []byte("two"))
+	require.NoError(t, err)
+	assert.Equal(t, "one"+string(escpos.Init())+"two", string(mockAdapter.writeData))
+}
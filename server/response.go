@@ -0,0 +1,92 @@
+package server
+
+import (
+	"net"
+	"time"
+
+	"github.com/nixxel-company-limited/escpos-usb-server/escpos"
+)
+
+// ProcessIDAwaiter is implemented by adapters that can wait for the
+// printer's response to a process ID request, such as adapter.USBAdapter
+type ProcessIDAwaiter interface {
+	AwaitProcessID(id escpos.ProcessID, timeout time.Duration) error
+}
+
+// SetResponseForwarding makes the server answer the process ID requests
+// (GS ( H fn 48) in streamed clients' data, so POS software that checks
+// how far the printer got works through the server as with a network
+// printer. After writing data containing a request, the server waits up
+// to timeout for the printer's response and forwards it to the client;
+// a response that does not arrive is logged and not forwarded. This needs
+// an adapter implementing ProcessIDAwaiter. Buffered jobs are written
+// after their client stops sending, so their requests are not answered.
+// Zero, the default, disables forwarding.
+func (s *Server) SetResponseForwarding(timeout time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responseTimeout = timeout
+}
+
+// processIDScanner finds the process ID requests in a client's data, which
+// may be split across reads
+type processIDScanner struct {
+	// tail holds the end of the data scanned so far, which may be the
+	// start of a request
+	tail []byte
+}
+
+// scan returns the IDs of the requests that end in data
+func (sc *processIDScanner) scan(data []byte) []escpos.ProcessID {
+	buf := append(sc.tail, data...)
+
+	var ids []escpos.ProcessID
+	for i := 0; i+escpos.ProcessIDRequestLen <= len(buf); i++ {
+		// Requests entirely in the tail were found by the previous scan
+		if i+escpos.ProcessIDRequestLen <= len(sc.tail) {
+			continue
+		}
+		if id, ok := escpos.ParseProcessIDRequest(buf[i:]); ok {
+			ids = append(ids, id)
+		}
+	}
+
+	keep := min(len(buf), escpos.ProcessIDRequestLen-1)
+	sc.tail = append(sc.tail[:0:0], buf[len(buf)-keep:]...)
+	return ids
+}
+
+// forwardResponses waits for the printer's response to each process ID
+// request in data, which was just written, and sends it to the client
+func (s *Server) forwardResponses(conn net.Conn, requests *processIDScanner, data []byte, timeout time.Duration) {
+	ids := requests.scan(data)
+	if len(ids) == 0 {
+		return
+	}
+
+	s.swapMu.RLock()
+	defer s.swapMu.RUnlock()
+	device := s.printer()
+
+	awaiter, ok := device.(ProcessIDAwaiter)
+	if !ok {
+		s.logger.Printf("Cannot answer process ID requests from %s: the adapter does not read responses", conn.RemoteAddr())
+		return
+	}
+	if err := flushAdapter(device); err != nil {
+		s.logger.Printf("Error flushing before process ID request: %v", err)
+		return
+	}
+
+	for _, id := range ids {
+		if err := awaiter.AwaitProcessID(id, timeout); err != nil {
+			s.logger.Printf("No response to process ID %q from %s: %v", id[:], conn.RemoteAddr(), err)
+			continue
+		}
+		conn.SetWriteDeadline(time.Now().Add(ackWriteTimeout))
+		if _, err := conn.Write(escpos.ProcessIDResponse(id)); err != nil {
+			s.logger.Printf("Error forwarding process ID response to %s: %v", conn.RemoteAddr(), err)
+			return
+		}
+	}
+}
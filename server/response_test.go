@@ -0,0 +1,129 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nixxel-company-limited/escpos-usb-server/escpos"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// loopbackAdapter answers the process ID requests written to it, like a
+// printer that has processed everything it received
+type loopbackAdapter struct {
+	mu sync.Mutex
+	MockAdapter
+	answered map[escpos.ProcessID]int
+	// ignore lists IDs the printer never answers
+	ignore map[escpos.ProcessID]bool
+}
+
+func (a *loopbackAdapter) Write(data []byte) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.MockAdapter.Write(data)
+}
+
+func (a *loopbackAdapter) AwaitProcessID(id escpos.ProcessID, timeout time.Duration) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	requested := 0
+	for i := range a.writeData {
+		if got, ok := escpos.ParseProcessIDRequest(a.writeData[i:]); ok && got == id {
+			requested++
+		}
+	}
+	if a.ignore[id] || requested <= a.answered[id] {
+		return errors.New("no response")
+	}
+	if a.answered == nil {
+		a.answered = make(map[escpos.ProcessID]int)
+	}
+	a.answered[id]++
+	return nil
+}
+
+func processIDRequest(t *testing.T, id string) []byte {
+	t.Helper()
+	request, err := escpos.RequestProcessID(escpos.ProcessID([]byte(id)))
+	require.NoError(t, err)
+	return request
+}
+
+func TestServerForwardsProcessIDResponses(t *testing.T) {
+	loopback := &loopbackAdapter{ignore: map[escpos.ProcessID]bool{{'0', '0', '0', '3'}: true}}
+	server := New(loopback, "127.0.0.1:0")
+	server.SetResponseForwarding(time.Second)
+
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	conn, err := net.Dial("tcp", server.BoundAddress())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// The second request is split across writes; the third is never
+	// answered by the printer
+	second := processIDRequest(t, "0002")
+	for _, chunk := range [][]byte{
+		append([]byte("receipt one"), processIDRequest(t, "0001")...),
+		append([]byte("receipt two"), second[:5]...),
+		second[5:],
+		processIDRequest(t, "0003"),
+		processIDRequest(t, "0001"),
+	} {
+		_, err := conn.Write(chunk)
+		require.NoError(t, err)
+		time.Sleep(10 * time.Millisecond)
+	}
+	conn.(*net.TCPConn).CloseWrite()
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	replies, err := io.ReadAll(conn)
+	require.NoError(t, err)
+
+	var want []byte
+	for _, id := range []string{"0001", "0002", "0001"} {
+		want = append(want, escpos.ProcessIDResponse(escpos.ProcessID([]byte(id)))...)
+	}
+	assert.Equal(t, want, replies)
+}
+
+func TestServerResponseForwardingDisabled(t *testing.T) {
+	loopback := &loopbackAdapter{}
+	server := New(loopback, "127.0.0.1:0")
+
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	conn, err := net.Dial("tcp", server.BoundAddress())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write(processIDRequest(t, "0001"))
+	require.NoError(t, err)
+	conn.(*net.TCPConn).CloseWrite()
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	replies, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.Empty(t, replies)
+}
+
+func TestProcessIDScanner(t *testing.T) {
+	request := processIDRequest(t, "AB12")
+	var sc processIDScanner
+
+	assert.Empty(t, sc.scan(request[:3]))
+	assert.Empty(t, sc.scan(request[3:10]))
+	assert.Equal(t, []escpos.ProcessID{{'A', 'B', '1', '2'}}, sc.scan(append(request[10:], "text"...)))
+	// A request already reported is not reported again
+	assert.Empty(t, sc.scan([]byte("x")))
+	assert.Equal(t, []escpos.ProcessID{{'A', 'B', '1', '2'}, {'A', 'B', '1', '2'}}, sc.scan(append(append([]byte(nil), request...), request...)))
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nixxel-company-limited/escpos-usb-server/adapter"
+	"github.com/nixxel-company-limited/escpos-usb-server/escpos"
+)
+
+// SetResetOnWriteError makes the server send a printer reset (ESC @) and
+// flush the adapter before the next write after a write error, so a command
+// the printer buffered from the failed job cannot swallow the start of the
+// next one
+func (s *Server) SetResetOnWriteError(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.resetOnWriteError = enabled
+	if !enabled {
+		s.resetPending = false
+	}
+}
+
+// writeData writes job data to the adapter, resetting the printer first if
+// an earlier write failed and SetResetOnWriteError is enabled
+func (s *Server) writeData(ctx context.Context, data []byte) (int, error) {
+	s.swapMu.RLock()
+	defer s.swapMu.RUnlock()
+	device := s.printer()
+
+	if err := s.resync(ctx, device); err != nil {
+		return 0, err
+	}
+
+	ctx, release := s.interruptible(ctx)
+	defer release()
+
+	written, err := adapter.WriteContext(ctx, device, data)
+	if err != nil {
+		s.mu.Lock()
+		s.resetPending = s.resetOnWriteError
+		s.clearPending = true
+		s.mu.Unlock()
+		if context.Cause(ctx) == ErrServerStopped {
+			s.mu.Lock()
+			s.interruptedWrites++
+			s.mu.Unlock()
+			return written, fmt.Errorf("%w: write interrupted (%d of %d bytes written)", ErrServerStopped, written, len(data))
+		}
+	}
+	return written, err
+}
+
+// interruptible derives a context for an adapter write that is cancelled
+// with ErrServerStopped when StopWithTimeout gives up waiting. The returned
+// function releases it.
+func (s *Server) interruptible(ctx context.Context) (context.Context, func()) {
+	s.mu.Lock()
+	writeCtx := s.writeCtx
+	s.mu.Unlock()
+	if writeCtx == nil {
+		return ctx, func() {}
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	stop := context.AfterFunc(writeCtx, func() { cancel(ErrServerStopped) })
+	return ctx, func() {
+		stop()
+		cancel(nil)
+	}
+}
+
+// resync sends the pending printer reset, if any. The reset stays pending
+// if it cannot be written.
+func (s *Server) resync(ctx context.Context, device adapter.Adapter) error {
+	s.mu.Lock()
+	pending := s.resetPending
+	s.mu.Unlock()
+	if !pending {
+		return nil
+	}
+
+	if _, err := adapter.WriteContext(ctx, device, escpos.Init()); err != nil {
+		return err
+	}
+	if err := flushAdapter(device); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.resetPending = false
+	s.mu.Unlock()
+	s.logger.Println("Printer reset after write error")
+	return nil
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/nixxel-company-limited/escpos-usb-server/escpos"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyAdapter is a MockAdapter whose first write fails after accepting
+// part of the data, recording every write and flush
+type flakyAdapter struct {
+	MockAdapter
+	mu     sync.Mutex
+	failed bool
+	log    []string
+}
+
+func (a *flakyAdapter) Write(data []byte) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !a.failed {
+		a.failed = true
+		a.log = append(a.log, "partial "+string(data[:2]))
+		return 2, errors.New("pipe error")
+	}
+	a.log = append(a.log, string(data))
+	return len(data), nil
+}
+
+func (a *flakyAdapter) Flush() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.log = append(a.log, "flush")
+	return nil
+}
+
+func (a *flakyAdapter) Log() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]string(nil), a.log...)
+}
+
+func TestServerResetOnWriteError(t *testing.T) {
+	flaky := &flakyAdapter{}
+	server := New(flaky, "127.0.0.1:0")
+	server.SetResetOnWriteError(true)
+
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	ctx := context.Background()
+	_, err := server.PrintSync(ctx, []byte("\x1b!first"))
+	require.Error(t, err)
+
+	_, err = server.PrintSync(ctx, []byte("second"))
+	require.NoError(t, err)
+	_, err = server.PrintSync(ctx, []byte("third"))
+	require.NoError(t, err)
+
+	// One reset and flush between the failed job and the next, none after;
+	// every job that was written is flushed at its end
+	assert.Equal(t, []string{
+		"partial \x1b!",
+		string(escpos.Init()),
+		"flush",
+		"second",
+		"flush",
+		"third",
+		"flush",
+	}, flaky.Log())
+}
+
+func TestServerNoResetByDefault(t *testing.T) {
+	flaky := &flakyAdapter{}
+	server := New(flaky, "127.0.0.1:0")
+
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	ctx := context.Background()
+	_, err := server.PrintSync(ctx, []byte("\x1b!first"))
+	require.Error(t, err)
+	_, err = server.PrintSync(ctx, []byte("second"))
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"partial \x1b!", "second", "flush"}, flaky.Log())
+}
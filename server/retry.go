@@ -0,0 +1,95 @@
+package server
+
+import (
+	"errors"
+	"time"
+
+	"github.com/nixxel-company-limited/escpos-usb-server/adapter"
+)
+
+// reconnectRetryDelay is the pause between attempts to reopen a printer
+// that disconnected mid-job
+const reconnectRetryDelay = time.Second
+
+// Reconnector is implemented by adapters that can reopen a printer after
+// it disconnected, such as adapter.USBAdapter
+type Reconnector interface {
+	Reconnect() error
+}
+
+// SetJobRetries makes the queue worker retry a job up to n times when its
+// write fails because the printer disconnected. The worker waits until the
+// adapter reconnects, then requeues the whole job ahead of jobs of the same
+// priority, so nothing is written while the printer is away. Zero (the
+// default) reports the failure instead. Requires an adapter implementing
+// Reconnector.
+func (s *Server) SetJobRetries(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobRetries = n
+}
+
+// SetResumableJobs makes a job requeued after a disconnect (see
+// SetJobRetries) continue after the bytes the printer confirmed before it
+// went away, instead of being written again from the start. ESC/POS is not
+// generally safe to resume: a command cut in half, or printer state lost in
+// the power cycle, garbles the rest of the job. Only enable this for
+// streams known to survive it, e.g. plain text with no mode commands.
+func (s *Server) SetResumableJobs(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.resumableJobs = enabled
+}
+
+// retryAfterDisconnect waits for the printer to come back and requeues j
+// if its write failed with a disconnect and it has retries left. written is
+// how much of j was confirmed written. It returns false when the failure
+// should be reported instead.
+func (s *Server) retryAfterDisconnect(q *jobQueue, j *job, written int, err error) bool {
+	s.mu.Lock()
+	maxRetries := s.jobRetries
+	resumable := s.resumableJobs
+	done := s.done
+	s.mu.Unlock()
+
+	reconnector, ok := s.printer().(Reconnector)
+	if !ok || j.retries >= maxRetries || !adapter.IsDisconnect(err) {
+		return false
+	}
+
+	if !s.awaitReconnect(reconnector, done) {
+		return false
+	}
+
+	j.retries++
+	if resumable && written > j.offset {
+		j.offset = written
+		s.logger.Printf("Printer reconnected, resuming job at byte %d of %d (retry %d of %d)", j.offset, len(j.data), j.retries, maxRetries)
+	} else {
+		s.logger.Printf("Printer reconnected, requeueing job (retry %d of %d)", j.retries, maxRetries)
+	}
+	q.requeue(j)
+	return true
+}
+
+// awaitReconnect tries to reconnect the adapter until it succeeds or done
+// is closed, reporting whether it reconnected. A wrapper whose adapter
+// cannot reconnect (errors.ErrUnsupported) is not retried.
+func (s *Server) awaitReconnect(r Reconnector, done <-chan struct{}) bool {
+	for {
+		err := r.Reconnect()
+		if err == nil {
+			return true
+		}
+		if errors.Is(err, errors.ErrUnsupported) {
+			return false
+		}
+		s.logger.Printf("Waiting for printer to reconnect: %v", err)
+
+		select {
+		case <-done:
+			return false
+		case <-s.clock.After(reconnectRetryDelay):
+		}
+	}
+}
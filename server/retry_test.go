@@ -0,0 +1,119 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/gousb"
+	"github.com/nixxel-company-limited/escpos-usb-server/adapter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// unpluggingAdapter is a MockAdapter whose first write stops halfway with a
+// disconnect error. Reconnect fails until failReconnects attempts were made.
+type unpluggingAdapter struct {
+	MockAdapter
+	mu             sync.Mutex
+	unplugged      bool
+	writes         [][]byte
+	reconnects     int
+	failReconnects int
+}
+
+func (a *unpluggingAdapter) Write(data []byte) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !a.unplugged {
+		a.unplugged = true
+		half := len(data) / 2
+		a.writes = append(a.writes, append([]byte(nil), data[:half]...))
+		return half, &adapter.USBError{Op: "write", Code: gousb.TransferNoDevice, Err: gousb.ErrorNoDevice}
+	}
+	a.writes = append(a.writes, append([]byte(nil), data...))
+	return len(data), nil
+}
+
+func (a *unpluggingAdapter) Reconnect() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.reconnects++
+	if a.reconnects <= a.failReconnects {
+		return errors.New("cannot find printer")
+	}
+	return nil
+}
+
+func (a *unpluggingAdapter) Writes() [][]byte {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([][]byte(nil), a.writes...)
+}
+
+func TestServerRequeuesJobAfterReconnect(t *testing.T) {
+	clk := newFakeClock()
+	unplugging := &unpluggingAdapter{failReconnects: 1}
+
+	server := New(unplugging, "localhost:0")
+	server.clock = clk
+	server.SetJobRetries(2)
+
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := server.PrintSync(context.Background(), []byte("full receipt"))
+		done <- err
+	}()
+
+	// The first reconnect attempt fails; nothing is rewritten until the
+	// printer is back
+	require.Eventually(t, func() bool { return clk.Waiters() == 1 }, time.Second, 10*time.Millisecond)
+	assert.Len(t, unplugging.Writes(), 1)
+
+	clk.Advance(reconnectRetryDelay)
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("job was not retried")
+	}
+	assert.Equal(t, [][]byte{[]byte("full r"), []byte("full receipt")}, unplugging.Writes())
+}
+
+func TestServerNoRequeueByDefault(t *testing.T) {
+	unplugging := &unpluggingAdapter{}
+	server := New(unplugging, "localhost:0")
+
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	written, err := server.PrintSync(context.Background(), []byte("full receipt"))
+	assert.True(t, adapter.IsDisconnect(err))
+	assert.Equal(t, 6, written)
+	assert.Len(t, unplugging.Writes(), 1)
+}
+
+func TestServerResumesJobFromConfirmedOffset(t *testing.T) {
+	unplugging := &unpluggingAdapter{}
+	server := New(unplugging, "localhost:0")
+	server.SetJobRetries(1)
+	server.SetResumableJobs(true)
+
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	written, err := server.PrintSync(context.Background(), []byte("full receipt"))
+	require.NoError(t, err)
+	assert.Equal(t, len("full receipt"), written)
+
+	// Only the bytes after the six confirmed before the disconnect are resent
+	assert.Equal(t, [][]byte{[]byte("full r"), []byte("eceipt")}, unplugging.Writes())
+}
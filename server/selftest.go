@@ -0,0 +1,75 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nixxel-company-limited/escpos-usb-server/adapter"
+	"github.com/nixxel-company-limited/escpos-usb-server/escpos"
+)
+
+// selfTestTimeout bounds the startup self-test write, so a printer that
+// stopped taking data fails the start instead of hanging it
+const selfTestTimeout = 5 * time.Second
+
+// ErrSelfTestFailed is returned by Start, StartAsync and Serve when the
+// startup self-test could not write to the printer
+var ErrSelfTestFailed = errors.New("startup self-test failed")
+
+// SetStartupSelfTest makes the server write ESC @ (initialize, which prints
+// nothing) to the printer when it starts, before accepting connections, so
+// a broken printer path fails the start instead of the first real job
+func (s *Server) SetStartupSelfTest(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.startupSelfTest = enabled
+}
+
+// startupCheck opens the adapter and runs the startup self-test, if
+// enabled, before a start takes s.mu, so a slow printer holds up neither
+// the setters nor the status endpoints. It is skipped for a server already
+// running, whose start then fails. The control port is closed if the check
+// fails.
+func (s *Server) startupCheck() error {
+	s.mu.Lock()
+	skip := s.running || !s.startupSelfTest
+	device := s.adapter
+	s.mu.Unlock()
+	if skip {
+		return nil
+	}
+
+	err := adapter.OpenIfNeeded(device)
+	if err != nil {
+		err = fmt.Errorf("failed to open adapter: %w", err)
+	} else {
+		err = s.selfTest(device)
+	}
+	if err != nil {
+		s.logger.Printf("Error: %v", err)
+		s.mu.Lock()
+		s.dropControl()
+		s.mu.Unlock()
+	}
+	return err
+}
+
+// selfTest writes ESC @ to the freshly opened device, giving up after
+// selfTestTimeout
+func (s *Server) selfTest(device adapter.Adapter) error {
+	s.logger.Println("Running startup self-test")
+
+	ctx, cancel := context.WithTimeout(context.Background(), selfTestTimeout)
+	defer cancel()
+	if _, err := adapter.WriteContext(ctx, device, escpos.Init()); err != nil {
+		return fmt.Errorf("%w: %v", ErrSelfTestFailed, err)
+	}
+	if err := flushAdapter(device); err != nil {
+		return fmt.Errorf("%w: %v", ErrSelfTestFailed, err)
+	}
+
+	s.logger.Println("Startup self-test passed")
+	return nil
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nixxel-company-limited/escpos-usb-server/escpos"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerStartupSelfTest(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+	server := New(mockAdapter, "127.0.0.1:0")
+	server.SetStartupSelfTest(true)
+
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	assert.Equal(t, escpos.Init(), mockAdapter.writeData)
+}
+
+func TestServerStartupSelfTestFailure(t *testing.T) {
+	server := New(&brokenAdapter{}, "127.0.0.1:0")
+	server.SetStartupSelfTest(true)
+
+	err := server.StartAsync()
+	require.ErrorIs(t, err, ErrSelfTestFailed)
+	assert.Contains(t, err.Error(), "printer unavailable")
+	assert.False(t, server.IsRunning())
+}
+
+func TestServerNoSelfTestByDefault(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+	server := New(mockAdapter, "127.0.0.1:0")
+
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	assert.Empty(t, mockAdapter.writeData)
+}
+
+// heldAdapter is a MockAdapter whose writes wait until release is closed
+type heldAdapter struct {
+	MockAdapter
+	started chan struct{}
+	release chan struct{}
+}
+
+func (a *heldAdapter) WriteContext(ctx context.Context, data []byte) (int, error) {
+	close(a.started)
+	select {
+	case <-a.release:
+		return a.MockAdapter.Write(data)
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+func TestServerStartupSelfTestOutsideLock(t *testing.T) {
+	held := &heldAdapter{started: make(chan struct{}), release: make(chan struct{})}
+	server := New(held, "127.0.0.1:0")
+	server.SetStartupSelfTest(true)
+
+	started := make(chan error, 1)
+	go func() { started <- server.StartAsync() }()
+	<-held.started
+
+	// The server's settings and state stay reachable during the self-test
+	checked := make(chan bool, 1)
+	go func() {
+		server.SetInterJobDelay(0)
+		checked <- server.IsRunning()
+	}()
+	select {
+	case running := <-checked:
+		assert.False(t, running)
+	case <-time.After(time.Second):
+		t.Fatal("self-test holds the server lock")
+	}
+
+	close(held.release)
+	require.NoError(t, <-started)
+	defer server.Stop()
+	assert.Equal(t, escpos.Init(), held.writeData)
+}
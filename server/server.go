@@ -1,84 +1,208 @@
 package server
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net"
-	"os"
+	"net/http"
+	"runtime/debug"
 	"sync"
+	"text/template"
+	"time"
 
 	"github.com/nixxel-company-limited/escpos-usb-server/adapter"
 )
 
 // Server represents a TCP server that forwards data to a printer adapter
 type Server struct {
-	adapter  adapter.Adapter
+	// adapter is the printer, guarded by mu since SwapAdapter can replace
+	// it; use printer() outside mu
+	adapter adapter.Adapter
+	// swapMu is held for reading by every print write and for writing by
+	// SwapAdapter, which so waits for writes in flight and pauses new ones
+	swapMu sync.RWMutex
+
 	listener net.Listener
 	address  string
 	mu       sync.Mutex
 	running  bool
 	wg       sync.WaitGroup
 	logger   *log.Logger
+	conns    map[net.Conn]struct{}
+	// logLimiter caps the logger's output, see SetLogRateLimit
+	logLimiter *logLimiter
+	// connections records client connections for GET /connections
+	connections connRegistry
+	// trace captures the data of clients traced with StartTrace
+	trace traceRing
+	// connContext derives each connection's context, see SetConnContext
+	connContext func(ctx context.Context, c net.Conn) context.Context
+
+	// handshakeTimeout bounds the wait for a client's first frame
+	handshakeTimeout time.Duration
+	// readTimeout is the idle timeout applied to every subsequent read
+	readTimeout time.Duration
+
+	onJobComplete func(JobResult)
+	onConnection  func(ConnEvent)
+
+	// maxDecompressedBytes caps decoded HTTP print bodies
+	maxDecompressedBytes int64
+
+	// done is closed by Stop to end background workers
+	done  chan struct{}
+	clock clock
+
+	// writeCtx is cancelled by StopWithTimeout to interrupt adapter writes
+	// still running after the grace period; interruptedWrites counts them
+	writeCtx          context.Context
+	cancelWrites      context.CancelFunc
+	interruptedWrites int
+
+	paperPollInterval time.Duration
+	paperStatus       *PaperStatus
+
+	queue         *jobQueue
+	metrics       queueMetrics
+	maxQueueBytes int
+	jobBuffering  bool
+	jobStore      JobStore
+	interJobDelay time.Duration
+	jobRetries    int
+	resumableJobs bool
+	// jobWriteTimeout bounds each queued job's write; jobTimeouts counts
+	// the jobs that exceeded it
+	jobWriteTimeout time.Duration
+	jobTimeouts     int
+
+	// commitOnlyOnCleanClose discards buffered jobs of connections that
+	// did not end with EOF or jobTerminator
+	commitOnlyOnCleanClose bool
+	jobTerminator          []byte
+
+	// lastJob is the last job written completely, for ReprintLast
+	lastJob []byte
+
+	// autoCut and jobEpilogue are written after every completed job
+	autoCut bool
+	// cutCommand overrides the adapter's cut for autoCut
+	cutCommand  []byte
+	jobEpilogue []byte
+	// footer is rendered and appended to every buffered job
+	footer *template.Template
+	// stages transform every buffered job in order, see AddStage
+	stages []Stage
+
+	// offlineResponse answers clients with OfflineResponse when the
+	// printer is offline
+	offlineResponse bool
+
+	// resetPending is set after a write error when resetOnWriteError is on
+	resetOnWriteError bool
+	resetPending      bool
+
+	// reuseAddr sets SO_REUSEADDR and retries a listen on EADDRINUSE
+	reuseAddr bool
+	// listenConfig tunes the listening socket, see SetListenConfig
+	listenConfig ListenConfig
+	// clearBufferBeforeJob sends DLE DC4 8 before a job when clearPending
+	// is set, i.e. a job was aborted since the last clear
+	clearBufferBeforeJob bool
+	clearPending         bool
+	// responseTimeout bounds the wait for a process ID response to
+	// forward, see SetResponseForwarding
+	responseTimeout time.Duration
+	// resetBetweenClients sends ESC @ before a job whose client differs
+	// from lastClient, the host of the previous job's client
+	resetBetweenClients bool
+	lastClient          string
+	lastClientSet       bool
+	// validateJobs logs escpos.Validate issues of buffered jobs
+	validateJobs bool
+
+	// protocol selects raw passthrough or acknowledged jobs; lastJobID
+	// numbers buffered jobs
+	protocol  Protocol
+	lastJobID uint64
+	// keepalivePing is the interval between pings to acked clients
+	keepalivePing time.Duration
+	// autoDetectProtocol sniffs each connection's protocol
+	autoDetectProtocol bool
+	// tcpHealthProbe answers "PING\n" connections with "PONG\n"
+	tcpHealthProbe bool
+	// logEmptyConnections logs connections before they send any data
+	logEmptyConnections bool
+	// startupSelfTest writes ESC @ to the printer before accepting clients
+	startupSelfTest bool
+	// wsOrigins are the browser origins allowed to open /ws besides the
+	// server's own, see SetWebSocketOrigins
+	wsOrigins []string
+	// control serves the administration endpoints on controlListener, see
+	// EnableControl
+	control         *http.Server
+	controlListener net.Listener
+}
+
+// drainTimeout bounds how long a force-closed connection is drained
+const drainTimeout = 100 * time.Millisecond
+
+// maxEmptyReads is how many reads in a row may return no data and no error
+// before the connection is treated as broken, as bufio does
+const maxEmptyReads = 100
+
+// ErrServerStopped is reported for jobs cut short by Stop
+var ErrServerStopped = errors.New("server stopped")
+
+// errConnectionPanic is the job error of a connection whose handler
+// panicked
+var errConnectionPanic = errors.New("connection handler panicked")
+
+// JobResult describes what happened to the data a client sent
+type JobResult struct {
+	ClientAddr    string
+	BytesReceived int
+	BytesWritten  int
+	// BytesDropped counts client bytes that never reached the printer
+	BytesDropped int
+	// Partial is set when the connection was force-closed before all of
+	// the client's bytes were written, so the client may want to reprint
+	Partial bool
+	Err     error
 }
 
-// New creates a new server instance
+// New creates a new server instance with the default configuration
 func New(device adapter.Adapter, address string) *Server {
-	logger := log.New(os.Stdout, "[SERVER] ", log.LstdFlags|log.Lmsgprefix)
-	return &Server{
-		adapter: device,
-		address: address,
-		logger:  logger,
-	}
+	return NewFromConfig(device, Config{Address: address})
 }
 
 // NewWithLogger creates a new server instance with a custom logger
 func NewWithLogger(device adapter.Adapter, address string, logger *log.Logger) *Server {
-	return &Server{
-		adapter: device,
-		address: address,
-		logger:  logger,
-	}
+	return NewFromConfig(device, Config{Address: address, Logger: logger})
 }
 
 // Start starts the TCP server and blocks until Stop is called
 func (s *Server) Start() error {
+	if err := s.startupCheck(); err != nil {
+		return err
+	}
 	s.mu.Lock()
 
 	s.logger.Printf("Starting server on %s (blocking mode)", s.address)
 
-	if s.running {
-		s.mu.Unlock()
-		s.logger.Println("Error: Server already running")
-		return fmt.Errorf("server already running")
-	}
-
-	listener, err := net.Listen("tcp", s.address)
+	listener, err := s.listen()
 	if err != nil {
 		s.mu.Unlock()
-		s.logger.Printf("Error: Failed to start server: %v", err)
-		return fmt.Errorf("failed to start server: %w", err)
+		return err
 	}
 
-	s.listener = listener
-	s.running = true
-	s.logger.Printf("Server listening on %s", s.address)
-
-	// Open the adapter if not already open
-	if !s.adapter.IsOpen() {
-		s.logger.Println("Opening printer adapter...")
-		if err := s.adapter.Open(); err != nil {
-			s.listener.Close()
-			s.running = false
-			s.mu.Unlock()
-			s.logger.Printf("Error: Failed to open adapter: %v", err)
-			return fmt.Errorf("failed to open adapter: %w", err)
-		}
-		s.logger.Println("Printer adapter opened successfully")
-	} else {
-		s.logger.Println("Printer adapter already open")
+	if err := s.begin(listener); err != nil {
+		s.mu.Unlock()
+		return err
 	}
-
 	s.mu.Unlock()
 
 	// Block and accept connections (freezes current goroutine)
@@ -90,152 +214,684 @@ func (s *Server) Start() error {
 
 // StartAsync starts the TCP server in a goroutine (non-blocking)
 func (s *Server) StartAsync() error {
+	if err := s.startupCheck(); err != nil {
+		return err
+	}
 	s.mu.Lock()
 
 	s.logger.Printf("Starting server on %s (async mode)", s.address)
 
+	listener, err := s.listen()
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+
+	if err := s.begin(listener); err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.acceptConnections()
+	}()
+	s.logger.Println("Server started in background, ready to accept connections")
+
+	return nil
+}
+
+// Serve accepts connections on a listener created by the caller and blocks
+// until Stop is called, like http.Server.Serve. This allows systemd socket
+// activation, listeners handed over for zero-downtime restarts, and tests
+// listening on port 0. The server takes ownership of l and closes it on Stop.
+// Address reports l's actual address afterwards.
+func (s *Server) Serve(l net.Listener) error {
+	if err := s.startupCheck(); err != nil {
+		l.Close()
+		return err
+	}
+	s.mu.Lock()
+
+	s.logger.Printf("Starting server on %s (serve mode)", l.Addr())
+
 	if s.running {
 		s.mu.Unlock()
 		s.logger.Println("Error: Server already running")
 		return fmt.Errorf("server already running")
 	}
 
-	listener, err := net.Listen("tcp", s.address)
-	if err != nil {
+	s.address = l.Addr().String()
+	if err := s.begin(l); err != nil {
 		s.mu.Unlock()
+		return err
+	}
+	s.mu.Unlock()
+
+	s.logger.Println("Ready to accept connections")
+	s.acceptConnections()
+
+	return nil
+}
+
+// listen creates the TCP listener for s.address. Callers must hold s.mu,
+// which is released while a listen is retried.
+func (s *Server) listen() (net.Listener, error) {
+	if s.running {
+		s.logger.Println("Error: Server already running")
+		return nil, fmt.Errorf("server already running")
+	}
+
+	listener, err := s.listenTCP()
+	// Another Start may have won while s.mu was released
+	if s.running {
+		if listener != nil {
+			listener.Close()
+		}
+		s.logger.Println("Error: Server already running")
+		return nil, fmt.Errorf("server already running")
+	}
+	if err != nil {
+		s.dropControl()
 		s.logger.Printf("Error: Failed to start server: %v", err)
-		return fmt.Errorf("failed to start server: %w", err)
+		return nil, fmt.Errorf("failed to start server: %w", err)
 	}
 
+	return listener, nil
+}
+
+// begin marks the server running on listener, opens the adapter and starts
+// the background workers. The listener and the control port are closed if
+// the adapter cannot be opened. Callers must hold s.mu.
+func (s *Server) begin(listener net.Listener) error {
 	s.listener = listener
 	s.running = true
 	s.logger.Printf("Server listening on %s", s.address)
 
-	// Open the adapter if not already open
-	if !s.adapter.IsOpen() {
+	// Open the adapter if not already open. A pre-opened adapter, or one
+	// opened concurrently by another user, is not an error.
+	wasOpen := s.adapter.IsOpen()
+	if !wasOpen {
 		s.logger.Println("Opening printer adapter...")
-		if err := s.adapter.Open(); err != nil {
-			s.listener.Close()
-			s.running = false
-			s.mu.Unlock()
-			s.logger.Printf("Error: Failed to open adapter: %v", err)
-			return fmt.Errorf("failed to open adapter: %w", err)
-		}
-		s.logger.Println("Printer adapter opened successfully")
-	} else {
+	}
+	if err := adapter.OpenIfNeeded(s.adapter); err != nil {
+		s.listener.Close()
+		s.dropControl()
+		s.running = false
+		s.logger.Printf("Error: Failed to open adapter: %v", err)
+		return fmt.Errorf("failed to open adapter: %w", err)
+	}
+	if wasOpen {
 		s.logger.Println("Printer adapter already open")
+	} else {
+		s.logger.Println("Printer adapter opened successfully")
 	}
 
-	s.mu.Unlock()
+	s.startBackground()
+	return nil
+}
 
+// startBackground launches the background workers. Callers must hold s.mu.
+func (s *Server) startBackground() {
+	s.done = make(chan struct{})
+	s.writeCtx, s.cancelWrites = context.WithCancel(context.Background())
+	s.interruptedWrites = 0
+
+	s.queue = newJobQueue(s.jobStore)
+	if s.jobStore != nil {
+		s.replayJobs(s.queue)
+	}
 	s.wg.Add(1)
-	go s.acceptConnections()
-	s.logger.Println("Server started in background, ready to accept connections")
+	go s.runQueue(s.queue)
 
-	return nil
+	if s.paperPollInterval > 0 {
+		s.wg.Add(1)
+		go s.pollPaperStatus(s.paperPollInterval, s.done)
+	}
 }
 
 // acceptConnections handles incoming client connections
 func (s *Server) acceptConnections() {
-	for {
-		s.logger.Println("Waiting for client connection...")
-		conn, err := s.listener.Accept()
-		if err != nil {
-			s.mu.Lock()
-			running := s.running
-			s.mu.Unlock()
+	for s.acceptConnection() {
+	}
+}
 
-			if !running {
-				// Server is shutting down
-				s.logger.Println("Server shutting down, stopping accept loop")
-				return
-			}
-			s.logger.Printf("Error accepting connection: %v", err)
-			continue
+// acceptConnection accepts one client connection and starts handling it,
+// reporting whether the accept loop should go on. A panic is logged and
+// the loop goes on, so one bad connection cannot stop the service.
+func (s *Server) acceptConnection() (more bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.logger.Printf("Panic in accept loop: %v\n%s", r, debug.Stack())
+			more = true
+		}
+	}()
+
+	s.logger.Println("Waiting for client connection...")
+	conn, err := s.listener.Accept()
+	if err != nil {
+		s.mu.Lock()
+		running := s.running
+		s.mu.Unlock()
+
+		if !running {
+			// Server is shutting down
+			s.logger.Println("Server shutting down, stopping accept loop")
+			return false
 		}
+		s.logger.Printf("Error accepting connection: %v", err)
+		return true
+	}
 
+	s.mu.Lock()
+	logEmpty := s.logEmptyConnections
+	s.mu.Unlock()
+	if logEmpty {
 		s.logger.Printf("Client connected from %s", conn.RemoteAddr())
-		s.wg.Add(1)
-		go s.handleConnection(conn)
 	}
+	s.trackConn(conn, true)
+	s.wg.Add(1)
+	go s.handleConnection(conn)
+	return true
+}
+
+// trackConn adds or removes a connection from the active set
+func (s *Server) trackConn(conn net.Conn, add bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conns == nil {
+		s.conns = make(map[net.Conn]struct{})
+	}
+	if add {
+		s.conns[conn] = struct{}{}
+	} else {
+		delete(s.conns, conn)
+	}
+}
+
+// SetConnContext sets a function deriving the context of each new TCP
+// connection, like http.Server.ConnContext. The context is passed down to
+// adapter writes for the connection, so cancelling it aborts an in-flight
+// write and its values (e.g. a request ID) reach the adapter. The context is
+// cancelled when the connection ends.
+func (s *Server) SetConnContext(fn func(ctx context.Context, c net.Conn) context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.connContext = fn
+}
+
+// SetLogEmptyConnections sets whether connections are logged before they
+// send any data, as they are by default. Turning it off keeps port scanners
+// and health checks that connect and close straight away out of the log:
+// a connection is then logged once its first data arrives. Connections that
+// send nothing are counted in Metrics either way.
+func (s *Server) SetLogEmptyConnections(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logEmptyConnections = enabled
 }
 
 // handleConnection handles a single client connection
 func (s *Server) handleConnection(conn net.Conn) {
 	defer s.wg.Done()
+	// A panic before the job is tracked, e.g. in the OnConnection
+	// callback, ends this connection only; it runs after the deferred
+	// cleanup below
 	defer func() {
-		s.logger.Printf("Client disconnected: %s", conn.RemoteAddr())
-		conn.Close()
+		if r := recover(); r != nil {
+			s.logger.Printf("Panic handling connection from %s: %v\n%s", conn.RemoteAddr(), r, debug.Stack())
+		}
 	}()
 
 	clientAddr := conn.RemoteAddr().String()
-	s.logger.Printf("Handling connection from %s", clientAddr)
+	result := JobResult{ClientAddr: clientAddr}
+
+	// Without logEmpty, connections are only logged once they send data
+	s.mu.Lock()
+	logEmpty := s.logEmptyConnections
+	s.mu.Unlock()
+
+	defer func(conn net.Conn) {
+		if logEmpty || result.BytesReceived > 0 {
+			s.logger.Printf("Client disconnected: %s", conn.RemoteAddr())
+		}
+		s.trackConn(conn, false)
+		conn.Close()
+	}(conn)
+
+	if logEmpty {
+		s.logger.Printf("Handling connection from %s", clientAddr)
+	}
+
+	// A health probe is not a job
+	probe := false
+	defer func() {
+		if !probe {
+			s.reportJob(result)
+		}
+	}()
+
+	connectedAt := s.clock.Now()
+	s.notifyConnection(ConnEvent{Phase: ConnConnected, RemoteAddr: clientAddr})
+	defer func() {
+		event := ConnEvent{
+			Phase:         ConnDisconnected,
+			RemoteAddr:    clientAddr,
+			BytesReceived: result.BytesReceived,
+			BytesWritten:  result.BytesWritten,
+			Duration:      s.clock.Now().Sub(connectedAt),
+			Reason:        closeReason(result.Err),
+		}
+		if event.Reason != CloseEOF && event.Reason != CloseShutdown {
+			event.Err = result.Err
+		}
+		s.notifyConnection(event)
+	}()
+
+	connID := s.connections.open(clientAddr, s.clock.Now())
+	defer func() { s.connections.close(connID, s.clock.Now()) }()
+
+	// A panic from here on, e.g. in a hook such as SetConnContext, is
+	// recorded as the job's error before the job and the disconnect are
+	// reported
+	defer func() {
+		if r := recover(); r != nil {
+			s.logger.Printf("Panic handling connection from %s: %v\n%s", clientAddr, r, debug.Stack())
+			result.Err = fmt.Errorf("%w: %v", errConnectionPanic, r)
+		}
+	}()
+
+	s.mu.Lock()
+	buffering := s.jobBuffering
+	cleanCloseOnly := s.commitOnlyOnCleanClose
+	terminator := s.jobTerminator
+	connContext := s.connContext
+	offlineResponse := s.offlineResponse
+	acked := s.protocol == ProtocolAcked
+	keepaliveInterval := s.keepalivePing
+	autoDetect := s.autoDetectProtocol
+	healthProbe := s.tcpHealthProbe
+	responseTimeout := s.responseTimeout
+	sniffTimeout := s.handshakeTimeout
+	if sniffTimeout <= 0 {
+		sniffTimeout = s.readTimeout
+	}
+	s.mu.Unlock()
+
+	// Acknowledged jobs are always buffered so they succeed or fail whole
+	buffering = buffering || acked
+
+	if offlineResponse && !s.printer().IsOpen() {
+		s.logger.Printf("Printer offline, turning away %s", clientAddr)
+		s.sendOffline(conn)
+		result.Err = ErrPrinterOffline
+		return
+	}
+
+	if autoDetect || healthProbe {
+		var protocol detectedProtocol
+		conn, protocol = sniffProtocol(conn, sniffTimeout, autoDetect, healthProbe)
+		switch protocol {
+		case detectedRaw:
+		case detectedHealthProbe:
+			probe = true
+			conn.SetWriteDeadline(time.Now().Add(ackWriteTimeout))
+			io.WriteString(conn, healthProbeReply)
+			return
+		default:
+			s.logger.Printf("Client %s speaks the %s protocol, which is not supported", clientAddr, protocol)
+			result.Err = fmt.Errorf("%w: %s", ErrUnsupportedProtocol, protocol)
+			conn.SetWriteDeadline(time.Now().Add(ackWriteTimeout))
+			fmt.Fprintf(conn, "ERR unsupported protocol %s\n", protocol)
+			return
+		}
+	}
+
+	ctx := context.Background()
+	if connContext != nil {
+		ctx = connContext(ctx, conn)
+	}
+	ctx, cancel := context.WithCancel(withClient(ctx, clientAddr))
+	defer cancel()
+
+	// Replies to acknowledged clients, shared with the keepalive pinger
+	replies := &replyConn{Conn: conn}
+	if acked && keepaliveInterval > 0 {
+		go s.keepalive(ctx, replies, keepaliveInterval)
+	}
 
 	// Buffer for reading data
 	buf := make([]byte, 4096)
+	handshake := true
+
+	// pending holds the client's data when job buffering is enabled
+	var pending []byte
+	// tail holds the last bytes streamed to the printer, to spot a job
+	// terminator split across reads
+	var tail []byte
+	// printed copies the streamed job for ReprintLast
+	var printed jobCopy
+	// requests finds process ID requests to answer, see
+	// SetResponseForwarding
+	var requests processIDScanner
+	emptyReads := 0
 
 	for {
+		// Timeouts are re-read on every iteration so a reload applies to
+		// connections that are already open
+		s.mu.Lock()
+		handshakeTimeout := s.handshakeTimeout
+		readTimeout := s.readTimeout
+		s.mu.Unlock()
+
+		// The first frame gets the (usually tighter) handshake deadline,
+		// every read after that falls back to the idle timeout
+		timeout := readTimeout
+		if handshake && handshakeTimeout > 0 {
+			timeout = handshakeTimeout
+		}
+		if timeout > 0 {
+			conn.SetReadDeadline(time.Now().Add(timeout))
+		} else {
+			conn.SetReadDeadline(time.Time{})
+		}
+
 		n, err := conn.Read(buf)
+		// A read may return no data and no error; retry a bounded number
+		// of times rather than spin on a connection that is stuck that way
+		if n == 0 && err == nil {
+			emptyReads++
+			if emptyReads < maxEmptyReads {
+				continue
+			}
+			err = io.ErrNoProgress
+		} else {
+			emptyReads = 0
+		}
 		if err != nil {
-			if err != io.EOF {
+			var netErr net.Error
+			if !s.IsRunning() {
+				s.logger.Printf("Server shutting down, closing client %s", clientAddr)
+				result.Err = ErrServerStopped
+				drained := s.drain(conn, buf)
+				result.BytesReceived += drained
+				result.BytesDropped += drained + len(pending)
+				if !buffering && result.BytesWritten > 0 {
+					s.abortJob()
+				}
+				return
+			} else if errors.As(err, &netErr) && netErr.Timeout() {
+				if handshake {
+					s.logger.Printf("Client %s timed out during handshake", clientAddr)
+				} else {
+					s.logger.Printf("Client %s idle timeout", clientAddr)
+				}
+				result.Err = err
+			} else if err != io.EOF {
 				s.logger.Printf("Error reading from client %s: %v", clientAddr, err)
+				result.Err = err
 			} else {
-				s.logger.Printf("Client %s closed connection", clientAddr)
+				if logEmpty || result.BytesReceived > 0 {
+					s.logger.Printf("Client %s closed connection", clientAddr)
+				}
+			}
+			if result.BytesReceived == 0 {
+				s.metrics.countEmptyConnection()
+			}
+			if !buffering {
+				if result.BytesWritten == 0 {
+					return
+				}
+				// Flushed even when aborted, so the job's buffered end
+				// cannot fail the next client's write
+				flushErr := s.flushJobEnd(clientAddr)
+				switch {
+				case err != io.EOF:
+					s.abortJob()
+				case flushErr != nil:
+					result.Err = flushErr
+				default:
+					s.recordLastJob(printed.data)
+					s.completeJob(printed.data)
+				}
+				return
+			}
+			complete := err == io.EOF || (len(terminator) > 0 && bytes.HasSuffix(pending, terminator))
+			if cleanCloseOnly && !complete {
+				s.logger.Printf("Discarding incomplete %d byte job from %s", len(pending), clientAddr)
+				result.BytesDropped += len(pending)
+				if acked && len(pending) > 0 {
+					s.sendAck(replies, s.newJobID(), errIncompleteJob)
+				}
+				return
+			}
+			s.connections.setState(connID, ConnStatePrinting, s.clock.Now())
+			id, jobErr := s.commitJob(ctx, &result, pending)
+			if acked && len(pending) > 0 {
+				s.sendAck(replies, id, jobErr)
+			} else if offlineResponse && jobErr != nil && s.printerOffline(jobErr) {
+				s.sendOffline(conn)
 			}
 			return
 		}
 
+		handshake = false
+
 		if n > 0 {
+			if !logEmpty && result.BytesReceived == 0 {
+				s.logger.Printf("Client connected from %s", clientAddr)
+			}
 			s.logger.Printf("Received %d bytes from %s", n, clientAddr)
+			result.BytesReceived += n
+			s.connections.received(connID, n, s.clock.Now())
+			s.trace.record(clientAddr, buf[:n], s.clock.Now())
+
+			if buffering {
+				pending = append(pending, buf[:n]...)
+				if acked {
+					pending = s.commitAckedJobs(ctx, replies, &result, pending, terminator)
+				}
+				continue
+			}
 
 			// Write data to the printer adapter
-			written, writeErr := s.adapter.Write(buf[:n])
+			write := s.writeData
+			if result.BytesWritten == 0 {
+				write = s.writeStart
+			}
+			written, writeErr := write(ctx, buf[:n])
+			result.BytesWritten += written
 			if writeErr != nil {
 				s.logger.Printf("Error writing to adapter: %v", writeErr)
+				result.Err = writeErr
+				if offlineResponse && s.printerOffline(writeErr) {
+					s.sendOffline(conn)
+				}
+				drained := s.drain(conn, buf)
+				result.BytesReceived += drained
+				result.BytesDropped += n - written + drained
 				return
 			}
 			s.logger.Printf("Wrote %d bytes to printer", written)
+			printed.add(buf[:n])
+
+			// A terminator ends a job mid-connection; flush so the end of
+			// the job is not held back in a coalescing buffer
+			if len(terminator) > 0 {
+				tail = append(tail, buf[:n]...)
+				if len(tail) > len(terminator) {
+					tail = append(tail[:0], tail[len(tail)-len(terminator):]...)
+				}
+				if bytes.Equal(tail, terminator) {
+					if flushErr := s.flushJobEnd(clientAddr); flushErr != nil {
+						result.Err = flushErr
+						drained := s.drain(conn, buf)
+						result.BytesReceived += drained
+						result.BytesDropped += drained
+						return
+					}
+				}
+			}
+
+			if responseTimeout > 0 {
+				s.forwardResponses(conn, &requests, buf[:n], responseTimeout)
+			}
 		}
 	}
 }
 
-// Stop stops the TCP server
+// drain reads and discards whatever the client has already sent so it can
+// be reported as dropped, returning the number of bytes discarded
+func (s *Server) drain(conn net.Conn, buf []byte) int {
+	conn.SetReadDeadline(time.Now().Add(drainTimeout))
+
+	total := 0
+	for {
+		n, err := conn.Read(buf)
+		total += n
+		if err != nil {
+			return total
+		}
+	}
+}
+
+// reportJob logs the outcome of a job and notifies the job callback
+func (s *Server) reportJob(result JobResult) {
+	result.Partial = result.BytesDropped > 0
+	if result.Partial {
+		s.logger.Printf("Client %s disconnected mid-job: %d bytes dropped (%d of %d written)",
+			result.ClientAddr, result.BytesDropped, result.BytesWritten, result.BytesReceived)
+	}
+
+	s.mu.Lock()
+	handler := s.onJobComplete
+	s.mu.Unlock()
+
+	if handler != nil {
+		handler(result)
+	}
+}
+
+// Stop stops the TCP server, waiting for active connections and queued
+// jobs to finish
 func (s *Server) Stop() error {
+	_, err := s.stop(0)
+	return err
+}
+
+// StopWithTimeout stops the server like Stop, but once grace has passed it
+// cancels the adapter writes still in flight so a job stuck on a slow
+// printer cannot block shutdown. It returns how many writes were
+// interrupted. Interrupting a write requires an adapter implementing
+// adapter.ContextWriter; other adapters are only stopped between writes.
+func (s *Server) StopWithTimeout(grace time.Duration) (int, error) {
+	return s.stop(grace)
+}
+
+// stop stops the server, interrupting in-flight writes after grace if it
+// is positive
+func (s *Server) stop(grace time.Duration) (int, error) {
 	s.mu.Lock()
 	if !s.running {
 		s.mu.Unlock()
 		s.logger.Println("Stop called but server is not running")
-		return nil
+		return 0, nil
 	}
 
 	s.logger.Println("Stopping server...")
 	s.running = false
 	listener := s.listener
+	cancelWrites := s.cancelWrites
+	close(s.done)
+	s.queue.close()
+	conns := make([]net.Conn, 0, len(s.conns))
+	for conn := range s.conns {
+		conns = append(conns, conn)
+	}
 	s.mu.Unlock()
 
 	if listener != nil {
 		s.logger.Println("Closing listener...")
 		listener.Close()
 	}
+	s.closeControl()
+
+	// Unblock handlers still waiting on idle clients, they drain and
+	// report whatever the client had in flight before closing
+	for _, conn := range conns {
+		conn.SetReadDeadline(time.Now())
+	}
 
 	// Wait for all connections to finish
 	s.logger.Println("Waiting for active connections to close...")
-	s.wg.Wait()
+	finished := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(finished)
+	}()
+	if grace > 0 {
+		select {
+		case <-finished:
+		case <-s.clock.After(grace):
+			s.logger.Printf("Still busy after %s, interrupting in-flight writes", grace)
+			cancelWrites()
+			<-finished
+		}
+	} else {
+		<-finished
+	}
+	cancelWrites()
 	s.logger.Println("All connections closed")
 
+	s.mu.Lock()
+	interrupted := s.interruptedWrites
+	s.writeCtx = nil
+	s.mu.Unlock()
+	if interrupted > 0 {
+		s.logger.Printf("Interrupted %d in-flight writes", interrupted)
+	}
+
 	// Close the adapter
-	if s.adapter.IsOpen() {
+	if device := s.printer(); device.IsOpen() {
 		s.logger.Println("Closing printer adapter...")
-		err := s.adapter.Close()
+		err := device.Close()
 		if err != nil {
 			s.logger.Printf("Error closing adapter: %v", err)
-			return err
+			return interrupted, err
 		}
 		s.logger.Println("Printer adapter closed")
 	}
 
 	s.logger.Println("Server stopped successfully")
-	return nil
+	return interrupted, nil
+}
+
+// SetHandshakeTimeout sets the deadline for a client's first frame (auth
+// token, protocol header, or the first chunk of raw data). Once the first
+// frame arrives the read timeout applies. Zero disables the handshake deadline.
+func (s *Server) SetHandshakeTimeout(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handshakeTimeout = d
+}
+
+// SetReadTimeout sets the idle timeout applied to each read after the
+// handshake. Zero disables the idle timeout.
+func (s *Server) SetReadTimeout(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.readTimeout = d
+}
+
+// OnJobComplete sets a callback invoked when a client's connection ends,
+// reporting how much of its data reached the printer
+func (s *Server) OnJobComplete(handler func(JobResult)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onJobComplete = handler
 }
 
 // IsRunning returns whether the server is running
@@ -247,10 +903,32 @@ func (s *Server) IsRunning() bool {
 
 // Address returns the server address
 func (s *Server) Address() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	return s.address
 }
 
+// BoundAddress returns the address the server is listening on, including
+// the port the system picked when the configured address uses port 0. It
+// returns "" while the server is not running.
+func (s *Server) BoundAddress() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.running || s.listener == nil {
+		return ""
+	}
+	return s.listener.Addr().String()
+}
+
 // GetAdapter returns the underlying adapter
 func (s *Server) GetAdapter() adapter.Adapter {
+	return s.printer()
+}
+
+// printer returns the current adapter
+func (s *Server) printer() adapter.Adapter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	return s.adapter
 }
@@ -1,7 +1,10 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"github.com/nixxel-company-limited/escpos-usb-server/adapter"
+	"io"
 	"net"
 	"testing"
 	"time"
@@ -14,6 +17,8 @@ import (
 type MockAdapter struct {
 	open      bool
 	writeData []byte
+	// failAfter makes writes fail once this many bytes were written (0 = never)
+	failAfter int
 }
 
 func (m *MockAdapter) Open() error {
@@ -22,6 +27,9 @@ func (m *MockAdapter) Open() error {
 }
 
 func (m *MockAdapter) Write(data []byte) (int, error) {
+	if m.failAfter > 0 && len(m.writeData) >= m.failAfter {
+		return 0, errors.New("mock write failure")
+	}
 	m.writeData = append(m.writeData, data...)
 	return len(data), nil
 }
@@ -53,9 +61,8 @@ func TestNewServer(t *testing.T) {
 
 func TestServerStartStop(t *testing.T) {
 	mockAdapter := &MockAdapter{}
-	address := "localhost:9101"
 
-	server := New(mockAdapter, address)
+	server := New(mockAdapter, "127.0.0.1:0")
 
 	// Test start async (non-blocking)
 	err := server.StartAsync()
@@ -74,6 +81,8 @@ func TestServerStartStop(t *testing.T) {
 	assert.False(t, server.IsRunning())
 	assert.False(t, mockAdapter.IsOpen())
 
+	assert.Empty(t, server.BoundAddress())
+
 	// Test double stop (should not error)
 	err = server.Stop()
 	assert.NoError(t, err)
@@ -81,12 +90,12 @@ func TestServerStartStop(t *testing.T) {
 
 func TestServerConnection(t *testing.T) {
 	mockAdapter := &MockAdapter{}
-	address := "localhost:9102"
 
-	server := New(mockAdapter, address)
+	server := New(mockAdapter, "127.0.0.1:0")
 
 	err := server.StartAsync()
 	require.NoError(t, err)
+	address := server.BoundAddress()
 	defer server.Stop()
 
 	// Give server time to start
@@ -112,12 +121,12 @@ func TestServerConnection(t *testing.T) {
 
 func TestServerMultipleConnections(t *testing.T) {
 	mockAdapter := &MockAdapter{}
-	address := "localhost:9103"
 
-	server := New(mockAdapter, address)
+	server := New(mockAdapter, "127.0.0.1:0")
 
 	err := server.StartAsync()
 	require.NoError(t, err)
+	address := server.BoundAddress()
 	defer server.Stop()
 
 	// Give server time to start
@@ -154,11 +163,11 @@ func TestServerWithRealUSBAdapter(t *testing.T) {
 	}
 	defer usbAdapter.Close()
 
-	address := "localhost:9104"
-	server := New(usbAdapter, address)
+	server := New(usbAdapter, "127.0.0.1:0")
 
 	err = server.StartAsync()
 	require.NoError(t, err)
+	address := server.BoundAddress()
 	defer server.Stop()
 
 	// Give server time to start
@@ -206,9 +215,8 @@ func TestServerInvalidAddress(t *testing.T) {
 
 func TestServerStartBlocking(t *testing.T) {
 	mockAdapter := &MockAdapter{}
-	address := "localhost:9105"
 
-	server := New(mockAdapter, address)
+	server := New(mockAdapter, "127.0.0.1:0")
 
 	// Start server in a goroutine since it blocks
 	started := make(chan error)
@@ -223,7 +231,7 @@ func TestServerStartBlocking(t *testing.T) {
 	assert.True(t, server.IsRunning())
 
 	// Connect to server
-	conn, err := net.Dial("tcp", address)
+	conn, err := net.Dial("tcp", server.BoundAddress())
 	require.NoError(t, err)
 	defer conn.Close()
 
@@ -247,3 +255,409 @@ func TestServerStartBlocking(t *testing.T) {
 		t.Fatal("Start() did not return after Stop()")
 	}
 }
+
+func TestServerHandshakeTimeout(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+
+	server := New(mockAdapter, "127.0.0.1:0")
+	server.SetHandshakeTimeout(200 * time.Millisecond)
+
+	err := server.StartAsync()
+	require.NoError(t, err)
+	address := server.BoundAddress()
+	defer server.Stop()
+
+	// Give server time to start
+	time.Sleep(100 * time.Millisecond)
+
+	// Connect but never send the handshake
+	conn, err := net.Dial("tcp", address)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	start := time.Now()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	// The server should drop us once the handshake deadline passes
+	buf := make([]byte, 1)
+	_, err = conn.Read(buf)
+	assert.ErrorIs(t, err, io.EOF)
+	assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Empty(t, mockAdapter.writeData)
+}
+
+func TestServerHandshakeTimeoutOnlyFirstFrame(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+
+	server := New(mockAdapter, "127.0.0.1:0")
+	server.SetHandshakeTimeout(100 * time.Millisecond)
+	server.SetReadTimeout(time.Second)
+
+	err := server.StartAsync()
+	require.NoError(t, err)
+	address := server.BoundAddress()
+	defer server.Stop()
+
+	// Give server time to start
+	time.Sleep(100 * time.Millisecond)
+
+	conn, err := net.Dial("tcp", address)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// Send the first frame within the handshake deadline
+	_, err = conn.Write([]byte("first"))
+	require.NoError(t, err)
+
+	// Stay idle longer than the handshake timeout but within the read timeout
+	time.Sleep(300 * time.Millisecond)
+
+	_, err = conn.Write([]byte("second"))
+	require.NoError(t, err)
+
+	// Give server time to process
+	time.Sleep(100 * time.Millisecond)
+
+	assert.Equal(t, []byte("firstsecond"), mockAdapter.writeData)
+}
+
+func TestServerReportsDroppedBytes(t *testing.T) {
+	mockAdapter := &MockAdapter{failAfter: 5}
+
+	server := New(mockAdapter, "127.0.0.1:0")
+
+	results := make(chan JobResult, 1)
+	server.OnJobComplete(func(r JobResult) {
+		results <- r
+	})
+
+	err := server.StartAsync()
+	require.NoError(t, err)
+	address := server.BoundAddress()
+	defer server.Stop()
+
+	// Give server time to start
+	time.Sleep(100 * time.Millisecond)
+
+	conn, err := net.Dial("tcp", address)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// First chunk reaches the printer
+	_, err = conn.Write([]byte("hello"))
+	require.NoError(t, err)
+	time.Sleep(100 * time.Millisecond)
+
+	// The printer fails mid-job, everything after is dropped
+	_, err = conn.Write([]byte("world!"))
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("more"))
+	require.NoError(t, err)
+
+	select {
+	case r := <-results:
+		assert.True(t, r.Partial)
+		assert.Equal(t, 5, r.BytesWritten)
+		assert.Equal(t, 10, r.BytesDropped)
+		assert.Equal(t, 15, r.BytesReceived)
+		assert.Error(t, r.Err)
+	case <-time.After(time.Second):
+		t.Fatal("job result was not reported")
+	}
+	assert.Equal(t, []byte("hello"), mockAdapter.writeData)
+}
+
+func TestServerReportsCompleteJob(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+
+	server := New(mockAdapter, "127.0.0.1:0")
+
+	results := make(chan JobResult, 1)
+	server.OnJobComplete(func(r JobResult) {
+		results <- r
+	})
+
+	err := server.StartAsync()
+	require.NoError(t, err)
+	address := server.BoundAddress()
+	defer server.Stop()
+
+	// Give server time to start
+	time.Sleep(100 * time.Millisecond)
+
+	conn, err := net.Dial("tcp", address)
+	require.NoError(t, err)
+
+	_, err = conn.Write([]byte("receipt"))
+	require.NoError(t, err)
+	time.Sleep(100 * time.Millisecond)
+	conn.Close()
+
+	select {
+	case r := <-results:
+		assert.False(t, r.Partial)
+		assert.Equal(t, 7, r.BytesWritten)
+		assert.Equal(t, 0, r.BytesDropped)
+		assert.NoError(t, r.Err)
+	case <-time.After(time.Second):
+		t.Fatal("job result was not reported")
+	}
+}
+
+func TestServerServe(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	server := New(mockAdapter, "")
+
+	served := make(chan error)
+	go func() {
+		served <- server.Serve(listener)
+	}()
+
+	require.Eventually(t, server.IsRunning, time.Second, 10*time.Millisecond)
+	assert.Equal(t, listener.Addr().String(), server.Address())
+	assert.True(t, mockAdapter.IsOpen())
+
+	// Serving twice is rejected like a double Start
+	assert.Error(t, server.Serve(listener))
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("socket activated"))
+	require.NoError(t, err)
+	conn.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	require.NoError(t, server.Stop())
+
+	select {
+	case err := <-served:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Serve() did not return after Stop()")
+	}
+	assert.Equal(t, []byte("socket activated"), mockAdapter.writeData)
+}
+
+// stallingAdapter is a MockAdapter whose context-aware writes block until
+// their context is done
+type stallingAdapter struct {
+	MockAdapter
+	started chan struct{}
+}
+
+func (a *stallingAdapter) WriteContext(ctx context.Context, data []byte) (int, error) {
+	close(a.started)
+	<-ctx.Done()
+	return 0, ctx.Err()
+}
+
+type connKey struct{}
+
+func TestServerConnContextCancelsWrite(t *testing.T) {
+	stalling := &stallingAdapter{started: make(chan struct{})}
+
+	server := New(stalling, "127.0.0.1:0")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var seen net.Conn
+	server.SetConnContext(func(_ context.Context, c net.Conn) context.Context {
+		seen = c
+		return context.WithValue(ctx, connKey{}, "request-1")
+	})
+
+	results := make(chan JobResult, 1)
+	server.OnJobComplete(func(r JobResult) {
+		results <- r
+	})
+
+	require.NoError(t, server.StartAsync())
+	address := server.BoundAddress()
+	defer server.Stop()
+
+	conn, err := net.Dial("tcp", address)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("receipt"))
+	require.NoError(t, err)
+
+	select {
+	case <-stalling.started:
+	case <-time.After(time.Second):
+		t.Fatal("write did not start")
+	}
+	cancel()
+
+	select {
+	case r := <-results:
+		assert.ErrorIs(t, r.Err, context.Canceled)
+		assert.Zero(t, r.BytesWritten)
+		assert.Equal(t, 7, r.BytesDropped)
+	case <-time.After(time.Second):
+		t.Fatal("cancelled write was not reported")
+	}
+	assert.NotNil(t, seen)
+}
+
+func TestServerStopWithTimeoutInterruptsWrite(t *testing.T) {
+	stalling := &stallingAdapter{started: make(chan struct{})}
+	server := New(stalling, "127.0.0.1:0")
+
+	results := make(chan JobResult, 1)
+	server.OnJobComplete(func(r JobResult) {
+		results <- r
+	})
+
+	require.NoError(t, server.StartAsync())
+
+	conn, err := net.Dial("tcp", server.BoundAddress())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("receipt"))
+	require.NoError(t, err)
+
+	select {
+	case <-stalling.started:
+	case <-time.After(time.Second):
+		t.Fatal("write did not start")
+	}
+
+	start := time.Now()
+	interrupted, err := server.StopWithTimeout(50 * time.Millisecond)
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, 1, interrupted)
+	assert.False(t, server.IsRunning())
+
+	r := <-results
+	assert.ErrorIs(t, r.Err, ErrServerStopped)
+	assert.Equal(t, 7, r.BytesDropped)
+}
+
+func TestServerStopWithTimeoutIdle(t *testing.T) {
+	server := New(&MockAdapter{}, "127.0.0.1:0")
+	require.NoError(t, server.StartAsync())
+
+	interrupted, err := server.StopWithTimeout(time.Second)
+	require.NoError(t, err)
+	assert.Zero(t, interrupted)
+}
+
+func TestServerBoundAddress(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+	server := New(mockAdapter, "127.0.0.1:0")
+	assert.Empty(t, server.BoundAddress())
+
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	address := server.BoundAddress()
+	host, port, err := net.SplitHostPort(address)
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1", host)
+	assert.NotEqual(t, "0", port)
+
+	results := make(chan JobResult, 1)
+	server.OnJobComplete(func(r JobResult) {
+		results <- r
+	})
+
+	conn, err := net.Dial("tcp", address)
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("port zero"))
+	require.NoError(t, err)
+	conn.Close()
+
+	select {
+	case r := <-results:
+		assert.Equal(t, 9, r.BytesWritten)
+	case <-time.After(time.Second):
+		t.Fatal("job result was not reported")
+	}
+	assert.Equal(t, []byte("port zero"), mockAdapter.writeData)
+}
+
+// scriptedConn is a net.Conn whose reads return scripted chunks, then
+// io.EOF. A nil chunk is a read returning no data and no error; with
+// emptyForever set, reads keep returning nothing once the script ends.
+type scriptedConn struct {
+	net.Conn
+	chunks       [][]byte
+	emptyForever bool
+	reads        int
+}
+
+func (c *scriptedConn) Read(b []byte) (int, error) {
+	c.reads++
+	if len(c.chunks) == 0 {
+		if c.emptyForever {
+			return 0, nil
+		}
+		return 0, io.EOF
+	}
+	chunk := c.chunks[0]
+	c.chunks = c.chunks[1:]
+	return copy(b, chunk), nil
+}
+
+func (c *scriptedConn) Write(b []byte) (int, error) { return len(b), nil }
+func (c *scriptedConn) Close() error                { return nil }
+func (c *scriptedConn) RemoteAddr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 4242}
+}
+func (c *scriptedConn) SetReadDeadline(time.Time) error    { return nil }
+func (c *scriptedConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// serveScripted runs handleConnection on conn on a started server and
+// returns the job result
+func serveScripted(t *testing.T, server *Server, conn net.Conn) JobResult {
+	t.Helper()
+	results := make(chan JobResult, 1)
+	server.OnJobComplete(func(r JobResult) {
+		results <- r
+	})
+	require.NoError(t, server.StartAsync())
+	t.Cleanup(func() { server.Stop() })
+
+	server.wg.Add(1)
+	go server.handleConnection(conn)
+
+	select {
+	case r := <-results:
+		return r
+	case <-time.After(time.Second):
+		t.Fatal("connection was not handled")
+		return JobResult{}
+	}
+}
+
+func TestServerEmptyReadThenData(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+	server := New(mockAdapter, "127.0.0.1:0")
+	conn := &scriptedConn{chunks: [][]byte{nil, nil, []byte("receipt")}}
+
+	result := serveScripted(t, server, conn)
+
+	assert.NoError(t, result.Err)
+	assert.Equal(t, 7, result.BytesReceived)
+	assert.Equal(t, []byte("receipt"), mockAdapter.writeData)
+	// Two empty reads, the data, then EOF
+	assert.Equal(t, 4, conn.reads)
+}
+
+func TestServerEmptyReadsGiveUp(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+	server := New(mockAdapter, "127.0.0.1:0")
+	conn := &scriptedConn{chunks: [][]byte{[]byte("receipt")}, emptyForever: true}
+
+	result := serveScripted(t, server, conn)
+
+	assert.ErrorIs(t, result.Err, io.ErrNoProgress)
+	assert.Equal(t, []byte("receipt"), mockAdapter.writeData)
+	assert.Equal(t, 1+maxEmptyReads, conn.reads)
+}
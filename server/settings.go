@@ -0,0 +1,42 @@
+package server
+
+import "time"
+
+// Settings holds the server configuration that is safe to change while the
+// server is running. The listen address is not included: changing it needs a
+// new listener.
+type Settings struct {
+	HandshakeTimeout     time.Duration
+	ReadTimeout          time.Duration
+	MaxDecompressedBytes int64
+	InterJobDelay        time.Duration
+}
+
+// Settings returns the current runtime settings
+func (s *Server) Settings() Settings {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return Settings{
+		HandshakeTimeout:     s.handshakeTimeout,
+		ReadTimeout:          s.readTimeout,
+		MaxDecompressedBytes: s.maxDecompressedBytes,
+		InterJobDelay:        s.interJobDelay,
+	}
+}
+
+// ApplySettings atomically replaces the runtime settings, e.g. after a
+// SIGHUP config reload. The adapter stays open and active connections are
+// kept; they pick up the new timeouts on their next read.
+func (s *Server) ApplySettings(settings Settings) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.handshakeTimeout = settings.HandshakeTimeout
+	s.readTimeout = settings.ReadTimeout
+	s.maxDecompressedBytes = settings.MaxDecompressedBytes
+	s.interJobDelay = settings.InterJobDelay
+
+	s.logger.Printf("Settings applied: handshake timeout %v, read timeout %v, max decompressed bytes %d, inter-job delay %v",
+		settings.HandshakeTimeout, settings.ReadTimeout, settings.MaxDecompressedBytes, settings.InterJobDelay)
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerApplySettings(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+	server := New(mockAdapter, "localhost:0")
+
+	settings := Settings{
+		HandshakeTimeout:     time.Second,
+		ReadTimeout:          5 * time.Second,
+		MaxDecompressedBytes: 1024,
+		InterJobDelay:        250 * time.Millisecond,
+	}
+	server.ApplySettings(settings)
+
+	assert.Equal(t, settings, server.Settings())
+}
+
+func TestServerReloadWhileRunning(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+
+	server := New(mockAdapter, "127.0.0.1:0")
+
+	err := server.StartAsync()
+	require.NoError(t, err)
+	address := server.BoundAddress()
+	defer server.Stop()
+
+	// Give server time to start
+	time.Sleep(100 * time.Millisecond)
+
+	// Reload with a short idle timeout while running
+	server.ApplySettings(Settings{ReadTimeout: 200 * time.Millisecond})
+	assert.True(t, server.IsRunning())
+	assert.True(t, mockAdapter.IsOpen())
+
+	conn, err := net.Dial("tcp", address)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("job"))
+	require.NoError(t, err)
+
+	// The reloaded idle timeout closes the connection
+	start := time.Now()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, []byte("job"), mockAdapter.writeData)
+}
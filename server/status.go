@@ -0,0 +1,181 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/nixxel-company-limited/escpos-usb-server/adapter"
+	"github.com/nixxel-company-limited/escpos-usb-server/escpos"
+)
+
+// PaperStatusSource is implemented by adapters that can report the paper
+// roll sensor (DLE EOT 4), such as adapter.USBAdapter
+type PaperStatusSource interface {
+	QueryPaperStatus() (byte, error)
+}
+
+// StatusQuerier is implemented by adapters that answer real-time status
+// requests (DLE EOT n), such as adapter.USBAdapter
+type StatusQuerier interface {
+	QueryStatus(n byte) (byte, error)
+}
+
+// errStatusUnsupported is returned when the adapter cannot report status
+var errStatusUnsupported = errors.New("adapter cannot report status")
+
+// PrinterStatus holds the decoded printer, offline and paper status flags
+type PrinterStatus struct {
+	Offline      bool `json:"offline"`
+	DrawerOpen   bool `json:"drawer_open"`
+	CoverOpen    bool `json:"cover_open"`
+	PaperFeeding bool `json:"paper_feeding"`
+	Error        bool `json:"error"`
+	PaperNearEnd bool `json:"paper_near_end"`
+	PaperEnd     bool `json:"paper_end"`
+}
+
+// queryPrinterStatus queries and decodes DLE EOT 1, 2 and 4
+func (s *Server) queryPrinterStatus() (PrinterStatus, error) {
+	querier, ok := s.printer().(StatusQuerier)
+	if !ok {
+		return PrinterStatus{}, errStatusUnsupported
+	}
+
+	var raw [3]byte
+	for i, n := range []byte{adapter.StatusPrinter, adapter.StatusOffline, adapter.StatusPaper} {
+		b, err := querier.QueryStatus(n)
+		if err != nil {
+			return PrinterStatus{}, err
+		}
+		raw[i] = b
+	}
+	printer := escpos.ParsePrinterStatus(raw[0])
+	offline := escpos.ParseOfflineStatus(raw[1])
+	paper := escpos.ParsePaperStatus(raw[2])
+
+	return PrinterStatus{
+		Offline:      printer.Offline,
+		DrawerOpen:   printer.DrawerOpen,
+		CoverOpen:    offline.CoverOpen,
+		PaperFeeding: offline.PaperFeeding,
+		Error:        offline.Error,
+		PaperNearEnd: paper.PaperNearEnd,
+		PaperEnd:     paper.PaperEnd,
+	}, nil
+}
+
+// PaperStatus is a cached paper sensor reading
+type PaperStatus struct {
+	// Raw is the DLE EOT 4 response byte
+	Raw byte `json:"raw"`
+	// NearEnd is set when the roll near-end sensor is triggered
+	NearEnd bool `json:"near_end"`
+	// End is set when the printer is out of paper
+	End       bool      `json:"end"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// clock abstracts time so background pollers can be tested
+type clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// SetPaperPollInterval enables a low-frequency background poll of the paper
+// sensor, so status requests are served from cache instead of querying the
+// printer each time. Zero (the default) disables polling. Takes effect on the
+// next Start.
+func (s *Server) SetPaperPollInterval(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paperPollInterval = d
+}
+
+// PaperStatus returns the last cached paper status, if any
+func (s *Server) PaperStatus() (PaperStatus, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.paperStatus == nil {
+		return PaperStatus{}, false
+	}
+	return *s.paperStatus, true
+}
+
+// pollPaperStatus refreshes the cached paper status every interval until
+// done is closed. Polling stops if the printer cannot be read from. The
+// adapter is looked up on every poll so a swapped printer is polled.
+func (s *Server) pollPaperStatus(interval time.Duration, done <-chan struct{}) {
+	defer s.wg.Done()
+
+	for {
+		source, ok := s.printer().(PaperStatusSource)
+		if !ok {
+			s.logger.Println("Paper status polling disabled: adapter cannot report status")
+			return
+		}
+
+		raw, err := source.QueryPaperStatus()
+		if errors.Is(err, adapter.ErrNoInEndpoint) {
+			s.logger.Println("Paper status polling disabled: printer has no IN endpoint")
+			return
+		}
+		if err != nil {
+			s.logger.Printf("Error polling paper status: %v", err)
+		} else {
+			paper := escpos.ParsePaperStatus(raw)
+			status := PaperStatus{
+				Raw:       raw,
+				NearEnd:   paper.PaperNearEnd,
+				End:       paper.PaperEnd,
+				UpdatedAt: s.clock.Now(),
+			}
+			s.mu.Lock()
+			s.paperStatus = &status
+			s.mu.Unlock()
+		}
+
+		select {
+		case <-done:
+			return
+		case <-s.clock.After(interval):
+		}
+	}
+}
+
+// handleStatus reports the cached printer status
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	type paperResponse struct {
+		PaperStatus
+		AgeSeconds float64 `json:"age_seconds"`
+	}
+	response := struct {
+		Running     bool             `json:"running"`
+		Open        bool             `json:"open"`
+		JobTimeouts int              `json:"job_timeouts"`
+		Paper       *paperResponse   `json:"paper"`
+		USB         adapter.USBStack `json:"usb"`
+	}{
+		Running:     s.IsRunning(),
+		Open:        s.printer().IsOpen(),
+		JobTimeouts: s.JobTimeouts(),
+		USB:         adapter.BackendInfo(),
+	}
+
+	if status, ok := s.PaperStatus(); ok {
+		response.Paper = &paperResponse{
+			PaperStatus: status,
+			AgeSeconds:  s.clock.Now().Sub(status.UpdatedAt).Seconds(),
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nixxel-company-limited/escpos-usb-server/adapter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock is a manually advanced clock
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+}
+
+type fakeWaiter struct {
+	deadline time.Time
+	ch       chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ch := make(chan time.Time, 1)
+	c.waiters = append(c.waiters, fakeWaiter{deadline: c.now.Add(d), ch: ch})
+	return ch
+}
+
+// Advance moves the clock forward, firing any timers that expire
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+	remaining := c.waiters[:0]
+	for _, w := range c.waiters {
+		if !w.deadline.After(c.now) {
+			w.ch <- c.now
+		} else {
+			remaining = append(remaining, w)
+		}
+	}
+	c.waiters = remaining
+}
+
+// Waiters returns the number of pending timers
+func (c *fakeClock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
+
+// statusAdapter is a MockAdapter that also reports paper status
+type statusAdapter struct {
+	MockAdapter
+	mu      sync.Mutex
+	status  byte
+	queries int
+}
+
+func (a *statusAdapter) QueryPaperStatus() (byte, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.queries++
+	return a.status, nil
+}
+
+func (a *statusAdapter) Queries() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.queries
+}
+
+func TestServerPaperStatusPolling(t *testing.T) {
+	statusMock := &statusAdapter{status: 0x0C}
+	clk := newFakeClock()
+
+	server := New(statusMock, "127.0.0.1:0")
+	server.clock = clk
+	server.SetPaperPollInterval(10 * time.Second)
+
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	// The first poll happens at startup
+	require.Eventually(t, func() bool { return clk.Waiters() == 1 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, 1, statusMock.Queries())
+
+	status, ok := server.PaperStatus()
+	require.True(t, ok)
+	assert.True(t, status.NearEnd)
+	assert.False(t, status.End)
+	assert.Equal(t, clk.Now(), status.UpdatedAt)
+
+	// Nothing happens before the interval elapses
+	clk.Advance(5 * time.Second)
+	assert.Equal(t, 1, statusMock.Queries())
+
+	// The paper runs out and the next poll picks it up
+	statusMock.mu.Lock()
+	statusMock.status = 0x6C
+	statusMock.mu.Unlock()
+
+	clk.Advance(5 * time.Second)
+	require.Eventually(t, func() bool { return clk.Waiters() == 1 && statusMock.Queries() == 2 }, time.Second, 5*time.Millisecond)
+
+	status, ok = server.PaperStatus()
+	require.True(t, ok)
+	assert.True(t, status.End)
+	assert.Equal(t, clk.Now(), status.UpdatedAt)
+}
+
+func TestServerPaperStatusPollingUnsupported(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+
+	server := New(mockAdapter, "127.0.0.1:0")
+	server.SetPaperPollInterval(time.Millisecond)
+
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	time.Sleep(50 * time.Millisecond)
+
+	_, ok := server.PaperStatus()
+	assert.False(t, ok)
+}
+
+func TestHTTPStatusReportsCachedPaperAge(t *testing.T) {
+	statusMock := &statusAdapter{}
+	clk := newFakeClock()
+
+	server := New(statusMock, "localhost:0")
+	server.clock = clk
+	server.paperStatus = &PaperStatus{Raw: 0x00, UpdatedAt: clk.Now()}
+	clk.Advance(30 * time.Second)
+
+	rec := httptest.NewRecorder()
+	server.HTTPHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var body struct {
+		Paper struct {
+			End        bool    `json:"end"`
+			AgeSeconds float64 `json:"age_seconds"`
+		} `json:"paper"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.False(t, body.Paper.End)
+	assert.Equal(t, 30.0, body.Paper.AgeSeconds)
+
+	// The cached value is served without querying the printer
+	assert.Equal(t, 0, statusMock.Queries())
+}
+
+func TestHTTPStatusReportsUSBStack(t *testing.T) {
+	server := New(&MockAdapter{}, "localhost:0")
+
+	rec := httptest.NewRecorder()
+	server.HTTPHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var body struct {
+		USB adapter.USBStack `json:"usb"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, adapter.BackendInfo(), body.USB)
+}
@@ -0,0 +1,219 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// StoredJob is a queued job as persisted by a JobStore
+type StoredJob struct {
+	// ID is assigned by the store on Save
+	ID       string `json:"-"`
+	Priority int    `json:"priority"`
+	Data     []byte `json:"data"`
+}
+
+// JobStore persists queued jobs so they survive a crash. Jobs are saved when
+// queued and deleted once they were written to the printer; anything left in
+// the store is replayed on the next Start.
+type JobStore interface {
+	// Save persists a job and returns its ID
+	Save(job StoredJob) (string, error)
+	// Load returns all pending jobs, oldest first
+	Load() ([]StoredJob, error)
+	// Delete removes a job once it was written
+	Delete(id string) error
+}
+
+// jobFileExt is the extension of job files in a FileJobStore
+const jobFileExt = ".job"
+
+// FileJobStore is a JobStore keeping one file per pending job in a directory
+type FileJobStore struct {
+	dir string
+	mu  sync.Mutex
+	seq uint64
+}
+
+// NewFileJobStore creates a store in dir, creating the directory if needed
+func NewFileJobStore(dir string) (*FileJobStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create job store: %w", err)
+	}
+
+	store := &FileJobStore{dir: dir}
+
+	// Continue numbering after the jobs already on disk
+	ids, err := store.ids()
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) > 0 {
+		store.seq, _ = strconv.ParseUint(ids[len(ids)-1], 10, 64)
+	}
+
+	return store, nil
+}
+
+// Save writes the job to a new file, via a temp file so a crash never leaves
+// a partial job behind
+func (f *FileJobStore) Save(job StoredJob) (string, error) {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode job: %w", err)
+	}
+
+	f.mu.Lock()
+	f.seq++
+	// Zero padded so lexical order matches save order
+	id := fmt.Sprintf("%020d", f.seq)
+	f.mu.Unlock()
+
+	tmp, err := os.CreateTemp(f.dir, "tmp-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to save job: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("failed to save job: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("failed to save job: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("failed to save job: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), f.path(id)); err != nil {
+		return "", fmt.Errorf("failed to save job: %w", err)
+	}
+
+	return id, nil
+}
+
+// Load reads all pending jobs in the order they were saved
+func (f *FileJobStore) Load() ([]StoredJob, error) {
+	ids, err := f.ids()
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]StoredJob, 0, len(ids))
+	for _, id := range ids {
+		data, err := os.ReadFile(f.path(id))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load job %s: %w", id, err)
+		}
+		var job StoredJob
+		if err := json.Unmarshal(data, &job); err != nil {
+			return nil, fmt.Errorf("failed to decode job %s: %w", id, err)
+		}
+		job.ID = id
+		jobs = append(jobs, job)
+	}
+
+	return jobs, nil
+}
+
+// Delete removes a job file. Deleting an unknown job is not an error.
+func (f *FileJobStore) Delete(id string) error {
+	err := os.Remove(f.path(id))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete job %s: %w", id, err)
+	}
+	return nil
+}
+
+func (f *FileJobStore) path(id string) string {
+	return filepath.Join(f.dir, id+jobFileExt)
+}
+
+// ids lists the IDs of the job files in the store, oldest first
+func (f *FileJobStore) ids() ([]string, error) {
+	entries, err := os.ReadDir(f.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read job store: %w", err)
+	}
+
+	var ids []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, jobFileExt) {
+			continue
+		}
+		ids = append(ids, strings.TrimSuffix(name, jobFileExt))
+	}
+	sort.Strings(ids)
+
+	return ids, nil
+}
+
+// SetJobStore persists queued jobs to store so they are replayed after a
+// crash. Takes effect on the next Start.
+func (s *Server) SetJobStore(store JobStore) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobStore = store
+}
+
+// replayJobs queues the jobs left in the store by a previous run. Callers
+// must hold s.mu.
+func (s *Server) replayJobs(q *jobQueue) {
+	jobs, err := s.jobStore.Load()
+	if err != nil {
+		s.logger.Printf("Error loading stored jobs: %v", err)
+		return
+	}
+	if len(jobs) == 0 {
+		return
+	}
+
+	s.logger.Printf("Replaying %d stored jobs", len(jobs))
+	for _, stored := range jobs {
+		j := &job{
+			ctx:      context.Background(),
+			data:     stored.Data,
+			priority: stored.Priority,
+			storeID:  stored.ID,
+			queuedAt: s.clock.Now(),
+			done:     make(chan jobOutcome, 1),
+		}
+		if err := q.push(j, 0); err != nil {
+			s.logger.Printf("Error replaying stored job %s: %v", stored.ID, err)
+		}
+	}
+}
+
+// persistJob saves a newly queued job to the store, if one is set
+func (s *Server) persistJob(store JobStore, j *job) error {
+	if store == nil {
+		return nil
+	}
+	id, err := store.Save(StoredJob{Priority: j.priority, Data: j.data})
+	if err != nil {
+		return err
+	}
+	j.storeID = id
+	return nil
+}
+
+// forgetJob removes a finished job from the store
+func (s *Server) forgetJob(store JobStore, j *job) {
+	if store == nil || j.storeID == "" {
+		return
+	}
+	if err := store.Delete(j.storeID); err != nil {
+		s.logger.Printf("Error deleting stored job: %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// brokenAdapter is a MockAdapter whose writes always fail, standing in for a
+// printer that went away before the process crashed
+type brokenAdapter struct {
+	MockAdapter
+}
+
+func (a *brokenAdapter) Write(data []byte) (int, error) {
+	return 0, errors.New("printer unavailable")
+}
+
+func TestFileJobStore(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := NewFileJobStore(dir)
+	require.NoError(t, err)
+
+	first, err := store.Save(StoredJob{Data: []byte("first")})
+	require.NoError(t, err)
+	second, err := store.Save(StoredJob{Priority: 3, Data: []byte("second")})
+	require.NoError(t, err)
+
+	jobs, err := store.Load()
+	require.NoError(t, err)
+	assert.Equal(t, []StoredJob{
+		{ID: first, Data: []byte("first")},
+		{ID: second, Priority: 3, Data: []byte("second")},
+	}, jobs)
+
+	require.NoError(t, store.Delete(first))
+	require.NoError(t, store.Delete(first))
+
+	// A reopened store keeps numbering after existing jobs
+	reopened, err := NewFileJobStore(dir)
+	require.NoError(t, err)
+	third, err := reopened.Save(StoredJob{Data: []byte("third")})
+	require.NoError(t, err)
+	assert.Greater(t, third, second)
+
+	jobs, err = reopened.Load()
+	require.NoError(t, err)
+	require.Len(t, jobs, 2)
+	assert.Equal(t, []byte("second"), jobs[0].Data)
+	assert.Equal(t, []byte("third"), jobs[1].Data)
+}
+
+func TestServerJobStoreReplay(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	// First run: the printer is gone, so no job is confirmed written
+	store, err := NewFileJobStore(dir)
+	require.NoError(t, err)
+
+	crashed := New(&brokenAdapter{}, "127.0.0.1:0")
+	crashed.SetJobStore(store)
+	require.NoError(t, crashed.StartAsync())
+	require.NoError(t, crashed.Submit(ctx, []byte("one ")))
+	require.NoError(t, crashed.Submit(ctx, []byte("two ")))
+	require.NoError(t, crashed.Submit(ctx, []byte("three")))
+	require.NoError(t, crashed.Stop())
+
+	jobs, err := store.Load()
+	require.NoError(t, err)
+	require.Len(t, jobs, 3)
+
+	// Second run replays the stored jobs in order and clears the store
+	store, err = NewFileJobStore(dir)
+	require.NoError(t, err)
+
+	mockAdapter := &MockAdapter{}
+	restarted := New(mockAdapter, "127.0.0.1:0")
+	restarted.SetJobStore(store)
+	require.NoError(t, restarted.StartAsync())
+
+	require.Eventually(t, func() bool {
+		jobs, err := store.Load()
+		return err == nil && len(jobs) == 0
+	}, time.Second, 10*time.Millisecond)
+	require.NoError(t, restarted.Stop())
+
+	assert.Equal(t, []byte("one two three"), mockAdapter.writeData)
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/nixxel-company-limited/escpos-usb-server/adapter"
+)
+
+// SwapAdapter replaces the printer, e.g. after a config reload selected a
+// different one, without restarting the server. Writes in flight finish on
+// the old adapter and new ones, including queued jobs, wait until the swap
+// is done. On a running server the old adapter is closed and the new one
+// opened; if the new one cannot be opened the old one is reopened and
+// kept, and the error is returned.
+func (s *Server) SwapAdapter(device adapter.Adapter) error {
+	s.swapMu.Lock()
+	defer s.swapMu.Unlock()
+
+	s.mu.Lock()
+	old := s.adapter
+	running := s.running
+	s.mu.Unlock()
+
+	if device == old {
+		return nil
+	}
+
+	if running {
+		s.logger.Println("Swapping printer adapter...")
+		if old.IsOpen() {
+			if err := old.Close(); err != nil {
+				s.logger.Printf("Error closing old adapter: %v", err)
+			}
+		}
+		if err := adapter.OpenIfNeeded(device); err != nil {
+			s.logger.Printf("Error opening new adapter, keeping the old one: %v", err)
+			if reopenErr := adapter.OpenIfNeeded(old); reopenErr != nil {
+				s.logger.Printf("Error reopening old adapter: %v", reopenErr)
+			}
+			return fmt.Errorf("failed to open adapter: %w", err)
+		}
+	}
+
+	s.mu.Lock()
+	s.adapter = device
+	// A pending reset or clear was for the old printer
+	s.resetPending = false
+	s.clearPending = false
+	s.mu.Unlock()
+
+	if running {
+		s.logger.Println("Printer adapter swapped")
+	}
+	return nil
+}
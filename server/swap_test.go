@@ -0,0 +1,97 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// unopenableAdapter is a MockAdapter that cannot be opened
+type unopenableAdapter struct {
+	MockAdapter
+}
+
+func (a *unopenableAdapter) Open() error {
+	return errors.New("no such printer")
+}
+
+func TestServerSwapAdapter(t *testing.T) {
+	old := newGatedAdapter()
+	server := New(old, "127.0.0.1:0")
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	// A job is being written to the old printer and another is queued
+	first := make(chan error, 1)
+	go func() {
+		_, err := server.PrintSync(context.Background(), []byte("first"))
+		first <- err
+	}()
+	require.Eventually(t, func() bool {
+		if server.swapMu.TryLock() {
+			server.swapMu.Unlock()
+			return false
+		}
+		return true
+	}, time.Second, time.Millisecond)
+	require.NoError(t, server.Submit(context.Background(), []byte("second")))
+
+	replacement := &MockAdapter{}
+	swapped := make(chan error, 1)
+	go func() { swapped <- server.SwapAdapter(replacement) }()
+
+	// Wait until the swap is waiting for the write in flight, which pauses
+	// new writes
+	require.Eventually(t, func() bool {
+		if server.swapMu.TryRLock() {
+			server.swapMu.RUnlock()
+			return false
+		}
+		return true
+	}, time.Second, time.Millisecond)
+	old.Release()
+
+	require.NoError(t, <-first)
+	require.NoError(t, <-swapped)
+
+	written, err := server.PrintSync(context.Background(), []byte("third"))
+	require.NoError(t, err)
+	assert.Equal(t, 5, written)
+
+	assert.Equal(t, [][]byte{[]byte("first")}, old.Writes())
+	assert.False(t, old.IsOpen())
+	assert.Equal(t, []byte("secondthird"), replacement.writeData)
+	assert.True(t, replacement.IsOpen())
+	assert.Same(t, replacement, server.GetAdapter())
+}
+
+func TestServerSwapAdapterOpenFailure(t *testing.T) {
+	old := &MockAdapter{}
+	server := New(old, "127.0.0.1:0")
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	err := server.SwapAdapter(&unopenableAdapter{})
+	assert.ErrorContains(t, err, "no such printer")
+
+	// The old printer stays in use
+	assert.Same(t, old, server.GetAdapter())
+	assert.True(t, old.IsOpen())
+	_, err = server.PrintSync(context.Background(), []byte("receipt"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("receipt"), old.writeData)
+}
+
+func TestServerSwapAdapterStopped(t *testing.T) {
+	server := New(&MockAdapter{}, "127.0.0.1:0")
+	replacement := &MockAdapter{}
+
+	require.NoError(t, server.SwapAdapter(replacement))
+	assert.Same(t, replacement, server.GetAdapter())
+	// Opened by Start, not by the swap
+	assert.False(t, replacement.IsOpen())
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/nixxel-company-limited/escpos-usb-server/adapter"
+)
+
+// NewTestServer starts a server for device on a free loopback port and
+// returns it with the address it listens on, so integration tests, including
+// those of downstream packages, do not collide on fixed ports. Like
+// httptest.NewServer it panics if the server cannot start. Callers should
+// Stop the server when done.
+func NewTestServer(device adapter.Adapter) (*Server, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("server: failed to listen on a free port: %v", err))
+	}
+	address := listener.Addr().String()
+
+	s := New(device, address)
+	s.mu.Lock()
+	err = s.begin(listener)
+	s.mu.Unlock()
+	if err != nil {
+		panic(fmt.Sprintf("server: failed to start test server: %v", err))
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.acceptConnections()
+	}()
+
+	return s, address
+}
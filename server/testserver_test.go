@@ -0,0 +1,68 @@
+package server
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTestServersRunConcurrently(t *testing.T) {
+	first, second := &MockAdapter{}, &MockAdapter{}
+
+	server1, address1 := NewTestServer(first)
+	defer server1.Stop()
+	server2, address2 := NewTestServer(second)
+	defer server2.Stop()
+
+	assert.NotEqual(t, address1, address2)
+	assert.True(t, server1.IsRunning())
+	assert.True(t, server2.IsRunning())
+
+	results := make(chan JobResult, 2)
+	for _, server := range []*Server{server1, server2} {
+		server.OnJobComplete(func(r JobResult) {
+			results <- r
+		})
+	}
+
+	var wg sync.WaitGroup
+	send := func(address, data string) {
+		defer wg.Done()
+		conn, err := net.Dial("tcp", address)
+		if !assert.NoError(t, err) {
+			return
+		}
+		conn.Write([]byte(data))
+		conn.Close()
+	}
+	wg.Add(2)
+	go send(address1, "first")
+	go send(address2, "second")
+	wg.Wait()
+
+	for range 2 {
+		select {
+		case <-results:
+		case <-time.After(time.Second):
+			t.Fatal("job result was not reported")
+		}
+	}
+	assert.Equal(t, []byte("first"), first.writeData)
+	assert.Equal(t, []byte("second"), second.writeData)
+}
+
+func TestNewTestServerAcceptsConnections(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+	server, address := NewTestServer(mockAdapter)
+	defer server.Stop()
+
+	assert.Equal(t, address, server.Address())
+
+	conn, err := net.DialTimeout("tcp", address, time.Second)
+	require.NoError(t, err)
+	conn.Close()
+}
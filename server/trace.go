@@ -0,0 +1,152 @@
+package server
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// maxTraceBytes bounds the client data kept by the trace ring buffer; the
+// oldest entries are dropped beyond it
+const maxTraceBytes = 256 << 10
+
+// TraceEntry is one read from a traced client connection
+type TraceEntry struct {
+	Time       time.Time
+	ClientAddr string
+	Data       []byte
+}
+
+// traceRing captures the data of the client addresses being traced. The
+// zero value is ready to use and traces nothing.
+type traceRing struct {
+	mu sync.Mutex
+	// addrs holds the traced addresses, "host:port" or a bare host
+	addrs   map[string]bool
+	entries []TraceEntry
+	size    int
+}
+
+// start begins tracing addr
+func (r *traceRing) start(addr string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.addrs == nil {
+		r.addrs = make(map[string]bool)
+	}
+	r.addrs[addr] = true
+}
+
+// stop ends tracing addr. Entries already captured are kept.
+func (r *traceRing) stop(addr string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.addrs, addr)
+}
+
+// traced returns the traced addresses, sorted
+func (r *traceRing) traced() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	addrs := make([]string, 0, len(r.addrs))
+	for addr := range r.addrs {
+		addrs = append(addrs, addr)
+	}
+	slices.Sort(addrs)
+	return addrs
+}
+
+// record keeps a copy of data read from clientAddr if it is traced, by its
+// full address or by its host
+func (r *traceRing) record(clientAddr string, data []byte, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.addrs) == 0 || len(data) == 0 {
+		return
+	}
+	host, _, err := net.SplitHostPort(clientAddr)
+	if !r.addrs[clientAddr] && (err != nil || !r.addrs[host]) {
+		return
+	}
+
+	r.entries = append(r.entries, TraceEntry{Time: now, ClientAddr: clientAddr, Data: append([]byte(nil), data...)})
+	r.size += len(data)
+	for r.size > maxTraceBytes && len(r.entries) > 1 {
+		r.size -= len(r.entries[0].Data)
+		r.entries = r.entries[1:]
+	}
+}
+
+// list returns the captured entries, oldest first
+func (r *traceRing) list() []TraceEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.entries)
+}
+
+// StartTrace captures everything the clients at addr send, for diagnosing
+// one terminal without logging every client's data. addr is a client's
+// "host:port" or a bare host, which matches all its connections. Up to
+// 256 KiB of captured data is kept, see Trace.
+func (s *Server) StartTrace(addr string) {
+	s.trace.start(addr)
+}
+
+// StopTrace stops capturing the clients at addr, as passed to StartTrace
+func (s *Server) StopTrace(addr string) {
+	s.trace.stop(addr)
+}
+
+// Trace returns the data captured from traced clients, oldest first
+func (s *Server) Trace() []TraceEntry {
+	return s.trace.list()
+}
+
+// traceEntryJSON is a TraceEntry as served by GET /debug/trace
+type traceEntryJSON struct {
+	Time       time.Time `json:"time"`
+	ClientAddr string    `json:"client_addr"`
+	Bytes      int       `json:"bytes"`
+	Dump       string    `json:"dump"`
+}
+
+// handleStartTrace starts tracing the client in the addr query parameter,
+// or with stop=1 stops it
+func (s *Server) handleStartTrace(w http.ResponseWriter, r *http.Request) {
+	addr := r.URL.Query().Get("addr")
+	if addr == "" {
+		http.Error(w, "missing addr", http.StatusBadRequest)
+		return
+	}
+
+	if r.URL.Query().Get("stop") == "1" {
+		s.logger.Printf("Stopped tracing %s", addr)
+		s.StopTrace(addr)
+	} else {
+		s.logger.Printf("Tracing %s", addr)
+		s.StartTrace(addr)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleTrace serves the captured data as hex dumps
+func (s *Server) handleTrace(w http.ResponseWriter, r *http.Request) {
+	entries := s.Trace()
+	out := make([]traceEntryJSON, len(entries))
+	for i, e := range entries {
+		out[i] = traceEntryJSON{Time: e.Time, ClientAddr: e.ClientAddr, Bytes: len(e.Data), Dump: hex.Dump(e.Data)}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Tracing []string         `json:"tracing"`
+		Entries []traceEntryJSON `json:"entries"`
+	}{s.trace.traced(), out})
+}
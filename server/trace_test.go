@@ -0,0 +1,105 @@
+package server
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerTraceCapturesOnlyTracedClient(t *testing.T) {
+	server := New(&MockAdapter{}, "127.0.0.1:0")
+	require.NoError(t, server.StartAsync())
+	defer server.Stop()
+
+	traced, err := net.Dial("tcp", server.BoundAddress())
+	require.NoError(t, err)
+	defer traced.Close()
+	other, err := net.Dial("tcp", server.BoundAddress())
+	require.NoError(t, err)
+	defer other.Close()
+
+	rec := httptest.NewRecorder()
+	server.HTTPHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/debug/trace?addr="+traced.LocalAddr().String(), nil))
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	_, err = traced.Write([]byte("\x1b@traced"))
+	require.NoError(t, err)
+	_, err = other.Write([]byte("untraced"))
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		sent := 0
+		for _, c := range server.Connections() {
+			sent += c.BytesSent
+		}
+		return sent == 16
+	}, time.Second, 10*time.Millisecond)
+
+	entries := server.Trace()
+	require.Len(t, entries, 1)
+	assert.Equal(t, traced.LocalAddr().String(), entries[0].ClientAddr)
+	assert.Equal(t, []byte("\x1b@traced"), entries[0].Data)
+
+	rec = httptest.NewRecorder()
+	server.HTTPHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/trace", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var body struct {
+		Tracing []string `json:"tracing"`
+		Entries []struct {
+			ClientAddr string `json:"client_addr"`
+			Bytes      int    `json:"bytes"`
+			Dump       string `json:"dump"`
+		} `json:"entries"`
+	}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+	assert.Equal(t, []string{traced.LocalAddr().String()}, body.Tracing)
+	require.Len(t, body.Entries, 1)
+	assert.Equal(t, 8, body.Entries[0].Bytes)
+	assert.Contains(t, body.Entries[0].Dump, "1b 40 74 72 61 63 65 64")
+}
+
+func TestTraceRingStop(t *testing.T) {
+	var r traceRing
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// A bare host matches every connection from it
+	r.start("10.0.0.5")
+	r.record("10.0.0.5:4000", []byte("a"), now)
+	r.record("10.0.0.6:4000", []byte("b"), now)
+	r.stop("10.0.0.5")
+	r.record("10.0.0.5:4001", []byte("c"), now)
+
+	entries := r.list()
+	require.Len(t, entries, 1)
+	assert.Equal(t, []byte("a"), entries[0].Data)
+}
+
+func TestTraceRingDropsOldest(t *testing.T) {
+	var r traceRing
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	r.start("10.0.0.5")
+
+	chunk := make([]byte, maxTraceBytes/2)
+	for i := range 3 {
+		chunk[0] = byte(i)
+		r.record("10.0.0.5:4000", chunk, now)
+	}
+
+	entries := r.list()
+	require.Len(t, entries, 2)
+	assert.Equal(t, byte(1), entries[0].Data[0])
+	assert.Equal(t, byte(2), entries[1].Data[0])
+}
+
+func TestHTTPStartTraceRequiresAddr(t *testing.T) {
+	server := New(&MockAdapter{}, "127.0.0.1:0")
+	rec := httptest.NewRecorder()
+	server.HTTPHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/debug/trace", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
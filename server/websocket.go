@@ -0,0 +1,348 @@
+package server
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nixxel-company-limited/escpos-usb-server/adapter"
+)
+
+// webSocketGUID is appended to the client key to compute the handshake
+// accept value (RFC 6455 section 1.3)
+const webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WebSocket opcodes
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xA
+)
+
+// WebSocket close codes
+const (
+	wsCloseNormal      = 1000
+	wsCloseProtocol    = 1002
+	wsCloseUnsupported = 1003
+	wsCloseTooBig      = 1009
+)
+
+// wsWriteTimeout bounds sending a frame to a WebSocket client
+const wsWriteTimeout = 5 * time.Second
+
+var errWebSocketProtocol = errors.New("websocket protocol error")
+
+// wsFrame is a single WebSocket frame
+type wsFrame struct {
+	fin     bool
+	opcode  byte
+	masked  bool
+	payload []byte
+}
+
+// SetWebSocketOrigins sets the browser origins, e.g.
+// "https://pos.example.com", besides the server's own that may open GET
+// /ws. Browsers send an Origin header with every WebSocket handshake, so
+// without this check any page the cashier opens could print. Handshakes
+// without an Origin, i.e. not from a browser, are always accepted.
+func (s *Server) SetWebSocketOrigins(origins []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.wsOrigins = append([]string(nil), origins...)
+}
+
+// webSocketOriginAllowed reports whether a handshake with r's Origin
+// header may be upgraded: no Origin, the host r was sent to, or one of the
+// origins set with SetWebSocketOrigins
+func (s *Server) webSocketOriginAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && u.Host != "" && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, allowed := range s.wsOrigins {
+		if strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleWebSocket serves GET /ws. Each binary message is a print job,
+// queued like a buffered TCP job. Once it is written the server replies
+// with a binary message holding the raw DLE EOT 1, 2 and 4 status bytes,
+// or an empty one if the printer cannot report status. A job that fails
+// gets a text message "ERR <reason>" instead. Handshakes from other
+// origins than allowed by SetWebSocketOrigins get 403.
+func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	if !headerHasToken(r.Header, "Connection", "upgrade") || !headerHasToken(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "expected a websocket upgrade", http.StatusBadRequest)
+		return
+	}
+	if !s.webSocketOriginAllowed(r) {
+		s.logger.Printf("Refusing WebSocket from %s: origin %q not allowed", r.RemoteAddr, r.Header.Get("Origin"))
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported websocket version", http.StatusUpgradeRequired)
+		return
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		http.Error(w, "missing Sec-WebSocket-Key", http.StatusBadRequest)
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket not supported", http.StatusInternalServerError)
+		return
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		s.logger.Printf("WebSocket hijack failed: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	// Clear the deadlines set by the HTTP server
+	conn.SetDeadline(time.Time{})
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", webSocketAccept(key))
+	if err := rw.Flush(); err != nil {
+		return
+	}
+
+	clientAddr := conn.RemoteAddr().String()
+	s.logger.Printf("WebSocket client connected: %s", clientAddr)
+	connID := s.connections.open(clientAddr, s.clock.Now())
+	defer func() {
+		s.connections.close(connID, s.clock.Now())
+		s.logger.Printf("WebSocket client disconnected: %s", clientAddr)
+	}()
+
+	send := func(opcode byte, payload []byte) error {
+		conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+		if err := writeWSFrame(rw.Writer, opcode, payload); err != nil {
+			return err
+		}
+		return rw.Flush()
+	}
+
+	limit := s.maxBodyBytes()
+	var message []byte
+	var messageType byte
+	// fragmented is set while a message's continuation frames are awaited
+	fragmented := false
+	for {
+		frame, err := readWSFrame(rw.Reader, limit)
+		if err != nil {
+			if errors.Is(err, errBodyTooLarge) {
+				send(wsClose, wsClosePayload(wsCloseTooBig, "message too large"))
+			} else if errors.Is(err, errWebSocketProtocol) {
+				send(wsClose, wsClosePayload(wsCloseProtocol, err.Error()))
+			} else if err != io.EOF {
+				s.logger.Printf("Error reading from WebSocket client %s: %v", clientAddr, err)
+			}
+			return
+		}
+		if !frame.masked {
+			send(wsClose, wsClosePayload(wsCloseProtocol, "client frames must be masked"))
+			return
+		}
+
+		switch frame.opcode {
+		case wsPing:
+			send(wsPong, frame.payload)
+			continue
+		case wsPong:
+			continue
+		case wsClose:
+			send(wsClose, wsClosePayload(wsCloseNormal, ""))
+			return
+		case wsText, wsBinary:
+			if fragmented {
+				send(wsClose, wsClosePayload(wsCloseProtocol, "new message before the last one was finished"))
+				return
+			}
+			messageType = frame.opcode
+			message = append(message[:0], frame.payload...)
+		case wsContinuation:
+			if !fragmented {
+				send(wsClose, wsClosePayload(wsCloseProtocol, "continuation frame without a message"))
+				return
+			}
+			message = append(message, frame.payload...)
+		default:
+			send(wsClose, wsClosePayload(wsCloseProtocol, "unknown opcode"))
+			return
+		}
+		if int64(len(message)) > limit {
+			send(wsClose, wsClosePayload(wsCloseTooBig, "message too large"))
+			return
+		}
+		fragmented = !frame.fin
+		if fragmented {
+			continue
+		}
+
+		if messageType != wsBinary {
+			send(wsClose, wsClosePayload(wsCloseUnsupported, "print jobs must be binary messages"))
+			return
+		}
+
+		s.logger.Printf("Received %d byte WebSocket job from %s", len(message), clientAddr)
+		s.connections.received(connID, len(message), s.clock.Now())
+		s.connections.setState(connID, ConnStatePrinting, s.clock.Now())
+		reply, replyType := s.printWebSocketJob(r, message)
+		s.connections.setState(connID, ConnStateActive, s.clock.Now())
+		if err := send(replyType, reply); err != nil {
+			s.logger.Printf("Error replying to WebSocket client %s: %v", clientAddr, err)
+			return
+		}
+	}
+}
+
+// printWebSocketJob queues a job and returns the reply message and its type
+func (s *Server) printWebSocketJob(r *http.Request, data []byte) ([]byte, byte) {
+	written, err := s.PrintSync(r.Context(), append([]byte(nil), data...))
+	if err != nil {
+		s.logger.Printf("Error printing WebSocket job: %v", err)
+		return []byte("ERR " + strings.Join(strings.Fields(err.Error()), " ")), wsText
+	}
+	s.logger.Printf("Wrote %d bytes to printer", written)
+
+	querier, ok := s.printer().(StatusQuerier)
+	if !ok {
+		return nil, wsBinary
+	}
+	var status []byte
+	for _, n := range []byte{adapter.StatusPrinter, adapter.StatusOffline, adapter.StatusPaper} {
+		b, err := querier.QueryStatus(n)
+		if err != nil {
+			return nil, wsBinary
+		}
+		status = append(status, b)
+	}
+	return status, wsBinary
+}
+
+// webSocketAccept computes Sec-WebSocket-Accept for a client key
+func webSocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + webSocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// headerHasToken reports whether a comma separated header contains token,
+// ignoring case
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, value := range h.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// readWSFrame reads one frame, unmasking its payload. Payloads larger than
+// limit fail with errBodyTooLarge.
+func readWSFrame(r io.Reader, limit int64) (wsFrame, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return wsFrame{}, err
+	}
+
+	frame := wsFrame{
+		fin:    header[0]&0x80 != 0,
+		opcode: header[0] & 0x0F,
+		masked: header[1]&0x80 != 0,
+	}
+	if header[0]&0x70 != 0 {
+		return wsFrame{}, fmt.Errorf("%w: reserved bits set", errWebSocketProtocol)
+	}
+
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return wsFrame{}, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return wsFrame{}, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if frame.opcode >= wsClose && (length > 125 || !frame.fin) {
+		return wsFrame{}, fmt.Errorf("%w: invalid control frame", errWebSocketProtocol)
+	}
+	if length > uint64(limit) {
+		return wsFrame{}, errBodyTooLarge
+	}
+
+	var mask [4]byte
+	if frame.masked {
+		if _, err := io.ReadFull(r, mask[:]); err != nil {
+			return wsFrame{}, err
+		}
+	}
+
+	frame.payload = make([]byte, length)
+	if _, err := io.ReadFull(r, frame.payload); err != nil {
+		return wsFrame{}, err
+	}
+	if frame.masked {
+		for i := range frame.payload {
+			frame.payload[i] ^= mask[i%4]
+		}
+	}
+	return frame, nil
+}
+
+// writeWSFrame writes an unmasked, unfragmented server frame
+func writeWSFrame(w *bufio.Writer, opcode byte, payload []byte) error {
+	header := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n <= 125:
+		header = append(header, byte(n))
+	case n <= 0xFFFF:
+		header = append(header, 126)
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header = append(header, 127)
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+// wsClosePayload encodes a close frame's status code and reason
+func wsClosePayload(code uint16, reason string) []byte {
+	return append(binary.BigEndian.AppendUint16(nil, code), reason...)
+}
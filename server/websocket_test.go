@@ -0,0 +1,248 @@
+package server
+
+import (
+	"bufio"
+	"encoding/binary"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nixxel-company-limited/escpos-usb-server/adapter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// wsClient is a minimal WebSocket client for exercising /ws
+type wsClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// dialWebSocket opens a WebSocket connection to the /ws endpoint of srv
+func dialWebSocket(t *testing.T, srv *httptest.Server) *wsClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	key := "dGhlIHNhbXBsZSBub25jZQ=="
+	_, err = conn.Write([]byte("GET /ws HTTP/1.1\r\nHost: printer\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: " + key + "\r\nSec-WebSocket-Version: 13\r\n\r\n"))
+	require.NoError(t, err)
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	require.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", resp.Header.Get("Sec-WebSocket-Accept"))
+
+	return &wsClient{conn: conn, reader: reader}
+}
+
+// send writes a masked frame, as clients must
+func (c *wsClient) send(t *testing.T, fin bool, opcode byte, payload []byte) {
+	t.Helper()
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+	frame := []byte{first}
+	if len(payload) <= 125 {
+		frame = append(frame, 0x80|byte(len(payload)))
+	} else {
+		frame = append(frame, 0x80|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	}
+	mask := []byte{0x37, 0xFA, 0x21, 0x3D}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	_, err := c.conn.Write(frame)
+	require.NoError(t, err)
+}
+
+// receive reads the next frame from the server
+func (c *wsClient) receive(t *testing.T) wsFrame {
+	t.Helper()
+	frame, err := readWSFrame(c.reader, 1<<20)
+	require.NoError(t, err)
+	assert.False(t, frame.masked, "server frames must not be masked")
+	return frame
+}
+
+func startWebSocketServer(t *testing.T, a adapter.Adapter) (*Server, *httptest.Server) {
+	t.Helper()
+	server := New(a, "127.0.0.1:0")
+	require.NoError(t, server.StartAsync())
+	t.Cleanup(func() { server.Stop() })
+
+	srv := httptest.NewServer(server.HTTPHandler())
+	t.Cleanup(srv.Close)
+	return server, srv
+}
+
+func TestWebSocketPrintReturnsStatus(t *testing.T) {
+	statusAdapter := &cannedStatusAdapter{
+		responses: map[byte]byte{
+			adapter.StatusPrinter: 0x12,
+			adapter.StatusOffline: 0x16,
+			adapter.StatusPaper:   0x1E,
+		},
+	}
+	_, srv := startWebSocketServer(t, statusAdapter)
+
+	client := dialWebSocket(t, srv)
+	client.send(t, true, wsBinary, []byte("receipt\n"))
+
+	reply := client.receive(t)
+	assert.Equal(t, byte(wsBinary), reply.opcode)
+	assert.Equal(t, []byte{0x12, 0x16, 0x1E}, reply.payload)
+	assert.Equal(t, []byte("receipt\n"), statusAdapter.writeData)
+
+	client.send(t, true, wsBinary, []byte("second\n"))
+	reply = client.receive(t)
+	assert.Equal(t, []byte{0x12, 0x16, 0x1E}, reply.payload)
+	assert.Equal(t, []byte("receipt\nsecond\n"), statusAdapter.writeData)
+}
+
+func TestWebSocketFragmentedMessage(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+	_, srv := startWebSocketServer(t, mockAdapter)
+
+	client := dialWebSocket(t, srv)
+	client.send(t, false, wsBinary, []byte("rec"))
+	client.send(t, true, wsPing, []byte("hi"))
+	pong := client.receive(t)
+	assert.Equal(t, byte(wsPong), pong.opcode)
+	assert.Equal(t, []byte("hi"), pong.payload)
+	client.send(t, true, wsContinuation, []byte("eipt"))
+
+	reply := client.receive(t)
+	assert.Equal(t, byte(wsBinary), reply.opcode)
+	assert.Empty(t, reply.payload, "adapter cannot report status")
+	assert.Equal(t, []byte("receipt"), mockAdapter.writeData)
+}
+
+func TestWebSocketFragmentationErrors(t *testing.T) {
+	testCases := []struct {
+		name   string
+		frames func(t *testing.T, c *wsClient)
+	}{
+		{"NewMessageWhileFragmented", func(t *testing.T, c *wsClient) {
+			c.send(t, false, wsBinary, []byte("rec"))
+			c.send(t, true, wsBinary, []byte("eipt"))
+		}},
+		{"ContinuationWithoutMessage", func(t *testing.T, c *wsClient) {
+			c.send(t, true, wsContinuation, []byte("eipt"))
+		}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockAdapter := &MockAdapter{}
+			_, srv := startWebSocketServer(t, mockAdapter)
+
+			client := dialWebSocket(t, srv)
+			tc.frames(t, client)
+
+			reply := client.receive(t)
+			require.Equal(t, byte(wsClose), reply.opcode)
+			assert.Equal(t, uint16(wsCloseProtocol), binary.BigEndian.Uint16(reply.payload))
+			assert.Empty(t, mockAdapter.writeData)
+		})
+	}
+}
+
+func TestWebSocketWriteFailure(t *testing.T) {
+	offline := &offlineAdapter{}
+	_, srv := startWebSocketServer(t, offline)
+	offline.SetOffline(true)
+
+	client := dialWebSocket(t, srv)
+	client.send(t, true, wsBinary, []byte("receipt"))
+
+	reply := client.receive(t)
+	assert.Equal(t, byte(wsText), reply.opcode)
+	assert.Equal(t, "ERR device not open", string(reply.payload))
+}
+
+func TestWebSocketRejectsText(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+	_, srv := startWebSocketServer(t, mockAdapter)
+
+	client := dialWebSocket(t, srv)
+	client.send(t, true, wsText, []byte("receipt"))
+
+	reply := client.receive(t)
+	require.Equal(t, byte(wsClose), reply.opcode)
+	assert.Equal(t, uint16(wsCloseUnsupported), binary.BigEndian.Uint16(reply.payload))
+	assert.Empty(t, mockAdapter.writeData)
+}
+
+func TestWebSocketMessageTooLarge(t *testing.T) {
+	mockAdapter := &MockAdapter{}
+	server, srv := startWebSocketServer(t, mockAdapter)
+	server.SetMaxDecompressedBytes(4)
+
+	client := dialWebSocket(t, srv)
+	client.send(t, false, wsBinary, []byte("rec"))
+	client.send(t, true, wsContinuation, []byte("eipt"))
+
+	reply := client.receive(t)
+	require.Equal(t, byte(wsClose), reply.opcode)
+	assert.Equal(t, uint16(wsCloseTooBig), binary.BigEndian.Uint16(reply.payload))
+	assert.Empty(t, mockAdapter.writeData)
+}
+
+func TestWebSocketOrigin(t *testing.T) {
+	testCases := []struct {
+		name   string
+		origin string
+		want   int
+	}{
+		{"NoOrigin", "", http.StatusSwitchingProtocols},
+		{"SameHost", "http://printer", http.StatusSwitchingProtocols},
+		{"Allowed", "https://pos.example.com", http.StatusSwitchingProtocols},
+		{"Foreign", "https://evil.example", http.StatusForbidden},
+	}
+
+	server, srv := startWebSocketServer(t, &MockAdapter{})
+	server.SetWebSocketOrigins([]string{"https://pos.example.com/"})
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+			require.NoError(t, err)
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+			request := "GET /ws HTTP/1.1\r\nHost: printer\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+				"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n"
+			if tc.origin != "" {
+				request += "Origin: " + tc.origin + "\r\n"
+			}
+			_, err = conn.Write([]byte(request + "\r\n"))
+			require.NoError(t, err)
+
+			resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, tc.want, resp.StatusCode)
+		})
+	}
+}
+
+func TestWebSocketRequiresUpgrade(t *testing.T) {
+	server := New(&MockAdapter{}, "localhost:0")
+
+	req := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	rec := httptest.NewRecorder()
+	server.HTTPHandler().ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}